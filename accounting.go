@@ -0,0 +1,118 @@
+// accounting.go implements the request accounting of the summary: it
+// reconciles the requests workers sent with the results recorded, and the
+// results with the outcomes they were counted under, so that the totals can
+// be trusted after aborts, retries, timeouts and injected cancellations.
+// A request retried several times is one request with several attempts, and
+// a skipped scenario step is recorded without being sent.
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Accounting reconciles the requests of a run.
+type Accounting struct {
+	Planned int // Requests the run was set to send, 0 if open-ended
+	Sent    int // Requests workers started
+	Dropped int // Queued requests dropped unsent when the run was cancelled
+	Skipped int // Scenario steps recorded as skipped without being sent
+
+	// NotDispatched are planned requests never handed to a worker because
+	// the run ended first.
+	NotDispatched int
+
+	Recorded  int // Results recorded, skipped steps included
+	Succeeded int // Recorded results counted as successful
+	Failed    int // Recorded results counted as failed, skipped steps included
+	Cancelled int // Recorded results cancelled by -cancel-rate
+
+	// Unaccounted are sent requests without a recorded result. A negative
+	// count means results were recorded more than once.
+	Unaccounted int
+
+	// Unclassified are recorded results not counted as successful, failed,
+	// cancelled or chaos. Any other value than 0 is a bug.
+	Unclassified int
+}
+
+// ok reports whether every request is accounted for exactly once.
+func (a *Accounting) ok() bool {
+	return a.Unaccounted == 0 && a.Unclassified == 0
+}
+
+// accounting returns the accounting of s, nil if s does not see requests
+// being sent, such as the per-step stats of a scenario. The caller holds
+// s.mu.
+func (s *Stats) accounting() *Accounting {
+	sent, dropped := int(s.sent.Load()), int(s.dropped.Load())
+	if sent == 0 && dropped == 0 {
+		return nil
+	}
+	chaos := 0
+	for _, c := range s.chaos {
+		chaos += c.Sent
+	}
+	a := &Accounting{
+		Sent:         sent,
+		Dropped:      dropped,
+		Skipped:      s.skippedSteps,
+		Recorded:     s.totalRequests,
+		Succeeded:    s.successCount,
+		Failed:       s.failCount,
+		Cancelled:    s.cancelled,
+		Unaccounted:  sent - (s.totalRequests - s.skippedSteps),
+		Unclassified: s.totalRequests - s.successCount - s.failCount - s.cancelled - chaos,
+	}
+	// The planned total of a load profile or pattern is only an estimate.
+	if s.profile == nil && !s.patterned {
+		a.Planned = s.numRequests
+		a.NotDispatched = max(0, s.numRequests-sent-dropped-s.skippedSteps)
+	}
+	return a
+}
+
+// RequestDropped counts a queued request dropped unsent because the run
+// was cancelled. It is safe for concurrent use.
+func (s *Stats) RequestDropped() {
+	s.dropped.Add(1)
+}
+
+// formatAccounting describes a in one line of the summary.
+func formatAccounting(a *Accounting) string {
+	var parts []string
+	parts = append(parts, fmt.Sprintf("%d sent", a.Sent))
+	if a.Skipped > 0 {
+		parts = append(parts, fmt.Sprintf("%d steps skipped", a.Skipped))
+	}
+	if a.Dropped > 0 {
+		parts = append(parts, fmt.Sprintf("%d dropped from the queue", a.Dropped))
+	}
+	if a.NotDispatched > 0 {
+		parts = append(parts, fmt.Sprintf("%d never dispatched", a.NotDispatched))
+	}
+	line := strings.Join(parts, ", ") + fmt.Sprintf("; %d recorded: %d successful, %d failed", a.Recorded, a.Succeeded, a.Failed)
+	if a.Cancelled > 0 {
+		line += fmt.Sprintf(", %d cancelled", a.Cancelled)
+	}
+	switch {
+	case a.Unaccounted > 0:
+		line += fmt.Sprintf(", %d sent requests unaccounted for", a.Unaccounted)
+	case a.Unaccounted < 0:
+		line += fmt.Sprintf(", %d results recorded more than once", -a.Unaccounted)
+	}
+	return line
+}
+
+// printAccounting prints the accounting line of the summary, with a
+// warning if requests are not accounted for exactly once.
+func printAccounting(w io.Writer, a *Accounting) {
+	fmt.Fprintf(w, "Accounting:        %s\n", formatAccounting(a))
+	if a.Unclassified != 0 {
+		fmt.Fprintf(w, "                   Warning: %d results are not counted as successful, failed or cancelled\n", a.Unclassified)
+	}
+	if !a.ok() {
+		fmt.Fprintln(w, "                   Warning: the totals above are inconsistent; please report this as a bug")
+	}
+}
@@ -0,0 +1,391 @@
+// agent.go implements the `agent` subcommand of distributed mode. An agent
+// is a long-running HTTP server that waits for a controller to assign it a
+// share of a load test, runs it with the regular worker pool, and returns
+// its raw statistics as a StatsSnapshot so the controller can merge them.
+//
+// Whoever can reach an agent can make it send requests, so an agent only
+// listens beyond loopback with a -token, and the flags it is forwarded
+// cannot write files or load plugins on its machine, nor, unless it runs
+// with -allow-local-reads, read its files or environment into requests.
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultAgentAddr is the address agents listen on by default, on every
+// interface with a token and on loopback without.
+const defaultAgentAddr = ":7070"
+
+// distributedTokenEnv is the environment variable holding the shared token
+// of distributed runs when -token is not set, which keeps the token out of
+// process listings and manifests.
+const distributedTokenEnv = "LOAD_TESTER_TOKEN"
+
+// forwardedWriteFlags are the load test flags agents refuse from a
+// controller: they write files on the agent, or load a test definition
+// from its disk.
+var forwardedWriteFlags = map[string]bool{
+	"record": true, "record-requests": true, "failure-manifest": true, "output-file": true,
+	"config": true, "scenario": true,
+}
+
+// forwardedReadFlags are the load test flags that read files on the agent,
+// which agents only accept from a controller with -allow-local-reads.
+var forwardedReadFlags = map[string]bool{
+	"body-file": true, "data": true, "endpoints": true, "profile": true, "client-profiles": true, "form-file": true,
+	"cert": true, "key": true, "ca": true, "budgets": true, "baseline": true,
+}
+
+// forwardLimits restricts what the load test flags a controller forwards
+// to an agent may do on the agent's machine.
+type forwardLimits struct {
+	allowReads bool // -allow-local-reads: files and environment variables may be read
+}
+
+// check reports the flags set in fs that the limits forbid. Plugins may
+// only be named if the agent loaded them itself.
+func (l *forwardLimits) check(fs *flag.FlagSet) error {
+	var problems validationErrors
+	fs.Visit(func(f *flag.Flag) {
+		switch {
+		case forwardedWriteFlags[f.Name]:
+			problems.addf("-%s is not accepted from a controller", f.Name)
+		case f.Name == "generator-plugin":
+			for _, path := range *f.Value.(*headerFlags) {
+				if !pluginLoaded(path) {
+					problems.addf("-generator-plugin %s is not accepted from a controller: start the agent with it", path)
+				}
+			}
+		case l.allowReads:
+		case forwardedReadFlags[f.Name]:
+			problems.addf("-%s reads files on the agent, %s", f.Name, localReadsHint)
+		case f.Name == "body" && strings.HasPrefix(f.Value.String(), "@"):
+			problems.addf("-body @FILE reads files on the agent, %s", localReadsHint)
+		}
+	})
+	return problems.err()
+}
+
+// localReadsHint ends the errors of forwarded flags and placeholders that
+// read the agent's files or environment.
+const localReadsHint = "which agents only accept from a controller with -allow-local-reads"
+
+// agentRunRequest is the work assignment a controller sends to an agent.
+type agentRunRequest struct {
+	Args     []string `json:"args"`     // Load test flags, exactly as on the command line
+	Requests int      `json:"requests"` // This agent's share of -n
+	Rate     float64  `json:"rate"`     // This agent's share of -rate, 0 if unlimited
+
+	// Stream, if set, asks the agent to push live results while running.
+	Stream *streamTarget `json:"stream,omitempty"`
+}
+
+// agent serves run assignments from a controller, one at a time.
+type agent struct {
+	token  string
+	limits forwardLimits
+	busy   sync.Mutex
+
+	// finished is closed after the first completed run when the agent was
+	// started with -once.
+	once     bool
+	finished chan struct{}
+	doneOnce sync.Once
+
+	mu  sync.Mutex
+	run *agentRun // Run in progress, nil when idle
+}
+
+// agentRun is the controllable state of the run an agent is executing.
+type agentRun struct {
+	cancel context.CancelFunc
+	pause  *PauseGate
+	stats  *Stats
+}
+
+// agentStatus is the body of an agent's health response.
+type agentStatus struct {
+	State     string `json:"state"` // "idle", "running" or "paused"
+	Completed int    `json:"completed"`
+	Total     int    `json:"total"`
+}
+
+// stoppedByController is the stop reason recorded when a controller stops
+// a run.
+const stoppedByController = "stopped from the controller"
+
+// runAgentCommand starts an agent and blocks until it is interrupted or,
+// with -once, until it has completed one run.
+func runAgentCommand(args []string) error {
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	listen := fs.String("listen", defaultAgentAddr, "Address to listen on for controller assignments")
+	token := fs.String("token", "", "Shared token the controller must present (default $"+distributedTokenEnv+"); without one the agent only listens on loopback")
+	once := fs.Bool("once", false, "Exit after completing one run (e.g. in a Kubernetes Job)")
+	join := fs.String("join", "", "Controller address (host:port) to register with")
+	advertise := fs.String("advertise", "", "Address the controller should use to reach this agent (default: as seen by the controller)")
+	allowReads := fs.Bool("allow-local-reads", false, "Accept forwarded flags and placeholders that read this machine's files and environment (-data, -body-file, TLS files, {{$file}}, {{$env}}, ...)")
+	var plugins headerFlags
+	fs.Var(&plugins, "generator-plugin", "Go plugin (.so) whose generators forwarded templates may use, named by the same path on the controller (can be repeated)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *token == "" {
+		*token = os.Getenv(distributedTokenEnv)
+	}
+	if *token == "" {
+		listenSet := false
+		fs.Visit(func(f *flag.Flag) { listenSet = listenSet || f.Name == "listen" })
+		if !listenSet {
+			*listen = "127.0.0.1" + defaultAgentAddr
+		} else if !loopbackAddr(*listen) {
+			return fmt.Errorf("validation error: -token or $%s is required to listen on %s; without one agents only listen on loopback, e.g. -listen 127.0.0.1%s", distributedTokenEnv, *listen, defaultAgentAddr)
+		}
+	}
+	if err := loadGeneratorPlugins(plugins); err != nil {
+		return fmt.Errorf("validation error: %w", err)
+	}
+
+	a := &agent{token: *token, limits: forwardLimits{allowReads: *allowReads}, once: *once, finished: make(chan struct{})}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", a.handleHealth)
+	mux.HandleFunc("/readyz", handleReady)
+	mux.HandleFunc("/run", a.handleRun)
+	mux.HandleFunc("/pause", a.handleControl)
+	mux.HandleFunc("/resume", a.handleControl)
+	mux.HandleFunc("/stop", a.handleControl)
+	server := &http.Server{Addr: *listen, Handler: mux}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		fmt.Fprintf(os.Stderr, "agent: listening on %s\n", *listen)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	if *join != "" {
+		go joinController(ctx, *join, *token, *listen, *advertise)
+	}
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	case <-a.finished:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handleHealth reports that the agent is up, along with an agentStatus.
+// Controllers poll it before dispatching work and while a run is going on.
+func (a *agent) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !checkToken(r, a.token) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	status := agentStatus{State: "idle"}
+	a.mu.Lock()
+	if run := a.run; run != nil {
+		status.State = "running"
+		if run.pause.Paused() {
+			status.State = "paused"
+		}
+		status.Completed, status.Total, _ = run.stats.Progress()
+	}
+	a.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleReady reports that the agent is serving, for readiness probes,
+// which cannot present the token. It tells nothing about runs.
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleControl pauses, resumes or stops the run in progress, depending on
+// the request path. Without a run in progress it does nothing.
+func (a *agent) handleControl(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkToken(r, a.token) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	a.mu.Lock()
+	run := a.run
+	a.mu.Unlock()
+	if run == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/pause":
+		run.pause.Pause()
+	case "/resume":
+		run.pause.Resume()
+	case "/stop":
+		run.stats.MarkStopped(stoppedByController)
+		run.pause.Resume()
+		run.cancel()
+	}
+	fmt.Fprintf(os.Stderr, "agent: %s requested by controller\n", strings.TrimPrefix(r.URL.Path, "/"))
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleRun executes a run assignment and responds with the agent's
+// StatsSnapshot. Only one run executes at a time.
+func (a *agent) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkToken(r, a.token) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	if !a.busy.TryLock() {
+		http.Error(w, "agent is busy with another run", http.StatusConflict)
+		return
+	}
+	defer a.busy.Unlock()
+
+	var req agentRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("decoding assignment: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	config, err := parseForwardedConfigArgs(req.Args, &a.limits)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if config.ScenarioFile != "" {
+		http.Error(w, "scenario mode is not supported by agents", http.StatusBadRequest)
+		return
+	}
+	if req.Requests < 1 {
+		http.Error(w, fmt.Sprintf("requests must be >= 1, got %d", req.Requests), http.StatusBadRequest)
+		return
+	}
+	config.NumRequests = req.Requests
+	config.Rate = req.Rate
+
+	fmt.Fprintf(os.Stderr, "agent: running %d requests against %s (concurrency %d)\n", config.NumRequests, config.URL, config.Concurrency)
+
+	stats := NewStats(config.NumRequests)
+	stats.Configure(config)
+	runCtx, cancelRun := context.WithCancel(r.Context())
+	defer cancelRun()
+	config.Pause = &PauseGate{}
+
+	a.mu.Lock()
+	a.run = &agentRun{cancel: cancelRun, pause: config.Pause, stats: stats}
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		a.run = nil
+		a.mu.Unlock()
+	}()
+
+	// Results are pushed until the run ends; the pusher then delivers the
+	// final frame before the response below tells the controller the run
+	// is over.
+	pushCtx, stopPush := context.WithCancel(context.Background())
+	pushDone := make(chan struct{})
+	if req.Stream != nil {
+		controllerAddr := streamAddr(r, req.Stream)
+		go func() {
+			defer close(pushDone)
+			pushFrames(pushCtx, controllerAddr, a.token, *req.Stream, stats)
+		}()
+	} else {
+		close(pushDone)
+	}
+
+	if err := RunLoadTest(runCtx, config, stats); err != nil {
+		fmt.Fprintf(os.Stderr, "agent: run ended early: %v\n", err)
+	}
+	stopPush()
+	<-pushDone
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats.Snapshot()); err != nil {
+		fmt.Fprintf(os.Stderr, "agent: sending results: %v\n", err)
+	}
+	fmt.Fprintf(os.Stderr, "agent: run finished\n")
+
+	if a.once {
+		a.doneOnce.Do(func() { close(a.finished) })
+	}
+}
+
+// streamAddr returns the controller address to push results to: the one
+// given in target, or the host the assignment came from.
+func streamAddr(r *http.Request, target *streamTarget) string {
+	if target.Addr != "" {
+		return target.Addr
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.JoinHostPort(host, strconv.Itoa(target.Port))
+}
+
+// checkToken reports whether r carries the expected bearer token. An empty
+// expected token disables the check. The comparison takes the same time
+// whatever the mismatch, so that the token cannot be guessed a byte at a
+// time.
+func checkToken(r *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) == 1
+}
+
+// loopbackAddr reports whether the listen address addr only accepts
+// connections from the local machine.
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,174 @@
+// assert.go implements response assertions (-assert-status,
+// -assert-body-contains, -assert-body-regex, -assert-json): checks every
+// response must pass to count as successful. A server that answers 200
+// with an error page or an empty result list is as broken as one that
+// refuses the connection, but without assertions only the latter shows up
+// in the failure count.
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// statusSet is a set of HTTP status codes and classes, e.g. "200,204,3xx".
+type statusSet struct {
+	codes   map[int]bool
+	classes [6]bool // Index 2 for 2xx, and so on
+	text    string  // As written on the command line
+}
+
+// parseStatusSet parses a comma-separated list of status codes (200) and
+// classes (2xx).
+func parseStatusSet(s string) (*statusSet, error) {
+	set := &statusSet{codes: make(map[int]bool), text: s}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if len(part) == 3 && strings.HasSuffix(part, "xx") && part[0] >= '1' && part[0] <= '5' {
+			set.classes[part[0]-'0'] = true
+			continue
+		}
+		code, err := strconv.Atoi(part)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status %q, expected a code such as 200 or a class such as 2xx", part)
+		}
+		set.codes[code] = true
+	}
+	return set, nil
+}
+
+// contains reports whether code is in the set. A nil set contains no code.
+func (s *statusSet) contains(code int) bool {
+	if s == nil {
+		return false
+	}
+	if s.codes[code] {
+		return true
+	}
+	class := code / 100
+	return class >= 1 && class <= 5 && s.classes[class]
+}
+
+func (s *statusSet) String() string {
+	return s.text
+}
+
+// jsonAssertion requires the value at a JSON path of the body to equal
+// want, compared in the string form of extractJSONPath.
+type jsonAssertion struct {
+	path string
+	want string
+}
+
+// Assertions are the checks a response must pass to count as successful.
+// A nil *Assertions passes every response.
+type Assertions struct {
+	Status       *statusSet // Allowed statuses, nil for any
+	BodyContains []string
+	BodyRegex    []*regexp.Regexp
+	JSON         []jsonAssertion
+}
+
+// parseAssertions builds the assertions of the -assert-* flags, returning
+// nil if none is set.
+func parseAssertions(status string, contains, regexes, jsonPaths []string) (*Assertions, error) {
+	if status == "" && len(contains) == 0 && len(regexes) == 0 && len(jsonPaths) == 0 {
+		return nil, nil
+	}
+	a := &Assertions{BodyContains: contains}
+	if status != "" {
+		set, err := parseStatusSet(status)
+		if err != nil {
+			return nil, fmt.Errorf("-assert-status: %w", err)
+		}
+		a.Status = set
+	}
+	for _, expr := range regexes {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("-assert-body-regex: %w", err)
+		}
+		a.BodyRegex = append(a.BodyRegex, re)
+	}
+	for _, expr := range jsonPaths {
+		path, want, ok := strings.Cut(expr, "=")
+		if !ok || path == "" {
+			return nil, fmt.Errorf("-assert-json: invalid %q, expected PATH=VALUE such as status=ok", expr)
+		}
+		a.JSON = append(a.JSON, jsonAssertion{path: path, want: want})
+	}
+	return a, nil
+}
+
+// needsBody reports whether any assertion reads the response body.
+func (a *Assertions) needsBody() bool {
+	return a != nil && (len(a.BodyContains) > 0 || len(a.BodyRegex) > 0 || len(a.JSON) > 0)
+}
+
+// check returns the first assertion a response with the given status and
+// body fails, or "" if it passes them all. The reasons name the assertion
+// rather than the value found, so the summary can count them.
+func (a *Assertions) check(status int, body []byte) string {
+	if a == nil {
+		return ""
+	}
+	if a.Status != nil && !a.Status.contains(status) {
+		return fmt.Sprintf("status %d, expected %s", status, a.Status)
+	}
+	for _, s := range a.BodyContains {
+		if !strings.Contains(string(body), s) {
+			return fmt.Sprintf("body does not contain %q", s)
+		}
+	}
+	for _, re := range a.BodyRegex {
+		if !re.Match(body) {
+			return fmt.Sprintf("body does not match %q", re)
+		}
+	}
+	for _, j := range a.JSON {
+		got, err := extractJSONPath(body, j.path)
+		if err != nil {
+			return fmt.Sprintf("JSON %s is missing", j.path)
+		}
+		if got != j.want {
+			return fmt.Sprintf("JSON %s is not %q", j.path, j.want)
+		}
+	}
+	return ""
+}
+
+// bodyCapture keeps the first maxResponseBody bytes written to it and
+// discards the rest, so assertions can read a body that is being drained.
+type bodyCapture struct {
+	buf []byte
+}
+
+func (c *bodyCapture) Write(p []byte) (int, error) {
+	if room := maxResponseBody - len(c.buf); room > 0 {
+		c.buf = append(c.buf, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// printAssertFailures prints the number of responses that failed each
+// assertion, most frequent first.
+func printAssertFailures(w io.Writer, counts map[string]int) {
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if counts[reasons[i]] != counts[reasons[j]] {
+			return counts[reasons[i]] > counts[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	fmt.Fprintln(w, "Assertion Failures:")
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "  %-40s %d\n", reason, counts[reason])
+	}
+}
@@ -0,0 +1,184 @@
+// attribution.go implements the latency attribution of retried and
+// redirected requests. The headline latency of a request is that of its
+// last attempt, redirects included, which is neither what one exchange
+// with the server takes nor what the caller waited for. Both are kept as
+// distributions of their own: attempt latency, every attempt and redirect
+// hop on its own, and request latency, from the first attempt to the final
+// response with backoff and redirect chains included.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxRedirects is how many redirects a request follows, as with the
+// default policy of net/http.
+const maxRedirects = 10
+
+// redirectLog records when each redirect of a request was followed.
+type redirectLog struct {
+	at []time.Time
+}
+
+// redirectLogKey is the context key of a request's redirectLog.
+type redirectLogKey struct{}
+
+// withRedirectLog returns req with a redirect log that checkRedirect
+// records the request's redirects on.
+func withRedirectLog(req *http.Request) (*http.Request, *redirectLog) {
+	l := &redirectLog{}
+	return req.WithContext(context.WithValue(req.Context(), redirectLogKey{}, l)), l
+}
+
+// checkRedirect is the redirect policy of the load test clients: that of
+// net/http, also noting the time of each redirect on the request's log.
+// Redirected requests share the context of the original one, and the
+// client calls the policy on the goroutine that sent the request.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if l, ok := req.Context().Value(redirectLogKey{}).(*redirectLog); ok {
+		l.at = append(l.at, time.Now())
+	}
+	return nil
+}
+
+// hops appends to exchanges the duration of each exchange of an attempt
+// sent at start that took d: one per redirect followed, and the last.
+func (l *redirectLog) hops(exchanges []time.Duration, start time.Time, d time.Duration) []time.Duration {
+	from := start
+	for _, t := range l.at {
+		exchanges = append(exchanges, t.Sub(from))
+		from = t
+	}
+	return append(exchanges, start.Add(d).Sub(from))
+}
+
+// attribute sets the exchanges of a single-attempt result sent at start
+// from the redirects l recorded.
+func (l *redirectLog) attribute(result *RequestResult, start time.Time) {
+	if len(l.at) == 0 {
+		return
+	}
+	result.Redirects = len(l.at)
+	result.Exchanges = l.hops(nil, start, result.Duration)
+	result.Logical = result.Duration
+}
+
+// latencyAttribution holds the attempt and request latencies of a run.
+type latencyAttribution struct {
+	attempts   durationHist // Every attempt and redirect hop
+	requests   durationHist // Every request, retries and redirects included
+	redirected int          // Requests that followed redirects
+	redirects  int          // Redirects followed
+}
+
+// attributionSnapshot is the serializable form of a latencyAttribution.
+type attributionSnapshot struct {
+	Attempts   durationHistSnapshot `json:"attempts"`
+	Requests   durationHistSnapshot `json:"requests"`
+	Redirected int                  `json:"redirected,omitempty"`
+	Redirects  int                  `json:"redirects,omitempty"`
+}
+
+// attributionMark remembers how much of a latencyAttribution Delta has
+// returned.
+type attributionMark struct {
+	attempts   histMark
+	requests   histMark
+	redirected int
+	redirects  int
+}
+
+// record adds the latencies of one request.
+func (a *latencyAttribution) record(result RequestResult) {
+	if len(result.Exchanges) == 0 {
+		a.attempts.record(result.Duration)
+		a.requests.record(result.Duration)
+		return
+	}
+	for _, d := range result.Exchanges {
+		a.attempts.record(d)
+	}
+	a.requests.record(result.Logical)
+	if result.Redirects > 0 {
+		a.redirected++
+		a.redirects += result.Redirects
+	}
+}
+
+// snapshot returns a copy of a.
+func (a *latencyAttribution) snapshot() *attributionSnapshot {
+	var m attributionMark
+	return a.delta(&m)
+}
+
+// merge adds the latencies of snap.
+func (a *latencyAttribution) merge(snap *attributionSnapshot) {
+	if snap == nil {
+		return
+	}
+	a.attempts.merge(snap.Attempts)
+	a.requests.merge(snap.Requests)
+	a.redirected += snap.Redirected
+	a.redirects += snap.Redirects
+}
+
+// delta returns the latencies added since m, nil if there are none, and
+// advances m.
+func (a *latencyAttribution) delta(m *attributionMark) *attributionSnapshot {
+	if !a.requests.grew(&m.requests) {
+		return nil
+	}
+	snap := &attributionSnapshot{
+		Attempts:   a.attempts.delta(&m.attempts),
+		Requests:   a.requests.delta(&m.requests),
+		Redirected: a.redirected - m.redirected,
+		Redirects:  a.redirects - m.redirects,
+	}
+	m.redirected, m.redirects = a.redirected, a.redirects
+	return snap
+}
+
+// LatencyAttribution splits the latency of retried and redirected requests
+// into that of their exchanges and that of the requests as a whole.
+type LatencyAttribution struct {
+	Attempts   LatencyDist // Every attempt and redirect hop on its own
+	Requests   LatencyDist // First attempt to final response, backoff included
+	Retried    int         // Requests retried at least once
+	Redirected int         // Requests that followed redirects
+	Redirects  int         // Redirects followed
+}
+
+// summarize returns the attribution of a, nil if no request was retried
+// or redirected, which leaves both distributions equal to the headline.
+func (a *latencyAttribution) summarize(m PercentileMethod, retried int) *LatencyAttribution {
+	if retried == 0 && a.redirected == 0 {
+		return nil
+	}
+	return &LatencyAttribution{
+		Attempts:   a.attempts.dist(m),
+		Requests:   a.requests.dist(m),
+		Retried:    retried,
+		Redirected: a.redirected,
+		Redirects:  a.redirects,
+	}
+}
+
+// printAttribution prints the attempt and request latency distributions.
+func printAttribution(w io.Writer, a *LatencyAttribution) {
+	fmt.Fprintf(w, "Latency Attribution (%d requests retried, %d redirected):\n", a.Retried, a.Redirected)
+	fmt.Fprintf(w, "  %-9s %8s %10s %10s %10s %10s %10s %10s\n", "Latency", "Count", "Avg", "P50", "P90", "P95", "P99", "Max")
+	for _, row := range []struct {
+		name string
+		d    LatencyDist
+	}{{"Attempt", a.Attempts}, {"Request", a.Requests}} {
+		fmt.Fprintf(w, "  %-9s %8d %10s %10s %10s %10s %10s %10s\n", row.name, row.d.Count,
+			formatDuration(row.d.Avg), formatDuration(row.d.P50), formatDuration(row.d.P90), formatDuration(row.d.P95), formatDuration(row.d.P99), formatDuration(row.d.Max))
+	}
+}
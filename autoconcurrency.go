@@ -0,0 +1,137 @@
+// autoconcurrency.go implements -auto-concurrency: before the test, a short
+// probe runs the request at 1, 2, 4, ... workers up to -c and picks the
+// concurrency at the knee of the throughput curve, the last level whose
+// doubling still paid off. Past the knee, more workers only queue up at the
+// target and inflate latency, so it is a sensible -c for users who don't
+// know the capacity of what they are testing.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Probe parameters: every level sends probeRequestsPerWorker requests per
+// worker, at least probeMinRequests.
+const (
+	probeRequestsPerWorker = 20
+	probeMinRequests       = 50
+)
+
+// A level is past the knee if it adds less than probeMinGain of the
+// previous level's throughput, or raises the error rate by more than
+// probeMaxErrorRise percentage points.
+const (
+	probeMinGain      = 0.10
+	probeMaxErrorRise = 1.0
+)
+
+// ProbeLevel is the result of one concurrency level of the probe.
+type ProbeLevel struct {
+	Concurrency    int
+	Requests       int
+	RequestsPerSec float64
+	P95            time.Duration
+	ErrorRate      float64 // Percent of requests that failed
+}
+
+// ConcurrencyProbe is the outcome of -auto-concurrency.
+type ConcurrencyProbe struct {
+	Levels []ProbeLevel
+	Chosen int    // Concurrency the test ran with
+	Reason string // Why Chosen is the knee
+}
+
+// probeLevels returns the concurrency levels probed up to ceiling: powers
+// of two, and ceiling itself.
+func probeLevels(ceiling int) []int {
+	var levels []int
+	for c := 1; c < ceiling; c *= 2 {
+		levels = append(levels, c)
+	}
+	return append(levels, ceiling)
+}
+
+// probeConcurrency probes config's request at increasing concurrency up to
+// config.Concurrency, logging each level on w, and stops at the knee. The
+// probe is unpaced and leaves out everything that outlives a run or changes
+// the traffic (recording, StatsD, mirroring, injected cancellations, chaos
+// and header fuzzing), so only the main run is seen there.
+func probeConcurrency(ctx context.Context, config *Config, w io.Writer) (*ConcurrencyProbe, error) {
+	probe := *config
+	probe.Rate, probe.Profile, probe.Pattern = 0, nil, nil
+	probe.RecordFile, probe.RecordRequests = "", false
+	probe.StatsD, probe.FailureManifest, probe.Mirror = nil, nil, nil
+	probe.Cancel, probe.Chaos, probe.HeaderFuzz = CancelInjection{}, ChaosMode{}, HeaderFuzz{}
+
+	levels := probeLevels(config.Concurrency)
+	fmt.Fprintf(w, "Probing concurrency %v for -auto-concurrency\n", levels)
+	p := &ConcurrencyProbe{}
+	for _, c := range levels {
+		probe.Concurrency = c
+		probe.NumRequests = max(probeMinRequests, c*probeRequestsPerWorker)
+		stats := NewStats(probe.NumRequests)
+		stats.Configure(&probe)
+		if err := RunLoadTest(ctx, &probe, stats); err != nil {
+			return nil, fmt.Errorf("concurrency probe: %w", err)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("concurrency probe: %w", err)
+		}
+		s := stats.GetSummary()
+		level := ProbeLevel{Concurrency: c, Requests: s.TotalRequests, RequestsPerSec: s.RequestsPerSec, P95: s.P95, ErrorRate: failRate(s)}
+		fmt.Fprintf(w, "  -c %-4d %9.1f req/s  P95 %-10s %6.2f%% failed\n", c, level.RequestsPerSec, formatDuration(level.P95), level.ErrorRate)
+		if s.SuccessCount == 0 {
+			return nil, fmt.Errorf("concurrency probe: all %d requests at -c %d failed", s.TotalRequests, c)
+		}
+		p.Levels = append(p.Levels, level)
+		if p.knee() {
+			break
+		}
+	}
+	if p.Chosen == 0 {
+		last := p.Levels[len(p.Levels)-1]
+		p.Chosen = last.Concurrency
+		p.Reason = fmt.Sprintf("throughput still grew at the ceiling of %d workers, raise -c to probe further", last.Concurrency)
+	}
+	fmt.Fprintf(w, "Using -c %d: %s\n\n", p.Chosen, p.Reason)
+	return p, nil
+}
+
+// knee reports whether the last level probed is past the knee, setting
+// Chosen and Reason if it is.
+func (p *ConcurrencyProbe) knee() bool {
+	n := len(p.Levels)
+	if n < 2 {
+		return false
+	}
+	prev, last := p.Levels[n-2], p.Levels[n-1]
+	switch {
+	case last.ErrorRate > prev.ErrorRate+probeMaxErrorRise:
+		p.Reason = fmt.Sprintf("errors rose from %.2f%% to %.2f%% at %d workers", prev.ErrorRate, last.ErrorRate, last.Concurrency)
+	case last.RequestsPerSec < prev.RequestsPerSec*(1+probeMinGain):
+		p.Reason = fmt.Sprintf("%d workers added less than %.0f%% throughput (%.1f vs %.1f req/s)",
+			last.Concurrency, probeMinGain*100, last.RequestsPerSec, prev.RequestsPerSec)
+	default:
+		return false
+	}
+	p.Chosen = prev.Concurrency
+	return true
+}
+
+// printConcurrencyProbe prints the levels of the probe and the chosen
+// concurrency.
+func printConcurrencyProbe(w io.Writer, p *ConcurrencyProbe) {
+	fmt.Fprintln(w, "Auto Concurrency:")
+	fmt.Fprintf(w, "  %8s %10s %12s %10s %8s\n", "Workers", "Requests", "Req/s", "P95", "Failed")
+	for _, l := range p.Levels {
+		mark := ""
+		if l.Concurrency == p.Chosen {
+			mark = "  ◀ chosen"
+		}
+		fmt.Fprintf(w, "  %8d %10d %12.1f %10s %7.2f%%%s\n", l.Concurrency, l.Requests, l.RequestsPerSec, formatDuration(l.P95), l.ErrorRate, mark)
+	}
+	fmt.Fprintf(w, "  Chose -c %d: %s\n", p.Chosen, p.Reason)
+}
@@ -0,0 +1,89 @@
+// batch.go implements batch bodies (-batch-size and -batch-format) for
+// bulk-ingest endpoints such as Elasticsearch's _bulk API or analytics
+// collectors: the body template is rendered several times per request and
+// the records are sent together, as newline-delimited JSON or as a JSON
+// array.
+package main
+
+import (
+	"fmt"
+	mathrand "math/rand"
+	"strings"
+)
+
+// Batch body formats of -batch-format.
+const (
+	batchNDJSON = "ndjson"
+	batchArray  = "array"
+)
+
+// Batch renders the body template Size times into every request body.
+type Batch struct {
+	Size   int
+	Format string // batchNDJSON or batchArray
+}
+
+// parseBatch validates the -batch-size and -batch-format flags. It returns
+// nil if size is 0, batching being off.
+func parseBatch(size int, format string) (*Batch, error) {
+	if format != batchNDJSON && format != batchArray {
+		return nil, fmt.Errorf("invalid -batch-format %q, expected %s or %s", format, batchNDJSON, batchArray)
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("-batch-size must be >= 0, got %d", size)
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	return &Batch{Size: size, Format: format}, nil
+}
+
+// render renders the body of request requestIndex from t with random
+// values from rng, appending the
+// generated values to generated unless it is nil. Records are rendered
+// with consecutive indexes of their own, requestIndex*Size onwards, so
+// that {{$sequence}} and -data rows differ between the records of a
+// batch. A nil Batch renders t once.
+func (b *Batch) render(t *Template, requestIndex int, rng *mathrand.Rand, generated *[]generatedValue) string {
+	if b == nil {
+		return t.RenderRecording(requestIndex, rng, nil, generated)
+	}
+	var sb strings.Builder
+	if b.Format == batchArray {
+		sb.WriteByte('[')
+	}
+	for i := range b.Size {
+		record := t.RenderRecording(requestIndex*b.Size+i, rng, nil, generated)
+		switch b.Format {
+		case batchArray:
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(strings.TrimSpace(record))
+		default:
+			// Every line ends in a newline, the last one included, as
+			// _bulk requires. A record may span lines, such as a _bulk
+			// action and its document.
+			sb.WriteString(strings.TrimRight(record, "\r\n"))
+			sb.WriteByte('\n')
+		}
+	}
+	if b.Format == batchArray {
+		sb.WriteByte(']')
+	}
+	return sb.String()
+}
+
+// contentType returns the Content-Type batch bodies are sent with unless
+// a header sets one.
+func (b *Batch) contentType() string {
+	if b.Format == batchArray {
+		return "application/json"
+	}
+	return "application/x-ndjson"
+}
+
+// String describes the batch for the banner.
+func (b *Batch) String() string {
+	return fmt.Sprintf("%d records per request (%s)", b.Size, b.Format)
+}
@@ -0,0 +1,38 @@
+// browser.go implements browser emulation mode. Real browsers open at most
+// six connections per host and send a characteristic set of headers, so
+// with -browser-mode the transport is capped accordingly and every request
+// carries browser-like headers, making results approximate what users see
+// rather than an unconstrained client.
+package main
+
+import "net/http"
+
+// defaultBrowserConns is the per-host connection limit used by all major
+// browsers for HTTP/1.1.
+const defaultBrowserConns = 6
+
+// browserHeaders is the header set sent in browser mode, modeled on a
+// desktop Chrome navigation request. Accept-Encoding is left to the
+// transport, which asks for gzip and decodes it before the body reaches
+// assertions, extraction and byte counts; naming br or deflate, which
+// nothing here decodes, would hand them compressed bytes.
+var browserHeaders = map[string]string{
+	"User-Agent":                "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+	"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+	"Accept-Language":           "en-US,en;q=0.9",
+	"Cache-Control":             "no-cache",
+	"Upgrade-Insecure-Requests": "1",
+	"Sec-Fetch-Dest":            "document",
+	"Sec-Fetch-Mode":            "navigate",
+	"Sec-Fetch-Site":            "none",
+}
+
+// applyBrowserHeaders sets the browser header set on req. Headers that are
+// already present (e.g. from -header) take precedence.
+func applyBrowserHeaders(req *http.Request) {
+	for key, value := range browserHeaders {
+		if req.Header.Get(key) == "" {
+			req.Header.Set(key, value)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+// budgets.go implements performance budgets (-budgets FILE): a JSON or
+// YAML file, checked into the repository next to the code it covers, that caps
+// latency percentiles and the error rate and sets a throughput floor for
+// the whole run and for each label. Every budget becomes a set of
+// thresholds, checked when the run has finished and reported as a
+// compliance table, and a violated budget fails the run.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// errBudgets is returned when at least one budget was violated.
+var errBudgets = errors.New("performance budgets violated")
+
+// budgetFile is the JSON format of a -budgets file:
+//
+//	{"budgets": [
+//	  {"p95": "500ms", "max_error_rate": "1%"},
+//	  {"label": "checkout", "p95": "300ms", "min_rps": 50}
+//	]}
+type budgetFile struct {
+	Budgets []budgetEntry `json:"budgets"`
+}
+
+// budgetEntry is the budget of the whole run, or of one label.
+type budgetEntry struct {
+	Label        string      `json:"label"`
+	Avg          string      `json:"avg"`
+	P50          string      `json:"p50"`
+	P90          string      `json:"p90"`
+	P95          string      `json:"p95"`
+	P99          string      `json:"p99"`
+	MinRPS       *float64    `json:"min_rps"`
+	MaxErrorRate budgetValue `json:"max_error_rate"` // Percent, "1%" or 1
+}
+
+// budgetValue is a limit given either as a JSON string or as a number.
+type budgetValue string
+
+// UnmarshalJSON accepts a string or a number.
+func (v *budgetValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = budgetValue(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("expected a string or a number, got %s", data)
+	}
+	*v = budgetValue(n)
+	return nil
+}
+
+// percent returns v with a % sign, "" if unset.
+func (v budgetValue) percent() string {
+	if v == "" || strings.HasSuffix(string(v), "%") {
+		return string(v)
+	}
+	return string(v) + "%"
+}
+
+// Budgets is a loaded -budgets file.
+type Budgets struct {
+	Thresholds []Threshold // Every limit of every budget, in file order
+}
+
+// loadBudgets reads and validates a -budgets file.
+func loadBudgets(path string) (*Budgets, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading budgets: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if data, err = budgetsYAML(data); err != nil {
+			return nil, fmt.Errorf("parsing budgets %s: %w", path, err)
+		}
+	}
+	var f budgetFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("parsing budgets %s: %w", path, err)
+	}
+	if len(f.Budgets) == 0 {
+		return nil, fmt.Errorf("budgets %s: at least one budget is required", path)
+	}
+
+	b := &Budgets{}
+	seen := make(map[string]bool)
+	for i, e := range f.Budgets {
+		if seen[e.Label] {
+			if e.Label == "" {
+				return nil, fmt.Errorf("budgets %s: budget %d: more than one budget for the whole run", path, i+1)
+			}
+			return nil, fmt.Errorf("budgets %s: budget %d: duplicate label %q", path, i+1, e.Label)
+		}
+		seen[e.Label] = true
+
+		limits := []struct{ metric, op, value string }{
+			{"avg", "<=", e.Avg},
+			{"p50", "<=", e.P50},
+			{"p90", "<=", e.P90},
+			{"p95", "<=", e.P95},
+			{"p99", "<=", e.P99},
+			{"error_rate", "<=", e.MaxErrorRate.percent()},
+		}
+		if e.MinRPS != nil {
+			limits = append(limits, struct{ metric, op, value string }{"rps", ">=", strconv.FormatFloat(*e.MinRPS, 'g', -1, 64)})
+		}
+		n := len(b.Thresholds)
+		for _, l := range limits {
+			if l.value == "" {
+				continue
+			}
+			limit, err := parseThresholdLimit(l.metric, l.value)
+			if err != nil {
+				return nil, fmt.Errorf("budgets %s: budget %d: %s: %w", path, i+1, l.metric, err)
+			}
+			expr := l.metric
+			if e.Label != "" {
+				expr += "{" + e.Label + "}"
+			}
+			b.Thresholds = append(b.Thresholds, Threshold{Expr: expr + l.op + l.value, Metric: l.metric, Label: e.Label, Op: l.op, Limit: limit})
+		}
+		if len(b.Thresholds) == n {
+			return nil, fmt.Errorf("budgets %s: budget %d sets no limit, expected avg, p50, p90, p95, p99, min_rps or max_error_rate", path, i+1)
+		}
+	}
+	return b, nil
+}
+
+// budgetsYAML converts a YAML budgets file to the JSON format, in which it
+// is then validated:
+//
+//	budgets:
+//	  - p95: 500ms
+//	    max_error_rate: 1%
+//	  - label: checkout
+//	    p95: 300ms
+//	    min_rps: 50
+//
+// It reads the subset of YAML the format needs, a budgets key holding a
+// list of mappings of scalars, and rejects anything else rather than
+// pulling in a YAML library.
+func budgetsYAML(data []byte) ([]byte, error) {
+	var (
+		budgets    []map[string]any
+		item       map[string]any
+		seenKey    bool
+		dashIndent = -1 // Column of the list's dashes
+		keyIndent  = -1 // Column of the current item's keys
+	)
+	for i, raw := range strings.Split(string(data), "\n") {
+		n := i + 1
+		line := strings.TrimRight(stripYAMLComment(raw), " \t\r")
+		if strings.TrimSpace(line) == "" || line == "---" {
+			continue
+		}
+		text := strings.TrimLeft(line, " ")
+		indent := len(line) - len(text)
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs cannot indent YAML", n)
+		}
+		if !seenKey {
+			if indent != 0 || text != "budgets:" {
+				return nil, fmt.Errorf("line %d: expected \"budgets:\" holding a list of budgets", n)
+			}
+			seenKey = true
+			continue
+		}
+
+		if text == "-" || strings.HasPrefix(text, "- ") {
+			if dashIndent < 0 {
+				dashIndent = indent
+			}
+			if indent != dashIndent {
+				return nil, fmt.Errorf("line %d: budget not aligned with the previous ones", n)
+			}
+			item = make(map[string]any)
+			budgets = append(budgets, item)
+			rest := strings.TrimLeft(text[1:], " ")
+			keyIndent = -1
+			if rest == "" {
+				continue
+			}
+			keyIndent = indent + len(text) - len(rest)
+			text = rest
+		} else {
+			if item == nil {
+				if indent == 0 {
+					return nil, fmt.Errorf("line %d: unknown key, only \"budgets\" is supported", n)
+				}
+				return nil, fmt.Errorf("line %d: expected a list item (\"- \")", n)
+			}
+			if keyIndent < 0 && indent > dashIndent {
+				keyIndent = indent
+			}
+			if indent != keyIndent {
+				return nil, fmt.Errorf("line %d: key not aligned with the budget's other keys", n)
+			}
+		}
+
+		if text[0] == '{' || text[0] == '[' {
+			return nil, fmt.Errorf("line %d: flow style is not supported, write one key per line", n)
+		}
+		key, value, ok := strings.Cut(text, ":")
+		if !ok || (value != "" && value[0] != ' ') {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", n)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if value == "" {
+			return nil, fmt.Errorf("line %d: %s: missing value; nested values are not supported", n, key)
+		}
+		if _, dup := item[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", n, key)
+		}
+		v, err := yamlScalar(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", n, key, err)
+		}
+		item[key] = v
+	}
+	if !seenKey {
+		return nil, errors.New("expected \"budgets:\" holding a list of budgets")
+	}
+	return json.Marshal(map[string]any{"budgets": budgets})
+}
+
+// stripYAMLComment removes a # comment from line, unless the # is quoted
+// or part of a word.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// yamlScalar returns the value of a plain or quoted YAML scalar: a number
+// if it reads as one, a string otherwise.
+func yamlScalar(s string) (any, error) {
+	switch s[0] {
+	case '"':
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string %s", s)
+		}
+		return v, nil
+	case '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return nil, fmt.Errorf("invalid quoted string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case '{', '[', '&', '*', '!', '|', '>':
+		return nil, fmt.Errorf("unsupported YAML value %s, only plain and quoted scalars are supported", s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return json.Number(s), nil
+	}
+	return s, nil
+}
+
+// formatLimit formats a threshold's operator and limit in its metric's
+// unit, as in "<= 300.00ms".
+func (t Threshold) formatLimit() string {
+	r := ThresholdResult{Threshold: t, Actual: t.Limit}
+	return t.Op + " " + r.formatActual()
+}
+
+// printBudgets prints the budget compliance table: one row per limit,
+// grouped by label in file order.
+func printBudgets(w io.Writer, results []ThresholdResult) {
+	met := 0
+	for _, r := range results {
+		if r.Passed {
+			met++
+		}
+	}
+	fmt.Fprintf(w, "Performance Budgets: %d of %d met\n", met, len(results))
+	fmt.Fprintf(w, "  %-16s %-11s %-16s %-18s %s\n", "Label", "Metric", "Budget", "Actual", "Result")
+	for i, r := range results {
+		label := r.Label
+		if label == "" {
+			label = "(all)"
+		}
+		if i > 0 && results[i-1].Label == r.Label {
+			label = ""
+		}
+		verdict := "PASS"
+		if !r.Passed {
+			verdict = "FAIL"
+		}
+		actual := r.formatActual()
+		if r.Missing {
+			actual = "no requests"
+		}
+		fmt.Fprintf(w, "  %-16s %-11s %-16s %-18s %s\n", label, r.Metric, r.formatLimit(), actual, verdict)
+	}
+}
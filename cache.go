@@ -0,0 +1,143 @@
+// cache.go implements the `cache` subcommand: the same test run twice back
+// to back, first against a cold cache, then against the cache the first
+// run warmed, with the results reported side by side. Before the cold run
+// the cache can be emptied by purge requests (-purge), so the comparison
+// does not depend on what earlier traffic left cached.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// runCacheCommand implements `cache [flags] -- <load test flags>`.
+func runCacheCommand(args []string) error {
+	fs := flag.NewFlagSet("cache", flag.ContinueOnError)
+	var purgeURLs, purgeHeaders headerFlags
+	fs.Var(&purgeURLs, "purge", "URL requested before the cold run to empty the cache (can be repeated)")
+	purgeMethod := fs.String("purge-method", "PURGE", "HTTP method of the -purge requests")
+	fs.Var(&purgeHeaders, "purge-header", "Header of the -purge requests in 'Key: Value' format, e.g. for an API token (can be repeated)")
+	pause := fs.Duration("pause", 0, "Pause between the cold and the warm run")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	method := strings.ToUpper(*purgeMethod)
+	if !validMethod(method) {
+		return fmt.Errorf("validation error: invalid -purge-method %q", *purgeMethod)
+	}
+	for _, u := range purgeURLs {
+		if err := validTargetURL(u); err != nil {
+			return fmt.Errorf("validation error: -purge %s: %w", u, err)
+		}
+	}
+	header := make(http.Header)
+	for _, h := range purgeHeaders {
+		key, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("validation error: invalid -purge-header %q, expected 'Key: Value'", h)
+		}
+		header.Set(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+	if *pause < 0 {
+		return fmt.Errorf("validation error: -pause must be >= 0, got %s", *pause)
+	}
+
+	// Everything after the cache flags configures the test run twice.
+	config, err := parseConfigArgs(fs.Args())
+	if err != nil {
+		return err
+	}
+	switch {
+	case config.ScenarioFile != "":
+		return fmt.Errorf("validation error: scenario mode is not supported by cache")
+	case len(config.ConfigFiles) > 0:
+		return fmt.Errorf("validation error: -config is not supported by cache")
+	case config.Repeat > 1 || config.Mirror != nil:
+		return fmt.Errorf("validation error: -repeat and -mirror-to are not supported by cache")
+	case config.AutoConcurrency:
+		return fmt.Errorf("validation error: -auto-concurrency is not supported by cache, set -c")
+	case config.MaxMemory > 0:
+		return fmt.Errorf("validation error: -max-memory is not supported by cache")
+	case config.RecordFile != "" || config.FailureManifest != nil:
+		return fmt.Errorf("validation error: -record and -failure-manifest are not supported by cache, the warm run would overwrite the file")
+	case config.OutputFile != "" || len(config.Exporters) > 0:
+		return fmt.Errorf("validation error: -output-file and exporters are not supported by cache")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logOut := os.Stderr
+	PrintBanner(logOut, config)
+	for _, u := range purgeURLs {
+		if err := purgeCache(ctx, method, u, header, config.Timeout); err != nil {
+			return err
+		}
+		fmt.Fprintf(logOut, "Purged %s\n", u)
+	}
+
+	var runs [2]Summary
+	for i, name := range []string{"cold", "warm"} {
+		if i > 0 && *pause > 0 {
+			fmt.Fprintf(logOut, "Pausing %s before the warm run\n", *pause)
+			select {
+			case <-time.After(*pause):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		fmt.Fprintf(logOut, "Running the %s cache test\n", name)
+		stats := NewStats(config.NumRequests)
+		stats.Configure(config)
+		err := runWithProgress(!config.CI, logOut, stats, func() error {
+			return RunLoadTest(ctx, config, stats)
+		})
+		fmt.Fprintln(logOut)
+		if err != nil {
+			return fmt.Errorf("%s run: %w", name, err)
+		}
+		runs[i] = stats.GetSummary()
+	}
+
+	printCacheComparison(os.Stdout, runs[0], runs[1])
+	return nil
+}
+
+// purgeCache sends one purge request, failing unless the response has a
+// 2xx or 3xx status.
+func purgeCache(ctx context.Context, method, url string, header http.Header, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return fmt.Errorf("purging %s: %w", url, err)
+	}
+	req.Header = header.Clone()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("purging %s: %w", url, err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("purging %s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+// printCacheComparison prints the cold and warm results side by side.
+func printCacheComparison(w io.Writer, cold, warm Summary) {
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	fmt.Fprintln(w, " Cold vs Warm Cache")
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	printSideBySide(w, "Cold", "Warm", cold, warm)
+}
@@ -0,0 +1,47 @@
+// cancel.go implements client-side cancellation injection (-cancel-rate).
+// A random fraction of requests is aborted mid-flight after a random delay,
+// as a client disconnecting would, to load test how the server copes with
+// cancelled requests and half-written responses. Injected cancellations are
+// counted separately from failures and excluded from latency statistics.
+package main
+
+import (
+	"context"
+	"errors"
+	mathrand "math/rand"
+	"time"
+)
+
+// defaultCancelAfter is the default upper bound of the cancellation delay.
+const defaultCancelAfter = 100 * time.Millisecond
+
+// CancelInjection describes which requests to cancel and when. The zero
+// value disables injection.
+type CancelInjection struct {
+	Rate     float64       // Fraction of requests to cancel, 0-1
+	MaxDelay time.Duration // Requests are cancelled after a uniform random delay in (0, MaxDelay]
+}
+
+// apply derives the context for one request. For a Rate fraction of
+// requests, picked with rng, the returned context is cancelled after a
+// random delay, and injected is true. The caller must call cancel when the
+// request is done.
+func (c CancelInjection) apply(ctx context.Context, rng *mathrand.Rand) (reqCtx context.Context, cancel context.CancelFunc, injected bool) {
+	if c.Rate <= 0 || rng.Float64() >= c.Rate {
+		return ctx, func() {}, false
+	}
+
+	reqCtx, abort := context.WithCancel(ctx)
+	delay := time.Duration(rng.Int63n(int64(c.MaxDelay))) + 1
+	timer := time.AfterFunc(delay, abort)
+	return reqCtx, func() {
+		timer.Stop()
+		abort()
+	}, true
+}
+
+// wasInjectedCancel reports whether a request failed because of an
+// injected cancellation rather than the run itself being cancelled.
+func wasInjectedCancel(parent context.Context, injected bool, err error) bool {
+	return injected && err != nil && parent.Err() == nil && errors.Is(err, context.Canceled)
+}
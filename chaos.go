@@ -0,0 +1,282 @@
+// chaos.go implements malformed-request chaos mode (-chaos). A configurable
+// share of requests is replaced by deliberately malformed ones: a broken
+// Content-Length, a body that is not valid UTF-8, or headers larger than
+// servers and proxies normally accept. Since net/http refuses to send most
+// of these, chaos requests are written by hand over their own connection,
+// and the server's responses are tallied per kind instead of mixing into
+// the regular results.
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of malformed request.
+const (
+	chaosContentLength = "content-length"
+	chaosUTF8          = "utf8"
+	chaosHeaders       = "headers"
+)
+
+// chaosKinds lists every kind, in the order they are reported.
+var chaosKinds = []string{chaosContentLength, chaosUTF8, chaosHeaders}
+
+// chaosHeaderSize is the size of the padding header of a "headers" chaos
+// request. It exceeds Go's 1MB default limit and the few kilobytes most
+// proxies and servers allow.
+const chaosHeaderSize = 1<<20 + 4<<10
+
+// badContentLengths are the Content-Length headers sent by "content-length"
+// chaos requests, along with a 4-byte body.
+var badContentLengths = []string{
+	"Content-Length: 1024",                            // More than is sent
+	"Content-Length: -4",                              // Negative
+	"Content-Length: four",                            // Not a number
+	"Content-Length: 4\r\nContent-Length: 8",          // Conflicting duplicates
+	"Content-Length: 4\r\nTransfer-Encoding: chunked", // Both framings (smuggling vector)
+}
+
+// ChaosMode describes which requests to replace by malformed ones. The zero
+// value disables chaos mode.
+type ChaosMode struct {
+	Rate  float64  // Fraction of requests to replace, 0-1
+	Kinds []string // Kinds to choose from, uniformly
+}
+
+// parseKinds parses a comma-separated list of kinds for flag name, each of
+// which must be one of valid.
+func parseKinds(name, s string, valid []string) ([]string, error) {
+	var kinds []string
+	for _, part := range strings.Split(s, ",") {
+		kind := strings.TrimSpace(part)
+		known := false
+		for _, k := range valid {
+			if kind == k {
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown -%s entry %q, expected %s", name, kind, strings.Join(valid, ", "))
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// pick decides with rng whether the next request is a chaos request and
+// of which kind.
+func (c ChaosMode) pick(rng *mathrand.Rand) (kind string, ok bool) {
+	if c.Rate <= 0 || rng.Float64() >= c.Rate {
+		return "", false
+	}
+	return c.Kinds[rng.Intn(len(c.Kinds))], true
+}
+
+// ChaosCounts tallies the server's reactions to one kind of malformed
+// request.
+type ChaosCounts struct {
+	Sent       int         `json:"sent"`
+	Status     map[int]int `json:"status,omitempty"` // Responses by status code
+	NoResponse int         `json:"no_response"`      // Connection closed, reset or timed out without a response
+}
+
+// add counts one chaos request outcome.
+func (c *ChaosCounts) add(result RequestResult) {
+	c.Sent++
+	if result.Error != nil {
+		c.NoResponse++
+		return
+	}
+	if c.Status == nil {
+		c.Status = make(map[int]int)
+	}
+	c.Status[result.StatusCode]++
+}
+
+// merge folds o into c.
+func (c *ChaosCounts) merge(o ChaosCounts) {
+	c.Sent += o.Sent
+	c.NoResponse += o.NoResponse
+	for code, n := range o.Status {
+		if c.Status == nil {
+			c.Status = make(map[int]int)
+		}
+		c.Status[code] += n
+	}
+}
+
+// sub returns the counts in c that are not in prev.
+func (c ChaosCounts) sub(prev ChaosCounts) ChaosCounts {
+	d := ChaosCounts{Sent: c.Sent - prev.Sent, NoResponse: c.NoResponse - prev.NoResponse}
+	for code, n := range c.Status {
+		if n -= prev.Status[code]; n != 0 {
+			if d.Status == nil {
+				d.Status = make(map[int]int)
+			}
+			d.Status[code] = n
+		}
+	}
+	return d
+}
+
+// accepted returns how many requests got a 2xx or 3xx response, i.e. were
+// not rejected by the server.
+func (c ChaosCounts) accepted() int {
+	n := 0
+	for code, count := range c.Status {
+		if code < 400 {
+			n += count
+		}
+	}
+	return n
+}
+
+// statusList formats the status counts as "400: 12, 431: 3" in code order.
+func (c ChaosCounts) statusList() string {
+	codes := make([]int, 0, len(c.Status))
+	for code := range c.Status {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		parts[i] = fmt.Sprintf("%d: %d", code, c.Status[code])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// realRequests returns the requests of s that were not chaos requests.
+// Throughput counts only these: a malformed request is not the traffic
+// being measured, and is answered or dropped far faster than real ones.
+func (s Summary) realRequests() int {
+	n := s.TotalRequests
+	for _, c := range s.Chaos {
+		n -= c.Sent
+	}
+	return n
+}
+
+// sendChaos sends one malformed request of the given kind over a new
+// connection and reads the response.
+func (w *Worker) sendChaos(ctx context.Context, kind string, requestIndex int, rng *mathrand.Rand) RequestResult {
+	result := RequestResult{Chaos: kind}
+
+	u, err := url.Parse(w.config.URLTemplate.Render(requestIndex, rng))
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	raw := buildChaosRequest(kind, u, w.config, requestIndex, rng)
+	result.Method = raw.method
+	result.RequestBytes = int64(len(raw.data))
+
+	ctx, cancel := context.WithTimeout(ctx, w.config.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	conn, err := dialChaos(ctx, u, w.config.TLS)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Servers often answer and close before reading all of an oversized
+	// request, so a write error is not yet a failure.
+	conn.Write(raw.data)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	defer resp.Body.Close()
+	n, _ := io.Copy(io.Discard, resp.Body)
+
+	result.StatusCode = resp.StatusCode
+	result.ContentLength = n
+	result.HeaderBytes = responseHeaderSize(resp)
+	return result
+}
+
+// chaosRequest is a hand-written HTTP/1.1 request.
+type chaosRequest struct {
+	method string
+	data   []byte
+}
+
+// buildChaosRequest writes a malformed request of the given kind for u,
+// carrying the configured headers rendered for request index with rng.
+func buildChaosRequest(kind string, u *url.URL, config *Config, index int, rng *mathrand.Rand) chaosRequest {
+	method := config.Method
+	var extra, body string
+	switch kind {
+	case chaosContentLength:
+		if !methodSendsBody(method) {
+			method = http.MethodPost
+		}
+		extra = badContentLengths[rng.Intn(len(badContentLengths))] + "\r\n"
+		body = "oops"
+	case chaosUTF8:
+		if !methodSendsBody(method) {
+			method = http.MethodPost
+		}
+		// Truncated multi-byte sequences, a lone continuation byte,
+		// overlong encodings and bytes never valid in UTF-8.
+		body = "{\"name\": \"\xe2\x82\", \"text\": \"\x80abc\xc0\xaf\xff\xfe\"}"
+		extra = fmt.Sprintf("Content-Type: application/json; charset=utf-8\r\nContent-Length: %d\r\n", len(body))
+	case chaosHeaders:
+		extra = "X-Chaos-Padding: " + strings.Repeat("a", chaosHeaderSize) + "\r\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", method, u.RequestURI())
+	fmt.Fprintf(&b, "Host: %s\r\n", u.Host)
+	for _, h := range config.HeaderTemplates {
+		fmt.Fprintf(&b, "%s: %s\r\n", h.name.Render(index, rng), h.value.Render(index, rng))
+	}
+	b.WriteString("Connection: close\r\n")
+	b.WriteString(extra)
+	b.WriteString("\r\n")
+	b.WriteString(body)
+	return chaosRequest{method: method, data: []byte(b.String())}
+}
+
+// dialChaos opens a connection to u's host, using TLS configured by t for
+// https URLs.
+func dialChaos(ctx context.Context, u *url.URL, t *TLSSettings) (net.Conn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	if u.Scheme == "https" {
+		c := t.clientConfig()
+		if c == nil {
+			c = &tls.Config{}
+		}
+		c.ServerName, c.NextProtos = u.Hostname(), []string{"http/1.1"}
+		d := &tls.Dialer{Config: c}
+		return d.DialContext(ctx, "tcp", host)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", host)
+}
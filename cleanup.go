@@ -0,0 +1,92 @@
+// cleanup.go verifies that a run released what it acquired. The goroutine
+// and file descriptor counts of the process are taken before the run and
+// compared after it, together with the number of the run's connections
+// still open. A process that runs tests back to back, such as an agent or
+// a harness calling RunLoadTest in a loop, would otherwise only find a
+// slow leak when it runs out of file descriptors.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"time"
+)
+
+// cleanupSettle bounds how long checkCleanup waits for the counts to come
+// back down: transports close connections and end their goroutines
+// asynchronously.
+const cleanupSettle = 2 * time.Second
+
+// CleanupReport is what a run left behind.
+type CleanupReport struct {
+	OpenConnections  int // Connections dialed by the run that are still open
+	GoroutinesBefore int
+	GoroutinesAfter  int
+	FDsBefore        int // Open file descriptors, -1 where the platform does not list them
+	FDsAfter         int
+}
+
+// Clean reports whether the run left no connection, goroutine or file
+// descriptor behind.
+func (r *CleanupReport) Clean() bool {
+	return r.OpenConnections == 0 && r.GoroutinesAfter <= r.GoroutinesBefore && r.FDsAfter <= r.FDsBefore
+}
+
+// resourceBaseline is the process's resources before a run.
+type resourceBaseline struct {
+	goroutines int
+	fds        int
+	conns      int64
+}
+
+// takeResourceBaseline records the resources in use before a run.
+func takeResourceBaseline() resourceBaseline {
+	return resourceBaseline{goroutines: runtime.NumGoroutine(), fds: countFDs(), conns: openConns.Load()}
+}
+
+// checkCleanup compares the resources in use with base, giving them up to
+// cleanupSettle to return to it.
+func checkCleanup(base resourceBaseline) *CleanupReport {
+	deadline := time.Now().Add(cleanupSettle)
+	for {
+		r := &CleanupReport{
+			OpenConnections:  int(openConns.Load() - base.conns),
+			GoroutinesBefore: base.goroutines,
+			GoroutinesAfter:  runtime.NumGoroutine(),
+			FDsBefore:        base.fds,
+			FDsAfter:         countFDs(),
+		}
+		if r.Clean() || time.Now().After(deadline) {
+			return r
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// countFDs returns the number of open file descriptors of the process, or
+// -1 if the platform has no /proc/self/fd (Linux) or /dev/fd (macOS, BSD).
+// Listing the directory opens one descriptor, which is counted every time.
+func countFDs() int {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		if entries, err := os.ReadDir(dir); err == nil {
+			return len(entries)
+		}
+	}
+	return -1
+}
+
+// printCleanup reports what the run left behind, warning about leaks.
+func printCleanup(w io.Writer, r *CleanupReport) {
+	fds := "not available"
+	if r.FDsBefore >= 0 {
+		fds = fmt.Sprintf("%d → %d", r.FDsBefore, r.FDsAfter)
+	}
+	status := "all released"
+	if !r.Clean() {
+		status = "Warning: resources left behind"
+	}
+	fmt.Fprintf(w, "Cleanup:           %s (connections open: %d, goroutines: %d → %d, file descriptors: %s)\n",
+		status, r.OpenConnections, r.GoroutinesBefore, r.GoroutinesAfter, fds)
+}
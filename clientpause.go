@@ -0,0 +1,107 @@
+// clientpause.go detects pauses on the load generator itself: Go garbage
+// collection stop-the-world pauses, read from the runtime, and scheduling
+// stalls, where a goroutine that should wake up every few milliseconds is
+// noticeably late (e.g. under CPU throttling). Pauses are recorded on Stats
+// and annotate the latency windows they fall in, so a client-side stall
+// isn't misread as a server latency spike.
+package main
+
+import (
+	"runtime"
+	"time"
+)
+
+const (
+	// pausePollInterval is how often the GC pause history is read.
+	pausePollInterval = 250 * time.Millisecond
+
+	// stallProbeInterval is the sleep of the scheduling stall probe.
+	stallProbeInterval = 10 * time.Millisecond
+
+	// stallThreshold is how late the probe must wake up to count as a stall.
+	stallThreshold = 20 * time.Millisecond
+
+	// significantClientPause is the smallest pause reported as coinciding
+	// with a latency spike.
+	significantClientPause = time.Millisecond
+)
+
+// Kinds of client pause passed to Stats.RecordClientPause.
+const (
+	pauseGC    = "gc"
+	pauseStall = "stall"
+)
+
+// ClientPauseSummary reports pauses of the load generator during the run.
+type ClientPauseSummary struct {
+	GC      LatencyDist   // Stop-the-world GC pauses
+	GCTotal time.Duration // Sum of all GC pauses
+	Stalls  LatencyDist   // Scheduling stalls longer than stallThreshold
+}
+
+// startPauseMonitor records GC pauses and scheduling stalls on stats until
+// the returned stop function is called. stop records any GC pauses that
+// completed since the last poll before returning.
+func startPauseMonitor(stats *Stats) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{}, 2)
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	lastGC := ms.NumGC
+
+	// GC pauses, from the runtime's circular buffer of the last 256.
+	go func() {
+		defer func() { finished <- struct{}{} }()
+		ticker := time.NewTicker(pausePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				lastGC = recordGCPauses(stats, lastGC)
+				return
+			}
+			lastGC = recordGCPauses(stats, lastGC)
+		}
+	}()
+
+	// Scheduling stalls: wake-ups that are much later than requested.
+	go func() {
+		defer func() { finished <- struct{}{} }()
+		for {
+			start := time.Now()
+			select {
+			case <-time.After(stallProbeInterval):
+			case <-done:
+				return
+			}
+			if late := time.Since(start) - stallProbeInterval; late > stallThreshold {
+				stats.RecordClientPause(pauseStall, time.Now(), late)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+		<-finished
+	}
+}
+
+// recordGCPauses records the GC pauses completed after GC cycle lastGC and
+// returns the latest cycle number.
+func recordGCPauses(stats *Stats, lastGC uint32) uint32 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	first := lastGC + 1
+	if ms.NumGC > 256 && first < ms.NumGC-255 {
+		first = ms.NumGC - 255 // Older pauses have been overwritten
+	}
+	for gc := first; gc <= ms.NumGC; gc++ {
+		i := (gc + 255) % 256
+		stats.RecordClientPause(pauseGC, time.Unix(0, int64(ms.PauseEnd[i])), time.Duration(ms.PauseNs[i]))
+	}
+	return ms.NumGC
+}
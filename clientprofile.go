@@ -0,0 +1,197 @@
+// clientprofile.go implements client profile rotation (-client-profiles):
+// a JSON file of client profiles, each a coherent set of User-Agent,
+// Accept-Language and further headers, optionally sent in an order of its
+// own (headerorder.go). Every virtual user keeps one profile
+// for the whole run and profiles are spread over the virtual users by
+// weight, so bot-detection layers in front of the target see a realistic
+// mix of clients rather than one client or headers mixed at random.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxProfileWeight bounds the sum of profile weights, which is the length
+// of the assignment cycle.
+const maxProfileWeight = 10000
+
+// ClientProfile is one client that virtual users can present as.
+type ClientProfile struct {
+	Name    string
+	Weight  int
+	Headers http.Header // User-Agent, Accept-Language and the profile's other headers
+	Order   []string    // Order of the request's header lines, nil for Go's
+}
+
+// ClientProfiles is the set of profiles loaded from -client-profiles.
+type ClientProfiles struct {
+	Profiles []ClientProfile
+	order    []int // Profile index for each slot of the weighted assignment cycle
+}
+
+// clientProfilesFile is the JSON layout of a -client-profiles file, e.g.
+//
+//	{"profiles": [
+//	  {"name": "chrome-windows", "weight": 3,
+//	   "user_agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) ...",
+//	   "accept_language": "en-US,en;q=0.9",
+//	   "headers": {"Sec-CH-UA-Platform": "\"Windows\""},
+//	   "header_order": ["Host", "Connection", "User-Agent", "Accept", "Accept-Language"]},
+//	  {"name": "safari-mac", "user_agent": "...", "accept_language": "fr-FR,fr;q=0.9"}
+//	]}
+type clientProfilesFile struct {
+	Profiles []struct {
+		Name           string            `json:"name"`
+		Weight         int               `json:"weight"`
+		UserAgent      string            `json:"user_agent"`
+		AcceptLanguage string            `json:"accept_language"`
+		Headers        map[string]string `json:"headers"`
+		HeaderOrder    []string          `json:"header_order"`
+	} `json:"profiles"`
+}
+
+// loadClientProfiles reads and validates a -client-profiles file.
+func loadClientProfiles(path string) (*ClientProfiles, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return nil, fmt.Errorf("client profiles %s: YAML is not supported, write the profiles as JSON", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading client profiles: %w", err)
+	}
+	var f clientProfilesFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing client profiles %s: %w", path, err)
+	}
+	if len(f.Profiles) == 0 {
+		return nil, fmt.Errorf("client profiles %s: at least one profile is required", path)
+	}
+
+	cp := &ClientProfiles{}
+	seen := make(map[string]bool)
+	total := 0
+	for i, fp := range f.Profiles {
+		name := fp.Name
+		if name == "" {
+			name = fmt.Sprintf("profile %d", i+1)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("client profiles %s: profile %d: duplicate profile name %q", path, i+1, name)
+		}
+		seen[name] = true
+
+		weight := fp.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("client profiles %s: profile %d (%s): weight must be > 0, got %d", path, i+1, name, fp.Weight)
+		}
+		total += weight
+		if total > maxProfileWeight {
+			return nil, fmt.Errorf("client profiles %s: weights add up to more than %d", path, maxProfileWeight)
+		}
+
+		headers := make(http.Header)
+		for key, value := range fp.Headers {
+			headers.Set(key, value)
+		}
+		if fp.UserAgent != "" {
+			headers.Set("User-Agent", fp.UserAgent)
+		}
+		if fp.AcceptLanguage != "" {
+			headers.Set("Accept-Language", fp.AcceptLanguage)
+		}
+		if headers.Get("User-Agent") == "" {
+			return nil, fmt.Errorf("client profiles %s: profile %d (%s): user_agent is required", path, i+1, name)
+		}
+		var order []string
+		for _, key := range fp.HeaderOrder {
+			if key == "" || strings.ContainsAny(key, ": \t\r\n") {
+				return nil, fmt.Errorf("client profiles %s: profile %d (%s): invalid header_order name %q", path, i+1, name, key)
+			}
+			order = append(order, http.CanonicalHeaderKey(key))
+		}
+		cp.Profiles = append(cp.Profiles, ClientProfile{Name: name, Weight: weight, Headers: headers, Order: order})
+	}
+	cp.order = weightedOrder(cp.Profiles, total)
+	return cp, nil
+}
+
+// weightedOrder spreads the profiles over a cycle of total slots in
+// proportion to their weights, interleaved rather than in runs (smooth
+// weighted round-robin), so that even a few virtual users get a mix.
+func weightedOrder(profiles []ClientProfile, total int) []int {
+	order := make([]int, 0, total)
+	current := make([]int, len(profiles))
+	for len(order) < total {
+		best := 0
+		for i, p := range profiles {
+			current[i] += p.Weight
+			if current[i] > current[best] {
+				best = i
+			}
+		}
+		current[best] -= total
+		order = append(order, best)
+	}
+	return order
+}
+
+// forUser returns the profile of virtual user n.
+func (cp *ClientProfiles) forUser(n int) *ClientProfile {
+	if cp == nil {
+		return nil
+	}
+	return &cp.Profiles[cp.order[n%len(cp.order)]]
+}
+
+// ordered reports whether any profile sets a header order.
+func (cp *ClientProfiles) ordered() bool {
+	if cp == nil {
+		return false
+	}
+	for _, p := range cp.Profiles {
+		if len(p.Order) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// apply sets the profile's headers on req and returns it, carrying the
+// profile's header order if it has one. Headers that are already present
+// (e.g. from -header) take precedence.
+func (p *ClientProfile) apply(req *http.Request) *http.Request {
+	if p == nil {
+		return req
+	}
+	for key, values := range p.Headers {
+		if req.Header.Get(key) == "" {
+			req.Header[key] = values
+		}
+	}
+	if len(p.Order) == 0 {
+		return req
+	}
+	return withHeaderOrder(req, p.Order)
+}
+
+// String describes the profiles for the banner, e.g.
+// "chrome-windows (x3), safari-mac".
+func (cp *ClientProfiles) String() string {
+	parts := make([]string, len(cp.Profiles))
+	for i, p := range cp.Profiles {
+		parts[i] = p.Name
+		if p.Weight > 1 {
+			parts[i] += fmt.Sprintf(" (x%d)", p.Weight)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,284 @@
+// clocksync.go implements measuring the client's clock offset (-clock-sync)
+// so timestamps the load tester reports can be lined up with server-side
+// logs and traces. The offset is measured once before the run, either
+// against an NTP server or against the Date header of the target's
+// responses, and reported with its uncertainty in the run's metadata.
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Clock sync methods.
+const (
+	clockSyncNTP  = "ntp"
+	clockSyncDate = "date"
+)
+
+const (
+	// defaultNTPServer is queried by -clock-sync ntp without a server.
+	defaultNTPServer = "pool.ntp.org"
+
+	// ntpSamples is the number of NTP queries; the one with the shortest
+	// round trip is used.
+	ntpSamples = 4
+
+	// dateSamples is the number of requests made for a Date header
+	// comparison, dateSpacing apart. The spacing is not a divisor of a
+	// second, so the samples fall at different points of the server's
+	// second and narrow down where it ticks over.
+	dateSamples = 8
+	dateSpacing = 137 * time.Millisecond
+)
+
+// ntpEpochOffset is the number of seconds between the NTP epoch (1900) and
+// the Unix epoch (1970).
+const ntpEpochOffset = 2208988800
+
+// ClockSync selects how the clock offset is measured. The zero value
+// disables the measurement.
+type ClockSync struct {
+	Method string // clockSyncNTP or clockSyncDate
+	Server string // NTP server as host:port; unused for clockSyncDate
+}
+
+// ClockOffset is a measured offset between the client's clock and a
+// reference clock. A positive Offset means the reference is ahead: the
+// reference time of a client timestamp t is t.Add(Offset).
+type ClockOffset struct {
+	Source      string        // clockSyncNTP or clockSyncDate
+	Server      string        // NTP server or target host measured against
+	Offset      time.Duration // Reference time minus client time
+	Uncertainty time.Duration // The true offset lies within Offset ± Uncertainty
+	MeasuredAt  time.Time     // Client time of the measurement
+}
+
+// parseClockSync parses a -clock-sync value: "ntp", "ntp:HOST[:PORT]" or
+// "date". An empty value disables clock sync.
+func parseClockSync(s string) (ClockSync, error) {
+	method, server, _ := strings.Cut(s, ":")
+	switch method {
+	case "":
+		return ClockSync{}, nil
+	case clockSyncDate:
+		if server != "" {
+			return ClockSync{}, fmt.Errorf("invalid -clock-sync value %q, date takes no server", s)
+		}
+		return ClockSync{Method: clockSyncDate}, nil
+	case clockSyncNTP:
+		if server == "" {
+			server = defaultNTPServer
+		}
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "123")
+		}
+		return ClockSync{Method: clockSyncNTP, Server: server}, nil
+	}
+	return ClockSync{}, fmt.Errorf("invalid -clock-sync value %q, expected ntp, ntp:HOST[:PORT] or date", s)
+}
+
+// MeasureClockOffset measures the client's clock offset as selected by cs.
+// For clockSyncDate, target is a URL on the server to compare against.
+func MeasureClockOffset(ctx context.Context, cs ClockSync, target string, timeout time.Duration) (*ClockOffset, error) {
+	switch cs.Method {
+	case clockSyncNTP:
+		return ntpOffset(ctx, cs.Server, timeout)
+	case clockSyncDate:
+		return dateOffset(ctx, target, timeout)
+	}
+	return nil, fmt.Errorf("unknown clock sync method %q", cs.Method)
+}
+
+// ntpOffset queries an NTP server using SNTP (RFC 4330) and returns the
+// offset measured with the shortest round trip.
+func ntpOffset(ctx context.Context, server string, timeout time.Duration) (*ClockOffset, error) {
+	var best *ClockOffset
+	var lastErr error
+	for i := 0; i < ntpSamples && ctx.Err() == nil; i++ {
+		o, err := ntpQuery(ctx, server, timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if best == nil || o.Uncertainty < best.Uncertainty {
+			best = o
+		}
+	}
+	if best == nil {
+		if lastErr == nil {
+			lastErr = ctx.Err()
+		}
+		return nil, fmt.Errorf("querying NTP server %s: %w", server, lastErr)
+	}
+	return best, nil
+}
+
+// ntpQuery sends one SNTP request to server.
+func ntpQuery(ctx context.Context, server string, timeout time.Duration) (*ClockOffset, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Version 4, client mode, with the send time as transmit timestamp
+	// so the reply can be matched to the request.
+	req := make([]byte, 48)
+	req[0] = 4<<3 | 3
+	sent := time.Now()
+	binary.BigEndian.PutUint64(req[40:], toNTPTime(sent))
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, 48)
+	for {
+		n, err := conn.Read(resp)
+		if err != nil {
+			return nil, err
+		}
+		received := time.Now()
+		if n < 48 || resp[0]&7 != 4 || binary.BigEndian.Uint64(resp[24:]) != binary.BigEndian.Uint64(req[40:]) {
+			continue // Not a server reply to this request
+		}
+		if resp[1] == 0 {
+			return nil, errors.New("server sent a kiss-of-death reply")
+		}
+
+		// t1 sent, t2 received by the server, t3 sent by the server, t4
+		// received. Offset and round trip as in RFC 4330 section 5.
+		t2 := fromNTPTime(binary.BigEndian.Uint64(resp[32:]))
+		t3 := fromNTPTime(binary.BigEndian.Uint64(resp[40:]))
+		offset := (t2.Sub(sent) + t3.Sub(received)) / 2
+		delay := received.Sub(sent) - t3.Sub(t2)
+		return &ClockOffset{
+			Source:      clockSyncNTP,
+			Server:      server,
+			Offset:      offset,
+			Uncertainty: delay / 2,
+			MeasuredAt:  sent,
+		}, nil
+	}
+}
+
+// toNTPTime converts t to a 64-bit NTP timestamp.
+func toNTPTime(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return secs<<32 | frac
+}
+
+// fromNTPTime converts a 64-bit NTP timestamp to a time.
+func fromNTPTime(ts uint64) time.Time {
+	secs := int64(ts>>32) - ntpEpochOffset
+	nanos := (ts & 0xffffffff) * uint64(time.Second) >> 32
+	return time.Unix(secs, int64(nanos))
+}
+
+// dateOffset estimates the offset from the Date header of several
+// responses from the root of target's host. A Date header has a resolution
+// of one second, but each response bounds the offset: the server's clock
+// read somewhere in [Date, Date+1s) at some point while the request was in
+// flight.
+// Intersecting these bounds over samples spread across a second narrows
+// the offset down to roughly the sample spacing plus the round trip.
+func dateOffset(ctx context.Context, target string, timeout time.Duration) (*ClockOffset, error) {
+	// Any response carries a Date header, so the root of the host does;
+	// templates in the path of target needn't be rendered.
+	u, err := url.Parse(stripTemplatePlaceholders(target))
+	if err != nil {
+		return nil, err
+	}
+	u = &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}
+	client := &http.Client{Timeout: timeout}
+
+	var lo, hi time.Duration
+	var measuredAt time.Time
+	for i := 0; i < dateSamples; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(dateSpacing):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		sent := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		received := time.Now()
+		resp.Body.Close()
+		date, err := http.ParseTime(resp.Header.Get("Date"))
+		if err != nil {
+			return nil, fmt.Errorf("response from %s has no valid Date header", u.Host)
+		}
+
+		sampleLo, sampleHi := date.Sub(received), date.Add(time.Second).Sub(sent)
+		if i == 0 || sampleLo > hi || sampleHi < lo {
+			// First sample, or one inconsistent with the earlier ones
+			// (e.g. the server's clock was stepped): start over from it.
+			lo, hi = sampleLo, sampleHi
+		} else {
+			lo, hi = max(lo, sampleLo), min(hi, sampleHi)
+		}
+		measuredAt = sent
+	}
+
+	return &ClockOffset{
+		Source:      clockSyncDate,
+		Server:      u.Host,
+		Offset:      (lo + hi) / 2,
+		Uncertainty: (hi - lo) / 2,
+		MeasuredAt:  measuredAt,
+	}, nil
+}
+
+// syncClock measures the clock offset when clock sync is enabled, noting
+// the result on w. A failed measurement is reported as a warning and
+// yields nil, since the run itself does not depend on it.
+func syncClock(ctx context.Context, w io.Writer, cs ClockSync, target string, timeout time.Duration) *ClockOffset {
+	if cs.Method == "" {
+		return nil
+	}
+	o, err := MeasureClockOffset(ctx, cs, target, timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: clock sync failed: %v\n", err)
+		return nil
+	}
+	fmt.Fprintf(w, "Clock offset: %s\n", formatClockOffset(o))
+	return o
+}
+
+// formatClockOffset formats an offset as e.g. "+12.30ms ±4.10ms (ntp
+// pool.ntp.org:123)".
+func formatClockOffset(o *ClockOffset) string {
+	sign := "+"
+	offset := o.Offset
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	return fmt.Sprintf("%s%s ±%s (%s %s)", sign, formatDuration(offset), formatDuration(o.Uncertainty), o.Source, o.Server)
+}
@@ -0,0 +1,316 @@
+// compare.go implements the `compare` subcommand. It diffs two raw result
+// files (-record) over time rather than by their final aggregates: both
+// runs are aligned by the time since their first request and cut into
+// buckets, and the latency delta per bucket shows when during the run the
+// candidate diverged from the baseline, e.g. a slowdown that only sets in
+// once caches fill up.
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// compareMinSamples is the number of successful requests a bucket needs in
+// both runs before its delta can count as a divergence.
+const compareMinSamples = 10
+
+// compareBarScale is the delta in percent drawn as one bar character, and
+// compareBarMax the longest bar drawn.
+const (
+	compareBarScale = 5
+	compareBarMax   = 30
+)
+
+// rawRun is a raw result file loaded for comparison.
+type rawRun struct {
+	path     string
+	requests int
+	errors   int
+	duration time.Duration   // From the first request start to the last request start
+	offsets  []time.Duration // Start of each successful request relative to the run's first
+	latency  []time.Duration // Latency of each successful request, parallel to offsets
+	failed   []time.Duration // Start of each failed request relative to the run's first
+}
+
+// compareMetric is the latency statistic compared per bucket.
+type compareMetric struct {
+	name string
+	pct  float64 // Percentile, or 0 for the average
+}
+
+// value computes the metric over durations using the nearest-rank method.
+func (m compareMetric) value(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	if m.pct == 0 {
+		var total time.Duration
+		for _, d := range durations {
+			total += d
+		}
+		return total / time.Duration(len(durations))
+	}
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return PercentileNearestRank.percentile(sorted, m.pct)
+}
+
+// parseCompareMetric parses a -metric value: avg or pNN, e.g. p95.
+func parseCompareMetric(s string) (compareMetric, error) {
+	if s == "avg" {
+		return compareMetric{name: s}, nil
+	}
+	if strings.HasPrefix(s, "p") {
+		pct, err := strconv.ParseFloat(s[1:], 64)
+		if err == nil && pct > 0 && pct <= 100 {
+			return compareMetric{name: s, pct: pct}, nil
+		}
+	}
+	return compareMetric{}, fmt.Errorf("invalid -metric value %q, expected avg or a percentile such as p95", s)
+}
+
+// compareBucket holds both runs' figures for one slice of time.
+type compareBucket struct {
+	start              time.Duration
+	base, cand         time.Duration // Metric value, 0 without successful requests
+	baseN, candN       int           // Successful requests
+	baseErrs, candErrs int           // Failed requests
+	deltaPct           float64       // Change from base to cand in percent, NaN if not comparable
+	diverged           bool
+}
+
+// runCompareCommand implements `compare [flags] baseline candidate`.
+func runCompareCommand(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	bucket := fs.Duration("bucket", time.Second, "Width of the time buckets the runs are compared in")
+	metricFlag := fs.String("metric", "p95", "Latency statistic compared per bucket: avg or a percentile such as p95")
+	thresholdFlag := fs.String("threshold", "20%", "Latency change per bucket reported as a divergence")
+	csvOut := fs.Bool("csv", false, "Emit the per-bucket comparison as CSV instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("compare: expected a baseline and a candidate result file, got %d arguments", fs.NArg())
+	}
+	if *bucket <= 0 {
+		return fmt.Errorf("compare: -bucket must be > 0, got %s", *bucket)
+	}
+	metric, err := parseCompareMetric(*metricFlag)
+	if err != nil {
+		return fmt.Errorf("compare: %w", err)
+	}
+	threshold, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(*thresholdFlag), "%"), 64)
+	if err != nil || threshold <= 0 {
+		return fmt.Errorf("compare: invalid -threshold value %q, expected a percentage such as 20%%", *thresholdFlag)
+	}
+
+	base, err := loadRawRun(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("compare: %w", err)
+	}
+	cand, err := loadRawRun(fs.Arg(1))
+	if err != nil {
+		return fmt.Errorf("compare: %w", err)
+	}
+
+	buckets := compareRuns(base, cand, *bucket, metric, threshold)
+	if *csvOut {
+		return writeCompareCSV(os.Stdout, buckets)
+	}
+	printComparison(os.Stdout, base, cand, buckets, *bucket, metric, threshold)
+	return nil
+}
+
+// loadRawRun reads a raw result file. Cancelled and chaos requests are
+// left out, as they are in the summary's latency figures.
+func loadRawRun(path string) (*rawRun, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading result file: %w", err)
+	}
+	defer f.Close()
+
+	all, err := readRawResults(f, path)
+	if err != nil {
+		return nil, err
+	}
+	var results []rawResult
+	for _, r := range all {
+		if !r.Cancelled && r.Chaos == "" {
+			results = append(results, r)
+		}
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("%s contains no results", path)
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Time.Before(results[j].Time) })
+	first := results[0].Time
+	run := &rawRun{
+		path:     path,
+		requests: len(results),
+		duration: results[len(results)-1].Time.Sub(first),
+	}
+	for _, r := range results {
+		offset := r.Time.Sub(first)
+		if r.Error != "" {
+			run.errors++
+			run.failed = append(run.failed, offset)
+			continue
+		}
+		run.offsets = append(run.offsets, offset)
+		run.latency = append(run.latency, time.Duration(r.LatencyMs*float64(time.Millisecond)))
+	}
+	return run, nil
+}
+
+// compareRuns cuts both runs into buckets of the given width, aligned to
+// each run's first request, and computes the metric delta per bucket.
+func compareRuns(base, cand *rawRun, width time.Duration, metric compareMetric, threshold float64) []compareBucket {
+	n := int(max(base.duration, cand.duration)/width) + 1
+	baseLat, candLat := make([][]time.Duration, n), make([][]time.Duration, n)
+	for i, offset := range base.offsets {
+		baseLat[offset/width] = append(baseLat[offset/width], base.latency[i])
+	}
+	for i, offset := range cand.offsets {
+		candLat[offset/width] = append(candLat[offset/width], cand.latency[i])
+	}
+
+	buckets := make([]compareBucket, n)
+	for i := range buckets {
+		b := &buckets[i]
+		b.start = time.Duration(i) * width
+		b.base, b.baseN = metric.value(baseLat[i]), len(baseLat[i])
+		b.cand, b.candN = metric.value(candLat[i]), len(candLat[i])
+		b.deltaPct = math.NaN()
+		if b.baseN > 0 && b.candN > 0 && b.base > 0 {
+			b.deltaPct = float64(b.cand-b.base) / float64(b.base) * 100
+			b.diverged = b.baseN >= compareMinSamples && b.candN >= compareMinSamples &&
+				math.Abs(b.deltaPct) >= threshold
+		}
+	}
+	for _, offset := range base.failed {
+		buckets[offset/width].baseErrs++
+	}
+	for _, offset := range cand.failed {
+		buckets[offset/width].candErrs++
+	}
+	return buckets
+}
+
+// printComparison prints the per-bucket comparison as a table with a bar
+// per delta, followed by where the runs diverged.
+func printComparison(w io.Writer, base, cand *rawRun, buckets []compareBucket, width time.Duration, metric compareMetric, threshold float64) {
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	fmt.Fprintln(w, " Run Comparison")
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	fmt.Fprintf(w, "Baseline:    %s (%d requests, %d errors, %s)\n", base.path, base.requests, base.errors, formatDuration(base.duration))
+	fmt.Fprintf(w, "Candidate:   %s (%d requests, %d errors, %s)\n", cand.path, cand.requests, cand.errors, formatDuration(cand.duration))
+	fmt.Fprintf(w, "Compared:    %s latency per %s since each run's first request\n", metric.name, width)
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "  %8s  %10s  %10s  %8s  %6s\n", "Time", "Baseline", "Candidate", "Delta", "Errors")
+	for _, b := range buckets {
+		fmt.Fprintf(w, "  %8s  %10s  %10s  %8s  %6s  %s\n",
+			b.start, bucketValue(b.base, b.baseN), bucketValue(b.cand, b.candN),
+			formatDelta(b.deltaPct), fmt.Sprintf("%d/%d", b.baseErrs, b.candErrs), deltaBar(b))
+	}
+	fmt.Fprintln(w, "  (Errors as baseline/candidate; █ slower, ░ faster, ◀ beyond the threshold)")
+
+	fmt.Fprintln(w)
+	overall := formatDelta(float64(metric.value(cand.latency)-metric.value(base.latency)) / float64(metric.value(base.latency)) * 100)
+	fmt.Fprintf(w, "Overall %s:  %s → %s (%s)\n", metric.name, formatDuration(metric.value(base.latency)), formatDuration(metric.value(cand.latency)), overall)
+
+	// Find the diverged buckets and their longest consecutive stretch.
+	first, longestStart, longestEnd, count := -1, 0, 0, 0
+	for i := 0; i < len(buckets); i++ {
+		if !buckets[i].diverged {
+			continue
+		}
+		j := i
+		for j+1 < len(buckets) && buckets[j+1].diverged {
+			j++
+		}
+		count += j - i + 1
+		if first < 0 {
+			first, longestStart, longestEnd = i, i, j
+		} else if j-i > longestEnd-longestStart {
+			longestStart, longestEnd = i, j
+		}
+		i = j
+	}
+	if first < 0 {
+		fmt.Fprintf(w, "Divergence:  none (no bucket changed by %g%% or more)\n", threshold)
+		return
+	}
+	fmt.Fprintf(w, "Divergence:  %d of %d buckets changed by %g%% or more, first at %s\n", count, len(buckets), threshold, buckets[first].start)
+	fmt.Fprintf(w, "             longest stretch %s to %s\n", buckets[longestStart].start, buckets[longestEnd].start+width)
+}
+
+// bucketValue formats a bucket's metric, or "-" when it had no successful
+// requests.
+func bucketValue(d time.Duration, n int) string {
+	if n == 0 {
+		return "-"
+	}
+	return formatDuration(d)
+}
+
+// formatDelta formats a change in percent with its sign, or "-" for NaN.
+func formatDelta(pct float64) string {
+	if math.IsNaN(pct) || math.IsInf(pct, 0) {
+		return "-"
+	}
+	return fmt.Sprintf("%+.1f%%", pct)
+}
+
+// deltaBar draws a bucket's delta as a bar, marking divergences.
+func deltaBar(b compareBucket) string {
+	if math.IsNaN(b.deltaPct) {
+		return ""
+	}
+	char := "█"
+	if b.deltaPct < 0 {
+		char = "░"
+	}
+	bar := strings.Repeat(char, min(int(math.Abs(b.deltaPct)/compareBarScale), compareBarMax))
+	if b.diverged {
+		bar += " ◀"
+	}
+	return bar
+}
+
+// writeCompareCSV writes the per-bucket comparison as CSV, e.g. for
+// plotting in a spreadsheet.
+func writeCompareCSV(w io.Writer, buckets []compareBucket) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"offset_s", "baseline_ms", "candidate_ms", "delta_pct",
+		"baseline_requests", "candidate_requests", "baseline_errors", "candidate_errors", "diverged"})
+	for _, b := range buckets {
+		delta := ""
+		if !math.IsNaN(b.deltaPct) {
+			delta = strconv.FormatFloat(b.deltaPct, 'f', 2, 64)
+		}
+		cw.Write([]string{
+			strconv.FormatFloat(b.start.Seconds(), 'f', -1, 64),
+			strconv.FormatFloat(ms(b.base), 'f', 3, 64),
+			strconv.FormatFloat(ms(b.cand), 'f', 3, 64),
+			delta,
+			strconv.Itoa(b.baseN), strconv.Itoa(b.candN),
+			strconv.Itoa(b.baseErrs), strconv.Itoa(b.candErrs),
+			strconv.FormatBool(b.diverged),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
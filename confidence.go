@@ -0,0 +1,63 @@
+// confidence.go implements the minimum sample guard of -min-samples. A
+// percentile is only as good as the samples beyond it: the P99 of 100
+// requests is the single slowest one, and that of 50 requests is simply
+// the maximum. Percentiles that fewer than -min-samples samples lie beyond
+// are flagged as low-confidence in the reports instead of being presented
+// like the others.
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// defaultMinSamples is the default of -min-samples.
+const defaultMinSamples = 10
+
+// tailSamples returns how many of n samples lie beyond their nearest-rank
+// percentile pct.
+func tailSamples(n int, pct float64) int {
+	return n - int(math.Ceil(pct/100*float64(n)))
+}
+
+// confidenceNote returns why percentile pct of s is low-confidence, or ""
+// if enough samples back it or s was not checked.
+func confidenceNote(s Summary, pct float64) string {
+	if s.MinSamples <= 0 || s.Samples == 0 {
+		return ""
+	}
+	beyond := tailSamples(s.Samples, pct)
+	if beyond >= s.MinSamples {
+		return ""
+	}
+	return fmt.Sprintf("low confidence: %d of %d samples beyond it, -min-samples %d", beyond, s.Samples, s.MinSamples)
+}
+
+// lowConfidencePercentiles returns the reported percentiles of s that are
+// low-confidence, keyed "p99" etc., in increasing order.
+func lowConfidencePercentiles(s Summary) []string {
+	pcts := []float64{50, 90, 95, 99}
+	for _, p := range s.Percentiles {
+		pcts = append(pcts, p.Percentile)
+	}
+	sort.Float64s(pcts)
+	var keys []string
+	for i, p := range pcts {
+		if (i > 0 && p == pcts[i-1]) || confidenceNote(s, p) == "" {
+			continue
+		}
+		keys = append(keys, "p"+strconv.FormatFloat(p, 'g', -1, 64))
+	}
+	return keys
+}
+
+// withConfidence returns the formatted duration d of percentile pct of s,
+// followed by the confidence note, if any, in parentheses.
+func withConfidence(s Summary, pct float64, d string) string {
+	if note := confidenceNote(s, pct); note != "" {
+		return d + "  (" + note + ")"
+	}
+	return d
+}
@@ -6,34 +6,253 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
 // Config holds all configuration for a load test run.
 type Config struct {
-	URL          string            // Target URL to test
-	NumRequests  int               // Total number of requests to send
-	Concurrency  int               // Number of concurrent workers
-	Method       string            // HTTP method: GET, POST, PUT, DELETE
-	Timeout      time.Duration     // Per-request timeout
-	Headers      map[string]string // Custom HTTP headers
-	Body         string            // Request body for POST/PUT
-	ScenarioFile string            // Path to scenario JSON file (multi-step mode)
+	URL            string            // Target URL to test
+	NumRequests    int               // Total number of requests to send
+	Concurrency    int               // Number of concurrent workers
+	Rate           float64           // Requests per second across all workers, 0 for as fast as possible
+	Profile        *Profile          // Staged load profile replacing -n and -rate, nil for none
+	Pattern        *PatternSpec      // Load pattern replacing -n and -rate, nil for none
+	Method         string            // HTTP method: GET, POST, PUT, DELETE
+	Timeout        time.Duration     // Per-request timeout
+	Headers        map[string]string // Custom HTTP headers
+	Body           string            // Request body, sent with methods other than GET, HEAD, OPTIONS and TRACE
+	ScenarioFile   string            // Path to scenario JSON file (multi-step mode)
+	ConfigFiles    []string          // Test definition files run concurrently (multi-test mode)
+	RecordFile     string            // Raw result file written during the run, "" for none
+	RecordRequests bool              // Write each request as sent to RecordFile, for replay-request
+	Label          string            // Logical endpoint name results are grouped by, "" for none
+	Stop           StopConditions    // Response-based conditions that end the test early
+	Assertions     *Assertions       // Checks every response must pass to count as successful, nil for none
+	FailOn         *statusSet        // Statuses counted as failed requests, nil for none
+	Repeat         int               // Number of times the test is run, 1 for once
+	RepeatPause    time.Duration     // Pause between repeated runs
+
+	// AutoConcurrency probes for the number of workers before the test,
+	// up to Concurrency, and runs the test at the throughput knee.
+	AutoConcurrency bool
+
+	// MaxMemory bounds the memory of the run, in bytes, 0 for no bound:
+	// timings are kept in histograms only and the run ends early before
+	// the heap reaches it.
+	MaxMemory int64
+
+	// Stream enables streaming verification: response bodies are timed
+	// chunk by chunk instead of being drained in one go.
+	Stream bool
+
+	// CI enables the pipeline-friendly mode: no progress bar, JSON summary
+	// on stdout, everything else on stderr, non-zero exit on failure.
+	CI bool
+
+	// Output names the Formatter the results are written with; OutputFile,
+	// when set, receives them instead of stdout.
+	Output     string
+	OutputFile string
+
+	// Thresholds are pass/fail limits checked on the final summary.
+	Thresholds []Threshold
+	// Budgets are the performance budgets of -budgets, nil if none.
+	Budgets *Budgets
+	// SLA declares latency buckets whose shares of requests are reported.
+	SLA []SLA
+	// Baseline is the summary of an earlier run loaded from -baseline,
+	// which reports compare against; nil if not set.
+	Baseline *Summary
+
+	// BrowserMode caps connections per host at BrowserConns and sends
+	// browser-like headers with every request.
+	BrowserMode  bool
+	BrowserConns int
+
+	// MaxConnRate caps new connections per second, 0 for no limit.
+	MaxConnRate float64
+
+	// DisableKeepAlive opens a new connection for every request, and
+	// MaxConnsPerHost caps the connections per host, 0 for no cap.
+	DisableKeepAlive bool
+	MaxConnsPerHost  int
+
+	// Data is the -data CSV feed of {{$csv(column)}} placeholders, nil if
+	// there is none.
+	Data *dataFeed
+
+	// ValueReport counts the values random placeholders render to, for the
+	// generated value report.
+	ValueReport bool
+
+	// Seed seeds the random values and picks of every request from the
+	// request index, so that runs with the same seed send the same
+	// requests; 0 for an unseeded run.
+	Seed int64
+
+	// Templates is what the templates of this configuration, a -scenario
+	// file's included, are parsed with.
+	Templates *templateContext
+
+	// ProgressInterval is how often the progress line is redrawn, 0 for
+	// defaultProgressInterval.
+	ProgressInterval time.Duration
+
+	// HTTPVersion selects the protocols requests are sent over
+	// (httpVersion11, httpVersion2 or httpVersionAuto).
+	HTTPVersion string
+
+	// TLS configures the TLS handshakes of the requests, nil for Go's
+	// defaults.
+	TLS *TLSSettings
+
+	// Proxy is the forward proxy of the requests: a proxy URL, proxyNone
+	// for direct connections, or "" for the proxy of the environment.
+	Proxy string
+
+	// ClientProfiles, when set, gives every virtual user a client profile
+	// whose headers its requests carry.
+	ClientProfiles *ClientProfiles
+
+	// Cancel injects client-side cancellation of a fraction of requests.
+	Cancel CancelInjection
+
+	// Chaos replaces a fraction of requests by malformed ones.
+	Chaos ChaosMode
+
+	// Retry retries failed requests; IdempotencyHeader, when set, names a
+	// header carrying a per-request key that is kept across retries.
+	Retry             RetryPolicy
+	IdempotencyHeader string
+
+	// HeaderTemplates holds the -header flags in order, with placeholders
+	// allowed in both names and values.
+	HeaderTemplates []headerTemplate
+	// HeaderFuzz adds oversized or unusual headers to a fraction of requests.
+	HeaderFuzz HeaderFuzz
+
+	// ClockSync selects how the client's clock offset is measured before
+	// the run, for correlating reported timestamps with server logs.
+	ClockSync ClockSync
+
+	// Percentile selects how summary percentiles are computed.
+	Percentile PercentileMethod
+	// Percentiles lists the latency percentiles to report, nil for the
+	// defaults (P50, P90, P95 and P99).
+	Percentiles []float64
+	// MinSamples is the number of samples beyond a percentile below which
+	// the reports flag it as low-confidence, 0 to flag none.
+	MinSamples int
+	// Histogram is the number of latency histogram buckets in the text
+	// summary, 0 for no histogram.
+	Histogram int
+	// StatsD receives the metrics of every request, nil without -statsd.
+	StatsD *StatsD
+	// FailureManifest keeps the failed requests as sent, nil without
+	// -failure-manifest.
+	FailureManifest *FailureManifest
+	// TimeSeries is the interval of the time-series results, 0 for none.
+	TimeSeries time.Duration
+	// Exporters receive the results every ExportInterval while the run is
+	// in progress, and the final summary.
+	Exporters      []NamedExporter
+	ExportInterval time.Duration
+	// SpikeWindow is the width of the windows latency extremes are tracked
+	// in; windows whose max latency exceeds SpikeThreshold (if > 0) are
+	// counted as spikes.
+	SpikeWindow    time.Duration
+	SpikeThreshold time.Duration
+
+	// HonorRetryAfter pauses a worker when it receives a 429/503 response
+	// carrying Retry-After, for at most RetryAfterMax.
+	HonorRetryAfter bool
+	RetryAfterMax   time.Duration
 
 	// BodyTemplate is the parsed template for the request body. When it
 	// contains dynamic placeholders, each request gets a unique body.
 	BodyTemplate *Template
+	// Form, when set, replaces the body by a multipart form.
+	Form *Form
+	// Batch, when set, sends several renderings of the body template in
+	// every request body.
+	Batch *Batch
 	// URLTemplate is the parsed template for the target URL. When it
 	// contains dynamic placeholders, each request targets a unique URL.
 	URLTemplate *Template
+	// MethodMix, when set, overrides Method: each request picks its method
+	// (and body) at random according to the mix weights.
+	MethodMix *MethodMix
+	// Endpoints, when set, replaces URL, Method and Body: each request
+	// picks one of its endpoints at random according to their weights.
+	Endpoints *EndpointMix
+	// Mirror, when set, copies a share of the requests to a second target
+	// with shadow stats of its own.
+	Mirror *Mirror
+	// Pause, when set, lets another goroutine hold request dispatch. It is
+	// not bound to a flag; distributed agents set it so the controller can
+	// pause their runs.
+	Pause *PauseGate
+}
+
+// validMethod reports whether method is a syntactically valid HTTP method,
+// a token of letters, digits and the symbols RFC 9110 allows. Methods
+// beyond the standard ones, such as WebDAV's PROPFIND, are accepted.
+func validMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for _, c := range method {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// methodSendsBody reports whether requests of method carry the configured
+// body. GET, HEAD, OPTIONS and TRACE requests go without, so a -body meant
+// for the writes of a method mix is not attached to its reads.
+func methodSendsBody(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
+
+// loadBody returns the request body given by -body or -body-file. As with
+// curl's -d, a -body starting with @ names the file to read instead.
+func loadBody(body, bodyFile string) (string, error) {
+	if strings.HasPrefix(body, "@") {
+		if bodyFile != "" {
+			return "", fmt.Errorf("-body @file and -body-file are mutually exclusive")
+		}
+		bodyFile = body[1:]
+		if bodyFile == "" {
+			return "", fmt.Errorf("-body @ needs a file name, as in -body @payload.json")
+		}
+	} else if body != "" && bodyFile != "" {
+		return "", fmt.Errorf("-body and -body-file are mutually exclusive")
+	}
+	if bodyFile == "" {
+		return body, nil
+	}
+	data, err := os.ReadFile(bodyFile)
+	if err != nil {
+		return "", fmt.Errorf("reading body file: %w", err)
+	}
+	return string(data), nil
 }
 
 // headerFlags is a custom flag type that allows multiple -header flags.
 // It implements the flag.Value interface so the flag package can accumulate
-// repeated -header values into a single slice.
+// repeated -header values into a single slice. It is also used for other
+// repeatable string flags such as -method-body.
 type headerFlags []string
 
 // String returns a string representation of the collected headers.
@@ -50,122 +269,874 @@ func (h *headerFlags) Set(value string) error {
 // ParseConfig parses command-line flags and returns a validated Config.
 // It returns an error with a clear message if any validation fails.
 func ParseConfig() (*Config, error) {
+	return parseConfigArgs(os.Args[1:])
+}
+
+// parseConfigArgs parses and validates load test flags from args. It lets
+// subcommands (e.g. the distributed controller) build a Config from their
+// arguments. Invalid flags are reported together in a *ValidationError.
+func parseConfigArgs(args []string) (*Config, error) {
+	return parseForwardedConfigArgs(args, nil)
+}
+
+// parseForwardedConfigArgs is parseConfigArgs for the arguments a
+// controller forwarded to an agent, which are checked against limits
+// before any file is touched. Local arguments have nil limits.
+func parseForwardedConfigArgs(args []string, limits *forwardLimits) (*Config, error) {
 	fs := flag.NewFlagSet("load-tester", flag.ContinueOnError)
 
 	urlFlag := fs.String("url", "", "Target URL to load test (required)")
 	numRequests := fs.Int("n", 100, "Total number of requests to send")
 	concurrency := fs.Int("c", 10, "Number of concurrent workers (1-100)")
-	method := fs.String("method", "GET", "HTTP method: GET, POST, PUT, DELETE")
+	autoConcurrency := fs.Bool("auto-concurrency", false, "Probe 1, 2, 4, ... workers before the test and run it at the throughput knee; -c, if set, caps the probe (default 100)")
+	rateLimit := fs.Float64("rate", 0, "Limit throughput to this many requests per second across all workers (0 = unlimited)")
+	profileFile := fs.String("profile", "", "JSON file of load stages, each with a duration and a rate, run one after another")
+	patternFlag := fs.String("pattern", "", "Traffic shape replacing -n and -rate, as NAME:PARAMS with NAME one of "+strings.Join(loadPatternNames(), ", ")+", e.g. ramp:10,200,5m")
+	method := fs.String("method", "GET", "HTTP method: GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS or any other method name")
 	timeout := fs.String("timeout", "10s", "Per-request timeout (e.g. 5s, 500ms)")
-	body := fs.String("body", "", "Request body for POST/PUT requests")
+	body := fs.String("body", "", "Request body (not sent with GET, HEAD, OPTIONS or TRACE); @FILE reads it from FILE")
+	bodyFile := fs.String("body-file", "", "Read the request body from this file; placeholders in it are rendered per request")
 	scenarioFile := fs.String("scenario", "", "Path to scenario JSON file for multi-step load testing")
+	stopBody := fs.String("stop-when-body-contains", "", "Stop the test when a response body contains this substring")
+	stopConsecutive := fs.String("stop-after-consecutive", "", "Stop the test after N consecutive responses with a status, as 'STATUS:N' (e.g. 429:10)")
+	failOn5xx := fs.Bool("fail-on-5xx", false, "Count 5xx responses as failed requests and exit non-zero if any request failed")
+	failOn4xx := fs.Bool("fail-on-4xx", false, "Count 4xx responses as failed requests and exit non-zero if any request failed")
+	failOnStatus := fs.String("fail-on-status", "", "Count responses with these statuses as failed requests and exit non-zero if any request failed, e.g. 429,503 or 5xx")
+	assertStatus := fs.String("assert-status", "", "Count responses as failed unless their status is in this list of codes and classes, e.g. 200,204 or 2xx,304")
+	var assertContains, assertRegex, assertJSON headerFlags
+	fs.Var(&assertContains, "assert-body-contains", "Count responses as failed unless their body contains this substring (can be repeated)")
+	fs.Var(&assertRegex, "assert-body-regex", "Count responses as failed unless their body matches this regular expression (can be repeated)")
+	fs.Var(&assertJSON, "assert-json", "Count responses as failed unless the JSON body has this value at a path, as 'PATH=VALUE' (e.g. status=ok, can be repeated)")
+
+	honorRetryAfter := fs.Bool("honor-retry-after", false, "Pause a worker for the Retry-After delay of 429/503 responses")
+	retryAfterMax := fs.String("retry-after-max", "30s", "Maximum pause when honoring Retry-After")
+
+	stream := fs.Bool("stream", false, "Streaming mode: record time-to-first-chunk, inter-chunk gaps and stream duration")
+	ci := fs.Bool("ci", false, "CI mode: no progress bar, JSON summary on stdout, logs on stderr, non-zero exit on failure")
+	progressEvery := fs.Duration("progress-interval", defaultProgressInterval, "How often the progress line is redrawn; raise it at very high request rates")
+	outputFile := fs.String("output-file", "", "Write the results to this file instead of stdout")
+	output := fs.String("output", "", "Results format: "+strings.Join(formatterNames(), ", ")+" (default text, or json with -ci)")
+	browserMode := fs.Bool("browser-mode", false, "Emulate a browser: cap connections per host and send browser-like headers")
+	browserConns := fs.Int("browser-conns", defaultBrowserConns, "Maximum connections per host in -browser-mode")
+	httpFlag := fs.String("http", httpVersion11, "HTTP protocol: 1.1, 2 (over TLS, or h2c with prior knowledge over http://) or auto (HTTP/2 where TLS negotiates it)")
+	http3 := fs.Bool("http3", false, "Not supported: HTTP/3 would need quic-go, and the tool uses the standard library only")
+	insecure := fs.Bool("insecure", false, "Skip TLS certificate verification")
+	certFile := fs.String("cert", "", "Client certificate PEM file for mutual TLS, with -key")
+	keyFile := fs.String("key", "", "Private key PEM file of -cert")
+	caFile := fs.String("ca", "", "CA bundle PEM file to verify the server with instead of the system roots")
+	tlsMinVersion := fs.String("tls-min-version", "", "Lowest TLS version to negotiate: 1.0, 1.1, 1.2 or 1.3 (default Go's, 1.2)")
+	tlsCiphers := fs.String("tls-ciphers", "", "Comma-separated TLS 1.0-1.2 cipher suites to offer, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+	proxyFlag := fs.String("proxy", "", "Forward proxy URL (http://, https:// or socks5://), or none to ignore HTTP_PROXY and HTTPS_PROXY (default from the environment)")
+	clientProfilesFile := fs.String("client-profiles", "", "JSON file of client profiles (User-Agent, Accept-Language, headers) rotated across virtual users")
+	maxConnRate := fs.String("max-conn-rate", "", "Open at most this many new connections per second, e.g. 100/s or 600/m (default unlimited)")
+	disableKeepAlive := fs.Bool("disable-keepalive", false, "Open a new connection for every request instead of reusing pooled ones")
+	maxConnsPerHost := fs.Int("max-conns-per-host", 0, "Maximum connections per host, requests beyond it wait for a free one (0 = unlimited)")
+	var generatorPlugins headerFlags
+	fs.Var(&generatorPlugins, "generator-plugin", "Go plugin (.so) registering template generators of its own through a Generators variable (can be repeated)")
+	jwtSecret := fs.String("jwt-secret", "", "Key {{$jwt(claims)}} tokens are signed with using HS256 (default $"+jwtSecretEnv+")")
+	dataFile := fs.String("data", "", "CSV file whose columns templates read as {{$csv(column)}}, one row per request; the first row names the columns")
+	valueReport := fs.Bool("value-report", false, "Report the distribution of the values random placeholders generated (buckets for numbers, top values for picks)")
+	templateEngine := fs.String("template-engine", engineBuiltin, "Template language of URLs, headers and bodies: builtin ({{$uuid}} placeholders) or go (text/template with {{uuid}} functions)")
+	dataOrder := fs.String("data-order", dataOrderCycle, "Order in which requests take the -data rows: cycle or random")
+	seed := fs.Int64("seed", 0, "Seed random placeholders and picks so that runs with the same seed send the same requests (0 = random)")
+	methodMix := fs.String("method-mix", "", "Weighted method mix, e.g. 'GET:80,POST:20' (overrides -method)")
+	percentilesFlag := fs.String("percentiles", "50,90,95,99", "Comma-separated latency percentiles to report, e.g. 50,90,99,99.9")
+	percentileFlag := fs.String("percentile", "nearest-rank", "Percentile method: nearest-rank or linear (interpolated)")
+	spikeWindow := fs.String("spike-window", defaultSpikeWindow.String(), "Width of the windows in which max/min latency is tracked")
+	statsdAddr := fs.String("statsd", "", "Send per-request latency timers and counters to this StatsD/DogStatsD HOST:PORT over UDP while the test runs")
+	timeSeries := fs.String("timeseries", "", "Report requests, error rate and latency per interval of this length, e.g. 1s (default off)")
+	exportInterval := fs.String("export-interval", defaultExportInterval.String(), "Interval at which results are sent to the -export exporters")
+	minSamples := fs.Int("min-samples", defaultMinSamples, "Flag percentiles that fewer than this many samples lie beyond as low-confidence in the reports (0 = never)")
+	histogram := fs.Int("histogram", defaultHistogramBuckets, "Number of latency histogram buckets in the text summary, 0 to omit the histogram")
+	maxMemory := fs.String("max-memory", "", "Bound the memory of the run (e.g. 512MB): keep every timing in histograms and end the run early, with its summary, before the heap reaches the limit")
+	spikeThreshold := fs.String("spike-threshold", "", "Count windows whose max latency exceeds this duration (e.g. 500ms)")
+	cancelRate := fs.String("cancel-rate", "", "Abort this percentage of requests mid-flight, e.g. 5% (client disconnect testing)")
+	cancelAfter := fs.String("cancel-after", defaultCancelAfter.String(), "Maximum delay before an injected cancellation")
+	chaosRate := fs.String("chaos", "", "Replace this percentage of requests by malformed ones, e.g. 2% (robustness testing)")
+	chaosKindsFlag := fs.String("chaos-kinds", strings.Join(chaosKinds, ","), "Kinds of malformed request for -chaos: content-length, utf8, headers")
+	headerFuzz := fs.String("header-fuzz", "", "Add fuzzed headers to this percentage of requests, e.g. 5% (header limit probing)")
+	fuzzKindsFlag := fs.String("header-fuzz-kinds", strings.Join(headerFuzzKinds, ","), "Kinds of header fuzzing: long-header, many-headers, header-names")
+	headerFuzzSize := fs.Int("header-fuzz-size", defaultFuzzHeaderSize, "Length in bytes of the value of a long-header request")
+	headerFuzzCount := fs.Int("header-fuzz-count", defaultFuzzHeaderCount, "Number of headers added to a many-headers request")
+
+	retries := fs.Int("retries", 0, "Retry requests failing with an error, 429 or 5xx up to N times")
+	retryBackoff := fs.String("retry-backoff", defaultRetryBackoff.String(), "Delay before the first retry, doubled for each further one")
+	idempotencyHeader := fs.String("idempotency-header", "", "Send a per-request key kept across retries in this header, e.g. Idempotency-Key")
+	endpointsFile := fs.String("endpoints", "", "JSON file of weighted endpoints (name, method, url, headers, body, weight) mixed in one run, instead of -url")
+	mirrorTo := fs.String("mirror-to", "", "Also send a copy of requests to this base URL, e.g. a canary, with separate shadow stats")
+	mirrorPercent := fs.String("mirror-percent", "100%", "Percentage of requests copied to -mirror-to")
+	mirrorDiff := fs.String("mirror-diff", "", "Compare each response with the mirror's response to its copy on these fields: status, body (comma-separated)")
+	var mirrorDiffJSON headerFlags
+	fs.Var(&mirrorDiffJSON, "mirror-diff-json", "Compare the value at this JSON path of each response with the mirror's response to its copy (can be repeated)")
+	label := fs.String("label", "", "Logical endpoint name to group the results by in every output, e.g. checkout")
+	record := fs.String("record", "", "Write every request's result to this file as JSON lines (for the compare subcommand)")
+	recordRequests := fs.Bool("record-requests", false, "Also write each request as sent to the -record file (for the replay-request subcommand)")
+	failureManifestFile := fs.String("failure-manifest", "", "Write the first 1000 failed requests as sent, with the values they were rendered from, to this JSON lines file (for the replay-request subcommand)")
+	repeat := fs.Int("repeat", 1, "Run the test this many times and report the mean and standard deviation of the key metrics across runs")
+	repeatPause := fs.Duration("repeat-pause", 0, "Pause between the runs of -repeat, e.g. 30s")
+	clockSync := fs.String("clock-sync", "", "Measure the client clock offset before the run: ntp, ntp:HOST[:PORT] or date (target's Date header)")
 
 	var headers headerFlags
 	fs.Var(&headers, "header", "Custom header in 'Key: Value' format (can be repeated)")
+	batchSize := fs.Int("batch-size", 0, "Render the body template this many times per request and send the records together (0 = off)")
+	batchFormat := fs.String("batch-format", batchNDJSON, "How -batch-size records are joined: ndjson (one per line) or array (a JSON array)")
+	var formValues, formFiles headerFlags
+	fs.Var(&formValues, "form", "Multipart form field in 'NAME=VALUE' format, the value may contain placeholders (can be repeated)")
+	fs.Var(&formFiles, "form-file", "File uploaded as a multipart form field, in 'NAME=PATH' format (can be repeated)")
+	var methodBodies headerFlags
+	fs.Var(&methodBodies, "method-body", "Body for one method of -method-mix in 'METHOD:body' format (can be repeated)")
+	var thresholdFlags headerFlags
+	var exportFlags headerFlags
+	fs.Var(&exportFlags, "export", "Send the results to an exporter while the run is in progress, as NAME=TARGET with NAME one of "+strings.Join(exporterNames(), ", ")+" (can be repeated)")
+	influxURL := fs.String("influx-url", "", "Write the results to the InfluxDB server at this URL while the run is in progress, e.g. http://localhost:8086")
+	influxBucket := fs.String("influx-bucket", "", "InfluxDB bucket (or database for InfluxDB 1.x) written to by -influx-url")
+	influxOrg := fs.String("influx-org", os.Getenv("INFLUX_ORG"), "InfluxDB 2.x organization of -influx-bucket (default $INFLUX_ORG)")
+	budgetsFile := fs.String("budgets", "", "JSON file of performance budgets (latency, error rate, RPS floor) per label to check the results against")
+	gateValues := make([]*string, len(gateFlags))
+	for i, g := range gateFlags {
+		gateValues[i] = fs.String(g.name, "", g.usage)
+	}
+	fs.Var(&thresholdFlags, "threshold", "Pass/fail limit on the summary such as 'p95<300ms', 'error_rate<1%' or 'rps>=100' (can be repeated)")
+	var slaFlags headerFlags
+	fs.Var(&slaFlags, "sla", "Latency buckets to report shares of, e.g. 'fast<100ms,ok<300ms,slow'; prefix LABEL= for one label (can be repeated)")
+	baselineFile := fs.String("baseline", "", "JSON summary of an earlier run (-output json) to compare the results against")
+	var configFiles headerFlags
+	fs.Var(&configFiles, "config", "Path to a test definition JSON file; repeat to run several tests concurrently")
 
-	if err := fs.Parse(os.Args[1:]); err != nil {
+	if err := fs.Parse(args); err != nil {
 		return nil, err
 	}
+	if limits != nil {
+		if err := limits.check(fs); err != nil {
+			return nil, err
+		}
+	}
 
 	// --- Validation ---
+	// Every problem is collected rather than returned as found, so all of
+	// them can be fixed in one pass.
+	var problems validationErrors
+
+	stop, err := parseStopConditions(*stopBody, *stopConsecutive)
+	if err != nil {
+		problems.add(err)
+	}
+
+	// The engine is chosen, the feed loaded, the JWT key and seed set and
+	// the generator plugins loaded before any template is parsed:
+	// templates, including those of a -scenario file, are parsed with the
+	// context tc of this configuration, whose engine they use, whose feed
+	// their {{$csv(column)}} placeholders bind to, whose key their {{$jwt}}
+	// placeholders sign with and whose seed {{$uuid}} follows, and plugin
+	// placeholders resolve.
+	if err := loadGeneratorPlugins(generatorPlugins); err != nil {
+		problems.add(err)
+	}
+	engine, err := parseTemplateEngine(*templateEngine)
+	if err != nil {
+		problems.add(err)
+		engine = engineBuiltin
+	}
+	var data *dataFeed
+	if *dataFile != "" {
+		if data, err = loadDataFeed(*dataFile, *dataOrder); err != nil {
+			problems.add(err)
+		}
+	}
+	if data != nil && *seed != 0 {
+		data.seedWith(*seed)
+	}
+	tc := &templateContext{engine: engine, feed: data, jwtKey: jwtKey(*jwtSecret), seed: *seed, noLocalReads: limits != nil && !limits.allowReads}
+
+	assertions, err := parseAssertions(*assertStatus, assertContains, assertRegex, assertJSON)
+	if err != nil {
+		problems.add(err)
+	}
+	failOn, err := parseFailOn(*failOn5xx, *failOn4xx, *failOnStatus)
+	if err != nil {
+		problems.addf("-fail-on-status: %w", err)
+	}
+
+	pctMethod, err := parsePercentileMethod(*percentileFlag)
+	if err != nil {
+		problems.add(err)
+	}
+	pcts, err := parsePercentiles(*percentilesFlag)
+	if err != nil {
+		problems.add(err)
+	}
+
+	spikeSize, spikeLimit, err := parseSpikeFlags(*spikeWindow, *spikeThreshold)
+	if err != nil {
+		problems.add(err)
+	}
+
+	outputFormat, err := parseOutputFormat(*output, *ci)
+	if err != nil {
+		problems.add(err)
+	}
+
+	var thresholds []Threshold
+	for _, expr := range thresholdFlags {
+		t, err := parseThreshold(expr)
+		if err != nil {
+			problems.add(err)
+			continue
+		}
+		thresholds = append(thresholds, t)
+	}
+	for i, g := range gateFlags {
+		if *gateValues[i] == "" {
+			continue
+		}
+		t, err := parseGate(g.name, g.metric, g.op, *gateValues[i])
+		if err != nil {
+			problems.add(err)
+			continue
+		}
+		thresholds = append(thresholds, t)
+	}
+
+	var budgets *Budgets
+	if *budgetsFile != "" {
+		if budgets, err = loadBudgets(*budgetsFile); err != nil {
+			problems.add(err)
+		}
+	}
+
+	var slas []SLA
+	slaLabels := make(map[string]bool)
+	for _, spec := range slaFlags {
+		sla, err := parseSLA(spec)
+		if err != nil {
+			problems.add(err)
+			continue
+		}
+		if slaLabels[sla.Label] {
+			problems.addf("more than one -sla for label %q", sla.Label)
+			continue
+		}
+		slaLabels[sla.Label] = true
+		slas = append(slas, sla)
+	}
+
+	var baseline *Summary
+	if *baselineFile != "" {
+		if baseline, err = loadBaseline(*baselineFile); err != nil {
+			problems.add(err)
+		}
+	}
+
+	clock, err := parseClockSync(*clockSync)
+	if err != nil {
+		problems.add(err)
+	}
+
+	connRate, err := parseConnRate(*maxConnRate)
+	if err != nil {
+		problems.add(err)
+	}
+
+	var clientProfiles *ClientProfiles
+	if *clientProfilesFile != "" {
+		if clientProfiles, err = loadClientProfiles(*clientProfilesFile); err != nil {
+			problems.add(err)
+		}
+	}
+
+	var failureManifest *FailureManifest
+	if *failureManifestFile != "" {
+		failureManifest = newFailureManifest(*failureManifestFile)
+	}
+	var statsd *StatsD
+	if *statsdAddr != "" {
+		if statsd, err = newStatsD(*statsdAddr); err != nil {
+			problems.add(err)
+		}
+	}
+
+	seriesSize, err := parseTimeSeriesInterval(*timeSeries)
+	if err != nil {
+		problems.add(err)
+	}
+
+	namedExporters := make([]NamedExporter, 0, len(exportFlags))
+	for _, e := range exportFlags {
+		ne, err := parseExport(e)
+		if err != nil {
+			problems.add(err)
+			continue
+		}
+		namedExporters = append(namedExporters, ne)
+	}
+	if *influxURL != "" {
+		target, err := influxWriteURL(*influxURL, *influxBucket, *influxOrg)
+		if err != nil {
+			problems.add(err)
+		} else if e, err := newInfluxExporter(target); err != nil {
+			problems.addf("invalid -influx-url: %w", err)
+		} else {
+			namedExporters = append(namedExporters, NamedExporter{Name: "influx", Target: target, Exporter: e})
+		}
+	} else if *influxBucket != "" {
+		problems.addf("-influx-bucket requires -influx-url")
+	}
+	exportEvery, err := time.ParseDuration(*exportInterval)
+	if err != nil || exportEvery <= 0 {
+		problems.addf("-export-interval must be a positive duration, got %q", *exportInterval)
+	}
+
+	maxMem, err := parseMaxMemory(*maxMemory)
+	if err != nil {
+		problems.add(err)
+	}
+	if *histogram < 0 {
+		problems.addf("-histogram must be >= 0, got %d", *histogram)
+	}
+	if *minSamples < 0 {
+		problems.addf("-min-samples must be >= 0, got %d", *minSamples)
+	}
+
+	if *browserConns < 1 {
+		problems.addf("-browser-conns must be >= 1, got %d", *browserConns)
+	}
+	if *maxConnsPerHost < 0 {
+		problems.addf("-max-conns-per-host must be >= 0, got %d", *maxConnsPerHost)
+	} else if *maxConnsPerHost > 0 && *browserMode {
+		problems.addf("-max-conns-per-host cannot be combined with -browser-mode, set -browser-conns instead")
+	}
+	httpVersion, err := parseHTTPVersion(*httpFlag)
+	if err != nil {
+		problems.add(err)
+	}
+	if *http3 {
+		problems.addf("-http3: %v", errHTTP3)
+	}
+	if clientProfiles.ordered() && httpVersion != httpVersion11 {
+		problems.addf("-client-profiles with header_order needs -http 1.1: Go's HTTP/2 client picks the header order itself")
+	}
+	tlsSettings, err := parseTLSSettings(*insecure, *certFile, *keyFile, *caFile, *tlsMinVersion, *tlsCiphers)
+	if err != nil {
+		problems.add(err)
+	}
+	proxy, err := parseProxy(*proxyFlag)
+	if err != nil {
+		problems.add(err)
+	}
+
+	maxPause, err := time.ParseDuration(*retryAfterMax)
+	if err != nil {
+		problems.addf("invalid -retry-after-max value %q: %w", *retryAfterMax, err)
+	} else if maxPause <= 0 {
+		problems.addf("-retry-after-max must be > 0, got %s", maxPause)
+	}
+
+	if *repeat < 1 {
+		problems.addf("-repeat must be >= 1, got %d", *repeat)
+	}
+	if *progressEvery <= 0 {
+		problems.addf("-progress-interval must be > 0, got %s", *progressEvery)
+	}
+	if *repeatPause < 0 {
+		problems.addf("-repeat-pause must be >= 0, got %s", *repeatPause)
+	}
+	if *repeat > 1 && (*record != "" || *failureManifestFile != "") {
+		problems.addf("-record and -failure-manifest are not supported with -repeat, every run would overwrite the file")
+	}
+
+	// Multi-test mode: each -config file defines its own test; only the
+	// reporting options on the command line apply.
+	if len(configFiles) > 0 {
+		visitUnusedFlags(fs, commandLineTestFlags, func(name string) {
+			if reason, ok := unsupportedTestFlags[name]; ok {
+				problems.addf("%s", reason)
+			} else {
+				problems.addf("set -%s in each -config file, not on the command line", name)
+			}
+		})
+		if err := problems.err(); err != nil {
+			return nil, err
+		}
+		return &Config{
+			ConfigFiles: configFiles,
+			CI:          *ci,
+			Output:      outputFormat,
+			OutputFile:  *outputFile,
+			Thresholds:  thresholds,
+			Budgets:     budgets,
+			SLA:         slas,
+			Baseline:    baseline,
+			ClockSync:   clock,
+			Percentile:  pctMethod,
+			Histogram:   *histogram,
+			Percentiles: pcts,
+			MinSamples:  *minSamples,
+			TimeSeries:  seriesSize,
+			MaxMemory:   maxMem,
+
+			Exporters:      namedExporters,
+			ExportInterval: exportEvery,
+
+			SpikeWindow:    spikeSize,
+			SpikeThreshold: spikeLimit,
+
+			ProgressInterval: *progressEvery,
+		}, nil
+	}
 
 	// Scenario mode: only need timeout, skip URL/method/body validation.
 	if *scenarioFile != "" {
+		visitUnusedFlags(fs, scenarioFlags, func(name string) {
+			if hint, ok := scenarioFlagHints[name]; ok {
+				problems.addf("-%s is not supported in scenario mode, %s", name, hint)
+			} else {
+				problems.addf("-%s is not supported in scenario mode", name)
+			}
+		})
 		dur, err := time.ParseDuration(*timeout)
 		if err != nil {
-			return nil, fmt.Errorf("validation error: invalid -timeout value %q: %w", *timeout, err)
+			problems.addf("invalid -timeout value %q: %w", *timeout, err)
+		}
+		if err := problems.err(); err != nil {
+			return nil, err
 		}
 		return &Config{
 			ScenarioFile: *scenarioFile,
 			Timeout:      dur,
+			Stop:         stop,
+			FailOn:       failOn,
+			CI:           *ci,
+			Output:       outputFormat,
+			OutputFile:   *outputFile,
+			Thresholds:   thresholds,
+			Budgets:      budgets,
+			SLA:          slas,
+			Baseline:     baseline,
+			BrowserMode:  *browserMode,
+			BrowserConns: *browserConns,
+			MaxConnRate:  connRate,
+			HTTPVersion:  httpVersion,
+			TLS:          tlsSettings,
+			Proxy:        proxy,
+			ClockSync:    clock,
+			Percentile:   pctMethod,
+			Histogram:    *histogram,
+			Percentiles:  pcts,
+			MinSamples:   *minSamples,
+			TimeSeries:   seriesSize,
+			MaxMemory:    maxMem,
+
+			SpikeWindow:     spikeSize,
+			SpikeThreshold:  spikeLimit,
+			ClientProfiles:  clientProfiles,
+			StatsD:          statsd,
+			FailureManifest: failureManifest,
+			Exporters:       namedExporters,
+			ExportInterval:  exportEvery,
+
+			DisableKeepAlive: *disableKeepAlive,
+			MaxConnsPerHost:  *maxConnsPerHost,
+
+			Data:             data,
+			ValueReport:      *valueReport,
+			Seed:             *seed,
+			Templates:        tc,
+			ProgressInterval: *progressEvery,
+
+			HonorRetryAfter: *honorRetryAfter,
+			RetryAfterMax:   maxPause,
 		}, nil
 	}
 
-	// URL is required.
-	if *urlFlag == "" {
-		return nil, fmt.Errorf("validation error: -url flag is required")
+	// An endpoints file brings the URLs, methods, bodies and labels; the
+	// first endpoint's URL stands in for the target where one URL is
+	// needed, such as clock synchronization.
+	var endpoints *EndpointMix
+	if *endpointsFile != "" {
+		var conflict string
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "url", "method", "method-mix", "method-body", "body", "body-file", "form", "form-file", "label":
+				if conflict == "" {
+					conflict = f.Name
+				}
+			}
+		})
+		if conflict != "" {
+			problems.addf("-endpoints cannot be combined with -%s, each endpoint sets its own method, URL, body and label", conflict)
+		}
+		if endpoints, err = loadEndpoints(*endpointsFile, tc); err != nil {
+			problems.add(err)
+		} else {
+			*urlFlag = endpoints.Endpoints[0].URL
+		}
 	}
 
-	// Validate URL has a proper http/https scheme.
-	// When the URL contains {{...}} template placeholders, replace them with
-	// dummy values before parsing so that url.ParseRequestURI succeeds.
-	urlToValidate := stripTemplatePlaceholders(*urlFlag)
-	parsed, err := url.ParseRequestURI(urlToValidate)
-	if err != nil {
-		return nil, fmt.Errorf("validation error: invalid URL %q: %w", *urlFlag, err)
-	}
-	if parsed.Scheme != "http" && parsed.Scheme != "https" {
-		return nil, fmt.Errorf("validation error: URL scheme must be http or https, got %q", parsed.Scheme)
+	// URL is required.
+	if *urlFlag == "" {
+		problems.addf("-url is required, e.g. -url https://example.com/ (or use -scenario, -config or -endpoints)")
+	} else if err := validTargetURL(*urlFlag); err != nil {
+		problems.add(err)
 	}
 
 	// Number of requests must be at least 1.
 	if *numRequests < 1 {
-		return nil, fmt.Errorf("validation error: -n (number of requests) must be >= 1, got %d", *numRequests)
+		problems.addf("-n (number of requests) must be >= 1, got %d", *numRequests)
 	}
 
-	// Concurrency must be between 1 and 100.
+	// Concurrency must be between 1 and 100. With -auto-concurrency it caps
+	// the workers probed, at 100 unless -c is set.
 	if *concurrency < 1 || *concurrency > 100 {
-		return nil, fmt.Errorf("validation error: -c (concurrency) must be between 1 and 100, got %d", *concurrency)
+		problems.addf("-c (concurrency) must be between 1 and 100, got %d", *concurrency)
+	}
+	if *autoConcurrency {
+		cSet := false
+		fs.Visit(func(f *flag.Flag) { cSet = cSet || f.Name == "c" })
+		if !cSet {
+			*concurrency = 100
+		}
 	}
 
-	// Method must be one of the allowed HTTP methods.
-	allowedMethods := map[string]bool{
-		"GET":    true,
-		"POST":   true,
-		"PUT":    true,
-		"DELETE": true,
+	// A negative rate makes no sense; 0 means unlimited.
+	if *rateLimit < 0 {
+		problems.addf("-rate must be >= 0, got %g", *rateLimit)
 	}
+
+	// A load profile sets the rate and, through its durations, the number
+	// of requests itself.
+	var profile *Profile
+	if *profileFile != "" {
+		explicit := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+		if explicit["n"] || explicit["rate"] {
+			problems.addf("-profile cannot be combined with -n or -rate, its stages set both")
+		}
+		if profile, err = loadProfile(*profileFile); err != nil {
+			problems.add(err)
+		} else {
+			*numRequests = profile.plannedRequests()
+		}
+	}
+
+	// So does a load pattern, whose requests are counted up front.
+	var pattern *PatternSpec
+	if *patternFlag != "" {
+		explicit := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+		switch {
+		case explicit["n"] || explicit["rate"]:
+			problems.addf("-pattern cannot be combined with -n or -rate, the pattern sets both")
+		case *profileFile != "":
+			problems.addf("-pattern cannot be combined with -profile")
+		}
+		if pattern, err = parsePatternSpec(*patternFlag); err != nil {
+			problems.add(err)
+		} else {
+			*numRequests = pattern.Requests
+		}
+	}
+
+	// Any well-formed method goes; methods are sent upper-cased.
 	upperMethod := strings.ToUpper(*method)
-	if !allowedMethods[upperMethod] {
-		return nil, fmt.Errorf("validation error: -method must be one of GET, POST, PUT, DELETE, got %q", *method)
+	if !validMethod(upperMethod) {
+		problems.addf("-method must be an HTTP method such as GET, POST, PATCH or HEAD, got %q", *method)
+	}
+
+	// A form is a body of its own, POSTed unless -method says otherwise,
+	// as with curl -F.
+	form, err := parseForm(formValues, formFiles, tc)
+	if err != nil {
+		problems.add(err)
+	}
+	if form != nil {
+		methodSet := false
+		fs.Visit(func(f *flag.Flag) { methodSet = methodSet || f.Name == "method" })
+		if !methodSet {
+			upperMethod = http.MethodPost
+		}
+		switch {
+		case !methodSendsBody(upperMethod):
+			problems.addf("-form needs a method that sends a body, such as POST or PUT, got %s", upperMethod)
+		case *body != "" || *bodyFile != "":
+			problems.addf("-form and -form-file cannot be combined with -body or -body-file")
+		case *methodMix != "":
+			problems.addf("-form and -form-file cannot be combined with -method-mix")
+		}
 	}
 
 	// Parse the timeout duration string.
 	dur, err := time.ParseDuration(*timeout)
 	if err != nil {
-		return nil, fmt.Errorf("validation error: invalid -timeout value %q: %w", *timeout, err)
+		problems.addf("invalid -timeout value %q: %w", *timeout, err)
 	}
 
 	// Parse custom headers from "Key: Value" format into a map.
 	headerMap := make(map[string]string)
+	headersValid := true
 	for _, h := range headers {
 		parts := strings.SplitN(h, ":", 2)
 		if len(parts) != 2 {
-			return nil, fmt.Errorf("validation error: invalid header format %q, expected 'Key: Value'", h)
+			problems.addf("invalid header format %q, expected 'Key: Value'", h)
+			headersValid = false
+			continue
 		}
 		key := strings.TrimSpace(parts[0])
 		value := strings.TrimSpace(parts[1])
 		if key == "" {
-			return nil, fmt.Errorf("validation error: header key must not be empty in %q", h)
+			problems.addf("header key must not be empty in %q", h)
+			headersValid = false
+			continue
 		}
 		headerMap[key] = value
 	}
+	var headerTmpls []headerTemplate
+	if headersValid {
+		if headerTmpls, err = parseHeaderTemplates(headers, tc); err != nil {
+			problems.addf("invalid %w", err)
+		}
+	}
 
-	// Parse the body template to detect and validate dynamic placeholders.
-	bodyTmpl, err := ParseTemplate(*body)
+	// Load the body, possibly from a file, and parse it as a template to
+	// detect and validate dynamic placeholders.
+	if *body, err = loadBody(*body, *bodyFile); err != nil {
+		problems.add(err)
+	}
+	bodyTmpl, err := tc.ParseTemplate(*body)
 	if err != nil {
-		return nil, fmt.Errorf("validation error: invalid body template: %w", err)
+		problems.addf("invalid body template: %w", err)
 	}
 
 	// Parse the URL template to detect and validate dynamic placeholders.
-	urlTmpl, err := ParseTemplate(*urlFlag)
+	urlTmpl, err := tc.ParseTemplate(*urlFlag)
+	if err != nil {
+		problems.addf("invalid URL template: %w", err)
+	}
+
+	// Parse the optional cancellation injection.
+	rate, err := parsePercent("cancel-rate", *cancelRate)
+	if err != nil {
+		problems.add(err)
+	}
+	cancelDelay, err := time.ParseDuration(*cancelAfter)
+	if err != nil {
+		problems.addf("invalid -cancel-after value %q: %w", *cancelAfter, err)
+	} else if cancelDelay <= 0 {
+		problems.addf("-cancel-after must be > 0, got %s", cancelDelay)
+	}
+
+	// Parse the optional chaos mode.
+	chaosShare, err := parsePercent("chaos", *chaosRate)
+	if err != nil {
+		problems.add(err)
+	}
+	kinds, err := parseKinds("chaos-kinds", *chaosKindsFlag, chaosKinds)
+	if err != nil {
+		problems.add(err)
+	}
+
+	// Parse the optional header fuzzing.
+	fuzzShare, err := parsePercent("header-fuzz", *headerFuzz)
+	if err != nil {
+		problems.add(err)
+	}
+	fuzzKinds, err := parseKinds("header-fuzz-kinds", *fuzzKindsFlag, headerFuzzKinds)
 	if err != nil {
-		return nil, fmt.Errorf("validation error: invalid URL template: %w", err)
+		problems.add(err)
+	}
+	if *headerFuzzSize <= 0 {
+		problems.addf("-header-fuzz-size must be > 0, got %d", *headerFuzzSize)
+	}
+	if *headerFuzzCount <= 0 {
+		problems.addf("-header-fuzz-count must be > 0, got %d", *headerFuzzCount)
+	}
+
+	// Parse the optional retry policy and idempotency key header.
+	if *retries < 0 {
+		problems.addf("-retries must be >= 0, got %d", *retries)
+	}
+	backoff, err := time.ParseDuration(*retryBackoff)
+	if err != nil {
+		problems.addf("invalid -retry-backoff value %q: %w", *retryBackoff, err)
+	} else if backoff < 0 {
+		problems.addf("-retry-backoff must be >= 0, got %s", backoff)
+	}
+	if err := validIdempotencyHeader(*idempotencyHeader); err != nil {
+		problems.add(err)
+	}
+
+	// Parse the optional method mix and its per-method bodies.
+	var mix *MethodMix
+	if *methodMix != "" {
+		bodies, err := parseMethodBodies(methodBodies)
+		if err != nil {
+			problems.add(err)
+		} else if mix, err = parseMethodMix(*methodMix, bodies, *body, tc); err != nil {
+			problems.add(err)
+		}
+	} else if len(methodBodies) > 0 {
+		problems.addf("-method-body requires -method-mix")
+	}
+
+	batch, err := parseBatch(*batchSize, *batchFormat)
+	if err != nil {
+		problems.add(err)
+	} else if batch != nil {
+		switch {
+		case form != nil:
+			problems.addf("-batch-size cannot be combined with -form and -form-file")
+		case *body == "" && *methodMix == "" && endpoints == nil:
+			problems.addf("-batch-size needs a body template to batch (-body, -body-file, -method-body or -endpoints)")
+		case *methodMix == "" && endpoints == nil && !methodSendsBody(upperMethod):
+			problems.addf("-batch-size needs a method that sends a body, such as POST or PUT, got %s", upperMethod)
+		}
+	}
+
+	var mirror *Mirror
+	if *mirrorTo != "" {
+		urlErr := validTargetURL(*mirrorTo)
+		if urlErr != nil {
+			problems.addf("-mirror-to: %w", urlErr)
+		}
+		share, err := parsePercent("mirror-percent", *mirrorPercent)
+		if err != nil {
+			problems.add(err)
+		} else if share == 0 {
+			problems.addf("-mirror-percent must be > 0")
+		}
+		if form != nil {
+			problems.addf("-mirror-to cannot copy -form and -form-file bodies")
+		}
+		if *repeat > 1 {
+			problems.addf("-mirror-to is not supported with -repeat")
+		}
+		diff, err := parseMirrorDiff(*mirrorDiff, mirrorDiffJSON)
+		if err != nil {
+			problems.add(err)
+		}
+		if urlErr == nil {
+			if mirror, err = newMirror(*mirrorTo, share, diff); err != nil {
+				problems.addf("-mirror-to: %w", err)
+			}
+		}
+	} else if *mirrorDiff != "" || len(mirrorDiffJSON) > 0 {
+		problems.addf("-mirror-diff and -mirror-diff-json require -mirror-to")
 	}
 
+	if *recordRequests {
+		if *record == "" {
+			problems.addf("-record-requests requires -record")
+		} else if isCSVRecord(*record) {
+			problems.addf("-record-requests requires a JSON lines -record file, not CSV")
+		}
+	}
+
+	if err := problems.err(); err != nil {
+		return nil, err
+	}
 	return &Config{
-		URL:          *urlFlag,
-		NumRequests:  *numRequests,
-		Concurrency:  *concurrency,
-		Method:       upperMethod,
-		Timeout:      dur,
-		Headers:      headerMap,
-		Body:         *body,
-		BodyTemplate: bodyTmpl,
-		URLTemplate:  urlTmpl,
+		URL:            *urlFlag,
+		RecordFile:     *record,
+		RecordRequests: *recordRequests,
+		Label:          *label,
+		Repeat:         *repeat,
+		RepeatPause:    *repeatPause,
+		NumRequests:    *numRequests,
+		Concurrency:    *concurrency,
+		Rate:           *rateLimit,
+		Profile:        profile,
+		Pattern:        pattern,
+		Method:         upperMethod,
+		Timeout:        dur,
+		Headers:        headerMap,
+		Body:           *body,
+		Stop:           stop,
+		Assertions:     assertions,
+		FailOn:         failOn,
+		BodyTemplate:   bodyTmpl,
+		Form:           form,
+		Batch:          batch,
+		URLTemplate:    urlTmpl,
+		MethodMix:      mix,
+		Endpoints:      endpoints,
+		Mirror:         mirror,
+		Stream:         *stream,
+		CI:             *ci,
+		Output:         outputFormat,
+		OutputFile:     *outputFile,
+		Thresholds:     thresholds,
+		Budgets:        budgets,
+		SLA:            slas,
+		Baseline:       baseline,
+		BrowserMode:    *browserMode,
+		BrowserConns:   *browserConns,
+		MaxConnRate:    connRate,
+		HTTPVersion:    httpVersion,
+		TLS:            tlsSettings,
+		Proxy:          proxy,
+		ClockSync:      clock,
+		Percentile:     pctMethod,
+		Histogram:      *histogram,
+		Percentiles:    pcts,
+		MinSamples:     *minSamples,
+		TimeSeries:     seriesSize,
+		MaxMemory:      maxMem,
+		Cancel:         CancelInjection{Rate: rate, MaxDelay: cancelDelay},
+		Chaos:          ChaosMode{Rate: chaosShare, Kinds: kinds},
+		HeaderFuzz:     HeaderFuzz{Rate: fuzzShare, Kinds: fuzzKinds, Size: *headerFuzzSize, Count: *headerFuzzCount},
+
+		SpikeWindow:     spikeSize,
+		SpikeThreshold:  spikeLimit,
+		ClientProfiles:  clientProfiles,
+		StatsD:          statsd,
+		FailureManifest: failureManifest,
+		Exporters:       namedExporters,
+		ExportInterval:  exportEvery,
+
+		Retry:             RetryPolicy{Max: *retries, Backoff: backoff},
+		IdempotencyHeader: *idempotencyHeader,
+
+		HeaderTemplates: headerTmpls,
+		HonorRetryAfter: *honorRetryAfter,
+		RetryAfterMax:   maxPause,
+
+		AutoConcurrency: *autoConcurrency,
+
+		DisableKeepAlive: *disableKeepAlive,
+		MaxConnsPerHost:  *maxConnsPerHost,
+
+		Data:             data,
+		ValueReport:      *valueReport,
+		Seed:             *seed,
+		Templates:        tc,
+		ProgressInterval: *progressEvery,
 	}, nil
 }
 
+// visitUnusedFlags calls fn with the name of every flag set in fs that is
+// not in used, in name order, so that a mode rejects the flags it would
+// otherwise ignore.
+func visitUnusedFlags(fs *flag.FlagSet, used map[string]bool, fn func(name string)) {
+	fs.Visit(func(f *flag.Flag) {
+		if !used[f.Name] {
+			fn(f.Name)
+		}
+	})
+}
+
+// validTargetURL checks that raw is an absolute http or https URL. When
+// the URL contains {{...}} template placeholders, they are replaced with
+// dummy values before parsing so that url.ParseRequestURI succeeds.
+func validTargetURL(raw string) error {
+	parsed, err := url.ParseRequestURI(stripTemplatePlaceholders(raw))
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %w", raw, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("URL scheme must be http or https, got %q", parsed.Scheme)
+	}
+	return nil
+}
+
 // stripTemplatePlaceholders replaces all {{...}} tokens with a dummy value
 // so that URL validation can succeed even when the URL contains dynamic
 // template placeholders like {{$randomInt}}.
@@ -185,3 +1156,62 @@ func stripTemplatePlaceholders(s string) string {
 	}
 	return result
 }
+
+// parsePercent parses a percentage flag value such as "5%" or "5" (both
+// meaning five percent) into a fraction between 0 and 1. An empty value
+// yields 0.
+func parsePercent(name, s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	pct, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || pct < 0 || pct > 100 {
+		return 0, fmt.Errorf("invalid -%s value %q, expected a percentage between 0 and 100 (e.g. 5%%)", name, s)
+	}
+	return pct / 100, nil
+}
+
+// ValidationError reports every problem found in a set of load test flags.
+type ValidationError struct {
+	Problems []error
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return "validation error: " + e.Problems[0].Error()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d validation errors:", len(e.Problems))
+	for _, p := range e.Problems {
+		b.WriteString("\n  - " + p.Error())
+	}
+	return b.String()
+}
+
+func (e *ValidationError) Unwrap() []error {
+	return e.Problems
+}
+
+// validationErrors collects the problems found while validating flags.
+type validationErrors struct {
+	problems []error
+}
+
+// add records err as a problem.
+func (v *validationErrors) add(err error) {
+	v.problems = append(v.problems, err)
+}
+
+// addf records a problem described as by fmt.Errorf.
+func (v *validationErrors) addf(format string, args ...any) {
+	v.add(fmt.Errorf(format, args...))
+}
+
+// err returns the problems recorded as a *ValidationError, or nil if
+// there are none.
+func (v *validationErrors) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
@@ -0,0 +1,78 @@
+// connerrors.go classifies failed requests by what went wrong on the
+// connection: a TCP reset or refusal, a failed TLS handshake, or an HTTP/2
+// connection shut down by GOAWAY or a stream reset by the server. Go reports
+// these as error strings that differ from one platform and code path to the
+// next; counted separately they tell a crashing or overloaded backend apart
+// from a misconfigured certificate or a proxy cycling its connections.
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"syscall"
+)
+
+// Connection error kinds.
+const (
+	connErrorReset       = "tcp_reset"
+	connErrorRefused     = "tcp_refused"
+	connErrorTLS         = "tls_handshake"
+	connErrorGoAway      = "http2_goaway"
+	connErrorStreamReset = "http2_stream_reset"
+)
+
+// connErrorKinds lists the kinds in report order.
+var connErrorKinds = []string{connErrorReset, connErrorRefused, connErrorTLS, connErrorGoAway, connErrorStreamReset}
+
+// connErrorDescriptions explain the kinds in the text summary.
+var connErrorDescriptions = map[string]string{
+	connErrorReset:       "connection reset by the peer",
+	connErrorRefused:     "connection refused",
+	connErrorTLS:         "TLS handshake failed",
+	connErrorGoAway:      "HTTP/2 connection closed by GOAWAY",
+	connErrorStreamReset: "HTTP/2 stream reset by the server",
+}
+
+// connError returns the kind of connection error err is, "" if it is none
+// of them. Timeouts are left to the timeout phases, even when they hit a
+// TLS handshake.
+func (t *phaseTrace) connError(err error) string {
+	if err == nil || isTimeout(err) {
+		return ""
+	}
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var verifyErr *tls.CertificateVerificationError
+	switch {
+	case t.tlsFailed.Load(), errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &verifyErr):
+		return connErrorTLS
+	case errors.Is(err, syscall.ECONNRESET):
+		return connErrorReset
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return connErrorRefused
+	}
+	// The HTTP/2 transport bundled with net/http does not export its error
+	// types, so they are recognized by their messages.
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "http2: server sent GOAWAY"), strings.Contains(msg, "http2: Transport received GOAWAY"):
+		return connErrorGoAway
+	case strings.Contains(msg, "stream error: stream ID"):
+		return connErrorStreamReset
+	}
+	return ""
+}
+
+// printConnErrors prints the number of requests failed per connection
+// error kind.
+func printConnErrors(w io.Writer, counts map[string]int) {
+	fmt.Fprintln(w, "Connection Errors:")
+	for _, kind := range connErrorKinds {
+		if n := counts[kind]; n > 0 {
+			fmt.Fprintf(w, "  %-19s %d (%s)\n", kind+":", n, connErrorDescriptions[kind])
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// connreuse.go implements connection reuse reporting: every request is
+// counted as sent on a new or a reused connection, as httptrace reports
+// it, with the latencies of each kind side by side. With -disable-keepalive
+// every request opens a connection of its own, so a run with and one
+// without it compare connection churn against a warm pool;
+// -max-conns-per-host caps the pool to see how few connections suffice.
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Connection kinds requests are counted under.
+const (
+	connNew    = "new"
+	connReused = "reused"
+)
+
+// connKind returns the kind of connection the traced request went over,
+// or "" if it got none.
+func (t *phaseTrace) connKind() string {
+	switch {
+	case !t.connected.Load():
+		return ""
+	case t.reused.Load():
+		return connReused
+	default:
+		return connNew
+	}
+}
+
+// connPoolDescription describes the connection pool settings of config
+// for the banner, "" for the defaults.
+func connPoolDescription(config *Config) string {
+	switch {
+	case config.DisableKeepAlive && config.MaxConnsPerHost > 0:
+		return fmt.Sprintf("keep-alive disabled, max %d connections per host", config.MaxConnsPerHost)
+	case config.DisableKeepAlive:
+		return "keep-alive disabled, a new connection per request"
+	case config.MaxConnsPerHost > 0:
+		return fmt.Sprintf("max %d connections per host", config.MaxConnsPerHost)
+	}
+	return ""
+}
+
+// connLabels are the names connection kinds are printed under.
+var connLabels = map[string]string{
+	connNew:    "New:",
+	connReused: "Reused:",
+}
+
+// printConnReuse prints the requests on new and reused connections with
+// their latencies.
+func printConnReuse(w io.Writer, reuse map[string]GroupSummary) {
+	total := 0
+	for _, g := range reuse {
+		total += g.Requests
+	}
+	for _, kind := range []string{connReused, connNew} {
+		g, ok := reuse[kind]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "  %-8s %d responses (%.1f%%) | avg %s | P95 %s | P99 %s\n", connLabels[kind], g.Requests,
+			float64(g.Requests)/float64(total)*100, formatDuration(g.AvgDuration), formatDuration(g.P95), formatDuration(g.P99))
+	}
+}
@@ -0,0 +1,119 @@
+// contenttype.go implements the breakdown of responses by Content-Type: how
+// many responses of each media type came back, how many body bytes they
+// carried and how long they took. An endpoint that answers JSON when it is
+// healthy may answer HTML error pages from a proxy, or empty bodies, under
+// load; the status codes alone do not always show the mix.
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Content-Type keys of responses that have no media type of their own.
+const (
+	contentTypeEmpty = "(empty)" // No body bytes, whatever the header says
+	contentTypeNone  = "(none)"  // A body without a Content-Type header
+	contentTypeOther = "(other)" // Media types past maxContentTypes
+)
+
+// maxContentTypes caps the media types tracked, so a server that varies
+// the header per response cannot grow the breakdown without bound.
+const maxContentTypes = 20
+
+// contentTypeOf returns the key a response is counted under: the media
+// type of its Content-Type header, lower-cased and without parameters such
+// as charset, or contentTypeEmpty or contentTypeNone.
+func contentTypeOf(header string, bodyBytes int64) string {
+	if bodyBytes == 0 {
+		return contentTypeEmpty
+	}
+	if header == "" {
+		return contentTypeNone
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		// Keep what precedes the parameters of a malformed header.
+		mediaType, _, _ = strings.Cut(header, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	}
+	return mediaType
+}
+
+// mediaTypeCounts accumulates the responses of one content type.
+type mediaTypeCounts struct {
+	Responses     int           `json:"responses"`
+	Bytes         int64         `json:"bytes"`
+	TotalDuration time.Duration `json:"total_duration"`
+}
+
+// add returns c plus o.
+func (c mediaTypeCounts) add(o mediaTypeCounts) mediaTypeCounts {
+	return mediaTypeCounts{c.Responses + o.Responses, c.Bytes + o.Bytes, c.TotalDuration + o.TotalDuration}
+}
+
+// sub returns c minus o.
+func (c mediaTypeCounts) sub(o mediaTypeCounts) mediaTypeCounts {
+	return mediaTypeCounts{c.Responses - o.Responses, c.Bytes - o.Bytes, c.TotalDuration - o.TotalDuration}
+}
+
+// recordContentType counts a response of content type ct in counts,
+// lumping new types past maxContentTypes under contentTypeOther.
+func recordContentType(counts map[string]mediaTypeCounts, ct string, c mediaTypeCounts) {
+	if _, ok := counts[ct]; !ok && len(counts) >= maxContentTypes {
+		ct = contentTypeOther
+	}
+	counts[ct] = counts[ct].add(c)
+}
+
+// ContentTypeSummary is the share of a run's responses of one content type.
+type ContentTypeSummary struct {
+	Responses   int
+	Bytes       int64 // Body bytes received
+	AvgDuration time.Duration
+}
+
+// summarizeContentTypes returns the summaries of counts, nil if empty.
+func summarizeContentTypes(counts map[string]mediaTypeCounts) map[string]ContentTypeSummary {
+	if len(counts) == 0 {
+		return nil
+	}
+	out := make(map[string]ContentTypeSummary, len(counts))
+	for ct, c := range counts {
+		s := ContentTypeSummary{Responses: c.Responses, Bytes: c.Bytes}
+		if c.Responses > 0 {
+			s.AvgDuration = c.TotalDuration / time.Duration(c.Responses)
+		}
+		out[ct] = s
+	}
+	return out
+}
+
+// printContentTypes prints the responses per content type, most frequent
+// first.
+func printContentTypes(w io.Writer, types map[string]ContentTypeSummary) {
+	names := make([]string, 0, len(types))
+	total := 0
+	for name, s := range types {
+		names = append(names, name)
+		total += s.Responses
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := types[names[i]], types[names[j]]
+		if a.Responses != b.Responses {
+			return a.Responses > b.Responses
+		}
+		return names[i] < names[j]
+	})
+	fmt.Fprintln(w, "Content Types:")
+	fmt.Fprintf(w, "  %-28s %10s %7s %12s %10s\n", "Type", "Responses", "Share", "Bytes", "Avg")
+	for _, name := range names {
+		s := types[name]
+		fmt.Fprintf(w, "  %-28s %10d %6.1f%% %12s %10s\n", name, s.Responses,
+			float64(s.Responses)/float64(total)*100, formatBytes(s.Bytes), formatDuration(s.AvgDuration))
+	}
+}
@@ -0,0 +1,543 @@
+// controller.go implements the `controller` subcommand of distributed mode.
+// A controller splits a load test across a set of agents, waits for each
+// agent's StatsSnapshot, and merges them into one Summary as if the whole
+// test had run in a single process. With -listen it also accepts agent
+// registrations and live result frames from agents.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// agentPollInterval is how often the controller re-checks agents that are
+// not yet healthy.
+const agentPollInterval = 2 * time.Second
+
+// runControllerCommand parses controller flags, then the load test flags
+// following them, and runs the test across the configured agents.
+func runControllerCommand(args []string) error {
+	fs := flag.NewFlagSet("controller", flag.ContinueOnError)
+	agentsFlag := fs.String("agents", "", "Comma-separated agent addresses (host:port)")
+	listen := fs.String("listen", "", "Address to accept agent registrations and live results on (e.g. :7070)")
+	advertise := fs.String("advertise", "", "Address agents should push live results to (default: as seen by each agent)")
+	minAgents := fs.Int("min-agents", 1, "With -listen, number of agents to wait for before starting")
+	token := fs.String("token", "", "Shared token presented to agents and required of registrations and live results (default $"+distributedTokenEnv+"); without one -listen only accepts loopback addresses")
+	waitStr := fs.String("wait", "2m", "How long to wait for agents to join and become healthy")
+	windowStr := fs.String("window", defaultStreamWindow.String(), "With -listen, how often agents push live results")
+	web := fs.String("web", "", "Address to serve the web dashboard on (e.g. :8080); its buttons require the token, and without one it only listens on loopback")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *token == "" {
+		*token = os.Getenv(distributedTokenEnv)
+	}
+
+	wait, err := time.ParseDuration(*waitStr)
+	if err != nil {
+		return fmt.Errorf("invalid wait duration %q: %w", *waitStr, err)
+	}
+	window, err := time.ParseDuration(*windowStr)
+	if err != nil {
+		return fmt.Errorf("invalid window duration %q: %w", *windowStr, err)
+	}
+	if window <= 0 {
+		return fmt.Errorf("validation error: window must be positive, got %s", window)
+	}
+
+	static := splitAgents(*agentsFlag)
+	if len(static) == 0 && *listen == "" {
+		return fmt.Errorf("validation error: -agents or -listen is required")
+	}
+	if *listen != "" && *token == "" && !loopbackAddr(*listen) {
+		return fmt.Errorf("validation error: -token or $%s is required to listen on %s; without one the controller only listens on loopback, e.g. -listen 127.0.0.1%s", distributedTokenEnv, *listen, defaultAgentAddr)
+	}
+	if *web != "" && *token == "" && !loopbackAddr(*web) {
+		return fmt.Errorf("validation error: -token or $%s is required to serve the dashboard on %s; without one it only listens on loopback, e.g. -web 127.0.0.1:8080", distributedTokenEnv, *web)
+	}
+	if *listen != "" && *minAgents < 1 {
+		return fmt.Errorf("validation error: min-agents must be >= 1, got %d", *minAgents)
+	}
+
+	// Everything after the controller flags is a regular load test
+	// configuration, forwarded to every agent.
+	loadArgs := fs.Args()
+	config, err := parseConfigArgs(loadArgs)
+	if err != nil {
+		return err
+	}
+	if config.ScenarioFile != "" {
+		return fmt.Errorf("validation error: scenario mode is not supported in distributed mode")
+	}
+	if config.Profile != nil {
+		return fmt.Errorf("validation error: -profile is not supported in distributed mode")
+	}
+	if config.Pattern != nil {
+		return fmt.Errorf("validation error: -pattern is not supported in distributed mode")
+	}
+	if config.AutoConcurrency {
+		return fmt.Errorf("validation error: -auto-concurrency is not supported in distributed mode")
+	}
+	if config.MaxMemory > 0 {
+		return fmt.Errorf("validation error: -max-memory is not supported in distributed mode")
+	}
+	if config.Repeat > 1 {
+		return fmt.Errorf("validation error: -repeat is not supported in distributed mode")
+	}
+	if config.Mirror != nil {
+		return fmt.Errorf("validation error: -mirror-to is not supported in distributed mode")
+	}
+
+	logOut := logWriter(config)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := &controller{
+		client:    &http.Client{},
+		token:     *token,
+		window:    window,
+		advertise: *advertise,
+	}
+
+	var dash *dashboard
+	if *web != "" {
+		dash = newDashboard(c, config)
+		if err := dash.serve(ctx, *web); err != nil {
+			return err
+		}
+	}
+
+	agents := static
+	if *listen != "" {
+		reg := newRegistry(c.token)
+		for _, addr := range static {
+			reg.add(addr)
+		}
+		serveErr, err := c.serve(ctx, *listen, reg)
+		if err != nil {
+			return err
+		}
+		agents, err = c.gatherAgents(ctx, reg, *minAgents, wait, serveErr)
+		if err != nil {
+			return err
+		}
+	}
+	if config.NumRequests < len(agents) {
+		return fmt.Errorf("validation error: -n (%d) must be at least the number of agents (%d)", config.NumRequests, len(agents))
+	}
+
+	fmt.Fprintf(os.Stderr, "controller: waiting for %d agent(s)\n", len(agents))
+	if err := c.waitForAgents(ctx, agents, wait); err != nil {
+		return err
+	}
+
+	if dash != nil {
+		dash.setAgents(agents)
+	}
+
+	PrintBanner(logOut, config)
+	fmt.Fprintf(logOut, "Agents:      %d (concurrency is per agent)\n", len(agents))
+
+	// With live results the progress bar follows the merged frames;
+	// otherwise results only arrive when each agent finishes.
+	var live *Stats
+	if c.port != 0 {
+		live = NewStats(config.NumRequests)
+		live.Configure(config)
+		c.setCollector(newResultCollector(c.token, newRunID(), live, agents))
+	}
+
+	if dash != nil {
+		dash.setState("running")
+		if live != nil {
+			dash.setStats(live)
+		}
+	}
+
+	stats := NewStats(config.NumRequests)
+	stats.Configure(config)
+
+	// Exporters follow the live results when agents stream them.
+	exported := stats
+	if live != nil {
+		exported = live
+	}
+	exports, err := startExports(config, exported, os.Stderr)
+	if err != nil {
+		return err
+	}
+	runErr := runWithProgress(!config.CI && live != nil, logOut, live, func() error {
+		return c.run(ctx, agents, loadArgs, config.NumRequests, config.Rate, stats)
+	})
+	if runErr != nil {
+		fmt.Fprintf(os.Stderr, "\nError running distributed load test: %v\n", runErr)
+	}
+	if dash != nil {
+		dash.setStats(stats)
+		dash.setState("finished")
+	}
+
+	summary := stats.GetSummary()
+	exports.finish(summary)
+	if err := writeReport(config, Report{Summary: summary}); err != nil && runErr == nil {
+		runErr = err
+	}
+
+	if config.CI && runErr != nil {
+		return runErr
+	}
+
+	// Keep the dashboard up so the team can review the results.
+	if dash != nil && !config.CI {
+		fmt.Fprintf(os.Stderr, "controller: run finished, dashboard still available; press Ctrl+C to exit\n")
+		<-ctx.Done()
+	}
+	return nil
+}
+
+// controller dispatches run assignments to agents.
+type controller struct {
+	client    *http.Client
+	token     string
+	window    time.Duration
+	advertise string
+	port      int // Port of the -listen server, 0 without one
+
+	mu        sync.Mutex
+	collector *resultCollector
+}
+
+// serve starts the -listen server, which accepts agent registrations and
+// live result frames. The server runs until ctx is done; it stays up for
+// the whole run so late agents are told the run has started instead of
+// retrying against a closed port.
+func (c *controller) serve(ctx context.Context, listen string, reg *registry) (<-chan error, error) {
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("listening for agents: %w", err)
+	}
+	c.port = ln.Addr().(*net.TCPAddr).Port
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", reg.handleRegister)
+	mux.HandleFunc("/frames", c.handleFrames)
+	server := &http.Server{Handler: mux}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(ln)
+	}()
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	return serveErr, nil
+}
+
+// handleFrames passes result frames to the current run's collector.
+func (c *controller) handleFrames(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	rc := c.collector
+	c.mu.Unlock()
+
+	if rc == nil {
+		http.Error(w, "no run in progress", http.StatusGone)
+		return
+	}
+	rc.handleFrames(w, r)
+}
+
+// setCollector installs the collector for the run about to start.
+func (c *controller) setCollector(rc *resultCollector) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.collector = rc
+}
+
+// gatherAgents waits until at least minAgents agents are registered,
+// counting the static list, and returns them.
+func (c *controller) gatherAgents(ctx context.Context, reg *registry, minAgents int, wait time.Duration, serveErr <-chan error) ([]string, error) {
+	fmt.Fprintf(os.Stderr, "controller: accepting agent registrations on port %d, waiting for %d\n", c.port, minAgents)
+
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	type result struct {
+		agents []string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		agents, err := reg.waitFor(waitCtx, minAgents)
+		done <- result{agents, err}
+	}()
+
+	select {
+	case err := <-serveErr:
+		return nil, fmt.Errorf("listening for agents: %w", err)
+	case r := <-done:
+		return r.agents, r.err
+	}
+}
+
+// waitForAgents polls every agent's health endpoint until all respond or
+// wait elapses.
+func (c *controller) waitForAgents(ctx context.Context, agents []string, wait time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	pending := append([]string(nil), agents...)
+	for {
+		var still []string
+		for _, addr := range pending {
+			if err := c.checkHealth(ctx, addr); err != nil {
+				still = append(still, addr)
+			}
+		}
+		if len(still) == 0 {
+			return nil
+		}
+		pending = still
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("agents not ready after %s: %s", wait, strings.Join(pending, ", "))
+		case <-time.After(agentPollInterval):
+		}
+	}
+}
+
+// checkHealth returns nil if the agent at addr is up and accepts the token.
+func (c *controller) checkHealth(ctx context.Context, addr string) error {
+	_, err := c.fetchStatus(ctx, addr)
+	return err
+}
+
+// fetchStatus queries the health endpoint of the agent at addr.
+func (c *controller) fetchStatus(ctx context.Context, addr string) (agentStatus, error) {
+	var status agentStatus
+
+	ctx, cancel := context.WithTimeout(ctx, agentPollInterval)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, agentURL(addr, "/healthz"), nil)
+	if err != nil {
+		return status, err
+	}
+	c.authorize(req)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return status, fmt.Errorf("agent %s: health check returned %d", addr, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return status, fmt.Errorf("agent %s: decoding status: %w", addr, err)
+	}
+	return status, nil
+}
+
+// broadcast sends a control request (path "/pause", "/resume" or "/stop")
+// to every agent, returning an error naming the agents that failed.
+func (c *controller) broadcast(ctx context.Context, agents []string, path string) error {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		failed []string
+	)
+	for _, addr := range agents {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			err := c.control(ctx, addr, path)
+			if err != nil {
+				mu.Lock()
+				failed = append(failed, fmt.Sprintf("%s: %v", addr, err))
+				mu.Unlock()
+			}
+		}(addr)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%s failed on %d agent(s): %s", strings.TrimPrefix(path, "/"), len(failed), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// control sends one control request to the agent at addr.
+func (c *controller) control(ctx context.Context, addr, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, agentURL(addr, path), nil)
+	if err != nil {
+		return err
+	}
+	c.authorize(req)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("agent returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// run assigns each agent its share of total requests, and of rate if set,
+// waits for all of them, and merges their results into stats. Agents that fail are reported
+// together; results from the others are still merged.
+//
+// When agents stream live results, an agent's contribution is assembled
+// from its frames. If any of its frames were lost, the final snapshot in
+// the agent's response is used instead.
+func (c *controller) run(ctx context.Context, agents []string, loadArgs []string, total int, rate float64, stats *Stats) error {
+	shares := splitRequests(total, len(agents))
+
+	c.mu.Lock()
+	rc := c.collector
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(agents))
+	for i, addr := range agents {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			assignment := agentRunRequest{Args: loadArgs, Requests: shares[i], Rate: rate * float64(shares[i]) / float64(total)}
+			if rc != nil {
+				assignment.Stream = &streamTarget{
+					Addr:    c.advertise,
+					Port:    c.port,
+					RunID:   rc.runID,
+					AgentID: addr,
+					Window:  c.window,
+				}
+			}
+			snap, err := c.assign(ctx, addr, assignment)
+			if err != nil {
+				errs[i] = fmt.Errorf("agent %s: %w", addr, err)
+				return
+			}
+			if rc != nil {
+				if streamed, ok := rc.complete(addr); ok {
+					stats.Merge(streamed.Snapshot())
+					return
+				}
+				fmt.Fprintf(os.Stderr, "controller: live results from %s incomplete, using its final snapshot\n", addr)
+			}
+			stats.Merge(snap)
+		}(i, addr)
+	}
+	wg.Wait()
+
+	var failed []string
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d agents failed: %s", len(failed), len(agents), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// newRunID returns a random identifier distinguishing this run's result
+// frames from those of earlier runs.
+func newRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// assign sends one run assignment to an agent and returns its results.
+func (c *controller) assign(ctx context.Context, addr string, assignment agentRunRequest) (StatsSnapshot, error) {
+	var snap StatsSnapshot
+
+	body, err := json.Marshal(assignment)
+	if err != nil {
+		return snap, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, agentURL(addr, "/run"), bytes.NewReader(body))
+	if err != nil {
+		return snap, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.authorize(req)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return snap, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return snap, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&snap); err != nil {
+		return snap, fmt.Errorf("decoding results: %w", err)
+	}
+	return snap, nil
+}
+
+// authorize adds the shared token to req, if one is configured.
+func (c *controller) authorize(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+}
+
+// splitAgents parses a comma-separated agent list, ignoring empty entries.
+func splitAgents(s string) []string {
+	var agents []string
+	for _, a := range strings.Split(s, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			agents = append(agents, a)
+		}
+	}
+	return agents
+}
+
+// splitRequests divides total as evenly as possible into n shares, giving
+// the remainder to the first shares.
+func splitRequests(total, n int) []int {
+	shares := make([]int, n)
+	for i := range shares {
+		shares[i] = total / n
+		if i < total%n {
+			shares[i]++
+		}
+	}
+	return shares
+}
+
+// agentURL builds the URL of an agent endpoint from its address. Addresses
+// may be given with or without a scheme.
+func agentURL(addr, path string) string {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return strings.TrimRight(addr, "/") + path
+}
@@ -0,0 +1,110 @@
+// cpulimit.go detects container CPU limits (cgroup v1 and v2 CFS quotas).
+// Containerized CI runners often allow far fewer CPUs than the host has, so
+// GOMAXPROCS is lowered to the quota to avoid CFS throttling, and a warning
+// is emitted when the requested concurrency vastly exceeds the available CPU,
+// since such runs produce silently throttled, misleading latencies.
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// concurrencyPerCPUWarn is the number of concurrent workers per available CPU
+// above which the client itself is likely to become the bottleneck.
+const concurrencyPerCPUWarn = 25
+
+// cgroup files holding the CFS CPU quota.
+const (
+	cgroupV2CPUMax    = "/sys/fs/cgroup/cpu.max"
+	cgroupV1CFSQuota  = "/sys/fs/cgroup/cpu/cpu.cfs_quota_us"
+	cgroupV1CFSPeriod = "/sys/fs/cgroup/cpu/cpu.cfs_period_us"
+)
+
+// CPUInfo describes the CPU resources available to the process.
+type CPUInfo struct {
+	Limit      float64 // CPU quota in cores, 0 if unlimited or unknown
+	HostCPUs   int     // runtime.NumCPU()
+	GOMAXPROCS int     // GOMAXPROCS after tuning
+	Adjusted   bool    // GOMAXPROCS was lowered to match Limit
+}
+
+// detectCPULimit returns the container CPU quota in cores, or 0 if there is
+// none or it cannot be determined (e.g. not running on Linux).
+func detectCPULimit() float64 {
+	// cgroup v2: "<quota> <period>" or "max <period>".
+	if data, err := os.ReadFile(cgroupV2CPUMax); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) == 2 && fields[0] != "max" {
+			return quotaToCores(fields[0], fields[1])
+		}
+		return 0
+	}
+
+	// cgroup v1: quota of -1 means unlimited.
+	quota, err := os.ReadFile(cgroupV1CFSQuota)
+	if err != nil {
+		return 0
+	}
+	period, err := os.ReadFile(cgroupV1CFSPeriod)
+	if err != nil {
+		return 0
+	}
+	return quotaToCores(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+// quotaToCores converts a CFS quota and period (in microseconds) into cores.
+func quotaToCores(quota, period string) float64 {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0
+	}
+	return q / p
+}
+
+// tuneForCPULimit lowers GOMAXPROCS to the container CPU quota (rounded up)
+// unless the user set GOMAXPROCS explicitly, and returns the resulting CPU info.
+func tuneForCPULimit() CPUInfo {
+	info := CPUInfo{
+		Limit:      detectCPULimit(),
+		HostCPUs:   runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+	}
+
+	if info.Limit > 0 && os.Getenv("GOMAXPROCS") == "" {
+		procs := int(math.Ceil(info.Limit))
+		if procs < info.GOMAXPROCS {
+			runtime.GOMAXPROCS(procs)
+			info.GOMAXPROCS = procs
+			info.Adjusted = true
+		}
+	}
+	return info
+}
+
+// availableCPUs returns the effective number of CPUs the process can use.
+func (c CPUInfo) availableCPUs() float64 {
+	if c.Limit > 0 && c.Limit < float64(c.HostCPUs) {
+		return c.Limit
+	}
+	return float64(c.HostCPUs)
+}
+
+// concurrencyWarning returns a warning when concurrency vastly exceeds the
+// available CPU, or "" if the ratio is reasonable.
+func (c CPUInfo) concurrencyWarning(concurrency int) string {
+	cpus := c.availableCPUs()
+	if cpus <= 0 || float64(concurrency) <= cpus*concurrencyPerCPUWarn {
+		return ""
+	}
+	return fmt.Sprintf("concurrency %d is more than %dx the %.2f available CPUs; the client may be CPU-throttled and inflate latencies",
+		concurrency, concurrencyPerCPUWarn, cpus)
+}
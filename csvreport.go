@@ -0,0 +1,62 @@
+// csvreport.go renders summaries as CSV (-output csv), one row for the
+// whole run followed by one per scenario step or test and one per label,
+// for spreadsheets and tools that track results across runs.
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvColumns is the header row of the CSV report.
+var csvColumns = []string{
+	"name", "method", "url", "label", "requests", "successful", "failed", "requests_per_sec",
+	"avg_ms", "min_ms", "max_ms", "p50_ms", "p90_ms", "p95_ms", "p99_ms",
+	"bytes_sent", "bytes_received",
+}
+
+// formatCSV renders the report as CSV.
+func formatCSV(w io.Writer, r Report) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvColumns)
+	cw.Write(csvRow(ReportGroup{Name: "all", Summary: r.Summary}))
+	for _, g := range r.Groups() {
+		cw.Write(csvRow(g))
+	}
+	for _, label := range groupNames(r.Summary.ByLabel) {
+		cw.Write(csvLabelRow(label, r.Summary.ByLabel[label], r.Summary.TotalTime))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvRow formats one group's results in the order of csvColumns.
+func csvRow(g ReportGroup) []string {
+	s := g.Summary
+	msField := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	return []string{
+		g.Name, g.Method, g.URL, g.Label,
+		strconv.Itoa(s.TotalRequests), strconv.Itoa(s.SuccessCount), strconv.Itoa(s.FailCount),
+		strconv.FormatFloat(s.RequestsPerSec, 'f', 2, 64),
+		msField(ms(s.AvgDuration)), msField(ms(s.MinDuration)), msField(ms(s.MaxDuration)),
+		msField(ms(s.P50)), msField(ms(s.P90)), msField(ms(s.P95)), msField(ms(s.P99)),
+		strconv.FormatInt(s.BytesSent, 10), strconv.FormatInt(s.TotalBytes+s.HeaderBytes, 10),
+	}
+}
+
+// csvLabelRow formats the results of one label over a run lasting elapsed.
+// Minimum, maximum and byte counts are not tracked per label, so those
+// columns are left empty.
+func csvLabelRow(label string, g GroupSummary, elapsed time.Duration) []string {
+	msField := func(d time.Duration) string { return strconv.FormatFloat(ms(d), 'f', 3, 64) }
+	rps := labelSummary(g, elapsed).RequestsPerSec
+	return []string{
+		"label:" + label, "", "", label,
+		strconv.Itoa(g.Requests), strconv.Itoa(g.Requests - g.Errors), strconv.Itoa(g.Errors),
+		strconv.FormatFloat(rps, 'f', 2, 64), msField(g.AvgDuration), "", "",
+		msField(g.P50), msField(g.P90), msField(g.P95), msField(g.P99),
+		"", "",
+	}
+}
@@ -0,0 +1,393 @@
+// curve.go implements the `curve` subcommand: a sweep of request rates from
+// -from to -to in one run, each held long enough to settle, that reports the
+// latency reached at every rate. The resulting latency-vs-throughput curve
+// shows where the target saturates: achieved throughput stops following
+// the offered rate and latency climbs steeply. The curve is printed as a
+// table with an ASCII plot, or written as CSV or a self-contained HTML page.
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// curveSaturation is the share of the offered rate a point must achieve;
+// below it the target is saturated.
+const curveSaturation = 0.9
+
+// Size of the ASCII plot in characters.
+const (
+	curvePlotWidth  = 60
+	curvePlotHeight = 15
+)
+
+// CurvePoint is the result of one rate of the sweep.
+type CurvePoint struct {
+	Rate      float64 // Offered rate
+	Achieved  float64 // Requests sent per second during the step
+	Group     GroupSummary
+	Saturated bool // Achieved less than curveSaturation of Rate
+}
+
+// curveMetric selects the latency statistic a curve is plotted with.
+type curveMetric struct {
+	name  string
+	value func(GroupSummary) time.Duration
+}
+
+// curveMetrics are the -metric values of `curve`.
+var curveMetrics = map[string]func(GroupSummary) time.Duration{
+	"avg": func(g GroupSummary) time.Duration { return g.AvgDuration },
+	"p50": func(g GroupSummary) time.Duration { return g.P50 },
+	"p90": func(g GroupSummary) time.Duration { return g.P90 },
+	"p95": func(g GroupSummary) time.Duration { return g.P95 },
+	"p99": func(g GroupSummary) time.Duration { return g.P99 },
+}
+
+// runCurveCommand implements `curve [flags] -- <load test flags>`.
+func runCurveCommand(args []string) error {
+	fs := flag.NewFlagSet("curve", flag.ContinueOnError)
+	from := fs.Float64("from", 0, "Lowest request rate of the sweep, in requests per second (required)")
+	to := fs.Float64("to", 0, "Highest request rate of the sweep, in requests per second (required)")
+	steps := fs.Int("steps", 10, "Number of rates from -from to -to, evenly spaced")
+	stepDuration := fs.Duration("step-duration", 30*time.Second, "How long each rate is measured")
+	warmup := fs.Duration("warmup", 5*time.Second, "How long each rate runs before it is measured, so latency settles")
+	metricFlag := fs.String("metric", "p99", "Latency statistic plotted: avg, p50, p90, p95 or p99")
+	csvOut := fs.Bool("csv", false, "Emit the curve as CSV instead of a table and plot")
+	htmlFile := fs.String("html", "", "Also write the curve as an HTML page with a chart to this file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *from <= 0 || *to < *from {
+		return fmt.Errorf("validation error: curve needs -from > 0 and -to >= -from, got %g and %g", *from, *to)
+	}
+	if *steps < 1 || (*steps == 1 && *to != *from) {
+		return fmt.Errorf("validation error: -steps must be >= 2 to sweep from %g to %g, got %d", *from, *to, *steps)
+	}
+	if *stepDuration <= 0 || *warmup < 0 {
+		return fmt.Errorf("validation error: -step-duration must be > 0 and -warmup >= 0")
+	}
+	value, ok := curveMetrics[*metricFlag]
+	if !ok {
+		return fmt.Errorf("validation error: invalid -metric %q, expected avg, p50, p90, p95 or p99", *metricFlag)
+	}
+	metric := curveMetric{name: *metricFlag, value: value}
+
+	// Everything after the curve flags configures the requests; the sweep
+	// sets the rate and the number of requests itself.
+	config, err := parseConfigArgs(fs.Args())
+	if err != nil {
+		return err
+	}
+	switch {
+	case config.ScenarioFile != "":
+		return fmt.Errorf("validation error: scenario mode is not supported by curve")
+	case len(config.ConfigFiles) > 0:
+		return fmt.Errorf("validation error: -config is not supported by curve")
+	case config.Profile != nil || config.Pattern != nil || config.Rate > 0:
+		return fmt.Errorf("validation error: -profile, -pattern and -rate cannot be combined with curve, the sweep sets the rate")
+	case config.OutputFile != "" || len(config.Exporters) > 0:
+		return fmt.Errorf("validation error: -output-file and exporters are not supported by curve, use -csv or -html")
+	case config.Repeat > 1 || config.Mirror != nil:
+		return fmt.Errorf("validation error: -repeat and -mirror-to are not supported by curve")
+	case config.AutoConcurrency:
+		return fmt.Errorf("validation error: -auto-concurrency is not supported by curve, set -c")
+	case config.MaxMemory > 0:
+		return fmt.Errorf("validation error: -max-memory is not supported by curve")
+	}
+	config.Profile = curveProfile(*from, *to, *steps, *stepDuration, *warmup)
+	config.NumRequests = config.Profile.plannedRequests()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logOut := os.Stderr
+	fmt.Fprintf(logOut, "Sweeping %s from %g to %g req/s in %d steps of %s", config.URL, *from, *to, *steps, *stepDuration)
+	if *warmup > 0 {
+		fmt.Fprintf(logOut, " after %s warm-up each", *warmup)
+	}
+	fmt.Fprintf(logOut, ", ~%d requests over %s\n", config.NumRequests, config.Profile.duration())
+
+	stats := NewStats(config.NumRequests)
+	stats.Configure(config)
+	runErr := runWithProgress(!config.CI, logOut, stats, func() error {
+		return RunLoadTest(ctx, config, stats)
+	})
+	if runErr != nil {
+		fmt.Fprintf(os.Stderr, "\nError running load test: %v\n", runErr)
+	}
+
+	points := curvePoints(stats.GetSummary().Stages)
+	if *htmlFile != "" {
+		f, err := os.Create(*htmlFile)
+		if err != nil {
+			return fmt.Errorf("creating HTML file: %w", err)
+		}
+		err = writeCurveHTML(f, config.URL, points, metric)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("writing HTML file: %w", err)
+		}
+	}
+	if *csvOut {
+		if err := writeCurveCSV(os.Stdout, points); err != nil {
+			return err
+		}
+	} else {
+		printCurve(os.Stdout, points, metric)
+	}
+	return runErr
+}
+
+// curveProfile returns the load profile of a sweep: steps rates evenly
+// spaced from from to to, each a warm-up stage (unless warmup is 0)
+// followed by the measured stage.
+func curveProfile(from, to float64, steps int, stepDuration, warmup time.Duration) *Profile {
+	p := &Profile{}
+	for i := 0; i < steps; i++ {
+		rate := from
+		if steps > 1 {
+			rate = from + (to-from)*float64(i)/float64(steps-1)
+		}
+		rate = math.Round(rate*100) / 100
+		if warmup > 0 {
+			p.Stages = append(p.Stages, Stage{Name: curveWarmupStage(rate), Duration: warmup, Rate: rate})
+		}
+		p.Stages = append(p.Stages, Stage{Name: curveStage(rate), Duration: stepDuration, Rate: rate})
+	}
+	return p
+}
+
+// curveStage and curveWarmupStage name the stages of rate.
+func curveStage(rate float64) string       { return fmt.Sprintf("%g req/s", rate) }
+func curveWarmupStage(rate float64) string { return "warm-up " + curveStage(rate) }
+
+// curvePoints picks the measured stages out of a sweep's stage results.
+// Stages a cancelled run never reached are left out.
+func curvePoints(stages []StageSummary) []CurvePoint {
+	var points []CurvePoint
+	for _, s := range stages {
+		if s.Name != curveStage(s.Rate) || s.Requests == 0 {
+			continue
+		}
+		points = append(points, CurvePoint{
+			Rate:      s.Rate,
+			Achieved:  s.RequestsPerSec,
+			Group:     s.GroupSummary,
+			Saturated: s.RequestsPerSec < curveSaturation*s.Rate,
+		})
+	}
+	return points
+}
+
+// printCurve prints the curve as a table, an ASCII plot of metric over the
+// achieved throughput, and where the target saturated.
+func printCurve(w io.Writer, points []CurvePoint, metric curveMetric) {
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	fmt.Fprintln(w, " Latency vs Throughput")
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	if len(points) == 0 {
+		fmt.Fprintln(w, "No rate was measured.")
+		return
+	}
+	fmt.Fprintf(w, "  %10s  %10s  %8s  %10s  %10s  %10s  %10s\n", "Offered", "Achieved", "Errors", "p50", "p95", "p99", "Avg")
+	for _, p := range points {
+		mark := ""
+		if p.Saturated {
+			mark = "  ◀ saturated"
+		}
+		fmt.Fprintf(w, "  %10s  %10s  %7.2f%%  %10s  %10s  %10s  %10s%s\n",
+			fmt.Sprintf("%g/s", p.Rate), fmt.Sprintf("%.1f/s", p.Achieved), p.Group.ErrorRate,
+			formatDuration(p.Group.P50), formatDuration(p.Group.P95), formatDuration(p.Group.P99),
+			formatDuration(p.Group.AvgDuration), mark)
+	}
+	fmt.Fprintln(w)
+	printCurvePlot(w, points, metric)
+	fmt.Fprintln(w)
+
+	for i, p := range points {
+		if p.Saturated {
+			fmt.Fprintf(w, "Saturation:  at %g req/s offered, %.1f req/s achieved", p.Rate, p.Achieved)
+			if i > 0 {
+				fmt.Fprintf(w, " (last kept up at %g req/s, %s %s)", points[i-1].Rate, metric.name, formatDuration(metric.value(points[i-1].Group)))
+			}
+			fmt.Fprintln(w)
+			return
+		}
+	}
+	fmt.Fprintf(w, "Saturation:  none, every rate achieved %.0f%% of the offered rate or more\n", curveSaturation*100)
+}
+
+// printCurvePlot draws metric over the achieved throughput, one ● per
+// point, on axes starting at zero.
+func printCurvePlot(w io.Writer, points []CurvePoint, metric curveMetric) {
+	maxX, maxY := 0.0, time.Duration(0)
+	for _, p := range points {
+		maxX = math.Max(maxX, p.Achieved)
+		maxY = max(maxY, metric.value(p.Group))
+	}
+	if maxX == 0 || maxY == 0 {
+		return
+	}
+
+	grid := make([][]rune, curvePlotHeight)
+	for i := range grid {
+		grid[i] = []rune(strings.Repeat(" ", curvePlotWidth))
+	}
+	for _, p := range points {
+		col := int(math.Round(p.Achieved / maxX * float64(curvePlotWidth-1)))
+		row := curvePlotHeight - 1 - int(math.Round(float64(metric.value(p.Group))/float64(maxY)*float64(curvePlotHeight-1)))
+		grid[row][col] = '●'
+	}
+
+	fmt.Fprintf(w, "  %s over achieved throughput:\n", metric.name)
+	for i, row := range grid {
+		label := ""
+		switch i {
+		case 0:
+			label = formatDuration(maxY)
+		case curvePlotHeight / 2:
+			label = formatDuration(maxY / 2)
+		}
+		fmt.Fprintf(w, "  %9s │%s\n", label, strings.TrimRight(string(row), " "))
+	}
+	fmt.Fprintf(w, "  %9s └%s\n", "0", strings.Repeat("─", curvePlotWidth))
+	right := fmt.Sprintf("%.0f req/s", maxX)
+	fmt.Fprintf(w, "  %9s  0%*s\n", "", curvePlotWidth-1, right)
+}
+
+// writeCurveCSV writes the curve as CSV, one row per rate.
+func writeCurveCSV(w io.Writer, points []CurvePoint) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"offered_rps", "achieved_rps", "requests", "errors", "error_rate",
+		"avg_ms", "p50_ms", "p90_ms", "p95_ms", "p99_ms", "saturated"})
+	for _, p := range points {
+		cw.Write([]string{
+			strconv.FormatFloat(p.Rate, 'f', -1, 64),
+			strconv.FormatFloat(p.Achieved, 'f', 2, 64),
+			strconv.Itoa(p.Group.Requests),
+			strconv.Itoa(p.Group.Errors),
+			strconv.FormatFloat(p.Group.ErrorRate, 'f', 2, 64),
+			strconv.FormatFloat(ms(p.Group.AvgDuration), 'f', 3, 64),
+			strconv.FormatFloat(ms(p.Group.P50), 'f', 3, 64),
+			strconv.FormatFloat(ms(p.Group.P90), 'f', 3, 64),
+			strconv.FormatFloat(ms(p.Group.P95), 'f', 3, 64),
+			strconv.FormatFloat(ms(p.Group.P99), 'f', 3, 64),
+			strconv.FormatBool(p.Saturated),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Size and margin of the HTML chart in pixels.
+const (
+	curveChartWidth  = 720
+	curveChartHeight = 360
+	curveChartMargin = 60
+)
+
+// curveChartPoint is a point of the HTML chart in SVG coordinates.
+type curveChartPoint struct {
+	X, Y      float64
+	Saturated bool
+	Title     string
+}
+
+// curveHTMLTemplate is the page of `curve -html`. Like -output html it has
+// no external assets; the chart is inline SVG.
+var curveHTMLTemplate = template.Must(template.New("curve").Funcs(template.FuncMap{
+	"duration": formatDuration,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Latency vs Throughput</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: right; }
+th { background: #f3f3f3; }
+.fail { color: #b00020; font-weight: bold; }
+svg text { font-size: 12px; fill: #555; }
+</style>
+</head>
+<body>
+<h1>Latency vs Throughput</h1>
+<p><code>{{.URL}}</code>, {{.Metric}} latency over achieved throughput.</p>
+<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}">
+<line x1="{{.Left}}" y1="{{.Bottom}}" x2="{{.Right}}" y2="{{.Bottom}}" stroke="#999"/>
+<line x1="{{.Left}}" y1="{{.Top}}" x2="{{.Left}}" y2="{{.Bottom}}" stroke="#999"/>
+<text x="{{.Left}}" y="{{.Bottom}}" dx="-6" dy="4" text-anchor="end">0</text>
+<text x="{{.Left}}" y="{{.Top}}" dx="-6" dy="4" text-anchor="end">{{duration .MaxY}}</text>
+<text x="{{.Right}}" y="{{.Bottom}}" dy="18" text-anchor="end">{{printf "%.0f" .MaxX}} req/s</text>
+<polyline fill="none" stroke="#3366cc" stroke-width="2" points="{{range .Points}}{{printf "%.1f,%.1f " .X .Y}}{{end}}"/>
+{{range .Points}}<circle cx="{{printf "%.1f" .X}}" cy="{{printf "%.1f" .Y}}" r="4" fill="{{if .Saturated}}#b00020{{else}}#3366cc{{end}}"><title>{{.Title}}</title></circle>
+{{end}}</svg>
+<table>
+<tr><th>Offered</th><th>Achieved</th><th>Requests</th><th>Error rate</th><th>p50</th><th>p90</th><th>p95</th><th>p99</th><th>Avg</th></tr>
+{{range .Rows}}<tr{{if .Saturated}} class="fail"{{end}}><td>{{.Rate}}/s</td><td>{{printf "%.1f" .Achieved}}/s</td><td>{{.Group.Requests}}</td><td>{{printf "%.2f" .Group.ErrorRate}}%</td><td>{{duration .Group.P50}}</td><td>{{duration .Group.P90}}</td><td>{{duration .Group.P95}}</td><td>{{duration .Group.P99}}</td><td>{{duration .Group.AvgDuration}}</td></tr>
+{{end}}</table>
+<p>Rates in red achieved less than {{.Saturation}}% of the offered rate.</p>
+</body>
+</html>
+`))
+
+// writeCurveHTML writes the curve of url as an HTML page charting metric
+// over the achieved throughput.
+func writeCurveHTML(w io.Writer, url string, points []CurvePoint, metric curveMetric) error {
+	maxX, maxY := 0.0, time.Duration(0)
+	for _, p := range points {
+		maxX = math.Max(maxX, p.Achieved)
+		maxY = max(maxY, metric.value(p.Group))
+	}
+	left, top := float64(curveChartMargin), float64(curveChartMargin/2)
+	right, bottom := float64(curveChartWidth-curveChartMargin/2), float64(curveChartHeight-curveChartMargin)
+
+	chart := make([]curveChartPoint, 0, len(points))
+	for _, p := range points {
+		c := curveChartPoint{X: left, Y: bottom, Saturated: p.Saturated}
+		if maxX > 0 {
+			c.X += p.Achieved / maxX * (right - left)
+		}
+		if maxY > 0 {
+			c.Y -= float64(metric.value(p.Group)) / float64(maxY) * (bottom - top)
+		}
+		c.Title = fmt.Sprintf("%g req/s offered, %.1f achieved, %s %s", p.Rate, p.Achieved, metric.name, formatDuration(metric.value(p.Group)))
+		chart = append(chart, c)
+	}
+
+	return curveHTMLTemplate.Execute(w, struct {
+		URL, Metric              string
+		Width, Height            int
+		Left, Top, Right, Bottom float64
+		MaxX                     float64
+		MaxY                     time.Duration
+		Points                   []curveChartPoint
+		Rows                     []CurvePoint
+		Saturation               float64
+	}{
+		URL: url, Metric: metric.name,
+		Width: curveChartWidth, Height: curveChartHeight,
+		Left: left, Top: top, Right: right, Bottom: bottom,
+		MaxX: maxX, MaxY: maxY,
+		Points:     chart,
+		Rows:       points,
+		Saturation: curveSaturation * 100,
+	})
+}
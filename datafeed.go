@@ -0,0 +1,132 @@
+// datafeed.go implements CSV data feeds (-data): the rows of a CSV file
+// whose columns templates use as {{$csv(column)}}. Every placeholder of a
+// request reads the same row, chosen from the request index (in scenario
+// mode, the iteration index, so all steps of an iteration share a row),
+// so an email and the matching password always go together.
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Row orders of -data-order.
+const (
+	dataOrderCycle  = "cycle"
+	dataOrderRandom = "random"
+)
+
+// dataFeed holds the rows of a -data file.
+type dataFeed struct {
+	path    string
+	order   string         // dataOrderCycle or dataOrderRandom
+	columns map[string]int // Column name -> index, from the header row
+	names   []string       // Column names in file order
+	rows    [][]string
+
+	seedOnce sync.Once
+	seed     uint64 // Picks the rows of dataOrderRandom, drawn on first use
+}
+
+// loadDataFeed reads the CSV file at path. Its first row names the
+// columns; every further row is a record.
+func loadDataFeed(path, order string) (*dataFeed, error) {
+	if order != dataOrderCycle && order != dataOrderRandom {
+		return nil, fmt.Errorf("invalid -data-order %q, expected %s or %s", order, dataOrderCycle, dataOrderRandom)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading data file: %w", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("data file %s is empty, expected a header row naming the columns", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing data file %s: %w", path, err)
+	}
+	feed := &dataFeed{path: path, order: order, columns: make(map[string]int)}
+	for i, name := range header {
+		// Spreadsheet exports often start with a byte order mark.
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if name == "" {
+			return nil, fmt.Errorf("data file %s: column %d has no name", path, i+1)
+		}
+		if _, dup := feed.columns[name]; dup {
+			return nil, fmt.Errorf("data file %s: duplicate column %q", path, name)
+		}
+		feed.columns[name] = i
+		feed.names = append(feed.names, name)
+	}
+	if feed.rows, err = r.ReadAll(); err != nil {
+		return nil, fmt.Errorf("parsing data file %s: %w", path, err)
+	}
+	if len(feed.rows) == 0 {
+		return nil, fmt.Errorf("data file %s has no rows below its header", path)
+	}
+	return feed, nil
+}
+
+// row returns the row used by request requestIndex.
+func (d *dataFeed) row(requestIndex int) []string {
+	n := uint64(len(d.rows))
+	if d.order == dataOrderCycle {
+		return d.rows[uint64(requestIndex)%n]
+	}
+	d.seedOnce.Do(func() { d.seed = mathrand.Uint64() })
+	return d.rows[splitmix64(d.seed+uint64(requestIndex))%n]
+}
+
+// seedWith makes the random order of d follow seed rather than a seed
+// drawn at random.
+func (d *dataFeed) seedWith(seed int64) {
+	d.seedOnce.Do(func() { d.seed = splitmix64(uint64(seed)) })
+}
+
+// splitmix64 scrambles x, so that consecutive request indexes pick
+// unrelated rows.
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// generator returns the generator of {{$csv(column)}}.
+func (d *dataFeed) generator(column string) (generatorFunc, error) {
+	i, ok := d.columns[column]
+	if !ok {
+		return nil, fmt.Errorf("$csv: no column %q in %s (columns: %s)", column, d.path, strings.Join(d.names, ", "))
+	}
+	// The CSV reader rejects rows with a different number of fields than
+	// the header, so every row has column i.
+	return func(requestIndex int, _ *mathrand.Rand) string {
+		return d.row(requestIndex)[i]
+	}, nil
+}
+
+// describe summarizes the feed for the banner.
+func (d *dataFeed) describe() string {
+	return fmt.Sprintf("%s (%d rows, %s order; columns: %s)", d.path, len(d.rows), d.order, strings.Join(d.names, ", "))
+}
+
+// csvGenerator returns the generator of {{$csv(column)}} on the feed of
+// c, so each -config file's templates read their own feed.
+func (c *templateContext) csvGenerator(params string) (generatorFunc, error) {
+	column := strings.TrimSpace(params)
+	if column == "" {
+		return nil, fmt.Errorf("$csv: expected a column name, e.g. $csv(email)")
+	}
+	if c.feed == nil {
+		return nil, fmt.Errorf("$csv(%s) needs a -data file", column)
+	}
+	return c.feed.generator(column)
+}
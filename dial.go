@@ -0,0 +1,187 @@
+// dial.go instruments connection establishment. Every new connection is
+// classified by address family (IPv4/IPv6) and timed, and connections to
+// dual-stack hosts that only succeeded over IPv4 after the Happy Eyeballs
+// fallback delay are counted, so broken IPv6 paths that silently inflate
+// connect times become visible in the summary. New connections can also be
+// rate limited (-max-conn-rate), since WAFs and load balancers may treat a
+// burst of new connections from one client as an attack. Open connections
+// are counted until closed, for the cleanup check after a run.
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// openConns is the number of connections dialed by instrumented dialers
+// that are not closed yet, across all runs of the process.
+var openConns atomic.Int64
+
+// trackedConn is a connection counted in openConns until it is closed.
+type trackedConn struct {
+	net.Conn
+	closed atomic.Bool
+}
+
+// Close closes the connection, counting it as closed once.
+func (c *trackedConn) Close() error {
+	if c.closed.CompareAndSwap(false, true) {
+		openConns.Add(-1)
+	}
+	return c.Conn.Close()
+}
+
+// happyEyeballsDelay is the delay before net.Dialer falls back from the
+// primary (IPv6) address family to IPv4. It matches the net package default.
+const happyEyeballsDelay = 300 * time.Millisecond
+
+// instrumentedDialer wraps a net.Dialer and reports every established
+// connection to stats.
+type instrumentedDialer struct {
+	dialer *net.Dialer
+	stats  *Stats
+
+	mu        sync.Mutex
+	dualStack map[string]bool // host -> resolves to both IPv4 and IPv6
+	connRate  *pacer          // Schedule of new connections, nil if unlimited; guarded by mu
+}
+
+// newInstrumentedDialer returns a dialer that records connection metrics
+// on stats and opens at most maxConnRate connections per second (0 for
+// no limit).
+func newInstrumentedDialer(stats *Stats, maxConnRate float64) *instrumentedDialer {
+	return &instrumentedDialer{
+		dialer: &net.Dialer{
+			Timeout:       30 * time.Second,
+			KeepAlive:     30 * time.Second,
+			FallbackDelay: happyEyeballsDelay,
+		},
+		stats:     stats,
+		dualStack: make(map[string]bool),
+		connRate:  newPacer(maxConnRate),
+	}
+}
+
+// DialContext dials addr and records the address family and dial time of
+// the resulting connection. It has the signature of Transport.DialContext.
+// Under a connection rate limit it first waits for its slot; the wait is
+// recorded separately and not counted as dial time.
+func (d *instrumentedDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if err := d.waitConnSlot(ctx); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	conn, err := d.dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(start)
+
+	family := "unknown"
+	if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		if tcpAddr.IP.To4() != nil {
+			family = "IPv4"
+		} else {
+			family = "IPv6"
+		}
+	}
+
+	// An IPv4 connection to a dual-stack host that took longer than the
+	// fallback delay most likely means the IPv6 attempt failed or hung.
+	fallback := false
+	if family == "IPv4" && elapsed >= happyEyeballsDelay {
+		host, _, splitErr := net.SplitHostPort(addr)
+		if splitErr == nil && d.isDualStack(ctx, host) {
+			fallback = true
+		}
+	}
+
+	d.stats.RecordDial(family, elapsed, fallback)
+	openConns.Add(1)
+	return &trackedConn{Conn: conn}, nil
+}
+
+// waitConnSlot blocks until the connection rate limit allows another
+// connection or ctx is done.
+func (d *instrumentedDialer) waitConnSlot(ctx context.Context) error {
+	if d.connRate == nil {
+		return nil
+	}
+	d.mu.Lock()
+	due := d.connRate.reserve()
+	d.mu.Unlock()
+
+	wait := time.Until(due)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		d.stats.RecordConnWait(wait)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseConnRate parses a -max-conn-rate value: connections per second,
+// written as "100", "100/s" or "6000/m". An empty value means no limit.
+func parseConnRate(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	per := time.Second
+	num := s
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		switch s[i+1:] {
+		case "s":
+		case "m":
+			per = time.Minute
+		default:
+			return 0, fmt.Errorf("invalid -max-conn-rate %q, expected N/s or N/m", s)
+		}
+		num = s[:i]
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid -max-conn-rate %q, expected a positive rate such as 100/s", s)
+	}
+	return n / per.Seconds(), nil
+}
+
+// isDualStack reports whether host resolves to both IPv4 and IPv6 addresses.
+// The answer is cached per host so each host is looked up at most once.
+func (d *instrumentedDialer) isDualStack(ctx context.Context, host string) bool {
+	d.mu.Lock()
+	cached, ok := d.dualStack[host]
+	d.mu.Unlock()
+	if ok {
+		return cached
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return false
+	}
+	var v4, v6 bool
+	for _, a := range addrs {
+		if a.IP.To4() != nil {
+			v4 = true
+		} else {
+			v6 = true
+		}
+	}
+
+	d.mu.Lock()
+	d.dualStack[host] = v4 && v6
+	d.mu.Unlock()
+	return v4 && v6
+}
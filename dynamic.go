@@ -6,35 +6,47 @@ package main
 
 import (
 	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-	"math/big"
 	mathrand "math/rand"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // generatorFunc produces a dynamic string value for a single request.
 // The requestIndex parameter is the zero-based sequence number of the
-// request within the load test run.
-type generatorFunc func(requestIndex int) string
+// request within the load test run, and rng the random source of the
+// worker rendering it, which random generators draw from rather than from
+// the shared source: rendering takes no lock, and -seed runs are
+// reproducible.
+type generatorFunc func(requestIndex int, rng *mathrand.Rand) string
 
 // templateSegment represents either a static text fragment, a dynamic
-// placeholder, or a variable lookup within a parsed template. Exactly one
-// of staticText, generator, or varName is used per segment.
+// placeholder, a variable lookup, or a repeated or conditional fragment
+// within a parsed template. Exactly one of staticText, generator, varName,
+// loop or cond is used per segment.
 type templateSegment struct {
 	staticText string
 	generator  generatorFunc
 	name       string // placeholder name (e.g. "$uuid"), empty for static segments
 	varName    string // variable name for {{.varName}} lookups, empty for non-var segments
+	loop       *templateLoop
+	cond       *templateCond
+	tag        string // tag name of a {{$label(NAME,...)}} generator
+	source     string // generator placeholder as written, e.g. "$randomInt(1,500)"
 }
 
 // Template is a parsed template that can efficiently render per-request
 // strings by concatenating static segments and dynamic generator outputs.
 type Template struct {
 	segments     []templateSegment
-	placeholders []string // unique placeholder names found in the template
-	raw          string   // original unparsed template string
+	placeholders []string    // unique placeholder names found in the template
+	raw          string      // original unparsed template string
+	goTmpl       *goTemplate // set for dynamic templates of the Go engine
 }
 
 // splitPlaceholder splits a raw placeholder text into a base name and a
@@ -89,6 +101,57 @@ func parseIntParams(raw string, defaults ...int) ([]int, error) {
 	return result, nil
 }
 
+// splitChoices splits the values of $randomChoice at '|'. A backslash
+// escapes a '|' or a backslash that is part of a value, as in `a\|b|c`.
+func splitChoices(raw string) ([]string, error) {
+	if raw == "" {
+		return nil, fmt.Errorf("expected values separated by '|'")
+	}
+	var choices []string
+	var cur strings.Builder
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; c {
+		case '\\':
+			if i+1 == len(raw) || (raw[i+1] != '|' && raw[i+1] != '\\') {
+				return nil, fmt.Errorf("invalid escape in %q, only \\| and \\\\ are allowed", raw)
+			}
+			i++
+			cur.WriteByte(raw[i])
+		case '|':
+			choices = append(choices, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	return append(choices, cur.String()), nil
+}
+
+// parseWeightedChoices parses the VALUE:WEIGHT pairs of $weightedChoice,
+// split as by splitChoices. The weight follows the last ':', so values may
+// contain colons themselves. It returns the values, their weights and the
+// sum of the weights.
+func parseWeightedChoices(raw string) (choices []string, weights []int, total int, err error) {
+	parts, err := splitChoices(raw)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	for _, part := range parts {
+		i := strings.LastIndex(part, ":")
+		if i == -1 {
+			return nil, nil, 0, fmt.Errorf("invalid choice %q, expected VALUE:WEIGHT, e.g. red:70", part)
+		}
+		w, err := strconv.Atoi(strings.TrimSpace(part[i+1:]))
+		if err != nil || w <= 0 {
+			return nil, nil, 0, fmt.Errorf("invalid weight in %q, expected a positive integer", part)
+		}
+		choices = append(choices, part[:i])
+		weights = append(weights, w)
+		total += w
+	}
+	return choices, weights, total, nil
+}
+
 // noParams is a helper that returns an error if a parameterless generator
 // receives parameters.
 func noParams(name, params string) error {
@@ -98,79 +161,236 @@ func noParams(name, params string) error {
 	return nil
 }
 
-// ParseTemplate parses a template string and returns a Template.
-// Placeholders use the syntax {{$name}}. Unknown placeholders cause an error.
-// If the template contains no placeholders, Render returns the original
-// string without allocations (the fast path).
-func ParseTemplate(raw string) (*Template, error) {
-	t := &Template{raw: raw}
-	seen := make(map[string]bool)
+// templateContext is what templates bind to when they are parsed: the
+// -template-engine, -data feed, -jwt-secret key and -seed of the
+// configuration they belong to. Each configuration parses its templates
+// with a context of its own, so that configurations parsed in one process,
+// such as the tests of -config, do not share them.
+type templateContext struct {
+	engine string    // engineBuiltin or engineGo
+	feed   *dataFeed // The feed {{$csv(column)}} reads, nil without -data
+	jwtKey []byte    // The key {{$jwt}} signs with, nil if there is none
+	seed   int64     // 0 if the run is not seeded
+
+	// noLocalReads rejects the placeholders reading files and environment
+	// variables, in templates forwarded to an agent.
+	noLocalReads bool
+
+	goGenerators sync.Map // Generators Go templates call, see goGenerator
+}
 
-	remaining := raw
+// ParseTemplate parses a template string with the engine of c and returns
+// a Template bound to the feed, key and seed of c. Placeholders use the
+// syntax {{$name}}. Unknown placeholders cause an error. If the template
+// contains no placeholders, Render returns the original string without
+// allocations (the fast path).
+//
+// Two actions shape the template itself. {{repeat N}}...{{end}} renders
+// the enclosed fragment N times, and {{repeat N "SEP"}} puts the Go-quoted
+// separator SEP between the repetitions, e.g.
+// [{{repeat 3 ","}}{"id":"{{$uuid}}"}{{end}}]. {{if prob(P)}}...{{end}}
+// renders the enclosed fragment with probability P, and the fragment of an
+// optional {{else}} otherwise. Actions may nest.
+func (c *templateContext) ParseTemplate(raw string) (*Template, error) {
+	if c.engine == engineGo {
+		return c.parseGoTemplate(raw)
+	}
+	p := &templateParser{ctx: c, seen: make(map[string]bool)}
+	segments, _, term, err := p.parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing template: %w", err)
+	}
+	if term != "" {
+		return nil, fmt.Errorf("parsing template: {{%s}} without {{repeat}} or {{if}}", term)
+	}
+	return &Template{raw: raw, segments: segments, placeholders: p.placeholders}, nil
+}
+
+// templateParser holds the state of one ParseTemplate call.
+type templateParser struct {
+	ctx          *templateContext
+	seen         map[string]bool
+	placeholders []string
+}
+
+// note records a placeholder name the first time it is found.
+func (p *templateParser) note(name string) {
+	if !p.seen[name] {
+		p.seen[name] = true
+		p.placeholders = append(p.placeholders, name)
+	}
+}
+
+// parse parses the segments of remaining up to its end or the first
+// {{end}} or {{else}} that belongs to no action of its own. It returns the
+// text after that action and its name, "end" or "else", or "" if remaining
+// ran out.
+func (p *templateParser) parse(remaining string) (segments []templateSegment, rest, term string, err error) {
 	for {
 		openIdx := strings.Index(remaining, "{{")
 		if openIdx == -1 {
 			// No more placeholders; append the rest as static text.
 			if len(remaining) > 0 {
-				t.segments = append(t.segments, templateSegment{staticText: remaining})
+				segments = append(segments, templateSegment{staticText: remaining})
 			}
-			break
+			return segments, "", "", nil
 		}
 
 		closeIdx := strings.Index(remaining[openIdx:], "}}")
 		if closeIdx == -1 {
 			// Unclosed {{ — treat the rest as literal text.
-			t.segments = append(t.segments, templateSegment{staticText: remaining})
-			break
+			segments = append(segments, templateSegment{staticText: remaining})
+			return segments, "", "", nil
 		}
 		closeIdx += openIdx // adjust to absolute position
 
 		// Static text before the placeholder.
 		if openIdx > 0 {
-			t.segments = append(t.segments, templateSegment{staticText: remaining[:openIdx]})
+			segments = append(segments, templateSegment{staticText: remaining[:openIdx]})
 		}
 
 		// Extract the placeholder (e.g. "$sequence(1,3)" from "{{$sequence(1,3)}}").
 		rawPlaceholder := strings.TrimSpace(remaining[openIdx+2 : closeIdx])
+		remaining = remaining[closeIdx+2:]
+
+		switch {
+		case rawPlaceholder == "end" || rawPlaceholder == "else":
+			return segments, remaining, rawPlaceholder, nil
+
+		case rawPlaceholder == "repeat" || strings.HasPrefix(rawPlaceholder, "repeat "):
+			loop, err := parseRepeat(rawPlaceholder)
+			if err != nil {
+				return nil, "", "", err
+			}
+			p.note("repeat")
+			var term string
+			loop.body, remaining, term, err = p.parse(remaining)
+			if err != nil {
+				return nil, "", "", err
+			}
+			if err := checkEnd(rawPlaceholder, term); err != nil {
+				return nil, "", "", err
+			}
+			segments = append(segments, templateSegment{loop: loop, name: "repeat"})
+
+		case rawPlaceholder == "if" || strings.HasPrefix(rawPlaceholder, "if "):
+			cond, err := parseIf(rawPlaceholder)
+			if err != nil {
+				return nil, "", "", err
+			}
+			p.note("if")
+			var term string
+			cond.then, remaining, term, err = p.parse(remaining)
+			if err == nil && term == "else" {
+				cond.els, remaining, term, err = p.parse(remaining)
+			}
+			if err != nil {
+				return nil, "", "", err
+			}
+			if err := checkEnd(rawPlaceholder, term); err != nil {
+				return nil, "", "", err
+			}
+			segments = append(segments, templateSegment{cond: cond, name: "if"})
 
-		if strings.HasPrefix(rawPlaceholder, ".") {
+		case strings.HasPrefix(rawPlaceholder, "."):
 			// Variable lookup: {{.varName}} — resolved at render time from vars map.
 			vName := rawPlaceholder[1:] // strip leading "."
 			if vName == "" {
-				return nil, fmt.Errorf("parsing template: empty variable name in {{.}}")
+				return nil, "", "", fmt.Errorf("empty variable name in {{.}}")
 			}
-			t.segments = append(t.segments, templateSegment{varName: vName, name: rawPlaceholder})
-			if !seen[rawPlaceholder] {
-				seen[rawPlaceholder] = true
-				t.placeholders = append(t.placeholders, rawPlaceholder)
-			}
-		} else {
+			segments = append(segments, templateSegment{varName: vName, name: rawPlaceholder})
+			p.note(rawPlaceholder)
+
+		default:
 			baseName, params, err := splitPlaceholder(rawPlaceholder)
 			if err != nil {
-				return nil, fmt.Errorf("parsing template: %w", err)
+				return nil, "", "", err
 			}
-			name := baseName
-			gen, err := lookupGenerator(baseName, params)
-			if err != nil {
-				return nil, fmt.Errorf("parsing template: %w", err)
+			var tag string
+			var gen generatorFunc
+			if baseName == tagPlaceholder {
+				tag, gen, err = p.ctx.parseTag(params)
+			} else {
+				gen, err = p.ctx.lookupGenerator(baseName, params)
 			}
-
-			t.segments = append(t.segments, templateSegment{generator: gen, name: name})
-			if !seen[name] {
-				seen[name] = true
-				t.placeholders = append(t.placeholders, name)
+			if err != nil {
+				return nil, "", "", err
 			}
+			segments = append(segments, templateSegment{generator: gen, name: baseName, tag: tag, source: rawPlaceholder})
+			p.note(baseName)
 		}
+	}
+}
 
-		remaining = remaining[closeIdx+2:]
+// checkEnd reports an error unless the fragment of action ended at term
+// "end".
+func checkEnd(action, term string) error {
+	switch term {
+	case "end":
+		return nil
+	case "else":
+		return fmt.Errorf("unexpected {{else}} in {{%s}}", action)
 	}
+	return fmt.Errorf("{{%s}} has no {{end}}", action)
+}
 
-	return t, nil
+// templateLoop is a {{repeat N "SEP"}}...{{end}} fragment.
+type templateLoop struct {
+	count int
+	sep   string
+	body  []templateSegment
+}
+
+// maxRepeat caps the count of a repeat, so that a typo can't build
+// gigabyte bodies.
+const maxRepeat = 100000
+
+// parseRepeat parses the count and optional separator of a repeat action,
+// such as `repeat 10 ","`.
+func parseRepeat(action string) (*templateLoop, error) {
+	args := strings.TrimSpace(strings.TrimPrefix(action, "repeat"))
+	countArg, sepArg, _ := strings.Cut(args, " ")
+	count, err := strconv.Atoi(countArg)
+	if err != nil || count < 0 || count > maxRepeat {
+		return nil, fmt.Errorf("{{%s}}: expected a count between 0 and %d, e.g. {{repeat 10}}", action, maxRepeat)
+	}
+	loop := &templateLoop{count: count}
+	if sepArg = strings.TrimSpace(sepArg); sepArg != "" {
+		if loop.sep, err = strconv.Unquote(sepArg); err != nil {
+			return nil, fmt.Errorf("{{%s}}: the separator must be a quoted string, e.g. {{repeat 10 \",\"}}", action)
+		}
+	}
+	return loop, nil
+}
+
+// templateCond is an {{if prob(P)}}...{{else}}...{{end}} fragment.
+type templateCond struct {
+	prob float64
+	then []templateSegment
+	els  []templateSegment
+}
+
+// parseIf parses the condition of an if action, such as `if prob(0.1)`.
+// Only prob(P), true with probability P, is supported.
+func parseIf(action string) (*templateCond, error) {
+	arg := strings.TrimSpace(strings.TrimPrefix(action, "if"))
+	inner, ok := strings.CutPrefix(arg, "prob(")
+	if ok {
+		inner, ok = strings.CutSuffix(inner, ")")
+	}
+	if !ok {
+		return nil, fmt.Errorf("{{%s}}: expected a condition of the form prob(P), e.g. {{if prob(0.1)}}", action)
+	}
+	prob, err := strconv.ParseFloat(strings.TrimSpace(inner), 64)
+	if err != nil || prob < 0 || prob > 1 {
+		return nil, fmt.Errorf("{{%s}}: the probability must be a number between 0 and 1", action)
+	}
+	return &templateCond{prob: prob}, nil
 }
 
 // HasPlaceholders reports whether the template contains any dynamic placeholders.
 func (t *Template) HasPlaceholders() bool {
-	return len(t.placeholders) > 0
+	return len(t.placeholders) > 0 || t.goTmpl != nil
 }
 
 // Placeholders returns the unique placeholder names found in the template.
@@ -179,17 +399,45 @@ func (t *Template) Placeholders() []string {
 }
 
 // Render generates a concrete string for the given request index by
-// evaluating every placeholder generator. If no placeholders exist,
-// it returns the original raw string without any allocation.
-func (t *Template) Render(requestIndex int) string {
-	return t.RenderWithVars(requestIndex, nil)
+// evaluating every placeholder generator, drawing random values from rng.
+// If no placeholders exist, it returns the original raw string without any
+// allocation.
+func (t *Template) Render(requestIndex int, rng *mathrand.Rand) string {
+	return t.RenderWithVars(requestIndex, rng, nil)
 }
 
 // RenderWithVars generates a concrete string for the given request index,
 // resolving both $generator placeholders and .varName variable lookups.
 // The vars map provides values for {{.varName}} placeholders. If a variable
 // is not found in the map, it is rendered as an empty string.
-func (t *Template) RenderWithVars(requestIndex int, vars map[string]string) string {
+func (t *Template) RenderWithVars(requestIndex int, rng *mathrand.Rand, vars map[string]string) string {
+	return t.RenderRecording(requestIndex, rng, vars, nil)
+}
+
+// generatedValue is the value a generator placeholder rendered to.
+type generatedValue struct {
+	Placeholder string `json:"placeholder"` // Base name, e.g. "$randomInt"
+	Value       string `json:"value"`
+
+	// Tag is the name of the tag a $label placeholder set, "" for other
+	// placeholders.
+	Tag string `json:"tag,omitempty"`
+
+	// Source is the placeholder as written, e.g. "$randomInt(1,500)", which
+	// -value-report groups values by.
+	Source string `json:"-"`
+}
+
+// RenderRecording is RenderWithVars that also appends the value of every
+// generator placeholder, in template order, to values unless it is nil.
+func (t *Template) RenderRecording(requestIndex int, rng *mathrand.Rand, vars map[string]string, values *[]generatedValue) string {
+	if t.goTmpl != nil {
+		// Errors depending on the data, such as a missing -data column,
+		// were reported when the template was parsed; what renders
+		// regardless is sent.
+		s, _ := t.goTmpl.render(requestIndex, rng, vars, values)
+		return s
+	}
 	if !t.HasPlaceholders() {
 		return t.raw
 	}
@@ -198,32 +446,59 @@ func (t *Template) RenderWithVars(requestIndex int, vars map[string]string) stri
 	// Pre-size the builder to roughly the raw length to avoid resizing.
 	b.Grow(len(t.raw))
 
-	for i := range t.segments {
-		seg := &t.segments[i]
+	renderSegments(&b, t.segments, requestIndex, rng, vars, values)
+	return b.String()
+}
+
+// renderSegments writes segments, rendered for request requestIndex, to b.
+func renderSegments(b *strings.Builder, segments []templateSegment, requestIndex int, rng *mathrand.Rand, vars map[string]string, values *[]generatedValue) {
+	for i := range segments {
+		seg := &segments[i]
 		if seg.varName != "" {
 			if vars != nil {
 				b.WriteString(vars[seg.varName])
 			}
 		} else if seg.generator != nil {
-			b.WriteString(seg.generator(requestIndex))
+			v := seg.generator(requestIndex, rng)
+			if values != nil {
+				*values = append(*values, generatedValue{Placeholder: seg.name, Value: v, Tag: seg.tag, Source: seg.source})
+			}
+			b.WriteString(v)
+		} else if seg.loop != nil {
+			for n := range seg.loop.count {
+				if n > 0 {
+					b.WriteString(seg.loop.sep)
+				}
+				renderSegments(b, seg.loop.body, requestIndex, rng, vars, values)
+			}
+		} else if seg.cond != nil {
+			if rng.Float64() < seg.cond.prob {
+				renderSegments(b, seg.cond.then, requestIndex, rng, vars, values)
+			} else {
+				renderSegments(b, seg.cond.els, requestIndex, rng, vars, values)
+			}
 		} else {
 			b.WriteString(seg.staticText)
 		}
 	}
-
-	return b.String()
 }
 
 // lookupGenerator returns the generator function for a named placeholder.
 // Parameterized placeholders (e.g. $sequence(1,3)) parse their params here
 // and return a closure capturing the parsed values. Parameterless generators
 // reject non-empty params with a clear error.
-func lookupGenerator(name, params string) (generatorFunc, error) {
+func (c *templateContext) lookupGenerator(name, params string) (generatorFunc, error) {
+	if c.noLocalReads && (name == "$env" || name == "$file" || name == "$lines") {
+		return nil, fmt.Errorf("%s reads the agent's files or environment, %s", name, localReadsHint)
+	}
 	switch name {
 	case "$uuid":
 		if err := noParams(name, params); err != nil {
 			return nil, err
 		}
+		if c.seed != 0 {
+			return genSeededUUID, nil
+		}
 		return genUUID, nil
 
 	case "$randomInt":
@@ -238,8 +513,8 @@ func lookupGenerator(name, params string) (generatorFunc, error) {
 		if min == 0 && max == 10000 && params == "" {
 			return genRandomInt, nil // fast path: default behavior
 		}
-		return func(_ int) string {
-			return fmt.Sprintf("%d", min+mathrand.Intn(max-min+1))
+		return func(_ int, rng *mathrand.Rand) string {
+			return fmt.Sprintf("%d", min+rng.Intn(max-min+1))
 		}, nil
 
 	case "$randomFloat":
@@ -249,16 +524,19 @@ func lookupGenerator(name, params string) (generatorFunc, error) {
 		return genRandomFloat, nil
 
 	case "$timestamp":
-		if err := noParams(name, params); err != nil {
-			return nil, err
+		if params == "" {
+			return genTimestamp, nil // fast path: default behavior
 		}
-		return genTimestamp, nil
+		return timestampGenerator(name, params, "unix")
 
 	case "$timestampISO":
-		if err := noParams(name, params); err != nil {
-			return nil, err
+		if params == "" {
+			return genTimestampISO, nil // fast path: default behavior
 		}
-		return genTimestampISO, nil
+		return timestampGenerator(name, params, "rfc3339")
+
+	case "$randomDate":
+		return randomDateGenerator(params)
 
 	case "$randomString":
 		p, err := parseIntParams(params, 16)
@@ -272,10 +550,10 @@ func lookupGenerator(name, params string) (generatorFunc, error) {
 		if length == 16 && params == "" {
 			return genRandomString, nil // fast path: default behavior
 		}
-		return func(_ int) string {
+		return func(_ int, rng *mathrand.Rand) string {
 			b := make([]byte, length)
 			for i := range b {
-				b[i] = alphanumeric[mathrand.Intn(len(alphanumeric))]
+				b[i] = alphanumeric[rng.Intn(len(alphanumeric))]
 			}
 			return string(b)
 		}, nil
@@ -305,12 +583,12 @@ func lookupGenerator(name, params string) (generatorFunc, error) {
 			return genSequence, nil // fast path: default behavior
 		}
 		if pad == 0 {
-			return func(requestIndex int) string {
+			return func(requestIndex int, _ *mathrand.Rand) string {
 				return fmt.Sprintf("%d", start+requestIndex)
 			}, nil
 		}
 		fmtStr := fmt.Sprintf("%%0%dd", pad)
-		return func(requestIndex int) string {
+		return func(requestIndex int, _ *mathrand.Rand) string {
 			return fmt.Sprintf(fmtStr, start+requestIndex)
 		}, nil
 
@@ -330,12 +608,12 @@ func lookupGenerator(name, params string) (generatorFunc, error) {
 			return nil, fmt.Errorf("$cycle: pad width must be >= 0, got %d", pad)
 		}
 		if pad == 0 {
-			return func(requestIndex int) string {
+			return func(requestIndex int, _ *mathrand.Rand) string {
 				return fmt.Sprintf("%d", start+(requestIndex%count))
 			}, nil
 		}
 		fmtStr := fmt.Sprintf("%%0%dd", pad)
-		return func(requestIndex int) string {
+		return func(requestIndex int, _ *mathrand.Rand) string {
 			return fmt.Sprintf(fmtStr, start+(requestIndex%count))
 		}, nil
 
@@ -357,15 +635,151 @@ func lookupGenerator(name, params string) (generatorFunc, error) {
 		}
 		return genRandomUA, nil
 
+	case "$padding":
+		// $padding(length) produces a fixed run of 'x' characters, e.g. for
+		// header values that probe size limits.
+		p, err := parseIntParams(params, 1024)
+		if err != nil {
+			return nil, fmt.Errorf("$padding: %w", err)
+		}
+		if p[0] <= 0 {
+			return nil, fmt.Errorf("$padding: length must be > 0, got %d", p[0])
+		}
+		value := padding(p[0])
+		return func(_ int, _ *mathrand.Rand) string { return value }, nil
+
+	case "$randomToken":
+		// $randomToken(length) produces a random string of the characters
+		// allowed in a header name.
+		p, err := parseIntParams(params, 16)
+		if err != nil {
+			return nil, fmt.Errorf("$randomToken: %w", err)
+		}
+		length := p[0]
+		if length <= 0 {
+			return nil, fmt.Errorf("$randomToken: length must be > 0, got %d", length)
+		}
+		return func(_ int, rng *mathrand.Rand) string { return randomToken(rng, length) }, nil
+
+	case "$randomHex":
+		// $randomHex(length) produces length random lowercase hex digits.
+		p, err := parseIntParams(params, 32)
+		if err != nil {
+			return nil, fmt.Errorf("$randomHex: %w", err)
+		}
+		length := p[0]
+		if length <= 0 {
+			return nil, fmt.Errorf("$randomHex: length must be > 0, got %d", length)
+		}
+		return func(_ int, rng *mathrand.Rand) string { return randomHex(rng, length) }, nil
+
+	case "$base64":
+		// $base64(bytes,url) encodes that many random bytes in standard
+		// base64, or in unpadded URL-safe base64 with "url".
+		sizeParam, variant, _ := strings.Cut(params, ",")
+		p, err := parseIntParams(sizeParam, 16)
+		if err != nil {
+			return nil, fmt.Errorf("$base64: %w", err)
+		}
+		size := p[0]
+		if size <= 0 {
+			return nil, fmt.Errorf("$base64: byte count must be > 0, got %d", size)
+		}
+		enc := base64.StdEncoding
+		switch strings.TrimSpace(variant) {
+		case "", "std":
+		case "url":
+			enc = base64.RawURLEncoding
+		default:
+			return nil, fmt.Errorf("$base64: unknown encoding %q, expected std or url", strings.TrimSpace(variant))
+		}
+		return func(_ int, rng *mathrand.Rand) string { return enc.EncodeToString(weakRandomBytes(rng, size)) }, nil
+
+	case "$randomBytesHex":
+		// $randomBytesHex(bytes) hex-encodes that many bytes from
+		// crypto/rand, for tokens that must not be predictable, unless
+		// the run is seeded.
+		p, err := parseIntParams(params, 16)
+		if err != nil {
+			return nil, fmt.Errorf("$randomBytesHex: %w", err)
+		}
+		size := p[0]
+		if size <= 0 {
+			return nil, fmt.Errorf("$randomBytesHex: byte count must be > 0, got %d", size)
+		}
+		if c.seed != 0 {
+			return func(_ int, rng *mathrand.Rand) string { return hex.EncodeToString(weakRandomBytes(rng, size)) }, nil
+		}
+		return func(_ int, _ *mathrand.Rand) string { return hex.EncodeToString(secureRandomBytes(size)) }, nil
+
+	case "$randomChoice":
+		// $randomChoice(a|b|c) picks one of the listed values.
+		choices, err := splitChoices(params)
+		if err != nil {
+			return nil, fmt.Errorf("$randomChoice: %w", err)
+		}
+		return func(_ int, rng *mathrand.Rand) string { return choices[rng.Intn(len(choices))] }, nil
+
+	case "$weightedChoice":
+		// $weightedChoice(a:70|b:20|c:10) picks a value with a probability
+		// proportional to its weight.
+		choices, weights, total, err := parseWeightedChoices(params)
+		if err != nil {
+			return nil, fmt.Errorf("$weightedChoice: %w", err)
+		}
+		return func(_ int, rng *mathrand.Rand) string {
+			n := rng.Intn(total)
+			for i, w := range weights {
+				n -= w
+				if n < 0 {
+					return choices[i]
+				}
+			}
+			return choices[len(choices)-1]
+		}, nil
+
+	case "$env":
+		// $env(NAME) is the value of an environment variable, read once
+		// when the template is parsed, so that secrets such as API keys
+		// stay off the command line.
+		name := strings.TrimSpace(params)
+		if name == "" {
+			return nil, fmt.Errorf("$env: expected a variable name, e.g. $env(API_KEY)")
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("$env: environment variable %s is not set", name)
+		}
+		return func(_ int, _ *mathrand.Rand) string { return value }, nil
+
+	case "$csv":
+		return c.csvGenerator(params)
+
+	case "$file":
+		return fileGenerator(params)
+
+	case "$jwt":
+		return c.jwtGenerator(params)
+
+	case "$lines":
+		return linesGenerator(params)
+
 	default:
-		return nil, fmt.Errorf("unknown placeholder %q (available: $uuid, $randomInt(min,max), $randomFloat, $timestamp, $timestampISO, $randomString(length), $randomEmail, $randomName, $sequence(start,pad), $cycle(start,count,pad), $randomBool, $randomIP, $randomUA)", name)
+		if gen, ok, err := lookupPluginGenerator(name, params); ok {
+			return gen, err
+		}
+		var plugins string
+		if len(pluginGenerators) > 0 {
+			plugins = ", " + pluginGeneratorNames()
+		}
+		return nil, fmt.Errorf("unknown placeholder %q (available: $uuid, $randomInt(min,max), $randomFloat, $timestamp(offset,format), $timestampISO(offset,format), $randomDate(from,to,format), $randomString(length), $randomEmail, $randomName, $sequence(start,pad), $cycle(start,count,pad), $randomBool, $randomIP, $randomUA, $padding(length), $randomToken(length), $randomHex(length), $base64(bytes,url), $randomBytesHex(bytes), $randomChoice(a|b|c), $weightedChoice(a:70|b:30), $env(NAME), $csv(column), $file(path), $lines(path), $jwt(name=value,...), $label(name,placeholder)%s)", name, plugins)
 	}
 }
 
 // --- Built-in Generators ---
 
 // genUUID generates a random UUID v4 string using crypto/rand.
-func genUUID(_ int) string {
+func genUUID(_ int, _ *mathrand.Rand) string {
 	var uuid [16]byte
 	if _, err := rand.Read(uuid[:]); err != nil {
 		// Fallback to math/rand if crypto/rand fails (extremely unlikely).
@@ -373,6 +787,20 @@ func genUUID(_ int) string {
 			uuid[i] = byte(mathrand.Intn(256))
 		}
 	}
+	return formatUUID(uuid)
+}
+
+// genSeededUUID generates a random UUID v4 string from rng, in seeded runs.
+func genSeededUUID(_ int, rng *mathrand.Rand) string {
+	var uuid [16]byte
+	for i := range uuid {
+		uuid[i] = byte(rng.Intn(256))
+	}
+	return formatUUID(uuid)
+}
+
+// formatUUID formats random bytes as a version 4 UUID.
+func formatUUID(uuid [16]byte) string {
 	// Set version 4 (bits 12-15 of time_hi_and_version).
 	uuid[6] = (uuid[6] & 0x0f) | 0x40
 	// Set variant bits (bits 6-7 of clk_seq_hi_res).
@@ -383,22 +811,22 @@ func genUUID(_ int) string {
 }
 
 // genRandomInt generates a random integer between 0 and 10000.
-func genRandomInt(_ int) string {
-	return fmt.Sprintf("%d", mathrand.Intn(10001))
+func genRandomInt(_ int, rng *mathrand.Rand) string {
+	return fmt.Sprintf("%d", rng.Intn(10001))
 }
 
 // genRandomFloat generates a random float between 0.0 and 1.0 with 6 decimal places.
-func genRandomFloat(_ int) string {
-	return fmt.Sprintf("%.6f", mathrand.Float64())
+func genRandomFloat(_ int, rng *mathrand.Rand) string {
+	return fmt.Sprintf("%.6f", rng.Float64())
 }
 
 // genTimestamp returns the current Unix timestamp in seconds.
-func genTimestamp(_ int) string {
+func genTimestamp(_ int, _ *mathrand.Rand) string {
 	return fmt.Sprintf("%d", time.Now().Unix())
 }
 
 // genTimestampISO returns the current time in ISO 8601 / RFC 3339 format.
-func genTimestampISO(_ int) string {
+func genTimestampISO(_ int, _ *mathrand.Rand) string {
 	return time.Now().UTC().Format(time.RFC3339)
 }
 
@@ -406,22 +834,22 @@ func genTimestampISO(_ int) string {
 const alphanumeric = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
 // genRandomString generates a random 16-character alphanumeric string.
-func genRandomString(_ int) string {
+func genRandomString(_ int, rng *mathrand.Rand) string {
 	b := make([]byte, 16)
 	for i := range b {
-		b[i] = alphanumeric[mathrand.Intn(len(alphanumeric))]
+		b[i] = alphanumeric[rng.Intn(len(alphanumeric))]
 	}
 	return string(b)
 }
 
 // genRandomEmail generates a random email address like user_abc123@example.com.
-func genRandomEmail(_ int) string {
+func genRandomEmail(_ int, rng *mathrand.Rand) string {
 	prefix := make([]byte, 8)
 	for i := range prefix {
-		prefix[i] = alphanumeric[mathrand.Intn(len(alphanumeric))]
+		prefix[i] = alphanumeric[rng.Intn(len(alphanumeric))]
 	}
 	domains := []string{"example.com", "test.com", "demo.org", "mail.example.com"}
-	domain := domains[mathrand.Intn(len(domains))]
+	domain := domains[rng.Intn(len(domains))]
 	return fmt.Sprintf("user_%s@%s", string(prefix), domain)
 }
 
@@ -434,30 +862,30 @@ var firstNames = []string{
 }
 
 // genRandomName returns a random first name from the built-in list.
-func genRandomName(_ int) string {
-	return firstNames[mathrand.Intn(len(firstNames))]
+func genRandomName(_ int, rng *mathrand.Rand) string {
+	return firstNames[rng.Intn(len(firstNames))]
 }
 
 // genSequence returns the request index as a monotonically increasing integer.
-func genSequence(requestIndex int) string {
+func genSequence(requestIndex int, _ *mathrand.Rand) string {
 	return fmt.Sprintf("%d", requestIndex)
 }
 
 // genRandomBool returns a random "true" or "false" string.
-func genRandomBool(_ int) string {
-	if mathrand.Intn(2) == 0 {
+func genRandomBool(_ int, rng *mathrand.Rand) string {
+	if rng.Intn(2) == 0 {
 		return "false"
 	}
 	return "true"
 }
 
 // genRandomIP generates a random IPv4 address, avoiding reserved ranges.
-func genRandomIP(_ int) string {
+func genRandomIP(_ int, rng *mathrand.Rand) string {
 	// Generate octets in 1-254 range for the first octet to avoid 0.x.x.x and 255.x.x.x.
-	o1 := mathrand.Intn(254) + 1
-	o2 := mathrand.Intn(256)
-	o3 := mathrand.Intn(256)
-	o4 := mathrand.Intn(254) + 1
+	o1 := rng.Intn(254) + 1
+	o2 := rng.Intn(256)
+	o3 := rng.Intn(256)
+	o4 := rng.Intn(254) + 1
 	return fmt.Sprintf("%d.%d.%d.%d", o1, o2, o3, o4)
 }
 
@@ -474,21 +902,40 @@ var userAgents = []string{
 }
 
 // genRandomUA returns a random User-Agent string from the built-in list.
-func genRandomUA(_ int) string {
-	return userAgents[mathrand.Intn(len(userAgents))]
+func genRandomUA(_ int, rng *mathrand.Rand) string {
+	return userAgents[rng.Intn(len(userAgents))]
 }
 
-// --- Seed initialization ---
+// hexDigits are the digits of $randomHex.
+const hexDigits = "0123456789abcdef"
 
-func init() {
-	// Seed math/rand with a cryptographically random value so that
-	// generator output varies across runs. On Go 1.20+ this is automatic,
-	// but we do it explicitly for Go 1.21 compatibility and clarity.
-	n, err := rand.Int(rand.Reader, big.NewInt(1<<62))
-	if err != nil {
-		// If crypto/rand fails, fall back to time-based seed.
-		mathrand.Seed(time.Now().UnixNano())
-		return
+// randomHex returns n random lowercase hex digits from rng.
+func randomHex(rng *mathrand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = hexDigits[rng.Intn(len(hexDigits))]
+	}
+	return string(b)
+}
+
+// weakRandomBytes returns n bytes from rng, which is cheaper than
+// crypto/rand for payloads that need not be unpredictable.
+func weakRandomBytes(rng *mathrand.Rand, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(rng.Intn(256))
+	}
+	return b
+}
+
+// secureRandomBytes returns n bytes from crypto/rand, falling back to
+// math/rand as genUUID does.
+func secureRandomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		for i := range b {
+			b[i] = byte(mathrand.Intn(256))
+		}
 	}
-	mathrand.Seed(n.Int64())
+	return b
 }
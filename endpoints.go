@@ -0,0 +1,152 @@
+// endpoints.go implements weighted endpoint mixes (-endpoints FILE): a JSON
+// file listing several requests, each with its own method, URL, headers,
+// body and weight. Every request of the run picks one of them at random by
+// weight, so a single run sends a realistic blend of traffic, e.g. mostly
+// catalog reads with the odd checkout, rather than hammering one URL. Each
+// endpoint's results are labeled with its name, so the summary reports
+// every endpoint on its own.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Endpoint is one request of an endpoint mix.
+type Endpoint struct {
+	Name    string            `json:"name"`
+	Label   string            `json:"label"`  // Label the results are grouped by, Name if empty
+	Method  string            `json:"method"` // GET if empty
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"` // Sent after -header, overriding headers of the same name
+	Body    string            `json:"body"`
+	Weight  int               `json:"weight"` // Relative share of requests, 1 if unset
+
+	urlTemplate  *Template
+	bodyTemplate *Template
+	headers      []headerTemplate
+}
+
+// EndpointMix picks an endpoint for each request according to relative
+// weights.
+type EndpointMix struct {
+	Endpoints []Endpoint
+	total     int
+}
+
+// endpointsFile is the JSON layout of an -endpoints file, e.g.
+//
+//	{"endpoints": [
+//	  {"name": "browse", "url": "https://shop.example.com/items/{{$randomInt(1,500)}}", "weight": 80},
+//	  {"name": "checkout", "method": "POST", "url": "https://shop.example.com/cart",
+//	   "headers": {"Content-Type": "application/json"}, "body": "{\"item\": 1}", "weight": 20}
+//	]}
+type endpointsFile struct {
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+// loadEndpoints reads and validates an -endpoints file, parsing the
+// templates of every endpoint with tc.
+func loadEndpoints(path string, tc *templateContext) (*EndpointMix, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading endpoints file: %w", err)
+	}
+	var f endpointsFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing endpoints file %s: %w", path, err)
+	}
+	if len(f.Endpoints) == 0 {
+		return nil, fmt.Errorf("endpoints file %s: at least one endpoint is required", path)
+	}
+
+	mix := &EndpointMix{Endpoints: f.Endpoints}
+	seen := make(map[string]bool)
+	for i := range mix.Endpoints {
+		e := &mix.Endpoints[i]
+		if e.Name == "" {
+			return nil, fmt.Errorf("endpoint %d: name is required", i+1)
+		}
+		if seen[e.Name] {
+			return nil, fmt.Errorf("endpoint %d: duplicate endpoint name %q", i+1, e.Name)
+		}
+		seen[e.Name] = true
+		if e.Label == "" {
+			e.Label = e.Name
+		}
+
+		e.Method = strings.ToUpper(e.Method)
+		if e.Method == "" {
+			e.Method = http.MethodGet
+		}
+		if !validMethod(e.Method) {
+			return nil, fmt.Errorf("endpoint %s: invalid method %q", e.Name, e.Method)
+		}
+		if e.Body != "" && !methodSendsBody(e.Method) {
+			return nil, fmt.Errorf("endpoint %s: a body is not sent with %s", e.Name, e.Method)
+		}
+		if e.Weight < 0 {
+			return nil, fmt.Errorf("endpoint %s: weight must be a positive integer, got %d", e.Name, e.Weight)
+		}
+		if e.Weight == 0 {
+			e.Weight = 1
+		}
+
+		if e.URL == "" {
+			return nil, fmt.Errorf("endpoint %s: url is required", e.Name)
+		}
+		if err := validTargetURL(e.URL); err != nil {
+			return nil, fmt.Errorf("endpoint %s: %w", e.Name, err)
+		}
+		if e.urlTemplate, err = tc.ParseTemplate(e.URL); err != nil {
+			return nil, fmt.Errorf("endpoint %s URL: %w", e.Name, err)
+		}
+		if e.bodyTemplate, err = tc.ParseTemplate(e.Body); err != nil {
+			return nil, fmt.Errorf("endpoint %s body: %w", e.Name, err)
+		}
+
+		// Headers are applied in name order, so the requests of an
+		// endpoint are built the same way every time.
+		names := make([]string, 0, len(e.Headers))
+		for name := range e.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		headers := make([]string, len(names))
+		for j, name := range names {
+			headers[j] = name + ": " + e.Headers[name]
+		}
+		if e.headers, err = parseHeaderTemplates(headers, tc); err != nil {
+			return nil, fmt.Errorf("endpoint %s: invalid %w", e.Name, err)
+		}
+
+		mix.total += e.Weight
+	}
+	return mix, nil
+}
+
+// Pick returns an endpoint chosen with rng, weighted by Weight.
+func (m *EndpointMix) Pick(rng *mathrand.Rand) *Endpoint {
+	n := rng.Intn(m.total)
+	for i := range m.Endpoints {
+		n -= m.Endpoints[i].Weight
+		if n < 0 {
+			return &m.Endpoints[i]
+		}
+	}
+	return &m.Endpoints[len(m.Endpoints)-1]
+}
+
+// String formats the mix as percentages, e.g. "browse 80%, checkout 20%".
+func (m *EndpointMix) String() string {
+	parts := make([]string, len(m.Endpoints))
+	for i, e := range m.Endpoints {
+		parts[i] = fmt.Sprintf("%s %.0f%%", e.Name, float64(e.Weight)/float64(m.total)*100)
+	}
+	return strings.Join(parts, ", ")
+}
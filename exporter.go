@@ -0,0 +1,232 @@
+// exporter.go implements metrics exporters (-export): while a run is in
+// progress its results are handed to every configured Exporter window by
+// window, and the final summary once it has finished, so external systems
+// such as Prometheus, StatsD or InfluxDB can follow a run live. Exporters
+// are registered under a name like formatters; the built-in ones are
+// registered below, and programs embedding the load tester can add their
+// own with RegisterExporter before parsing the configuration.
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultExportInterval is the length of the windows handed to exporters.
+const defaultExportInterval = 10 * time.Second
+
+// Exporter sends the results of a run to an external system.
+type Exporter interface {
+	// Start is called before the run starts.
+	Start(config *Config) error
+	// RecordWindow is called with the results of every export interval.
+	RecordWindow(w ExportWindow) error
+	// Finish is called with the final summary once the run has finished.
+	Finish(summary Summary) error
+}
+
+// ExportWindow is the results of the requests that completed within one
+// export interval. Summary.TotalTime is the window's length and
+// Summary.RequestsPerSec the rate within it.
+type ExportWindow struct {
+	Start   time.Time
+	End     time.Time
+	Summary Summary
+}
+
+// ExporterFactory creates an exporter sending to target, the part of an
+// -export value after "NAME=". It should only validate target; connections
+// are opened in Start.
+type ExporterFactory func(target string) (Exporter, error)
+
+// exporters maps -export names to their factories.
+var exporters = map[string]ExporterFactory{
+	"prometheus": newPrometheusExporter,
+	"statsd":     newStatsDExporter,
+	"influx":     newInfluxExporter,
+}
+
+// RegisterExporter makes f available as -export name=TARGET. It panics if
+// name is empty or already registered.
+func RegisterExporter(name string, f ExporterFactory) {
+	if name == "" || f == nil {
+		panic("RegisterExporter: empty name or nil factory")
+	}
+	if _, dup := exporters[name]; dup {
+		panic("RegisterExporter: exporter " + name + " already registered")
+	}
+	exporters[name] = f
+}
+
+// exporterNames returns the registered exporter names in order.
+func exporterNames() []string {
+	names := make([]string, 0, len(exporters))
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NamedExporter is an exporter configured with -export.
+type NamedExporter struct {
+	Name   string // e.g. "statsd"
+	Target string // e.g. "127.0.0.1:8125"
+	Exporter
+}
+
+// parseExport parses an -export value of the form NAME=TARGET.
+func parseExport(s string) (NamedExporter, error) {
+	name, target, ok := strings.Cut(s, "=")
+	if !ok || name == "" || target == "" {
+		return NamedExporter{}, fmt.Errorf("invalid -export %q, expected NAME=TARGET such as statsd=127.0.0.1:8125", s)
+	}
+	factory, ok := exporters[name]
+	if !ok {
+		return NamedExporter{}, fmt.Errorf("unknown -export %q, expected one of %s", name, strings.Join(exporterNames(), ", "))
+	}
+	e, err := factory(target)
+	if err != nil {
+		return NamedExporter{}, fmt.Errorf("invalid -export %q: %w", s, err)
+	}
+	return NamedExporter{Name: name, Target: target, Exporter: e}, nil
+}
+
+// exportSession feeds the windows of one run to its exporters.
+type exportSession struct {
+	config   *Config
+	stats    *Stats
+	errOut   io.Writer
+	stop     chan struct{}
+	done     chan struct{}
+	mu       sync.Mutex // Serializes windows, so the last one isn't sent twice
+	mark     statsMark
+	lastEnd  time.Time
+	finished bool
+}
+
+// startExports starts config's exporters on stats and then hands them a
+// window of stats every export interval until finish is called. Exporter
+// errors during the run are reported on errOut. It returns nil without
+// exporters.
+func startExports(config *Config, stats *Stats, errOut io.Writer) (*exportSession, error) {
+	if len(config.Exporters) == 0 {
+		return nil, nil
+	}
+	for _, e := range config.Exporters {
+		if err := e.Start(config); err != nil {
+			return nil, fmt.Errorf("starting %s exporter: %w", e.Name, err)
+		}
+	}
+
+	s := &exportSession{
+		config:  config,
+		stats:   stats,
+		errOut:  errOut,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		lastEnd: time.Now(),
+	}
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(config.ExportInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.sendWindow()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return s, nil
+}
+
+// sendWindow hands the results since the previous window to every
+// exporter.
+func (s *exportSession) sendWindow() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	end := time.Now()
+	window := NewStats(0)
+	window.Configure(s.config)
+	window.Merge(s.stats.Delta(&s.mark))
+	summary := window.GetSummary()
+	summary.TotalTime = end.Sub(s.lastEnd)
+	summary.RequestsPerSec = 0
+	if secs := summary.TotalTime.Seconds(); secs > 0 {
+		summary.RequestsPerSec = float64(summary.realRequests()) / secs
+	}
+	w := ExportWindow{Start: s.lastEnd, End: end, Summary: summary}
+	s.lastEnd = end
+
+	for _, e := range s.config.Exporters {
+		if err := e.RecordWindow(w); err != nil {
+			fmt.Fprintf(s.errOut, "export %s: %v\n", e.Name, err)
+		}
+	}
+}
+
+// finish sends the last, partial window and the final summary. It is a
+// no-op on a nil session.
+func (s *exportSession) finish(summary Summary) {
+	if s == nil || s.finished {
+		return
+	}
+	s.finished = true
+	close(s.stop)
+	<-s.done
+	s.sendWindow()
+	for _, e := range s.config.Exporters {
+		if err := e.Finish(summary); err != nil {
+			fmt.Fprintf(s.errOut, "export %s: %v\n", e.Name, err)
+		}
+	}
+}
+
+// exportSeries is one set of values exporters publish: the whole run or
+// window when Label is empty, otherwise the requests of one label.
+type exportSeries struct {
+	Label    string
+	Requests int
+	Errors   int
+	Avg      time.Duration
+	P50      time.Duration
+	P90      time.Duration
+	P95      time.Duration
+	P99      time.Duration
+}
+
+// exportSeriesOf returns the series of summary: the overall one first,
+// then one per label in label order.
+func exportSeriesOf(summary Summary) []exportSeries {
+	series := []exportSeries{{
+		Requests: summary.TotalRequests,
+		Errors:   summary.FailCount,
+		Avg:      summary.AvgDuration,
+		P50:      summary.P50,
+		P90:      summary.P90,
+		P95:      summary.P95,
+		P99:      summary.P99,
+	}}
+	for _, label := range groupNames(summary.ByLabel) {
+		g := summary.ByLabel[label]
+		series = append(series, exportSeries{
+			Label:    label,
+			Requests: g.Requests,
+			Errors:   g.Errors,
+			Avg:      g.AvgDuration,
+			P50:      g.P50,
+			P90:      g.P90,
+			P95:      g.P95,
+			P99:      g.P99,
+		})
+	}
+	return series
+}
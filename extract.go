@@ -0,0 +1,83 @@
+// extract.go implements the extraction rules of scenario steps, which carry
+// values from one step's response into the requests of later steps. A rule
+// is a JSON path into the body (the default), a regular expression over the
+// body, or a response header, so tokens can be taken from HTML pages,
+// Location headers or cookies as well as from JSON APIs.
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Extraction rule prefixes; a rule without one is a JSON path.
+const (
+	extractJSONPrefix   = "json:"
+	extractRegexPrefix  = "regex:"
+	extractHeaderPrefix = "header:"
+)
+
+// extractor is a parsed extraction rule.
+type extractor struct {
+	rule   string         // As written in the scenario
+	path   string         // JSON path, "" for other kinds
+	regex  *regexp.Regexp // Regular expression, nil for other kinds
+	header string         // Response header name, "" for other kinds
+}
+
+// parseExtractor parses an extraction rule: "json:PATH" or a bare PATH,
+// "regex:PATTERN" or "header:NAME".
+func parseExtractor(rule string) (*extractor, error) {
+	e := &extractor{rule: rule}
+	switch {
+	case strings.HasPrefix(rule, extractRegexPrefix):
+		re, err := regexp.Compile(strings.TrimPrefix(rule, extractRegexPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		if re.NumSubexp() > 1 {
+			return nil, fmt.Errorf("regular expression %q has %d groups, expected at most one", re, re.NumSubexp())
+		}
+		e.regex = re
+	case strings.HasPrefix(rule, extractHeaderPrefix):
+		e.header = strings.TrimSpace(strings.TrimPrefix(rule, extractHeaderPrefix))
+		if e.header == "" {
+			return nil, fmt.Errorf("header name is empty")
+		}
+	default:
+		e.path = strings.TrimPrefix(rule, extractJSONPrefix)
+		if e.path == "" {
+			return nil, fmt.Errorf("JSON path is empty")
+		}
+	}
+	return e, nil
+}
+
+// needsBody reports whether the rule reads the response body.
+func (e *extractor) needsBody() bool {
+	return e.header == ""
+}
+
+// extract applies the rule to a response with the given header and body.
+// A regular expression yields its group, or the whole match if it has
+// none.
+func (e *extractor) extract(header http.Header, body []byte) (string, error) {
+	switch {
+	case e.regex != nil:
+		m := e.regex.FindSubmatch(body)
+		if m == nil {
+			return "", fmt.Errorf("regular expression %q does not match the response body", e.regex)
+		}
+		return string(m[len(m)-1]), nil
+	case e.header != "":
+		v := header.Get(e.header)
+		if v == "" {
+			return "", fmt.Errorf("response has no %s header", e.header)
+		}
+		return v, nil
+	default:
+		return extractJSONPath(body, e.path)
+	}
+}
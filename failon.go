@@ -0,0 +1,48 @@
+// failon.go implements failing statuses (-fail-on-5xx, -fail-on-4xx,
+// -fail-on-status): responses with these statuses count as failed requests
+// rather than successful ones, and a run with any failed request exits
+// non-zero. By default a request succeeds as soon as a response arrives,
+// so a target answering every request with 503 passes.
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// errFailedRequests is returned when requests failed in a run with
+// failing statuses set.
+var errFailedRequests = errors.New("requests failed")
+
+// parseFailOn builds the set of failing statuses from the -fail-on-*
+// flags, returning nil if none is set.
+func parseFailOn(on5xx, on4xx bool, statuses string) (*statusSet, error) {
+	var parts []string
+	if on5xx {
+		parts = append(parts, "5xx")
+	}
+	if on4xx {
+		parts = append(parts, "4xx")
+	}
+	if statuses != "" {
+		parts = append(parts, statuses)
+	}
+	if len(parts) == 0 {
+		return nil, nil
+	}
+	return parseStatusSet(strings.Join(parts, ","))
+}
+
+// requestsFailed reports whether requests failed in a test with failing
+// statuses set: the run of config, or one of the tests of a multi-test run.
+func requestsFailed(config *Config, report Report) bool {
+	if config.FailOn != nil && report.Summary.FailCount > 0 {
+		return true
+	}
+	for _, test := range report.Tests {
+		if test.Config.FailOn != nil && test.Stats.GetSummary().FailCount > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+// filegen.go implements the file generators: {{$file(path)}}, the whole
+// contents of a file, such as a large JSON document or a certificate, and
+// {{$lines(path)}}, the lines of a file in turn, one per request, such as a
+// list of IDs or tokens. Files are read once, when the templates using them
+// are parsed, and shared by all placeholders naming the same path.
+package main
+
+import (
+	"fmt"
+	mathrand "math/rand"
+	"os"
+	"strings"
+	"sync"
+)
+
+// templateFiles caches the contents of the files read by {{$file}} and
+// {{$lines}} placeholders, by path.
+var templateFiles struct {
+	mu       sync.Mutex
+	contents map[string]string
+}
+
+// readTemplateFile returns the contents of the file at path, reading it on
+// first use.
+func readTemplateFile(path string) (string, error) {
+	templateFiles.mu.Lock()
+	defer templateFiles.mu.Unlock()
+
+	if content, ok := templateFiles.contents[path]; ok {
+		return content, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if templateFiles.contents == nil {
+		templateFiles.contents = make(map[string]string)
+	}
+	templateFiles.contents[path] = string(data)
+	return string(data), nil
+}
+
+// fileGenerator returns the generator of {{$file(path)}}.
+func fileGenerator(params string) (generatorFunc, error) {
+	path := strings.TrimSpace(params)
+	if path == "" {
+		return nil, fmt.Errorf("$file: expected a file path, e.g. $file(payload.json)")
+	}
+	content, err := readTemplateFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("$file: %w", err)
+	}
+	return func(_ int, _ *mathrand.Rand) string { return content }, nil
+}
+
+// linesGenerator returns the generator of {{$lines(path)}}: request i gets
+// line i of the file, starting over after the last. Blank lines are
+// skipped, and line endings are not part of the values.
+func linesGenerator(params string) (generatorFunc, error) {
+	path := strings.TrimSpace(params)
+	if path == "" {
+		return nil, fmt.Errorf("$lines: expected a file path, e.g. $lines(ids.txt)")
+	}
+	content, err := readTemplateFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("$lines: %w", err)
+	}
+	var lines []string
+	for line := range strings.Lines(content) {
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("$lines: %s has no non-blank lines", path)
+	}
+	return func(requestIndex int, _ *mathrand.Rand) string {
+		return lines[uint(requestIndex)%uint(len(lines))]
+	}, nil
+}
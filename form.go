@@ -0,0 +1,188 @@
+// form.go implements multipart/form-data request bodies (-form and
+// -form-file), as sent by HTML forms and file upload endpoints. Values may
+// contain placeholders and are rendered per request. Files are streamed
+// from disk into each request rather than read into memory, so uploads of
+// large files don't cost memory per worker; their size is taken before
+// every request so the body still goes out with a Content-Length.
+package main
+
+import (
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// formField is one -form value or -form-file file of a form.
+type formField struct {
+	name  string
+	value *Template // Value template, nil for a file
+	path  string    // File to upload, "" for a value
+}
+
+// Form is the multipart form sent as the body of every request.
+type Form struct {
+	fields []formField
+}
+
+// parseForm parses the -form NAME=VALUE and -form-file NAME=PATH flags,
+// checking that every file can be read and parsing the values with tc. It
+// returns nil if both are empty.
+func parseForm(values, files []string, tc *templateContext) (*Form, error) {
+	if len(values) == 0 && len(files) == 0 {
+		return nil, nil
+	}
+	f := &Form{}
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid -form %q, expected 'NAME=VALUE'", v)
+		}
+		tmpl, err := tc.ParseTemplate(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -form %q: %w", v, err)
+		}
+		f.fields = append(f.fields, formField{name: name, value: tmpl})
+	}
+	for _, v := range files {
+		name, path, ok := strings.Cut(v, "=")
+		if !ok || name == "" || path == "" {
+			return nil, fmt.Errorf("invalid -form-file %q, expected 'NAME=PATH'", v)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("-form-file %s: %w", name, err)
+		}
+		info, err := file.Stat()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("-form-file %s: %w", name, err)
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("-form-file %s: %s is a directory", name, path)
+		}
+		f.fields = append(f.fields, formField{name: name, path: path})
+	}
+	return f, nil
+}
+
+// formPart is a form field rendered for one request.
+type formPart struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+	File  string `json:"file,omitempty"` // Path of the uploaded file
+}
+
+// render renders the form's values for request index with random values
+// from rng, appending their generated values to generated unless it is nil.
+func (f *Form) render(index int, rng *mathrand.Rand, generated *[]generatedValue) []formPart {
+	parts := make([]formPart, len(f.fields))
+	for i, field := range f.fields {
+		parts[i] = formPart{Name: field.name, File: field.path}
+		if field.value != nil {
+			parts[i].Value = field.value.RenderRecording(index, rng, nil, generated)
+		}
+	}
+	return parts
+}
+
+// attachForm makes parts the body of req: a multipart stream written while
+// req is sent, with its Content-Type and Content-Length. GetBody recreates
+// the stream, so retries send the same body.
+func attachForm(req *http.Request, parts []formPart) error {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+
+	// A first pass counts the body, taking the files' sizes on disk.
+	var cw countingWriter
+	sizes := make([]int64, len(parts))
+	err := writeForm(&cw, boundary, parts, func(_ io.Writer, i int) error {
+		info, err := os.Stat(parts[i].File)
+		if err != nil {
+			return err
+		}
+		sizes[i] = info.Size()
+		cw.n += sizes[i]
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	open := func() (io.ReadCloser, error) {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(writeForm(pw, boundary, parts, func(w io.Writer, i int) error {
+				return copyFile(w, parts[i].File, sizes[i])
+			}))
+		}()
+		return pr, nil
+	}
+	req.Body, _ = open()
+	req.GetBody = open
+	req.ContentLength = cw.n
+	req.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+	return nil
+}
+
+// writeForm writes parts as a multipart body to w, calling file to write
+// the content of the i-th part when it is a file.
+func writeForm(w io.Writer, boundary string, parts []formPart, file func(w io.Writer, i int) error) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+	for i, p := range parts {
+		if p.File == "" {
+			if err := mw.WriteField(p.Name, p.Value); err != nil {
+				return err
+			}
+			continue
+		}
+		pw, err := mw.CreatePart(formFileHeader(p.Name, p.File))
+		if err != nil {
+			return err
+		}
+		if err := file(pw, i); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// copyFile copies the file at path, expected to hold size bytes, to w; a
+// file that changed size would not match the body's Content-Length.
+func copyFile(w io.Writer, path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := io.Copy(w, io.LimitReader(f, size))
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("%s changed size during the request", path)
+	}
+	return nil
+}
+
+// formFileHeader returns the part header of the upload of path as field
+// name, typed by the file's extension.
+func formFileHeader(name, path string) textproto.MIMEHeader {
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quote.Replace(name), quote.Replace(filepath.Base(path))))
+	h.Set("Content-Type", contentType)
+	return h
+}
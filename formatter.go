@@ -0,0 +1,178 @@
+// formatter.go implements the pluggable results formatters selected with
+// -output. Every output format is a Formatter registered under a name;
+// the built-in formats are registered below, and programs embedding the
+// load tester can add their own with RegisterFormatter before parsing the
+// configuration.
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Formatter renders the results of a finished run.
+type Formatter interface {
+	Format(w io.Writer, r Report) error
+}
+
+// FormatterFunc adapts an ordinary function to the Formatter interface.
+type FormatterFunc func(w io.Writer, r Report) error
+
+// Format calls f(w, r).
+func (f FormatterFunc) Format(w io.Writer, r Report) error {
+	return f(w, r)
+}
+
+// formatters maps -output names to their formatters.
+var formatters = map[string]Formatter{
+	"text":     FormatterFunc(formatText),
+	"json":     FormatterFunc(formatJSON),
+	"markdown": FormatterFunc(formatMarkdown),
+	"csv":      FormatterFunc(formatCSV),
+	"junit":    FormatterFunc(formatJUnit),
+	"html":     FormatterFunc(formatHTML),
+}
+
+// RegisterFormatter makes f available as -output name. It panics if name
+// is empty or already registered.
+func RegisterFormatter(name string, f Formatter) {
+	if name == "" || f == nil {
+		panic("RegisterFormatter: empty name or nil formatter")
+	}
+	if _, dup := formatters[name]; dup {
+		panic("RegisterFormatter: formatter " + name + " already registered")
+	}
+	formatters[name] = f
+}
+
+// formatterNames returns the registered formatter names in order.
+func formatterNames() []string {
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseOutputFormat validates an -output value. Without one, CI mode
+// defaults to json and interactive use to text.
+func parseOutputFormat(s string, ci bool) (string, error) {
+	if s == "" {
+		if ci {
+			return "json", nil
+		}
+		return "text", nil
+	}
+	if _, ok := formatters[s]; !ok {
+		return "", fmt.Errorf("unknown -output format %q, expected one of %s", s, strings.Join(formatterNames(), ", "))
+	}
+	return s, nil
+}
+
+// Report is the results of a run as handed to a Formatter. Scenario and
+// multi-test runs also carry the results of each step or test.
+type Report struct {
+	Summary  Summary           // Results of the whole run
+	Scenario *Scenario         // The scenario of a scenario run, nil otherwise
+	Steps    map[string]*Stats // Per-step results of a scenario run, by step name
+	Tests    []*TestDefinition // The tests of a multi-test run, nil otherwise
+	Baseline *Summary          // Summary of an earlier run to compare against, nil if none
+}
+
+// ReportGroup is a part of a run reported on its own: a scenario step or
+// one test of a multi-test run.
+type ReportGroup struct {
+	Name    string
+	Method  string
+	URL     string
+	Label   string // The step's or test's label, "" if unlabeled
+	Summary Summary
+}
+
+// Groups returns the results per scenario step or per test, in the order
+// they were defined. It returns nil for single-request runs.
+func (r Report) Groups() []ReportGroup {
+	var groups []ReportGroup
+	if r.Scenario != nil {
+		for _, step := range r.Scenario.Steps {
+			if ss, ok := r.Steps[step.Name]; ok {
+				groups = append(groups, ReportGroup{Name: step.Name, Method: step.Method, URL: step.URL, Label: step.Label, Summary: ss.GetSummary()})
+			}
+		}
+	}
+	for _, t := range r.Tests {
+		groups = append(groups, ReportGroup{Name: t.Name, Method: t.Config.Method, URL: t.Config.URL, Label: t.Config.Label, Summary: t.Stats.GetSummary()})
+	}
+	return groups
+}
+
+// Labels returns the results per label in name order, or nil if no
+// request was labeled. Only the metrics tracked per label are set.
+func (r Report) Labels() []ReportGroup {
+	var groups []ReportGroup
+	for _, label := range groupNames(r.Summary.ByLabel) {
+		s := labelSummary(r.Summary.ByLabel[label], r.Summary.TotalTime)
+		groups = append(groups, ReportGroup{Name: label, Label: label, Summary: s})
+	}
+	return groups
+}
+
+// reportFailures lists what makes results count as failed in pass/fail
+// formats such as JUnit: failed requests, server errors, early stops,
+// failed thresholds and violated budgets.
+func reportFailures(s Summary) []string {
+	var failures []string
+	if s.FailCount > 0 {
+		failures = append(failures, fmt.Sprintf("%d of %d requests failed", s.FailCount, s.TotalRequests))
+	}
+	serverErrors := 0
+	for code, count := range s.StatusCodes {
+		if code >= 500 {
+			serverErrors += count
+		}
+	}
+	if serverErrors > 0 {
+		failures = append(failures, fmt.Sprintf("%d responses with a 5xx status", serverErrors))
+	}
+	if s.StopReason != "" {
+		failures = append(failures, "stopped early: "+s.StopReason)
+	}
+	for _, t := range s.Thresholds {
+		if !t.Passed {
+			failures = append(failures, fmt.Sprintf("threshold %s failed: %s", t.Expr, t.formatActual()))
+		}
+	}
+	for _, b := range s.Budgets {
+		if !b.Passed {
+			failures = append(failures, fmt.Sprintf("budget %s exceeded: %s", b.Expr, b.formatActual()))
+		}
+	}
+	return failures
+}
+
+// formatText renders the human-readable summary.
+func formatText(w io.Writer, r Report) error {
+	switch {
+	case r.Scenario != nil:
+		PrintScenarioSummary(w, r.Summary, r.Scenario, r.Steps)
+	case r.Tests != nil:
+		PrintTestsSummary(w, r.Summary, r.Tests)
+	default:
+		PrintSummary(w, r.Summary)
+	}
+	return nil
+}
+
+// formatJSON renders the JSON summary.
+func formatJSON(w io.Writer, r Report) error {
+	switch {
+	case r.Scenario != nil:
+		return WriteScenarioSummaryJSON(w, r.Summary, r.Scenario, r.Steps)
+	case r.Tests != nil:
+		return WriteTestsSummaryJSON(w, r.Summary, r.Tests)
+	}
+	return WriteSummaryJSON(w, r.Summary)
+}
@@ -0,0 +1,267 @@
+// gotemplate.go implements the Go template engine of -template-engine go:
+// URLs, headers and bodies are Go text/template templates, with the
+// built-in generators as functions ({{uuid}}, {{randomInt 1 500}},
+// {{csv "email"}}) and scenario variables as map keys ({{.token}}), for
+// logic beyond what the {{$...}} placeholders and their repeat and if
+// actions offer.
+package main
+
+import (
+	"fmt"
+	mathrand "math/rand"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+// Template engines of -template-engine.
+const (
+	engineBuiltin = "builtin"
+	engineGo      = "go"
+)
+
+// parseTemplateEngine validates a -template-engine value.
+func parseTemplateEngine(s string) (string, error) {
+	switch s {
+	case engineBuiltin, engineGo:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid -template-engine %q, expected %s or %s", s, engineBuiltin, engineGo)
+}
+
+// goTemplateFuncs maps the functions of Go templates to the generators
+// they call, with the separator their arguments are joined by into the
+// generator's parameters: randomInt 1 500 calls $randomInt(1,500).
+var goTemplateFuncs = map[string]string{
+	"uuid":           ",",
+	"randomInt":      ",",
+	"randomFloat":    ",",
+	"timestamp":      ",",
+	"timestampISO":   ",",
+	"randomDate":     ",",
+	"randomString":   ",",
+	"randomEmail":    ",",
+	"randomName":     ",",
+	"sequence":       ",",
+	"cycle":          ",",
+	"randomBool":     ",",
+	"randomIP":       ",",
+	"randomUA":       ",",
+	"padding":        ",",
+	"randomToken":    ",",
+	"randomHex":      ",",
+	"base64":         ",",
+	"randomBytesHex": ",",
+	"randomChoice":   "|",
+	"weightedChoice": "|",
+	"env":            ",",
+	"csv":            ",",
+	"file":           ",",
+	"lines":          ",",
+	"jwt":            ",",
+}
+
+// goGenerator returns the generator of placeholder name with params. Go
+// templates look their generators up as they render; c caches them by
+// placeholder, as in "$randomInt(1,500)", so their parameters are parsed
+// once.
+func (c *templateContext) goGenerator(name, params string) (generatorFunc, error) {
+	key := name + "(" + params + ")"
+	if gen, ok := c.goGenerators.Load(key); ok {
+		return gen.(generatorFunc), nil
+	}
+	gen, err := c.lookupGenerator(name, params)
+	if err != nil {
+		return nil, err
+	}
+	c.goGenerators.Store(key, gen)
+	return gen, nil
+}
+
+// goTemplate is a template of the Go engine. Executions run on clones
+// from a pool, each with functions bound to a render state of its own, so
+// that concurrent requests render with their own index.
+type goTemplate struct {
+	ctx  *templateContext
+	base *template.Template
+	pool sync.Pool // of *goRenderer
+}
+
+// goRenderer is a clone of a goTemplate whose functions read and write
+// state.
+type goRenderer struct {
+	tmpl  *template.Template
+	state goRenderState
+}
+
+// goRenderState is the request a goRenderer renders for.
+type goRenderState struct {
+	ctx    *templateContext
+	index  int
+	rng    *mathrand.Rand
+	values *[]generatedValue
+}
+
+// choiceEscaper escapes the arguments of randomChoice and weightedChoice
+// for splitChoices.
+var choiceEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+
+// funcs returns the template functions bound to s. Those of an unused
+// state only serve parsing.
+func (s *goRenderState) funcs() template.FuncMap {
+	fm := template.FuncMap{
+		"requestIndex": func() int { return s.index },
+		"prob":         func(p float64) bool { return s.rng.Float64() < p },
+		tagFunc: func(name string, value any) string {
+			v := fmt.Sprint(value)
+			if s.values != nil {
+				*s.values = append(*s.values, generatedValue{Placeholder: tagPlaceholder, Value: v, Tag: name, Source: tagPlaceholder + "(" + name + ")"})
+			}
+			return v
+		},
+	}
+	for name, sep := range goTemplateFuncs {
+		fm[name] = s.generatorFunc("$"+name, sep)
+	}
+	for placeholder := range pluginGenerators {
+		fm[placeholder[1:]] = s.generatorFunc(placeholder, ",")
+	}
+	return fm
+}
+
+// generatorFunc returns the template function calling the generator of
+// placeholder with its arguments joined by sep.
+func (s *goRenderState) generatorFunc(placeholder, sep string) func(args ...any) (string, error) {
+	return func(args ...any) (string, error) {
+		params := make([]string, len(args))
+		for i, a := range args {
+			params[i] = fmt.Sprint(a)
+			if sep == "|" {
+				params[i] = choiceEscaper.Replace(params[i])
+			}
+		}
+		joined := strings.Join(params, sep)
+		gen, err := s.ctx.goGenerator(placeholder, joined)
+		if err != nil {
+			return "", err
+		}
+		v := gen(s.index, s.rng)
+		if s.values != nil {
+			source := placeholder
+			if joined != "" {
+				source += "(" + joined + ")"
+			}
+			*s.values = append(*s.values, generatedValue{Placeholder: placeholder, Value: v, Source: source})
+		}
+		return v, nil
+	}
+}
+
+// parseGoTemplate parses raw as a Go template. It renders the template
+// once for request 0 so that bad function arguments are reported now
+// rather than in every request.
+func (c *templateContext) parseGoTemplate(raw string) (*Template, error) {
+	base, err := template.New("").Option("missingkey=zero").Funcs((&goRenderState{ctx: c}).funcs()).Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing Go template: %w", err)
+	}
+	t := &Template{raw: raw, placeholders: goTemplateNames(base.Tree)}
+	if isStaticTree(base.Tree) {
+		return t, nil
+	}
+	g := &goTemplate{ctx: c, base: base}
+	g.pool.New = func() any {
+		r := &goRenderer{}
+		// Clone only fails once the template has been executed, and the
+		// base never is.
+		r.tmpl = template.Must(g.base.Clone()).Funcs(r.state.funcs())
+		return r
+	}
+	if _, err := g.render(0, scratchRand(), nil, nil); err != nil {
+		return nil, fmt.Errorf("rendering Go template: %w", err)
+	}
+	t.goTmpl = g
+	return t, nil
+}
+
+// render executes the template for request requestIndex with vars as its
+// data and random values from rng, appending the generated values to
+// values unless it is nil.
+func (g *goTemplate) render(requestIndex int, rng *mathrand.Rand, vars map[string]string, values *[]generatedValue) (string, error) {
+	r := g.pool.Get().(*goRenderer)
+	defer g.pool.Put(r)
+	r.state = goRenderState{ctx: g.ctx, index: requestIndex, rng: rng, values: values}
+	var b strings.Builder
+	err := r.tmpl.Execute(&b, vars)
+	return b.String(), err
+}
+
+// isStaticTree reports whether tree is plain text, rendering as its source.
+func isStaticTree(tree *parse.Tree) bool {
+	if tree == nil || tree.Root == nil {
+		return true
+	}
+	for _, n := range tree.Root.Nodes {
+		if n.Type() != parse.NodeText {
+			return false
+		}
+	}
+	return true
+}
+
+// goTemplateNames returns the functions and fields a Go template uses, in
+// order of appearance, as placeholders: "randomInt", ".token".
+func goTemplateNames(tree *parse.Tree) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n != nil {
+				for _, c := range n.Nodes {
+					walk(c)
+				}
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n != nil {
+				for _, c := range n.Cmds {
+					walk(c)
+				}
+			}
+		case *parse.CommandNode:
+			for _, a := range n.Args {
+				walk(a)
+			}
+		case *parse.IdentifierNode:
+			add(n.Ident)
+		case *parse.FieldNode:
+			add("." + strings.Join(n.Ident, "."))
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		}
+	}
+	if tree != nil {
+		walk(tree.Root)
+	}
+	return names
+}
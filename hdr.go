@@ -0,0 +1,207 @@
+// hdr.go implements the latency histogram in which Stats keeps request
+// durations, after the HDR histogram design: values below 2048ns are
+// counted exactly, and every power-of-two range above is split into 1024
+// equal buckets. Any recorded value is thus known to within 0.1% (three
+// significant digits), at a memory cost that depends only on the largest
+// latency, not on the number of requests, while histograms from different
+// agents still merge exactly.
+package main
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// hdrSubBucketBits sets the precision: 2^hdrSubBucketBits sub-buckets, half
+// of which split each power-of-two range above the exact range.
+const (
+	hdrSubBucketBits  = 11
+	hdrSubBuckets     = 1 << hdrSubBucketBits
+	hdrHalfSubBuckets = hdrSubBuckets / 2
+)
+
+// hdrHistogram counts durations in logarithmic buckets of bounded relative
+// width. The zero value is an empty histogram. It is not safe for
+// concurrent use; Stats guards its histograms with its mutex.
+type hdrHistogram struct {
+	counts []int64 // Count per bucket index, grown as larger values arrive
+	total  int64
+	min    time.Duration // Exact smallest value, valid if total > 0
+	max    time.Duration // Exact largest value
+}
+
+// hdrIndex returns the bucket index of v.
+func hdrIndex(v int64) int {
+	if v < hdrSubBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - hdrSubBucketBits
+	sub := int(v >> shift)
+	return hdrSubBuckets + (shift-1)*hdrHalfSubBuckets + sub - hdrHalfSubBuckets
+}
+
+// hdrRange returns the lowest value and the width of bucket i.
+func hdrRange(i int) (lo, width int64) {
+	if i < hdrSubBuckets {
+		return int64(i), 1
+	}
+	shift := (i-hdrSubBuckets)/hdrHalfSubBuckets + 1
+	sub := int64((i-hdrSubBuckets)%hdrHalfSubBuckets + hdrHalfSubBuckets)
+	return sub << shift, 1 << shift
+}
+
+// record adds one duration.
+func (h *hdrHistogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	i := hdrIndex(int64(d))
+	if i >= len(h.counts) {
+		h.grow(i + 1)
+	}
+	h.counts[i]++
+	if h.total == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.total++
+}
+
+// grow extends counts to at least n buckets.
+func (h *hdrHistogram) grow(n int) {
+	if n <= len(h.counts) {
+		return
+	}
+	counts := make([]int64, n, n+n/4)
+	copy(counts, h.counts)
+	h.counts = counts
+}
+
+// count returns the number of recorded durations.
+func (h *hdrHistogram) count() int {
+	return int(h.total)
+}
+
+// valueAtRank returns the duration of the value at 0-based rank r in
+// sorted order: the highest value its bucket can hold, clamped to the
+// exact extremes, so that the top rank is the exact maximum.
+func (h *hdrHistogram) valueAtRank(r int64) time.Duration {
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen > r {
+			lo, width := hdrRange(i)
+			v := time.Duration(lo + width - 1)
+			return min(max(v, h.min), h.max)
+		}
+	}
+	return h.max
+}
+
+// percentile returns the duration at percentile pct using method m, on the
+// same ranks as the sorted-slice functions. It returns zero when empty.
+func (h *hdrHistogram) percentile(m PercentileMethod, pct float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	if m == PercentileLinear {
+		pos := pct / 100 * float64(h.total-1)
+		if pos <= 0 {
+			return h.min
+		}
+		lo := int64(math.Floor(pos))
+		if lo >= h.total-1 {
+			return h.max
+		}
+		a, b := h.valueAtRank(lo), h.valueAtRank(lo+1)
+		return a + time.Duration(math.Round((pos-float64(lo))*float64(b-a)))
+	}
+	rank := int64(math.Ceil(pct/100*float64(h.total))) - 1
+	return h.valueAtRank(min(max(rank, 0), h.total-1))
+}
+
+// each calls fn with the middle of every non-empty bucket, clamped to the
+// exact extremes, and its count, in increasing order.
+func (h *hdrHistogram) each(fn func(d time.Duration, count int)) {
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		lo, width := hdrRange(i)
+		d := time.Duration(lo + width/2)
+		fn(min(max(d, h.min), h.max), int(c))
+	}
+}
+
+// merge adds the counts of o.
+func (h *hdrHistogram) merge(o hdrSnapshot) {
+	for i, c := range o.Counts {
+		if i >= len(h.counts) {
+			h.grow(i + 1)
+		}
+		h.counts[i] += c
+		h.total += c
+	}
+	if o.Total() == 0 {
+		return
+	}
+	if h.total == o.Total() || o.Min < h.min {
+		h.min = o.Min
+	}
+	if o.Max > h.max {
+		h.max = o.Max
+	}
+}
+
+// hdrSnapshot is the serializable form of a histogram: the non-empty
+// buckets by index and the exact extremes.
+type hdrSnapshot struct {
+	Counts map[int]int64 `json:"counts,omitempty"`
+	Min    time.Duration `json:"min,omitempty"`
+	Max    time.Duration `json:"max,omitempty"`
+}
+
+// Total returns the number of durations in the snapshot.
+func (s hdrSnapshot) Total() int64 {
+	var n int64
+	for _, c := range s.Counts {
+		n += c
+	}
+	return n
+}
+
+// snapshot returns a copy of the histogram.
+func (h *hdrHistogram) snapshot() hdrSnapshot {
+	return h.delta(nil)
+}
+
+// delta returns the counts added since mark, a copy of the counts taken
+// earlier (nil for everything), and updates mark to the current counts.
+// The extremes are those of the whole histogram; merging them again is
+// harmless.
+func (h *hdrHistogram) delta(mark *[]int64) hdrSnapshot {
+	snap := hdrSnapshot{Min: h.min, Max: h.max}
+	var prev []int64
+	if mark != nil {
+		prev = *mark
+	}
+	for i, c := range h.counts {
+		if i < len(prev) {
+			c -= prev[i]
+		}
+		if c == 0 {
+			continue
+		}
+		if snap.Counts == nil {
+			snap.Counts = make(map[int]int64)
+		}
+		snap.Counts[i] = c
+	}
+	if mark != nil {
+		*mark = append((*mark)[:0], h.counts...)
+	}
+	return snap
+}
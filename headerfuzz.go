@@ -0,0 +1,117 @@
+// headerfuzz.go implements header fuzzing (-header-fuzz). A configurable
+// share of otherwise regular requests carries a very long header value, a
+// large number of headers, or headers with random names, to probe the
+// header size and count limits of proxies and ingresses while the regular
+// load runs. Unlike -chaos requests these are valid HTTP and are sent by
+// the normal client; their outcomes are tallied per kind next to the
+// chaos kinds.
+package main
+
+import (
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"strings"
+)
+
+// Kinds of header fuzzing.
+const (
+	fuzzLongHeader  = "long-header"
+	fuzzManyHeaders = "many-headers"
+	fuzzHeaderNames = "header-names"
+)
+
+// headerFuzzKinds lists every kind, in the order they are reported.
+var headerFuzzKinds = []string{fuzzLongHeader, fuzzManyHeaders, fuzzHeaderNames}
+
+const (
+	// defaultFuzzHeaderSize is the default length of a long header value,
+	// twice the 8KB limit common to proxies.
+	defaultFuzzHeaderSize = 16 << 10
+
+	// defaultFuzzHeaderCount is the default number of headers added to a
+	// many-headers request, above the 100 allowed by e.g. Envoy.
+	defaultFuzzHeaderCount = 200
+
+	// fuzzRandomNames is the number of randomly named headers added to a
+	// header-names request.
+	fuzzRandomNames = 8
+)
+
+// tokenChars are the characters allowed in a header name (RFC 9110 tchar).
+const tokenChars = "!#$%&'*+-.^_`|~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// HeaderFuzz describes which requests get fuzzed headers. The zero value
+// disables header fuzzing.
+type HeaderFuzz struct {
+	Rate  float64  // Fraction of requests to fuzz, 0-1
+	Kinds []string // Kinds to choose from, uniformly
+	Size  int      // Length of a long-header value in bytes
+	Count int      // Number of headers added to a many-headers request
+}
+
+// pick decides with rng whether the next request is fuzzed and with which
+// kind.
+func (f HeaderFuzz) pick(rng *mathrand.Rand) (kind string, ok bool) {
+	if f.Rate <= 0 || rng.Float64() >= f.Rate {
+		return "", false
+	}
+	return f.Kinds[rng.Intn(len(f.Kinds))], true
+}
+
+// apply adds the fuzzed headers of the given kind to req, with names
+// drawn from rng.
+func (f HeaderFuzz) apply(req *http.Request, kind string, rng *mathrand.Rand) {
+	switch kind {
+	case fuzzLongHeader:
+		req.Header.Set("X-Fuzz-Long", padding(f.Size))
+	case fuzzManyHeaders:
+		for i := 0; i < f.Count; i++ {
+			req.Header.Set(fmt.Sprintf("X-Fuzz-%d", i), "1")
+		}
+	case fuzzHeaderNames:
+		for i := 0; i < fuzzRandomNames; i++ {
+			req.Header[randomToken(rng, 1+rng.Intn(64))] = []string{"1"}
+		}
+	}
+}
+
+// padding returns a string of n 'x' characters.
+func padding(n int) string {
+	return strings.Repeat("x", n)
+}
+
+// randomToken returns a random header name of length n, drawn from rng.
+func randomToken(rng *mathrand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = tokenChars[rng.Intn(len(tokenChars))]
+	}
+	return string(b)
+}
+
+// headerTemplate is a parsed -header flag whose name and value may both
+// contain placeholders.
+type headerTemplate struct {
+	name  *Template
+	value *Template
+}
+
+// parseHeaderTemplates parses the name and value templates of headers with
+// tc, keeping their order.
+func parseHeaderTemplates(headers []string, tc *templateContext) ([]headerTemplate, error) {
+	var out []headerTemplate
+	for _, h := range headers {
+		parts := strings.SplitN(h, ":", 2)
+		name, err := tc.ParseTemplate(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, fmt.Errorf("header %q name: %w", h, err)
+		}
+		value, err := tc.ParseTemplate(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("header %q value: %w", h, err)
+		}
+		out = append(out, headerTemplate{name: name, value: value})
+	}
+	return out, nil
+}
@@ -0,0 +1,160 @@
+// headerorder.go writes the request headers of client profiles in the
+// order the profile gives (-client-profiles "header_order"). Go's HTTP/1.1
+// client writes Host and User-Agent first and the other headers sorted by
+// name, the same for every client, while bot-detection layers fingerprint
+// that order. Runs with ordered profiles therefore wrap their connections
+// in an orderedConn, which rearranges the header block of each request on
+// its way out; the request's profile hands its order to the connection
+// through the GotConn hook of the request's client trace. HTTPS
+// connections of such runs are dialed by the tool rather than the
+// transport, so that the wrapper sits above TLS, which limits them to
+// HTTP/1.1.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+)
+
+// maxOrderedHead bounds the request head an orderedConn holds back while
+// waiting for its end; a longer head is written as it is.
+const maxOrderedHead = 1 << 20
+
+// headEnd ends the header block of an HTTP/1.1 request.
+var headEnd = []byte("\r\n\r\n")
+
+// orderedConn is a connection that writes the header lines of the next
+// request head in a given order. Everything else is written unchanged.
+type orderedConn struct {
+	net.Conn
+
+	mu    sync.Mutex
+	order []string // Header names for the next request head, nil to pass writes through
+	head  []byte   // Start of the head, held back until its end is written
+}
+
+// setOrder makes the next request head written to c follow order.
+func (c *orderedConn) setOrder(order []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order, c.head = order, c.head[:0]
+}
+
+// Write writes p, holding back the request head until it is complete so
+// that its header lines can be rearranged.
+func (c *orderedConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.order == nil {
+		return c.Conn.Write(p)
+	}
+
+	c.head = append(c.head, p...)
+	out := c.head
+	if end := bytes.Index(c.head, headEnd); end >= 0 {
+		out = append(reorderHead(c.head[:end+2], c.order), c.head[end+2:]...)
+	} else if len(c.head) <= maxOrderedHead {
+		return len(p), nil
+	}
+	_, err := c.Conn.Write(out)
+	c.order, c.head = nil, c.head[:0]
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// reorderHead returns the request line and header lines of head, each
+// ending in CRLF, with the headers named in order first, in that order,
+// and the others after them as they were.
+func reorderHead(head []byte, order []string) []byte {
+	lines := bytes.SplitAfter(head, []byte("\r\n"))
+	fields := lines[1:]
+	out := append(make([]byte, 0, len(head)), lines[0]...)
+	used := make([]bool, len(fields))
+	for _, name := range order {
+		for i, line := range fields {
+			if !used[i] && headerLineIs(line, name) {
+				out = append(out, line...)
+				used[i] = true
+			}
+		}
+	}
+	for i, line := range fields {
+		if !used[i] {
+			out = append(out, line...)
+		}
+	}
+	return out
+}
+
+// headerLineIs reports whether line is a header line of the header name.
+func headerLineIs(line []byte, name string) bool {
+	colon := bytes.IndexByte(line, ':')
+	return colon >= 0 && strings.EqualFold(string(line[:colon]), name)
+}
+
+// withHeaderOrder returns req with a client trace that hands order to the
+// connection the request is sent on.
+func withHeaderOrder(req *http.Request, order []string) *http.Request {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if c, ok := info.Conn.(*orderedConn); ok {
+				c.setOrder(order)
+			}
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// orderHeaders makes transport write the headers of requests carrying a
+// header order in that order: plain connections are wrapped as dialed, and
+// TLS connections are dialed and wrapped above TLS, offering HTTP/1.1
+// only. Requests to https:// targets through a proxy keep Go's order.
+func orderHeaders(transport *http.Transport) {
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &orderedConn{Conn: conn}, nil
+	}
+	transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		raw, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		config := &tls.Config{}
+		if transport.TLSClientConfig != nil {
+			config = transport.TLSClientConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		config.NextProtos = []string{"http/1.1"}
+
+		// The transport reports its own handshakes to the request's
+		// trace, for the tls phase; this one has to do it itself.
+		conn := tls.Client(raw, config)
+		trace := httptrace.ContextClientTrace(ctx)
+		if trace != nil && trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+		err = conn.HandshakeContext(ctx)
+		if trace != nil && trace.TLSHandshakeDone != nil {
+			trace.TLSHandshakeDone(conn.ConnectionState(), err)
+		}
+		if err != nil {
+			raw.Close()
+			return nil, err
+		}
+		return &orderedConn{Conn: conn}, nil
+	}
+}
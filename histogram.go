@@ -0,0 +1,85 @@
+// histogram.go implements the latency histogram of the text summary: the
+// range from the fastest to the slowest request split into equal-width
+// buckets (-histogram sets how many), each drawn as a bar proportional to
+// its request count, to show the shape of the distribution that the
+// percentiles only sample.
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// defaultHistogramBuckets is the number of histogram buckets without
+// -histogram.
+const defaultHistogramBuckets = 10
+
+// histogramWidth is the length of the bar of the fullest bucket.
+const histogramWidth = 40
+
+// HistogramBucket is one latency range of the histogram.
+type HistogramBucket struct {
+	From  time.Duration // Inclusive lower bound
+	To    time.Duration // Exclusive upper bound, inclusive for the last bucket
+	Count int
+}
+
+// latencyHistogram splits the range of the recorded latencies into n
+// equal-width buckets. It returns nil without latencies or with n < 1, and
+// a single bucket when all latencies are equal.
+func latencyHistogram(latencies *hdrHistogram, n int) []HistogramBucket {
+	if latencies.count() == 0 || n < 1 {
+		return nil
+	}
+	lo, hi := latencies.min, latencies.max
+	if lo == hi {
+		return []HistogramBucket{{From: lo, To: hi, Count: latencies.count()}}
+	}
+
+	width := (hi - lo) / time.Duration(n)
+	if width == 0 {
+		width = 1
+		n = int(hi - lo)
+	}
+	buckets := make([]HistogramBucket, n)
+	for i := range buckets {
+		buckets[i].From = lo + time.Duration(i)*width
+		buckets[i].To = buckets[i].From + width
+	}
+	buckets[n-1].To = hi
+	latencies.each(func(d time.Duration, count int) {
+		i := int((d - lo) / width)
+		if i >= n {
+			i = n - 1
+		}
+		buckets[i].Count += count
+	})
+	return buckets
+}
+
+// printHistogram prints the latency histogram with bars scaled to the
+// fullest bucket.
+func printHistogram(w io.Writer, buckets []HistogramBucket) {
+	most := 0
+	for _, b := range buckets {
+		most = max(most, b.Count)
+	}
+	ranges := make([]string, len(buckets))
+	rangeWidth := 0
+	for i, b := range buckets {
+		ranges[i] = formatDuration(b.From) + " - " + formatDuration(b.To)
+		rangeWidth = max(rangeWidth, len(ranges[i]))
+	}
+
+	fmt.Fprintln(w, "Latency Histogram:")
+	for i, b := range buckets {
+		bar := b.Count * histogramWidth / most
+		if bar == 0 && b.Count > 0 {
+			bar = 1 // Keep sparse buckets visible
+		}
+		line := fmt.Sprintf("  %-*s  %7d  %s", rangeWidth, ranges[i], b.Count, strings.Repeat("#", bar))
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
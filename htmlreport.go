@@ -0,0 +1,120 @@
+// htmlreport.go renders summaries as a self-contained HTML page
+// (-output html) that can be archived as a CI artifact or shared as is.
+package main
+
+import (
+	"html/template"
+	"io"
+	"sort"
+)
+
+// htmlReportTemplate is the page layout. It has no external assets.
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"duration":   formatDuration,
+	"bytes":      formatBytes,
+	"confidence": confidenceNote,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Load Test Results</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.15em; margin-top: 1.5em; }
+table { border-collapse: collapse; margin: 0.5em 0; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+th { background: #f3f3f3; }
+.fail { color: #b00020; font-weight: bold; }
+.ok { color: #1b7f3b; font-weight: bold; }
+code { font-size: 0.9em; }
+.low { color: #a15c00; }
+.low::after { content: " *"; }
+.note { color: #666; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>Load Test Results</h1>
+{{with .Failures}}<p class="fail">{{range .}}{{.}}<br>{{end}}</p>{{else}}<p class="ok">All requests succeeded.</p>{{end}}
+{{with .Summary}}
+<table>
+<tr><th>Total requests</th><td>{{.TotalRequests}}</td></tr>
+<tr><th>Successful</th><td>{{.SuccessCount}}</td></tr>
+<tr><th>Failed</th><td>{{.FailCount}}</td></tr>
+<tr><th>Total time</th><td>{{duration .TotalTime}}</td></tr>
+<tr><th>Requests/sec</th><td>{{printf "%.2f" .RequestsPerSec}}</td></tr>
+<tr><th>Data sent</th><td>{{bytes .BytesSent}}</td></tr>
+<tr><th>Data received</th><td>{{bytes .TotalBytes}} body, {{bytes .HeaderBytes}} headers</td></tr>
+</table>
+
+<h2>Latency</h2>
+<table>
+<tr><th>Average</th><th>Min</th><th>Max</th><th>P50</th><th>P90</th><th>P95</th><th>P99</th></tr>
+<tr><td>{{duration .AvgDuration}}</td><td>{{duration .MinDuration}}</td><td>{{duration .MaxDuration}}</td><td{{template "low" confidence . 50}}>{{duration .P50}}</td><td{{template "low" confidence . 90}}>{{duration .P90}}</td><td{{template "low" confidence . 95}}>{{duration .P95}}</td><td{{template "low" confidence . 99}}>{{duration .P99}}</td></tr>
+</table>
+{{if confidence . 99}}<p class="note">* Low confidence: fewer than {{.MinSamples}} of the {{.Samples}} samples lie beyond the percentile (-min-samples).</p>{{end}}
+{{end}}
+
+{{with .StatusCodes}}
+<h2>Status codes</h2>
+<table>
+<tr><th>Status</th><th>Responses</th></tr>
+{{range .}}<tr><td>{{.Code}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{end}}
+
+{{with .Groups}}
+<h2>Breakdown</h2>
+<table>
+<tr><th>Name</th><th>Request</th><th>Label</th><th>Requests</th><th>Failed</th><th>Req/s</th><th>Average</th><th>P50</th><th>P95</th><th>P99</th></tr>
+{{range .}}<tr><td>{{.Name}}</td><td><code>{{.Method}} {{.URL}}</code></td><td>{{.Label}}</td><td>{{.Summary.TotalRequests}}</td><td>{{.Summary.FailCount}}</td><td>{{printf "%.2f" .Summary.RequestsPerSec}}</td><td>{{duration .Summary.AvgDuration}}</td><td{{template "low" confidence .Summary 50}}>{{duration .Summary.P50}}</td><td{{template "low" confidence .Summary 95}}>{{duration .Summary.P95}}</td><td{{template "low" confidence .Summary 99}}>{{duration .Summary.P99}}</td></tr>
+{{end}}</table>
+{{end}}
+
+{{with .Labels}}
+<h2>By label</h2>
+<table>
+<tr><th>Label</th><th>Requests</th><th>Failed</th><th>Req/s</th><th>Average</th><th>P50</th><th>P95</th><th>P99</th></tr>
+{{range .}}<tr><td>{{.Label}}</td><td>{{.Summary.TotalRequests}}</td><td>{{.Summary.FailCount}}</td><td>{{printf "%.2f" .Summary.RequestsPerSec}}</td><td>{{duration .Summary.AvgDuration}}</td><td{{template "low" confidence .Summary 50}}>{{duration .Summary.P50}}</td><td{{template "low" confidence .Summary 95}}>{{duration .Summary.P95}}</td><td{{template "low" confidence .Summary 99}}>{{duration .Summary.P99}}</td></tr>
+{{end}}</table>
+{{end}}
+
+{{with .Summary.Errors}}
+<h2>Errors</h2>
+<ul>
+{{range .}}<li><code>{{.}}</code></li>
+{{end}}</ul>
+{{end}}
+</body>
+</html>
+{{define "low"}}{{with .}} class="low" title="{{.}}"{{end}}{{end}}`))
+
+// htmlStatus is one row of the status code table.
+type htmlStatus struct {
+	Code  int
+	Count int
+}
+
+// formatHTML renders the report as an HTML page.
+func formatHTML(w io.Writer, r Report) error {
+	codes := make([]htmlStatus, 0, len(r.Summary.StatusCodes))
+	for code, count := range r.Summary.StatusCodes {
+		codes = append(codes, htmlStatus{Code: code, Count: count})
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+
+	return htmlReportTemplate.Execute(w, struct {
+		Summary     Summary
+		Failures    []string
+		StatusCodes []htmlStatus
+		Groups      []ReportGroup
+		Labels      []ReportGroup
+	}{
+		Summary:     r.Summary,
+		Failures:    reportFailures(r.Summary),
+		StatusCodes: codes,
+		Groups:      r.Groups(),
+		Labels:      r.Labels(),
+	})
+}
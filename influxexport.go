@@ -0,0 +1,122 @@
+// influxexport.go implements the influx exporter (-export influx=URL),
+// which writes every export window as points in the InfluxDB line protocol
+// to a write endpoint such as http://localhost:8086/write?db=loadtest (1.x)
+// or http://localhost:8086/api/v2/write?org=ORG&bucket=BUCKET (2.x). With
+// INFLUX_TOKEN set, requests carry it for authentication.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// influxExporter writes points to an InfluxDB write endpoint.
+type influxExporter struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// newInfluxExporter creates an influx exporter writing to rawURL.
+func newInfluxExporter(rawURL string) (Exporter, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("expected an http(s) write URL such as http://localhost:8086/write?db=loadtest")
+	}
+	return &influxExporter{url: rawURL, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// Start reads the token; InfluxDB is only contacted with the first window.
+func (e *influxExporter) Start(*Config) error {
+	e.token = os.Getenv("INFLUX_TOKEN")
+	return nil
+}
+
+// RecordWindow writes one point per series, measurement load_tester for
+// the whole window and load_tester_label tagged with the label for each
+// label, stamped with the end of the window.
+func (e *influxExporter) RecordWindow(w ExportWindow) error {
+	return e.write(influxPoints(w.Summary, "load_tester", w.End))
+}
+
+// Finish writes the results of the whole run as measurement
+// load_tester_run (and load_tester_run_label).
+func (e *influxExporter) Finish(summary Summary) error {
+	return e.write(influxPoints(summary, "load_tester_run", time.Now()))
+}
+
+// influxWriteURL returns the write endpoint of bucket on the InfluxDB
+// server at base, as set by -influx-url and -influx-bucket. The 2.x write
+// API also serves InfluxDB 1.8+, where the bucket is "database" or
+// "database/retention-policy" and org is ignored.
+func influxWriteURL(base, bucket, org string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid -influx-url %q, expected the server URL such as http://localhost:8086", base)
+	}
+	if bucket == "" {
+		return "", fmt.Errorf("-influx-url requires -influx-bucket")
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v2/write"
+	q := url.Values{"bucket": {bucket}, "precision": {"ns"}}
+	if org != "" {
+		q.Set("org", org)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// influxPoints formats the series of summary as line protocol.
+func influxPoints(summary Summary, measurement string, at time.Time) string {
+	var b strings.Builder
+	for _, s := range exportSeriesOf(summary) {
+		b.WriteString(measurement)
+		if s.Label != "" {
+			b.WriteString("_label,label=" + influxEscape(s.Label))
+		}
+		rps := summary.RequestsPerSec
+		if s.Label != "" && summary.TotalTime > 0 {
+			// The summary has no per-label rates.
+			rps = float64(s.Requests) / summary.TotalTime.Seconds()
+		}
+		fmt.Fprintf(&b, " requests=%di,errors=%di,rps=%g", s.Requests, s.Errors, rps)
+		if s.Requests > 0 {
+			fmt.Fprintf(&b, ",avg_ms=%g,p50_ms=%g,p90_ms=%g,p95_ms=%g,p99_ms=%g", ms(s.Avg), ms(s.P50), ms(s.P90), ms(s.P95), ms(s.P99))
+		}
+		fmt.Fprintf(&b, " %d\n", at.UnixNano())
+	}
+	return b.String()
+}
+
+// write posts points to the write endpoint.
+func (e *influxExporter) write(points string) error {
+	req, err := http.NewRequest(http.MethodPost, e.url, strings.NewReader(points))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.token != "" {
+		req.Header.Set("Authorization", "Token "+e.token)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("writing points: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// influxEscape escapes a tag value.
+func influxEscape(s string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(s)
+}
@@ -0,0 +1,325 @@
+// initcmd.go implements the `init` subcommand, an interactive wizard for
+// first-time users. It asks for the target, the request, the load shape and
+// pass/fail limits one question at a time, writes the answers as a -config
+// test definition, and can run a short smoke test with them right away, so
+// a first test does not start with reading the flag list.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Smoke test load: at most smokeRate requests per second for smokeDuration.
+const (
+	smokeRate     = 10
+	smokeDuration = 10 * time.Second
+)
+
+// runInitCommand implements `init [-o FILE]`.
+func runInitCommand(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	output := fs.String("o", "loadtest.json", "Default path of the test definition to write")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("init: unexpected arguments %q", fs.Args())
+	}
+	return runWizard(os.Stdin, os.Stdout, *output)
+}
+
+// wizardAnswers are the answers of the init wizard.
+type wizardAnswers struct {
+	path  string
+	flags map[string]any // Load test flags for the -config file
+	gates []string       // Gate flags, which belong on the command line
+	smoke bool
+}
+
+// runWizard asks the wizard's questions on out, reading the answers from
+// in, writes the test definition and runs the smoke test if asked to.
+func runWizard(in io.Reader, out io.Writer, defaultPath string) error {
+	p := &prompter{in: bufio.NewScanner(in), out: out}
+	fmt.Fprintln(out, "This wizard writes a load test definition. Press Enter to accept the [default].")
+	fmt.Fprintln(out)
+
+	a, err := askWizard(p, defaultPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(testFileOf(a.flags), "", "  ")
+	if err != nil {
+		return err
+	}
+	args, err := wizardArgs(data)
+	if err != nil {
+		return err
+	}
+	// Validate everything together, as the run will.
+	if _, err := parseConfigArgs(append(args, a.gates...)); err != nil {
+		return err
+	}
+	if err := os.WriteFile(a.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", a.path, err)
+	}
+
+	command := append([]string{os.Args[0], "-config", a.path}, a.gates...)
+	fmt.Fprintf(out, "\nWrote %s. Run the test with:\n\n  %s\n\n", a.path, strings.Join(command, " "))
+	if !a.smoke {
+		return nil
+	}
+	return runSmokeTest(args, a.gates, out)
+}
+
+// askWizard asks the wizard's questions.
+func askWizard(p *prompter, defaultPath string) (*wizardAnswers, error) {
+	a := &wizardAnswers{flags: make(map[string]any)}
+
+	target, err := p.ask("Target URL, e.g. https://api.example.com/items", "", func(s string) error {
+		if s == "" {
+			return errors.New("a URL is required")
+		}
+		return validTargetURL(s)
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.flags["url"] = target
+
+	method, err := p.ask("HTTP method", "GET", func(s string) error {
+		if !validMethod(strings.ToUpper(s)) {
+			return fmt.Errorf("%q is not an HTTP method such as GET or POST", s)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	method = strings.ToUpper(method)
+	if method != "GET" {
+		a.flags["method"] = method
+	}
+
+	if methodSendsBody(method) {
+		body, err := p.ask("Request body, or @FILE to read it from a file (empty for none)", "", nil)
+		if err != nil {
+			return nil, err
+		}
+		if body != "" {
+			a.flags["body"] = body
+			contentType, err := p.ask("Content-Type of the body", "application/json", nil)
+			if err != nil {
+				return nil, err
+			}
+			a.flags["header"] = []string{"Content-Type: " + contentType}
+		}
+	}
+
+	fmt.Fprintln(p.out)
+	n, err := p.ask("Total number of requests", "100", intRange(1, 0))
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.ask("Concurrent workers (1-100)", "10", intRange(1, 100))
+	if err != nil {
+		return nil, err
+	}
+	rate, err := p.ask("Requests per second across all workers (0 for as fast as possible)", "0", func(s string) error {
+		if r, err := strconv.ParseFloat(s, 64); err != nil || r < 0 {
+			return fmt.Errorf("expected a number >= 0, got %q", s)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.flags["n"], _ = strconv.Atoi(n)
+	a.flags["c"], _ = strconv.Atoi(c)
+	if r, _ := strconv.ParseFloat(rate, 64); r > 0 {
+		a.flags["rate"] = r
+	}
+
+	fmt.Fprintln(p.out)
+	for _, gate := range []struct{ name, metric, question string }{
+		{"max-p95", "p95", "Fail the run if P95 latency exceeds, e.g. 300ms (empty for no limit)"},
+		{"max-error-rate", "error_rate", "Fail the run if the error rate exceeds, e.g. 1% (empty for no limit)"},
+	} {
+		value, err := p.ask(gate.question, "", func(s string) error {
+			if s == "" {
+				return nil
+			}
+			_, err := parseThresholdLimit(gate.metric, s)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			a.gates = append(a.gates, "-"+gate.name, value)
+		}
+	}
+
+	fmt.Fprintln(p.out)
+	for {
+		if a.path, err = p.ask("Write the test definition to", defaultPath, nil); err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(a.path); err != nil {
+			break
+		}
+		overwrite, err := p.confirm(a.path+" exists. Overwrite it?", false)
+		if err != nil {
+			return nil, err
+		}
+		if overwrite {
+			break
+		}
+	}
+	if a.smoke, err = p.confirm(fmt.Sprintf("Run a %s smoke test now?", smokeDuration), true); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// testFileOf returns the -config file layout of flags.
+func testFileOf(flags map[string]any) any {
+	return struct {
+		Flags map[string]any `json:"flags"`
+	}{flags}
+}
+
+// wizardArgs converts a test definition written by the wizard to
+// command-line arguments, as -config does.
+func wizardArgs(data []byte) ([]string, error) {
+	var f testFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	return testFlagArgs(f.Flags)
+}
+
+// runSmokeTest runs the test of args, with gates, at no more than
+// smokeRate requests per second for smokeDuration, and reports it as a
+// regular run would.
+func runSmokeTest(args, gates []string, out io.Writer) error {
+	config, err := parseConfigArgs(args)
+	if err != nil {
+		return err
+	}
+	rate := float64(smokeRate)
+	if config.Rate > 0 && config.Rate < rate {
+		rate = config.Rate
+	}
+	smoke := append(slices.Clip(args),
+		"-rate="+strconv.FormatFloat(rate, 'f', -1, 64),
+		"-n="+strconv.Itoa(max(1, int(rate*smokeDuration.Seconds()))),
+		"-c="+strconv.Itoa(min(config.Concurrency, smokeRate)))
+	if config, err = parseConfigArgs(append(smoke, gates...)); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(out, "Running a %s smoke test at %g requests/sec\n", smokeDuration, rate)
+	PrintBanner(os.Stderr, config)
+	stats := NewStats(config.NumRequests)
+	stats.Configure(config)
+	err = runWithProgress(true, os.Stderr, stats, func() error {
+		return RunLoadTest(ctx, config, stats)
+	})
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return fmt.Errorf("smoke test: %w", err)
+	}
+	return writeReport(config, Report{Summary: stats.GetSummary()})
+}
+
+// prompter asks questions on out and reads the answers from in.
+type prompter struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+// ask asks question until valid accepts the answer, offering def as the
+// answer to an empty line. A nil valid accepts any answer.
+func (p *prompter) ask(question, def string, valid func(string) error) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", question)
+		}
+		if !p.in.Scan() {
+			if err := p.in.Err(); err != nil {
+				return "", err
+			}
+			return "", errors.New("init: input ended before the wizard finished")
+		}
+		answer := strings.TrimSpace(p.in.Text())
+		if answer == "" {
+			answer = def
+		}
+		if valid != nil {
+			if err := valid(answer); err != nil {
+				fmt.Fprintf(p.out, "  %v\n", err)
+				continue
+			}
+		}
+		return answer, nil
+	}
+}
+
+// confirm asks a yes/no question, with def as the answer to an empty line.
+func (p *prompter) confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer, err := p.ask(question+" ("+hint+")", "", func(s string) error {
+		switch strings.ToLower(s) {
+		case "", "y", "yes", "n", "no":
+			return nil
+		}
+		return fmt.Errorf("answer y or n")
+	})
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	case "n", "no":
+		return false, nil
+	}
+	return def, nil
+}
+
+// intRange returns a validator of whole numbers from lo to hi, or of any
+// number from lo if hi is 0.
+func intRange(lo, hi int) func(string) error {
+	return func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < lo || (hi > 0 && n > hi) {
+			if hi > 0 {
+				return fmt.Errorf("expected a whole number from %d to %d, got %q", lo, hi, s)
+			}
+			return fmt.Errorf("expected a whole number >= %d, got %q", lo, s)
+		}
+		return nil
+	}
+}
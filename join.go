@@ -0,0 +1,191 @@
+// join.go implements agent auto-registration for distributed mode. Instead
+// of listing agents up front, a controller started with -listen accepts
+// registrations, and agents started with -join announce themselves to it.
+// Both sides authenticate with the shared -token, so autoscaled fleets can
+// join a run without knowing each other's addresses in advance.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// agentRegistration is what an agent sends to a controller to join a run.
+type agentRegistration struct {
+	Addr string `json:"addr,omitempty"` // Address the controller should use; empty means "the address you see me from"
+	Port int    `json:"port"`           // Port the agent listens on, used when Addr is empty
+}
+
+// registry collects agent registrations on the controller.
+type registry struct {
+	token string
+
+	mu     sync.Mutex
+	agents []string
+	seen   map[string]bool
+	closed bool
+
+	// joined receives a value (without blocking) whenever an agent joins.
+	joined chan struct{}
+}
+
+// newRegistry creates a registry that accepts agents presenting token.
+func newRegistry(token string) *registry {
+	return &registry{
+		token:  token,
+		seen:   make(map[string]bool),
+		joined: make(chan struct{}, 1),
+	}
+}
+
+// handleRegister accepts an agentRegistration. Registrations arriving
+// after the run has started are rejected so the agent knows to retry with
+// the next run.
+func (reg *registry) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkToken(r, reg.token) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var ar agentRegistration
+	if err := json.NewDecoder(r.Body).Decode(&ar); err != nil {
+		http.Error(w, fmt.Sprintf("decoding registration: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	addr := ar.Addr
+	if addr == "" {
+		if ar.Port < 1 || ar.Port > 65535 {
+			http.Error(w, fmt.Sprintf("invalid port %d", ar.Port), http.StatusBadRequest)
+			return
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			http.Error(w, "cannot determine agent address", http.StatusBadRequest)
+			return
+		}
+		addr = net.JoinHostPort(host, strconv.Itoa(ar.Port))
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.closed {
+		http.Error(w, "run already started", http.StatusConflict)
+		return
+	}
+	if !reg.seen[addr] {
+		reg.seen[addr] = true
+		reg.agents = append(reg.agents, addr)
+		fmt.Fprintf(os.Stderr, "controller: agent %s joined (%d registered)\n", addr, len(reg.agents))
+		select {
+		case reg.joined <- struct{}{}:
+		default:
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// add registers addr directly, as for agents given with -agents.
+func (reg *registry) add(addr string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if !reg.seen[addr] {
+		reg.seen[addr] = true
+		reg.agents = append(reg.agents, addr)
+	}
+}
+
+// waitFor blocks until at least n agents are registered, then closes the
+// registry and returns them.
+func (reg *registry) waitFor(ctx context.Context, n int) ([]string, error) {
+	for {
+		reg.mu.Lock()
+		if len(reg.agents) >= n {
+			reg.closed = true
+			agents := append([]string(nil), reg.agents...)
+			reg.mu.Unlock()
+			return agents, nil
+		}
+		have := len(reg.agents)
+		reg.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("only %d of %d agents joined: %w", have, n, ctx.Err())
+		case <-reg.joined:
+		}
+	}
+}
+
+// joinController registers the agent listening on listenAddr with the
+// controller at controllerAddr, retrying until it is accepted or ctx is
+// done. advertise, if set, is the address the controller should use to
+// reach this agent.
+func joinController(ctx context.Context, controllerAddr, token, listenAddr, advertise string) {
+	ar := agentRegistration{Addr: advertise}
+	if advertise == "" {
+		_, portStr, err := net.SplitHostPort(listenAddr)
+		if err == nil {
+			ar.Port, err = strconv.Atoi(portStr)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "agent: cannot determine port from %q, use -advertise: %v\n", listenAddr, err)
+			return
+		}
+	}
+	body, err := json.Marshal(ar)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agent: encoding registration: %v\n", err)
+		return
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	for {
+		err := register(ctx, client, agentURL(controllerAddr, "/register"), token, body)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "agent: joined controller %s\n", controllerAddr)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "agent: joining %s: %v (retrying)\n", controllerAddr, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(agentPollInterval):
+		}
+	}
+}
+
+// register performs a single registration attempt.
+func register(ctx context.Context, client *http.Client, url, token string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("controller returned %d", resp.StatusCode)
+	}
+	return nil
+}
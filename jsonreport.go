@@ -0,0 +1,788 @@
+// jsonreport.go renders summaries as JSON for machine consumption (CI
+// pipelines, dashboards). Durations are reported as floating-point
+// milliseconds and byte counts as integers.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// rfc3339Millis is the layout of timestamps: RFC 3339 with milliseconds.
+const rfc3339Millis = "2006-01-02T15:04:05.000Z07:00"
+
+// summaryJSON is the JSON representation of a Summary.
+type summaryJSON struct {
+	TotalRequests  int                         `json:"total_requests"`
+	SuccessCount   int                         `json:"success_count"`
+	FailCount      int                         `json:"fail_count"`
+	Failed5xx      int                         `json:"failed_5xx,omitempty"`
+	Cancelled      int                         `json:"cancelled,omitempty"`
+	Chaos          map[string]ChaosCounts      `json:"chaos,omitempty"`
+	Retries        *retryCounts                `json:"retries,omitempty"`
+	TotalErrors    int                         `json:"total_errors"`
+	TotalTimeMs    float64                     `json:"total_time_ms"`
+	RequestsPerSec float64                     `json:"requests_per_sec"`
+	TargetRate     float64                     `json:"target_rate,omitempty"`
+	StopReason     string                      `json:"stop_reason,omitempty"`
+	Percentile     string                      `json:"percentile_method"`
+	Latency        latencyJSON                 `json:"latency_ms"`
+	Percentiles    map[string]float64          `json:"percentiles_ms,omitempty"` // Keyed "p99.9" etc., from -percentiles
+	LowConfidence  []string                    `json:"low_confidence,omitempty"` // Percentiles under -min-samples, keyed like Percentiles
+	Windows        *windowsJSON                `json:"latency_windows,omitempty"`
+	TimeSeries     *timeSeriesJSON             `json:"timeseries,omitempty"`
+	ClientPauses   *clientPausesJSON           `json:"client_pauses,omitempty"`
+	StatusCodes    map[string]int              `json:"status_codes"`
+	ByMethod       map[string]groupSummaryJSON `json:"by_method,omitempty"`
+	ByLabel        map[string]groupSummaryJSON `json:"by_label,omitempty"`
+	ByTag          map[string]groupSummaryJSON `json:"by_tag,omitempty"`
+	Stages         []stageJSON                 `json:"stages,omitempty"`
+	SLA            []slaJSON                   `json:"sla,omitempty"`
+	Stream         *streamSummaryJSON          `json:"stream,omitempty"`
+	Connections    map[string]latencyJSON      `json:"connections,omitempty"`
+	ConnReuse      map[string]groupSummaryJSON `json:"connection_reuse,omitempty"`
+	Phases         map[string]latencyJSON      `json:"phases,omitempty"`
+	DialFallbacks  int                         `json:"dial_fallbacks,omitempty"`
+	ConnWaits      int                         `json:"conn_rate_waits,omitempty"`
+	ConnWaitMs     float64                     `json:"conn_rate_wait_ms,omitempty"`
+	Throttled      int                         `json:"throttled"`
+	ThrottledMs    float64                     `json:"throttled_time_ms"`
+	RateLimit      *rateLimitJSON              `json:"rate_limit,omitempty"`
+	Bytes          bytesJSON                   `json:"bytes"`
+	Errors         []string                    `json:"errors"`
+	Timeouts       map[string]int              `json:"timeouts,omitempty"`
+	Protocols      map[string]int              `json:"protocols,omitempty"`
+	ContentTypes   map[string]contentTypeJSON  `json:"content_types,omitempty"`
+	ConnErrors     map[string]int              `json:"connection_errors,omitempty"`
+	AssertFailures map[string]int              `json:"assertion_failures,omitempty"`
+	Clock          *clockJSON                  `json:"clock,omitempty"`
+	Cleanup        *cleanupJSON                `json:"cleanup,omitempty"`
+	Repeats        *repeatsJSON                `json:"repeats,omitempty"`
+	Mirror         *mirrorJSON                 `json:"mirror,omitempty"`
+	Probe          *autoConcurrencyJSON        `json:"auto_concurrency,omitempty"`
+	Thresholds     []thresholdJSON             `json:"thresholds,omitempty"`
+	Budgets        []thresholdJSON             `json:"budgets,omitempty"`
+
+	Values map[string]ValueDistribution `json:"generated_values,omitempty"`
+
+	Accounting  *accountingJSON  `json:"accounting,omitempty"`
+	Attribution *attributionJSON `json:"latency_attribution,omitempty"`
+}
+
+// timeSeriesJSON is the JSON representation of a TimeSeries.
+type timeSeriesJSON struct {
+	IntervalMs float64         `json:"interval_ms"`
+	Points     []timePointJSON `json:"points"`
+}
+
+// timePointJSON is one interval of a time series; latencies are in
+// milliseconds.
+type timePointJSON struct {
+	Start          string  `json:"start"`
+	Requests       int     `json:"requests"`
+	Errors         int     `json:"errors"`
+	ErrorRate      float64 `json:"error_rate_pct"`
+	RequestsPerSec float64 `json:"requests_per_sec"`
+	P50            float64 `json:"p50_ms"`
+	P90            float64 `json:"p90_ms"`
+	P95            float64 `json:"p95_ms"`
+	P99            float64 `json:"p99_ms"`
+}
+
+// thresholdJSON is the JSON representation of a ThresholdResult. Actual
+// is in the metric's unit: milliseconds, percent or requests per second.
+type thresholdJSON struct {
+	Threshold string  `json:"threshold"`
+	Label     string  `json:"label,omitempty"`
+	Actual    float64 `json:"actual"`
+	Passed    bool    `json:"passed"`
+	Missing   bool    `json:"missing,omitempty"` // No request carried the label
+}
+
+// clockJSON is the JSON representation of a ClockOffset.
+type clockJSON struct {
+	Source        string  `json:"source"`
+	Server        string  `json:"server"`
+	OffsetMs      float64 `json:"offset_ms"` // Add to client timestamps to get reference time
+	UncertaintyMs float64 `json:"uncertainty_ms"`
+	MeasuredAt    string  `json:"measured_at"` // RFC 3339 with milliseconds, client time
+}
+
+// attributionJSON is the JSON representation of a LatencyAttribution.
+type attributionJSON struct {
+	Attempts   latencyJSON `json:"attempts"`
+	Requests   latencyJSON `json:"requests"`
+	Retried    int         `json:"retried"`
+	Redirected int         `json:"redirected"`
+	Redirects  int         `json:"redirects"`
+}
+
+// accountingJSON reconciles the requests sent with the results recorded;
+// consistent is false if any request is counted twice or not at all.
+type accountingJSON struct {
+	Consistent    bool `json:"consistent"`
+	Planned       int  `json:"planned,omitempty"`
+	Sent          int  `json:"sent"`
+	Dropped       int  `json:"dropped"`
+	SkippedSteps  int  `json:"skipped_steps,omitempty"`
+	NotDispatched int  `json:"not_dispatched,omitempty"`
+	Recorded      int  `json:"recorded"`
+	Succeeded     int  `json:"successful"`
+	Failed        int  `json:"failed"`
+	Cancelled     int  `json:"cancelled"`
+	Unaccounted   int  `json:"unaccounted"`
+	Unclassified  int  `json:"unclassified"`
+}
+
+// cleanupJSON is what the run left behind; the file descriptor counts are
+// -1 where the platform does not list them.
+type cleanupJSON struct {
+	Clean            bool `json:"clean"`
+	OpenConnections  int  `json:"open_connections"`
+	GoroutinesBefore int  `json:"goroutines_before"`
+	GoroutinesAfter  int  `json:"goroutines_after"`
+	FDsBefore        int  `json:"fds_before"`
+	FDsAfter         int  `json:"fds_after"`
+}
+
+// mirrorJSON is the JSON representation of a MirrorSummary.
+type mirrorJSON struct {
+	Target  string          `json:"target"`
+	Percent float64         `json:"percent"`
+	Dropped int             `json:"dropped"`
+	Summary summaryJSON     `json:"summary"`
+	Diff    *mirrorDiffJSON `json:"diff,omitempty"`
+}
+
+// mirrorDiffJSON is the JSON representation of a MirrorDiffSummary.
+type mirrorDiffJSON struct {
+	Fields     []string               `json:"fields"`
+	Compared   int                    `json:"compared"`
+	Mismatched int                    `json:"mismatched"`
+	ByField    map[string]int         `json:"by_field"`
+	Samples    []mirrorDiffSampleJSON `json:"samples"`
+}
+
+// mirrorDiffSampleJSON is the JSON representation of a MirrorDiffSample.
+type mirrorDiffSampleJSON struct {
+	Method  string `json:"method"`
+	URL     string `json:"url"`
+	Field   string `json:"field"`
+	Primary string `json:"primary"`
+	Mirror  string `json:"mirror"`
+}
+
+// repeatsJSON is the JSON representation of a RepeatSummary, keyed by
+// metric name.
+type repeatsJSON struct {
+	Runs    int                         `json:"runs"`
+	PauseMs float64                     `json:"pause_ms"`
+	Metrics map[string]repeatMetricJSON `json:"metrics"`
+}
+
+// contentTypeJSON is the JSON representation of a ContentTypeSummary.
+type contentTypeJSON struct {
+	Responses int     `json:"responses"`
+	Bytes     int64   `json:"bytes"`
+	AvgMs     float64 `json:"avg_ms"`
+}
+
+// autoConcurrencyJSON is the JSON representation of a ConcurrencyProbe.
+type autoConcurrencyJSON struct {
+	Chosen int              `json:"chosen"`
+	Reason string           `json:"reason"`
+	Levels []probeLevelJSON `json:"levels"`
+}
+
+// probeLevelJSON is one level of the concurrency probe.
+type probeLevelJSON struct {
+	Concurrency    int     `json:"concurrency"`
+	Requests       int     `json:"requests"`
+	RequestsPerSec float64 `json:"requests_per_sec"`
+	P95Ms          float64 `json:"p95_ms"`
+	ErrorRate      float64 `json:"error_rate_pct"`
+}
+
+// repeatMetricJSON is one metric across repeated runs.
+type repeatMetricJSON struct {
+	Mean   float64   `json:"mean"`
+	StdDev float64   `json:"stddev"`
+	Min    float64   `json:"min"`
+	Max    float64   `json:"max"`
+	Values []float64 `json:"values"`
+}
+
+// latencyJSON is a latency distribution in milliseconds.
+type latencyJSON struct {
+	Count int     `json:"count,omitempty"`
+	Avg   float64 `json:"avg"`
+	Min   float64 `json:"min,omitempty"`
+	Max   float64 `json:"max,omitempty"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+}
+
+// groupSummaryJSON is the JSON representation of a GroupSummary.
+type groupSummaryJSON struct {
+	Requests  int         `json:"requests"`
+	Errors    int         `json:"errors"`
+	ErrorRate float64     `json:"error_rate_pct"`
+	Latency   latencyJSON `json:"latency_ms"`
+}
+
+// groupsJSON converts group summaries by name, returning nil for none.
+func groupsJSON(groups map[string]GroupSummary) map[string]groupSummaryJSON {
+	if len(groups) == 0 {
+		return nil
+	}
+	out := make(map[string]groupSummaryJSON, len(groups))
+	for name, g := range groups {
+		out[name] = newGroupSummaryJSON(g)
+	}
+	return out
+}
+
+// newGroupSummaryJSON converts a GroupSummary to its JSON representation.
+func newGroupSummaryJSON(g GroupSummary) groupSummaryJSON {
+	return groupSummaryJSON{
+		Requests:  g.Requests,
+		Errors:    g.Errors,
+		ErrorRate: g.ErrorRate,
+		Latency: latencyJSON{
+			Avg: ms(g.AvgDuration),
+			P50: ms(g.P50),
+			P90: ms(g.P90),
+			P95: ms(g.P95),
+			P99: ms(g.P99),
+		},
+	}
+}
+
+// slaJSON is the JSON representation of an SLAReport.
+type slaJSON struct {
+	Label    string          `json:"label,omitempty"` // Omitted for the whole run
+	Requests int             `json:"requests"`
+	Buckets  []slaBucketJSON `json:"buckets"`
+}
+
+// slaBucketJSON is the JSON representation of an SLAShare.
+type slaBucketJSON struct {
+	Name    string  `json:"name"`
+	BelowMs float64 `json:"below_ms,omitempty"` // Omitted for the open-ended last bucket
+	Count   int     `json:"count"`
+	Percent float64 `json:"pct"`
+}
+
+// stageJSON is the JSON representation of a StageSummary.
+type stageJSON struct {
+	Name           string  `json:"name"`
+	DurationS      float64 `json:"duration_s"`
+	TargetRate     float64 `json:"target_rate"`
+	RequestsPerSec float64 `json:"requests_per_sec"`
+	groupSummaryJSON
+}
+
+// streamSummaryJSON is the JSON representation of a StreamSummary.
+type streamSummaryJSON struct {
+	Requests   int         `json:"requests"`
+	Chunks     int         `json:"chunks"`
+	FirstChunk latencyJSON `json:"first_chunk_ms"`
+	Gaps       latencyJSON `json:"chunk_gap_ms"`
+	Total      latencyJSON `json:"duration_ms"`
+}
+
+// windowsJSON is the JSON representation of a WindowSummary.
+type windowsJSON struct {
+	SizeMs        float64 `json:"size_ms"`
+	Windows       int     `json:"windows"`
+	ThresholdMs   float64 `json:"threshold_ms,omitempty"`
+	OverThreshold int     `json:"over_threshold"`
+	WorstStart    string  `json:"worst_start"`                     // RFC 3339 with milliseconds
+	WorstStartRef string  `json:"worst_start_corrected,omitempty"` // WorstStart adjusted by the clock offset
+	WorstMaxMs    float64 `json:"worst_max_ms"`
+	WorstMinMs    float64 `json:"worst_min_ms"`
+	WorstRequests int     `json:"worst_requests"`
+	WorstPauseMs  float64 `json:"worst_client_pause_ms"`
+	PausedSpikes  int     `json:"over_threshold_during_client_pause"`
+}
+
+// rateLimitJSON is the JSON representation of a RateLimitSummary. Quota
+// values a response did not announce are omitted.
+type rateLimitJSON struct {
+	Limit           *int                 `json:"limit,omitempty"`
+	MinRemaining    *int                 `json:"min_remaining,omitempty"`
+	Exhausted       string               `json:"exhausted_at,omitempty"`       // RFC 3339 with milliseconds
+	FirstThrottled  string               `json:"first_throttled_at,omitempty"` // RFC 3339 with milliseconds
+	MaxRetryAfterMs float64              `json:"max_retry_after_ms,omitempty"`
+	WindowSizeMs    float64              `json:"window_size_ms"`
+	Trajectory      []rateLimitPointJSON `json:"trajectory"`
+}
+
+// rateLimitPointJSON is one window of the rate-limit trajectory.
+type rateLimitPointJSON struct {
+	Start        string  `json:"start"` // RFC 3339 with milliseconds
+	Samples      int     `json:"samples"`
+	Throttled    int     `json:"throttled"`
+	Limit        *int    `json:"limit,omitempty"`
+	MinRemaining *int    `json:"min_remaining,omitempty"`
+	ResetMs      float64 `json:"reset_ms,omitempty"`
+	RetryAfterMs float64 `json:"retry_after_ms,omitempty"`
+}
+
+// newRateLimitJSON converts a RateLimitSummary.
+func newRateLimitJSON(rs *RateLimitSummary) *rateLimitJSON {
+	quota := func(n int) *int {
+		if n < 0 {
+			return nil
+		}
+		return &n
+	}
+	at := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(rfc3339Millis)
+	}
+	out := &rateLimitJSON{
+		Limit:           quota(rs.Limit),
+		MinRemaining:    quota(rs.MinRemaining),
+		Exhausted:       at(rs.Exhausted),
+		FirstThrottled:  at(rs.FirstThrottled),
+		MaxRetryAfterMs: ms(rs.MaxRetryAfter),
+		WindowSizeMs:    ms(rs.WindowSize),
+	}
+	for _, p := range rs.Trajectory {
+		out.Trajectory = append(out.Trajectory, rateLimitPointJSON{
+			Start:        p.Start.Format(rfc3339Millis),
+			Samples:      p.Samples,
+			Throttled:    p.Throttled,
+			Limit:        quota(p.Limit),
+			MinRemaining: quota(p.MinRemaining),
+			ResetMs:      ms(p.Reset),
+			RetryAfterMs: ms(p.RetryAfter),
+		})
+	}
+	return out
+}
+
+// clientPausesJSON is the JSON representation of a ClientPauseSummary.
+type clientPausesJSON struct {
+	GC          latencyJSON `json:"gc_ms"`
+	GCTotalMs   float64     `json:"gc_total_ms"`
+	StallsMs    latencyJSON `json:"stalls_ms"`
+	StallOverMs float64     `json:"stall_threshold_ms"`
+}
+
+// bytesJSON reports data transfer totals and throughput.
+type bytesJSON struct {
+	Sent           int64   `json:"sent"`
+	ReceivedHeader int64   `json:"received_headers"`
+	ReceivedBody   int64   `json:"received_body"`
+	SentPerSec     float64 `json:"sent_per_sec"`
+	RecvPerSec     float64 `json:"received_per_sec"`
+	LengthUnknown  int     `json:"length_unknown_responses,omitempty"`
+}
+
+// ms converts a duration to floating-point milliseconds.
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// latencyDistJSON converts a LatencyDist to its JSON representation.
+func latencyDistJSON(d LatencyDist) latencyJSON {
+	return latencyJSON{
+		Count: d.Count,
+		Avg:   ms(d.Avg),
+		Max:   ms(d.Max),
+		P50:   ms(d.P50),
+		P90:   ms(d.P90),
+		P95:   ms(d.P95),
+		P99:   ms(d.P99),
+	}
+}
+
+// newSummaryJSON converts a Summary to its JSON representation.
+func newSummaryJSON(s Summary) summaryJSON {
+	out := summaryJSON{
+		TotalRequests:  s.TotalRequests,
+		SuccessCount:   s.SuccessCount,
+		FailCount:      s.FailCount,
+		Failed5xx:      s.Failed5xx,
+		Cancelled:      s.Cancelled,
+		Chaos:          s.Chaos,
+		TotalErrors:    s.TotalErrors,
+		TotalTimeMs:    ms(s.TotalTime),
+		RequestsPerSec: s.RequestsPerSec,
+		TargetRate:     s.TargetRate,
+		StopReason:     s.StopReason,
+		Percentile:     s.Percentile.String(),
+		Latency: latencyJSON{
+			Avg: ms(s.AvgDuration),
+			Min: ms(s.MinDuration),
+			Max: ms(s.MaxDuration),
+			P50: ms(s.P50),
+			P90: ms(s.P90),
+			P95: ms(s.P95),
+			P99: ms(s.P99),
+		},
+		StatusCodes:   make(map[string]int, len(s.StatusCodes)),
+		DialFallbacks: s.DialFallbacks,
+		ConnWaits:     s.ConnWaits,
+		ConnWaitMs:    ms(s.ConnWaitTime),
+		Throttled:     s.Throttled,
+		ThrottledMs:   ms(s.ThrottledTime),
+		Bytes: bytesJSON{
+			Sent:           s.BytesSent,
+			ReceivedHeader: s.HeaderBytes,
+			ReceivedBody:   s.TotalBytes,
+			SentPerSec:     s.SentPerSec,
+			RecvPerSec:     s.RecvPerSec,
+			LengthUnknown:  s.LengthUnknown,
+		},
+		Errors:         s.Errors,
+		Timeouts:       s.Timeouts,
+		Protocols:      s.Protocols,
+		ConnErrors:     s.ConnErrors,
+		AssertFailures: s.AssertFailures,
+	}
+
+	if len(s.ContentTypes) > 0 {
+		out.ContentTypes = make(map[string]contentTypeJSON, len(s.ContentTypes))
+		for ct, c := range s.ContentTypes {
+			out.ContentTypes[ct] = contentTypeJSON{Responses: c.Responses, Bytes: c.Bytes, AvgMs: ms(c.AvgDuration)}
+		}
+	}
+
+	for code, count := range s.StatusCodes {
+		out.StatusCodes[strconv.Itoa(code)] = count
+	}
+
+	if len(s.Percentiles) > 0 {
+		out.Percentiles = make(map[string]float64, len(s.Percentiles))
+		for _, p := range s.Percentiles {
+			out.Percentiles["p"+strconv.FormatFloat(p.Percentile, 'g', -1, 64)] = ms(p.Value)
+		}
+	}
+	out.LowConfidence = lowConfidencePercentiles(s)
+
+	if ws := s.Windows; ws != nil {
+		out.Windows = &windowsJSON{
+			SizeMs:        ms(ws.Size),
+			Windows:       ws.Windows,
+			ThresholdMs:   ms(ws.Threshold),
+			OverThreshold: ws.OverThreshold,
+			WorstStart:    ws.WorstStart.Format(rfc3339Millis),
+			WorstMaxMs:    ms(ws.WorstMax),
+			WorstMinMs:    ms(ws.WorstMin),
+			WorstRequests: ws.WorstCount,
+			WorstPauseMs:  ms(ws.WorstPause),
+			PausedSpikes:  ws.PausedSpikes,
+		}
+		if s.Clock != nil {
+			out.Windows.WorstStartRef = ws.WorstStart.Add(s.Clock.Offset).Format(rfc3339Millis)
+		}
+	}
+
+	if s.RateLimit != nil {
+		out.RateLimit = newRateLimitJSON(s.RateLimit)
+	}
+
+	if ts := s.TimeSeries; ts != nil {
+		out.TimeSeries = &timeSeriesJSON{IntervalMs: ms(ts.Interval), Points: make([]timePointJSON, 0, len(ts.Points))}
+		for _, p := range ts.Points {
+			out.TimeSeries.Points = append(out.TimeSeries.Points, timePointJSON{
+				Start:          p.Start.Format(rfc3339Millis),
+				Requests:       p.Requests,
+				Errors:         p.Errors,
+				ErrorRate:      p.ErrorRate,
+				RequestsPerSec: p.RequestsPerSec,
+				P50:            ms(p.P50),
+				P90:            ms(p.P90),
+				P95:            ms(p.P95),
+				P99:            ms(p.P99),
+			})
+		}
+	}
+
+	for _, t := range s.Thresholds {
+		out.Thresholds = append(out.Thresholds, thresholdJSON{Threshold: t.Expr, Label: t.Label, Actual: t.Actual, Passed: t.Passed, Missing: t.Missing})
+	}
+	for _, b := range s.Budgets {
+		out.Budgets = append(out.Budgets, thresholdJSON{Threshold: b.Expr, Label: b.Label, Actual: b.Actual, Passed: b.Passed, Missing: b.Missing})
+	}
+
+	if c := s.Clock; c != nil {
+		out.Clock = &clockJSON{
+			Source:        c.Source,
+			Server:        c.Server,
+			OffsetMs:      ms(c.Offset),
+			UncertaintyMs: ms(c.Uncertainty),
+			MeasuredAt:    c.MeasuredAt.Format(rfc3339Millis),
+		}
+	}
+
+	if c := s.Cleanup; c != nil {
+		out.Cleanup = &cleanupJSON{
+			Clean:            c.Clean(),
+			OpenConnections:  c.OpenConnections,
+			GoroutinesBefore: c.GoroutinesBefore,
+			GoroutinesAfter:  c.GoroutinesAfter,
+			FDsBefore:        c.FDsBefore,
+			FDsAfter:         c.FDsAfter,
+		}
+	}
+
+	if a := s.Accounting; a != nil {
+		out.Accounting = &accountingJSON{
+			Consistent:    a.ok(),
+			Planned:       a.Planned,
+			Sent:          a.Sent,
+			Dropped:       a.Dropped,
+			SkippedSteps:  a.Skipped,
+			NotDispatched: a.NotDispatched,
+			Recorded:      a.Recorded,
+			Succeeded:     a.Succeeded,
+			Failed:        a.Failed,
+			Cancelled:     a.Cancelled,
+			Unaccounted:   a.Unaccounted,
+			Unclassified:  a.Unclassified,
+		}
+	}
+
+	if m := s.Mirror; m != nil {
+		out.Mirror = &mirrorJSON{Target: m.Target, Percent: m.Rate * 100, Dropped: m.Dropped, Summary: newSummaryJSON(m.Summary)}
+		if d := m.Diff; d != nil {
+			diff := &mirrorDiffJSON{Fields: d.Fields, Compared: d.Compared, Mismatched: d.Mismatched, ByField: d.ByField,
+				Samples: make([]mirrorDiffSampleJSON, 0, len(d.Samples))}
+			for _, s := range d.Samples {
+				diff.Samples = append(diff.Samples, mirrorDiffSampleJSON{Method: s.Method, URL: s.URL, Field: s.Field, Primary: s.Primary, Mirror: s.Mirror})
+			}
+			out.Mirror.Diff = diff
+		}
+	}
+
+	if r := s.Repeats; r != nil {
+		out.Repeats = &repeatsJSON{Runs: r.Runs, PauseMs: ms(r.Pause), Metrics: make(map[string]repeatMetricJSON)}
+		for _, m := range r.Metrics {
+			out.Repeats.Metrics[m.Name] = repeatMetricJSON{Mean: m.Mean, StdDev: m.StdDev, Min: m.Min, Max: m.Max, Values: m.Values}
+		}
+	}
+
+	if p := s.Probe; p != nil {
+		out.Probe = &autoConcurrencyJSON{Chosen: p.Chosen, Reason: p.Reason}
+		for _, l := range p.Levels {
+			out.Probe.Levels = append(out.Probe.Levels, probeLevelJSON{
+				Concurrency: l.Concurrency, Requests: l.Requests, RequestsPerSec: l.RequestsPerSec, P95Ms: ms(l.P95), ErrorRate: l.ErrorRate,
+			})
+		}
+	}
+
+	if r := s.Retries; r.Retried > 0 || r.Keyed > 0 {
+		out.Retries = &r
+	}
+
+	if cp := s.ClientPauses; cp != nil {
+		out.ClientPauses = &clientPausesJSON{
+			GC:          latencyDistJSON(cp.GC),
+			GCTotalMs:   ms(cp.GCTotal),
+			StallsMs:    latencyDistJSON(cp.Stalls),
+			StallOverMs: ms(stallThreshold),
+		}
+	}
+
+	out.ByMethod = groupsJSON(s.ByMethod)
+	out.ByLabel = groupsJSON(s.ByLabel)
+	out.ByTag = groupsJSON(s.ByTag)
+	out.Values = s.Values
+	out.ConnReuse = groupsJSON(s.ConnReuse)
+	for _, r := range s.SLA {
+		sj := slaJSON{Label: r.Label, Requests: r.Total}
+		for _, b := range r.Buckets {
+			sj.Buckets = append(sj.Buckets, slaBucketJSON{Name: b.Name, BelowMs: ms(b.Below), Count: b.Count, Percent: b.Percent})
+		}
+		out.SLA = append(out.SLA, sj)
+	}
+	for _, st := range s.Stages {
+		out.Stages = append(out.Stages, stageJSON{
+			Name:             st.Name,
+			DurationS:        st.Duration.Seconds(),
+			TargetRate:       st.Rate,
+			RequestsPerSec:   st.RequestsPerSec,
+			groupSummaryJSON: newGroupSummaryJSON(st.GroupSummary),
+		})
+	}
+
+	if s.Stream != nil {
+		out.Stream = &streamSummaryJSON{
+			Requests:   s.Stream.Requests,
+			Chunks:     s.Stream.Chunks,
+			FirstChunk: latencyDistJSON(s.Stream.FirstChunk),
+			Gaps:       latencyDistJSON(s.Stream.Gaps),
+			Total:      latencyDistJSON(s.Stream.Total),
+		}
+	}
+
+	if len(s.Dials) > 0 {
+		out.Connections = make(map[string]latencyJSON, len(s.Dials))
+		for family, d := range s.Dials {
+			out.Connections[family] = latencyDistJSON(d)
+		}
+	}
+	if len(s.Phases) > 0 {
+		out.Phases = make(map[string]latencyJSON, len(s.Phases))
+		for phase, d := range s.Phases {
+			out.Phases[phase] = latencyDistJSON(d)
+		}
+	}
+	if a := s.Attribution; a != nil {
+		out.Attribution = &attributionJSON{
+			Attempts:   latencyDistJSON(a.Attempts),
+			Requests:   latencyDistJSON(a.Requests),
+			Retried:    a.Retried,
+			Redirected: a.Redirected,
+			Redirects:  a.Redirects,
+		}
+	}
+
+	return out
+}
+
+// scenarioSummaryJSON is the JSON representation of a scenario run.
+type scenarioSummaryJSON struct {
+	Scenario string            `json:"scenario"`
+	Overall  summaryJSON       `json:"overall"`
+	Steps    []stepSummaryJSON `json:"steps"`
+}
+
+// stepSummaryJSON is the JSON representation of one scenario step's results.
+type stepSummaryJSON struct {
+	Name   string `json:"name"`
+	Method string `json:"method"`
+	Label  string `json:"label,omitempty"`
+	summaryJSON
+}
+
+// testsSummaryJSON is the JSON representation of a multi-test run.
+type testsSummaryJSON struct {
+	Combined summaryJSON       `json:"combined"`
+	Tests    []testSummaryJSON `json:"tests"`
+}
+
+// testSummaryJSON is the JSON representation of one test's results.
+type testSummaryJSON struct {
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Label string `json:"label,omitempty"`
+	summaryJSON
+}
+
+// WriteSummaryJSON writes summary to w as indented JSON.
+func WriteSummaryJSON(w io.Writer, summary Summary) error {
+	return writeJSON(w, newSummaryJSON(summary))
+}
+
+// WriteScenarioSummaryJSON writes the overall and per-step results of a
+// scenario run to w as indented JSON. Steps appear in scenario order.
+func WriteScenarioSummaryJSON(w io.Writer, overall Summary, scenario *Scenario, stepStats map[string]*Stats) error {
+	out := scenarioSummaryJSON{
+		Scenario: scenario.Name,
+		Overall:  newSummaryJSON(overall),
+		Steps:    make([]stepSummaryJSON, 0, len(scenario.Steps)),
+	}
+	for _, step := range scenario.Steps {
+		ss, ok := stepStats[step.Name]
+		if !ok {
+			continue
+		}
+		out.Steps = append(out.Steps, stepSummaryJSON{
+			Name:        step.Name,
+			Method:      step.Method,
+			Label:       step.Label,
+			summaryJSON: newSummaryJSON(ss.GetSummary()),
+		})
+	}
+	return writeJSON(w, out)
+}
+
+// WriteTestsSummaryJSON writes the combined and per-test results of a
+// multi-test run to w as indented JSON. Tests appear in command-line order.
+func WriteTestsSummaryJSON(w io.Writer, combined Summary, tests []*TestDefinition) error {
+	out := testsSummaryJSON{
+		Combined: newSummaryJSON(combined),
+		Tests:    make([]testSummaryJSON, 0, len(tests)),
+	}
+	for _, t := range tests {
+		out.Tests = append(out.Tests, testSummaryJSON{
+			Name:        t.Name,
+			URL:         t.Config.URL,
+			Label:       t.Config.Label,
+			summaryJSON: newSummaryJSON(t.Stats.GetSummary()),
+		})
+	}
+	return writeJSON(w, out)
+}
+
+// loadBaseline reads the JSON summary of an earlier run, as written by
+// -output json, for reports to compare against. Only the figures reports
+// compare are restored. For scenario and multi-test summaries the overall
+// or combined results are used.
+func loadBaseline(path string) (*Summary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading baseline: %w", err)
+	}
+	var file struct {
+		summaryJSON
+		Overall  *summaryJSON `json:"overall"`
+		Combined *summaryJSON `json:"combined"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing baseline %s: %w", path, err)
+	}
+	in := &file.summaryJSON
+	if file.Overall != nil {
+		in = file.Overall
+	} else if file.Combined != nil {
+		in = file.Combined
+	}
+	if in.TotalRequests == 0 {
+		return nil, fmt.Errorf("baseline %s is not a JSON summary with results", path)
+	}
+
+	fromMs := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+	statusCodes := make(map[int]int, len(in.StatusCodes))
+	for code, count := range in.StatusCodes {
+		if c, err := strconv.Atoi(code); err == nil {
+			statusCodes[c] = count
+		}
+	}
+	return &Summary{
+		TotalRequests:  in.TotalRequests,
+		SuccessCount:   in.SuccessCount,
+		FailCount:      in.FailCount,
+		Failed5xx:      in.Failed5xx,
+		TotalTime:      fromMs(in.TotalTimeMs),
+		RequestsPerSec: in.RequestsPerSec,
+		StatusCodes:    statusCodes,
+		AvgDuration:    fromMs(in.Latency.Avg),
+		MinDuration:    fromMs(in.Latency.Min),
+		MaxDuration:    fromMs(in.Latency.Max),
+		P50:            fromMs(in.Latency.P50),
+		P90:            fromMs(in.Latency.P90),
+		P95:            fromMs(in.Latency.P95),
+		P99:            fromMs(in.Latency.P99),
+	}, nil
+}
+
+// writeJSON encodes v to w as indented JSON followed by a newline.
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,128 @@
+// junitreport.go renders summaries as JUnit XML (-output junit), the
+// format CI systems display as test results. The whole run is one test
+// case, and each scenario step or test of a multi-test run and each label
+// is another; a case fails when requests failed, the server answered 5xx,
+// or a stop condition ended the run early. Labeled cases are grouped by a
+// classname per label.
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// junitTestSuites is the root element of a JUnit report.
+type junitTestSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+// junitSuite is a JUnit test suite.
+type junitSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is a JUnit test case with an optional failure.
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+// junitFailure describes why a test case failed.
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// formatJUnit renders the report as JUnit XML.
+func formatJUnit(w io.Writer, r Report) error {
+	suite := junitSuite{
+		Name: "load-tester",
+		Time: junitSeconds(r.Summary),
+	}
+	suite.Cases = append(suite.Cases, junitCase(ReportGroup{Name: "overall", Summary: r.Summary}))
+	for _, g := range r.Groups() {
+		suite.Cases = append(suite.Cases, junitCase(g))
+	}
+	for _, g := range r.Labels() {
+		g.Name = "label " + g.Label
+		suite.Cases = append(suite.Cases, junitCase(g))
+	}
+	for _, c := range suite.Cases {
+		suite.Tests++
+		if c.Failure != nil {
+			suite.Failures++
+		}
+	}
+
+	out := junitTestSuites{
+		Name:     suite.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Time:     suite.Time,
+		Suites:   []junitSuite{suite},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitCase converts one group's results to a test case. The key metrics
+// go to system-out so they show up next to the verdict.
+func junitCase(g ReportGroup) junitTestCase {
+	s := g.Summary
+	name := g.Name
+	if g.URL != "" {
+		name = fmt.Sprintf("%s (%s %s)", g.Name, g.Method, g.URL)
+	}
+	c := junitTestCase{
+		Name:      name,
+		ClassName: junitClassName(g.Label),
+		Time:      junitSeconds(s),
+		SystemOut: fmt.Sprintf("requests=%d successful=%d failed=%d rps=%.2f avg=%s p50=%s p95=%s p99=%s",
+			s.TotalRequests, s.SuccessCount, s.FailCount, s.RequestsPerSec,
+			formatDuration(s.AvgDuration), formatDuration(s.P50), formatDuration(s.P95), formatDuration(s.P99)),
+	}
+	if failures := reportFailures(s); len(failures) > 0 {
+		c.Failure = &junitFailure{
+			Message: failures[0],
+			Type:    "LoadTestFailure",
+			Text:    strings.Join(append(failures, s.Errors...), "\n"),
+		}
+	}
+	return c
+}
+
+// junitClassName returns the classname of a case with the given label.
+func junitClassName(label string) string {
+	if label == "" {
+		return "load-tester"
+	}
+	return "load-tester." + label
+}
+
+// junitSeconds formats a run's duration as JUnit's seconds attribute.
+func junitSeconds(s Summary) string {
+	return fmt.Sprintf("%.3f", s.TotalTime.Seconds())
+}
@@ -0,0 +1,252 @@
+// jwt.go implements the {{$jwt(claims)}} generator: a JSON Web Token
+// signed with HS256 for every request, so that endpoints behind token
+// authentication can be load tested with unique, valid tokens. Claims are
+// NAME=VALUE pairs whose values may contain placeholders, written without
+// braces, as in {{$jwt(sub=user-$sequence(1000),role=admin,exp=+15m)}}.
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jwtSecretEnv is the environment variable holding the signing key when
+// -jwt-secret is not set, which keeps the key out of the command line.
+const jwtSecretEnv = "JWT_SECRET"
+
+// defaultJWTLifetime is how long tokens are valid without an exp claim.
+const defaultJWTLifetime = time.Hour
+
+// jwtKey returns the signing key of -jwt-secret, or of $JWT_SECRET if the
+// flag is not set, nil if neither is.
+func jwtKey(flagValue string) []byte {
+	if flagValue != "" {
+		return []byte(flagValue)
+	}
+	if env := os.Getenv(jwtSecretEnv); env != "" {
+		return []byte(env)
+	}
+	return nil
+}
+
+// jwtHeader is the encoded header of HS256 tokens.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// jwtTimeClaims are the claims holding times, given as offsets from the
+// signing time such as +15m, or as Unix times.
+var jwtTimeClaims = map[string]bool{"exp": true, "nbf": true, "iat": true}
+
+// jwtClaim is a claim of a {{$jwt}} placeholder: a time offset from the
+// signing time, or a value rendered from parts.
+type jwtClaim struct {
+	name   string
+	offset time.Duration // Offset from the signing time of a time claim
+	timed  bool          // Whether offset is used rather than parts
+	parts  []claimPart
+}
+
+// claimPart is a piece of a claim value: static text or a placeholder.
+type claimPart struct {
+	text string
+	gen  generatorFunc
+}
+
+// render renders the value of c for request requestIndex.
+func (c *jwtClaim) render(requestIndex int, rng *mathrand.Rand) string {
+	if len(c.parts) == 1 && c.parts[0].gen == nil {
+		return c.parts[0].text
+	}
+	var b strings.Builder
+	for _, p := range c.parts {
+		if p.gen != nil {
+			b.WriteString(p.gen(requestIndex, rng))
+		} else {
+			b.WriteString(p.text)
+		}
+	}
+	return b.String()
+}
+
+// parseClaimValue splits a claim value into static text and placeholders:
+// a '$' followed by a letter starts a placeholder, which runs to the end
+// of its name and of its parenthesized parameters, if any. Any other '$'
+// is text.
+func (c *templateContext) parseClaimValue(value string) ([]claimPart, error) {
+	var parts []claimPart
+	var text strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' || i+1 == len(value) || !isLetter(value[i+1]) {
+			text.WriteByte(value[i])
+			continue
+		}
+		end := i + 1
+		for end < len(value) && (isLetter(value[end]) || value[end] >= '0' && value[end] <= '9') {
+			end++
+		}
+		if end < len(value) && value[end] == '(' {
+			depth := 0
+			for ; end < len(value); end++ {
+				if value[end] == '(' {
+					depth++
+				} else if value[end] == ')' {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+			if depth != 0 {
+				return nil, fmt.Errorf("unclosed parenthesis in %q", value[i:])
+			}
+			end++
+		}
+		baseName, params, err := splitPlaceholder(value[i:end])
+		if err != nil {
+			return nil, err
+		}
+		if baseName == "$jwt" {
+			return nil, fmt.Errorf("tokens do not nest")
+		}
+		gen, err := c.lookupGenerator(baseName, params)
+		if err != nil {
+			return nil, err
+		}
+		if text.Len() > 0 {
+			parts = append(parts, claimPart{text: text.String()})
+			text.Reset()
+		}
+		parts = append(parts, claimPart{gen: gen})
+		i = end - 1
+	}
+	if text.Len() > 0 || len(parts) == 0 {
+		parts = append(parts, claimPart{text: text.String()})
+	}
+	return parts, nil
+}
+
+// isLetter reports whether c is an ASCII letter.
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// splitClaims splits the parameters of {{$jwt}} at the commas outside of
+// parentheses, so that claim values may be placeholders with parameters.
+func splitClaims(params string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range params {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, params[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, params[start:])
+}
+
+// jwtValue encodes a rendered claim value: integers and booleans as JSON
+// literals, anything else as a string.
+func jwtValue(s string) json.RawMessage {
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return json.RawMessage(s)
+	}
+	if s == "true" || s == "false" {
+		return json.RawMessage(s)
+	}
+	b, _ := json.Marshal(s)
+	return b
+}
+
+// parseJWTClaim parses one NAME=VALUE claim.
+func (c *templateContext) parseJWTClaim(part string) (jwtClaim, error) {
+	name, value, ok := strings.Cut(part, "=")
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	if !ok || name == "" {
+		return jwtClaim{}, fmt.Errorf("claim %q is not NAME=VALUE", strings.TrimSpace(part))
+	}
+	claim := jwtClaim{name: name}
+	if jwtTimeClaims[name] && (strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-")) {
+		d, err := parseTimeOffset(value)
+		if err != nil {
+			return jwtClaim{}, fmt.Errorf("claim %s: %w", name, err)
+		}
+		claim.offset, claim.timed = d, true
+		return claim, nil
+	}
+	parts, err := c.parseClaimValue(value)
+	if err != nil {
+		return jwtClaim{}, fmt.Errorf("claim %s: %w", name, err)
+	}
+	claim.parts = parts
+	return claim, nil
+}
+
+// jwtGenerator returns the generator of {{$jwt(claims)}}. Tokens carry
+// iat, the signing time, and exp, an hour later, unless the claims set
+// them.
+func (c *templateContext) jwtGenerator(params string) (generatorFunc, error) {
+	if c.jwtKey == nil {
+		return nil, fmt.Errorf("$jwt needs a signing key: set -jwt-secret or $%s", jwtSecretEnv)
+	}
+	secret := c.jwtKey
+	var claims []jwtClaim
+	seen := make(map[string]bool)
+	if strings.TrimSpace(params) != "" {
+		for _, part := range splitClaims(params) {
+			claim, err := c.parseJWTClaim(part)
+			if err != nil {
+				return nil, fmt.Errorf("$jwt: %w", err)
+			}
+			if seen[claim.name] {
+				return nil, fmt.Errorf("$jwt: duplicate claim %s", claim.name)
+			}
+			seen[claim.name] = true
+			claims = append(claims, claim)
+		}
+	}
+	if !seen["iat"] {
+		claims = append(claims, jwtClaim{name: "iat", timed: true})
+	}
+	if !seen["exp"] {
+		claims = append(claims, jwtClaim{name: "exp", offset: defaultJWTLifetime, timed: true})
+	}
+
+	return func(requestIndex int, rng *mathrand.Rand) string {
+		now := time.Now()
+		var payload strings.Builder
+		payload.WriteByte('{')
+		for i := range claims {
+			c := &claims[i]
+			if i > 0 {
+				payload.WriteByte(',')
+			}
+			name, _ := json.Marshal(c.name)
+			payload.Write(name)
+			payload.WriteByte(':')
+			if c.timed {
+				payload.WriteString(strconv.FormatInt(now.Add(c.offset).Unix(), 10))
+			} else {
+				payload.Write(jwtValue(c.render(requestIndex, rng)))
+			}
+		}
+		payload.WriteByte('}')
+
+		signing := jwtHeader + "." + base64.RawURLEncoding.EncodeToString([]byte(payload.String()))
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signing))
+		return signing + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}, nil
+}
@@ -0,0 +1,262 @@
+// k8s.go implements the `k8s` subcommand, which renders Kubernetes
+// manifests for a distributed load test: a Secret holding the shared
+// token, an Indexed Job running N agents, a headless Service giving each
+// agent a stable DNS name, and a controller Job that splits the test
+// across the agents and prints the merged summary. With -apply the
+// manifests are piped to `kubectl apply` instead of printed.
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// k8sLabel matches an RFC 1123 label, the form Kubernetes requires of
+// namespaces, Service names and pod hostnames.
+var k8sLabel = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// maxK8sLabel is the longest RFC 1123 label.
+const maxK8sLabel = 63
+
+// k8sParams holds the values substituted into the manifest template.
+type k8sParams struct {
+	Name      string
+	Namespace string
+	Image     string
+	Agents    int
+	Port      int
+	Token     string // Stored in a Secret, read by the pods from TokenEnv
+	TokenEnv  string
+	AgentList string
+	LoadArgs  []string
+}
+
+// k8sManifest is the template for all resources of a distributed run.
+// Agents are reachable as <name>-agent-<index>.<name>-agents because the
+// Job is Indexed and its pods use the headless Service as their subdomain.
+var k8sManifest = template.Must(template.New("k8s").Funcs(template.FuncMap{
+	"quote": yamlQuote,
+}).Parse(`apiVersion: v1
+kind: Secret
+metadata:
+  name: {{.Name}}-token
+  namespace: {{.Namespace}}
+type: Opaque
+stringData:
+  token: {{quote .Token}}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{.Name}}-agents
+  namespace: {{.Namespace}}
+spec:
+  clusterIP: None
+  selector:
+    app.kubernetes.io/name: {{.Name}}-agent
+  ports:
+    - name: agent
+      port: {{.Port}}
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{.Name}}-agent
+  namespace: {{.Namespace}}
+spec:
+  completionMode: Indexed
+  completions: {{.Agents}}
+  parallelism: {{.Agents}}
+  backoffLimit: 0
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: {{.Name}}-agent
+    spec:
+      subdomain: {{.Name}}-agents
+      restartPolicy: Never
+      containers:
+        - name: agent
+          image: {{.Image}}
+          args:
+            - "agent"
+            - "-listen"
+            - ":{{.Port}}"
+            - "-once"
+          env:
+            - name: {{.TokenEnv}}
+              valueFrom:
+                secretKeyRef:
+                  name: {{.Name}}-token
+                  key: token
+          ports:
+            - containerPort: {{.Port}}
+          readinessProbe:
+            httpGet:
+              path: /readyz
+              port: {{.Port}}
+            periodSeconds: 2
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{.Name}}-controller
+  namespace: {{.Namespace}}
+spec:
+  backoffLimit: 0
+  template:
+    spec:
+      restartPolicy: Never
+      containers:
+        - name: controller
+          image: {{.Image}}
+          args:
+            - "controller"
+            - "-agents"
+            - {{quote .AgentList}}
+            - "--"
+{{- range .LoadArgs}}
+            - {{quote .}}
+{{- end}}
+          env:
+            - name: {{.TokenEnv}}
+              valueFrom:
+                secretKeyRef:
+                  name: {{.Name}}-token
+                  key: token
+`))
+
+// runK8sCommand parses k8s flags and the load test flags following them,
+// then prints or applies the manifests.
+func runK8sCommand(args []string) error {
+	fs := flag.NewFlagSet("k8s", flag.ContinueOnError)
+	agents := fs.Int("agents", 3, "Number of agent pods")
+	image := fs.String("image", "go-load-tester:latest", "Container image with the go-load-tester binary as entrypoint")
+	name := fs.String("name", "load-test", "Name prefix for the generated resources")
+	namespace := fs.String("namespace", "default", "Namespace for the generated resources")
+	token := fs.String("token", "", "Shared token between controller and agents, stored in a Secret (default $"+distributedTokenEnv+", or a random one)")
+	apply := fs.Bool("apply", false, "Create the resources with `kubectl apply` instead of printing them")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *agents < 1 {
+		return fmt.Errorf("validation error: agents must be >= 1, got %d", *agents)
+	}
+	if *name == "" {
+		return fmt.Errorf("validation error: name is required")
+	}
+	if err := checkK8sNames(*name, *namespace, *agents); err != nil {
+		return err
+	}
+
+	if *token == "" {
+		*token = os.Getenv(distributedTokenEnv)
+	}
+	if *token == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return fmt.Errorf("generating a token: %w", err)
+		}
+		*token = hex.EncodeToString(b)
+	}
+
+	// Validate the load test flags now rather than inside the cluster, as
+	// the agents will: they run without -allow-local-reads.
+	loadArgs := fs.Args()
+	config, err := parseForwardedConfigArgs(loadArgs, &forwardLimits{})
+	if err != nil {
+		return err
+	}
+	if config.ScenarioFile != "" {
+		return fmt.Errorf("validation error: scenario mode is not supported in distributed mode")
+	}
+	if config.Profile != nil {
+		return fmt.Errorf("validation error: -profile is not supported in distributed mode")
+	}
+	if config.Pattern != nil {
+		return fmt.Errorf("validation error: -pattern is not supported in distributed mode")
+	}
+	if config.AutoConcurrency {
+		return fmt.Errorf("validation error: -auto-concurrency is not supported in distributed mode")
+	}
+	if config.MaxMemory > 0 {
+		return fmt.Errorf("validation error: -max-memory is not supported in distributed mode")
+	}
+	if config.NumRequests < *agents {
+		return fmt.Errorf("validation error: -n (%d) must be at least the number of agents (%d)", config.NumRequests, *agents)
+	}
+
+	params := k8sParams{
+		Name:      *name,
+		Namespace: *namespace,
+		Image:     *image,
+		Agents:    *agents,
+		Port:      7070,
+		Token:     *token,
+		TokenEnv:  distributedTokenEnv,
+		LoadArgs:  loadArgs,
+	}
+	addrs := make([]string, *agents)
+	for i := range addrs {
+		addrs[i] = fmt.Sprintf("%s-agent-%d.%s-agents:%d", *name, i, *name, params.Port)
+	}
+	params.AgentList = strings.Join(addrs, ",")
+
+	var buf bytes.Buffer
+	if err := k8sManifest.Execute(&buf, params); err != nil {
+		return fmt.Errorf("rendering manifests: %w", err)
+	}
+
+	if !*apply {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	cmd := exec.Command("kubectl", "apply", "-f", "-")
+	cmd.Stdin = &buf
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("kubectl apply: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Follow results with: kubectl logs -n %s -f job/%s-controller\n", *namespace, *name)
+	return nil
+}
+
+// checkK8sNames checks that name and namespace are RFC 1123 labels, and
+// that the longest names derived from name, the controller Job's and the
+// hostname of the last agent, still are.
+func checkK8sNames(name, namespace string, agents int) error {
+	var problems validationErrors
+	if !k8sLabel.MatchString(name) {
+		problems.addf("-name %q must consist of lowercase letters, digits and '-', and start and end with a letter or digit", name)
+	} else {
+		longest := max(len(name+"-controller"), len(name+"-agent-"+strconv.Itoa(agents-1)))
+		if longest > maxK8sLabel {
+			problems.addf("-name %q is too long: with %d agents it may have at most %d characters", name, agents, maxK8sLabel-(longest-len(name)))
+		}
+	}
+	if !k8sLabel.MatchString(namespace) || len(namespace) > maxK8sLabel {
+		problems.addf("-namespace %q must be at most %d lowercase letters, digits and '-', starting and ending with a letter or digit", namespace, maxK8sLabel)
+	}
+	return problems.err()
+}
+
+// yamlQuote renders s as a double-quoted YAML scalar. JSON string syntax is
+// a subset of YAML's double-quoted style.
+func yamlQuote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
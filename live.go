@@ -0,0 +1,165 @@
+// live.go implements the live figures of the progress line: the request
+// rate and P95 over the last few seconds, the errors so far and the
+// requests in flight against the number of workers. Stats keeps a small
+// ring of one-second slots for the moving figures, so they cost the same
+// however long the run is, and a gauge that workers raise and lower around
+// every request. The counts and gauges are atomics, so that at high request
+// rates watching the run does not contend with recording it.
+package main
+
+import "time"
+
+// liveSlots is how many one-second slots the moving rate and P95 span.
+const liveSlots = 5
+
+// liveRefresh is how often the moving rate and P95 are recomputed, which
+// takes the Stats mutex. In between, Live reports them as last computed.
+// Runs younger than 4*liveRefresh refresh them more often, so that their
+// first figures are not held for a whole refresh.
+const liveRefresh = time.Second
+
+// defaultProgressInterval is how often the progress line is redrawn unless
+// -progress-interval says otherwise.
+const defaultProgressInterval = 200 * time.Millisecond
+
+// liveSlot holds the requests completed within one second.
+type liveSlot struct {
+	sec       int64 // Unix second the slot counts, 0 if unused
+	requests  int
+	latencies hdrHistogram
+}
+
+// liveWindow is a ring of liveSlots one-second slots. It is not safe for
+// concurrent use; Stats guards it with its mutex.
+type liveWindow struct {
+	slots [liveSlots]liveSlot
+}
+
+// slot returns the slot of now, clearing it if it last counted an older
+// second.
+func (w *liveWindow) slot(now time.Time) *liveSlot {
+	sec := now.Unix()
+	sl := &w.slots[sec%liveSlots]
+	if sl.sec != sec {
+		*sl = liveSlot{sec: sec}
+	}
+	return sl
+}
+
+// add counts n requests completed at now with the given latencies.
+func (w *liveWindow) add(now time.Time, n int, latencies hdrSnapshot) {
+	sl := w.slot(now)
+	sl.requests += n
+	sl.latencies.merge(latencies)
+}
+
+// moving returns the request rate and P95 over the slots of the last
+// liveSlots seconds up to now. Runs younger than that are rated over their
+// age since start.
+func (w *liveWindow) moving(now, start time.Time, m PercentileMethod) (rate float64, p95 time.Duration) {
+	from := time.Unix(now.Unix()-liveSlots+1, 0)
+	if start.After(from) {
+		from = start
+	}
+	var n int
+	var h hdrHistogram
+	for i := range w.slots {
+		sl := &w.slots[i]
+		if sl.sec == 0 || sl.sec < from.Unix() || sl.sec > now.Unix() {
+			continue
+		}
+		n += sl.requests
+		h.merge(sl.latencies.snapshot())
+	}
+	if span := now.Sub(from); span > 0 {
+		rate = float64(n) / span.Seconds()
+	}
+	return rate, h.percentile(m, 95)
+}
+
+// LiveStatus is what the progress line shows at one moment of a run.
+type LiveStatus struct {
+	Completed int
+	Total     int
+	Elapsed   time.Duration
+	Errors    int           // Failed requests so far
+	Rate      float64       // Requests per second over the last liveSlots seconds
+	P95       time.Duration // P95 latency over the last liveSlots seconds
+	InFlight  int           // Requests sent and not yet completed
+	Workers   int           // Workers sending them, 0 if in-flight requests are not tracked
+}
+
+// liveMoving holds the moving figures of a Stats as computed at a time.
+type liveMoving struct {
+	at   time.Time
+	rate float64
+	p95  time.Duration
+}
+
+// setWorkers sets the number of workers whose in-flight requests s
+// tracks.
+func (s *Stats) setWorkers(n int) {
+	s.workers.Store(int64(n))
+}
+
+// RequestStarted marks a request as in flight until RequestDone. It is
+// safe for concurrent use.
+func (s *Stats) RequestStarted() {
+	s.inFlight.Add(1)
+	s.sent.Add(1)
+}
+
+// RequestDone marks a request started with RequestStarted as completed.
+func (s *Stats) RequestDone() {
+	s.inFlight.Add(-1)
+}
+
+// track adds the in-flight requests and workers of src to those s
+// reports, for Stats that only receive src's results through Merge.
+func (s *Stats) track(src *Stats) {
+	s.liveMu.Lock()
+	defer s.liveMu.Unlock()
+
+	s.sources = append(s.sources, src)
+}
+
+// Live returns the live status of the run. It is safe for concurrent use.
+func (s *Stats) Live() LiveStatus {
+	now := time.Now()
+	st := LiveStatus{
+		Completed: int(s.liveCompleted.Load()),
+		Total:     s.numRequests,
+		Elapsed:   now.Sub(s.startTime),
+		Errors:    int(s.liveErrors.Load()),
+		InFlight:  int(s.inFlight.Load()),
+		Workers:   int(s.workers.Load()),
+	}
+
+	s.liveMu.Lock()
+	if now.Sub(s.moving.at) >= min(liveRefresh, st.Elapsed/4) {
+		s.mu.Lock()
+		rate, p95 := s.live.moving(now, s.startTime, s.pctMethod)
+		s.mu.Unlock()
+		s.moving = liveMoving{at: now, rate: rate, p95: p95}
+	}
+	st.Rate, st.P95 = s.moving.rate, s.moving.p95
+	sources := s.sources
+	s.liveMu.Unlock()
+
+	if len(sources) > 0 {
+		st.Workers = 0
+	}
+	for _, src := range sources {
+		st.Workers += int(src.workers.Load())
+		st.InFlight += int(src.inFlight.Load())
+	}
+	return st
+}
+
+// progressInterval returns how often the progress of s is shown.
+func (s *Stats) progressInterval() time.Duration {
+	if s.interval > 0 {
+		return s.interval
+	}
+	return defaultProgressInterval
+}
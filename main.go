@@ -2,82 +2,325 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"syscall"
 )
 
+// subcommands maps subcommand names to their entry points. Each receives
+// the arguments following the subcommand name.
+var subcommands = map[string]func(args []string) error{
+	"template":       runTemplateCommand,
+	"agent":          runAgentCommand,
+	"controller":     runControllerCommand,
+	"k8s":            runK8sCommand,
+	"compare":        runCompareCommand,
+	"curve":          runCurveCommand,
+	"cache":          runCacheCommand,
+	"replay-request": runReplayRequestCommand,
+	"init":           runInitCommand,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	config, err := ParseConfig()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		fmt.Fprintln(os.Stderr, "Usage: go-load-tester -url <URL> [-n requests] [-c concurrency] [-method METHOD] [-timeout duration] [-header 'Key: Value'] [-body 'data']")
-		fmt.Fprintln(os.Stderr, "       go-load-tester -scenario <file.json> [-timeout duration]")
+		fmt.Fprintln(os.Stderr, "Usage: go-load-tester -url <URL> [-n requests] [-c concurrency] [-method METHOD] [-timeout duration] [-header 'Key: Value'] [-body 'data'] [-ci]")
+		fmt.Fprintln(os.Stderr, "       go-load-tester -scenario <file.json> [-timeout duration] [-ci]")
+		fmt.Fprintln(os.Stderr, "       go-load-tester -config <test.json> [-config <test.json> ...] [-ci]")
+		fmt.Fprintln(os.Stderr, "       go-load-tester init [-o loadtest.json]")
+		fmt.Fprintln(os.Stderr, "       go-load-tester template render|placeholders [-url URL] [-body data | -body-file path] [-data file.csv] [-n samples] [-seed N]")
+		fmt.Fprintln(os.Stderr, "       go-load-tester agent [-listen :7070] [-token X] [-once] [-join controller:7070 [-advertise host:port]]")
+		fmt.Fprintln(os.Stderr, "       go-load-tester controller -agents host:port,... | -listen :7070 [-min-agents N] [-advertise host:port] [-window 1s] [-web :8080] [-token X] [-wait 2m] -- <load test flags>")
+		fmt.Fprintln(os.Stderr, "       go-load-tester replay-request -from <failures.jsonl | run.jsonl> -index N [-step NAME] [-timeout 10s]")
+		fmt.Fprintln(os.Stderr, "       go-load-tester compare [-bucket 1s] [-metric p95] [-threshold 20%] [-csv] <baseline.jsonl> <candidate.jsonl>")
+		fmt.Fprintln(os.Stderr, "       go-load-tester curve -from RATE -to RATE [-steps 10] [-step-duration 30s] [-warmup 5s] [-metric p99] [-csv] [-html FILE] -- <load test flags>")
+		fmt.Fprintln(os.Stderr, "       go-load-tester cache [-purge URL ...] [-purge-method PURGE] [-purge-header 'Key: Value'] [-pause 0] -- <load test flags>")
+		fmt.Fprintln(os.Stderr, "       go-load-tester k8s [-agents N] [-image IMAGE] [-name NAME] [-namespace NS] [-token X] [-apply] -- <load test flags>")
 		os.Exit(1)
 	}
 
+	cpu := tuneForCPULimit()
+
+	logOut := logWriter(config)
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
 	// Scenario mode: multi-step flow.
 	if config.ScenarioFile != "" {
-		scenario, err := LoadScenario(config.ScenarioFile)
+		scenario, err := LoadScenario(config.ScenarioFile, config.Templates)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 
-		PrintScenarioBanner(scenario)
+		PrintScenarioBanner(logOut, scenario)
+		PrintCPUNotes(cpu, scenario.Concurrency)
+		clock := syncClock(ctx, logOut, config.ClockSync, scenario.Steps[0].URL, config.Timeout)
 
 		// Total requests = iterations * steps.
 		totalRequests := scenario.Iterations * len(scenario.Steps)
 		overallStats := NewStats(totalRequests)
+		overallStats.Configure(config)
 
 		// Per-step stats.
 		perStepStats := make(map[string]*Stats, len(scenario.Steps))
 		for _, step := range scenario.Steps {
 			perStepStats[step.Name] = NewStats(scenario.Iterations)
+			perStepStats[step.Name].Configure(config)
 		}
 
-		done := make(chan struct{})
-		progressDone := make(chan struct{})
-		go func() {
-			StartProgressMonitor(overallStats, done)
-			close(progressDone)
-		}()
+		exports := startExportsOrExit(config, overallStats)
+		baseline := takeResourceBaseline()
+		runCtx, guard := startMemoryGuard(ctx, config.MaxMemory, logOut, overallStats)
+		runErr := runWithProgress(!config.CI, logOut, overallStats, func() error {
+			return RunScenario(runCtx, scenario, config, overallStats, perStepStats)
+		})
+		guard.Close()
+		runErr = guard.result(runErr)
+		if runErr != nil {
+			fmt.Fprintf(os.Stderr, "\nError running scenario: %v\n", runErr)
+		}
 
-		if err := RunScenario(ctx, scenario, config, overallStats, perStepStats); err != nil {
-			fmt.Fprintf(os.Stderr, "\nError running scenario: %v\n", err)
+		overall := overallStats.GetSummary()
+		overall.Clock = clock
+		overall.Cleanup = checkCleanup(baseline)
+		exports.finish(overall)
+		report := Report{Summary: overall, Scenario: scenario, Steps: perStepStats}
+		if err := writeReport(config, report); err != nil {
+			runErr = err
 		}
 
-		close(done)
-		<-progressDone
+		exitCI(config, runErr, stop)
+		return
+	}
 
-		overall := overallStats.GetSummary()
-		PrintScenarioSummary(overall, scenario, perStepStats)
+	// Multi-test mode: independent tests running side by side.
+	if len(config.ConfigFiles) > 0 {
+		tests := make([]*TestDefinition, 0, len(config.ConfigFiles))
+		total, concurrency := 0, 0
+		for _, path := range config.ConfigFiles {
+			test, err := LoadTestDefinition(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			test.Config.MaxMemory = config.MaxMemory
+			test.Stats = NewStats(test.Config.NumRequests)
+			test.Stats.Configure(test.Config)
+			tests = append(tests, test)
+			total += test.Config.NumRequests
+			concurrency += test.Config.Concurrency
+		}
+
+		PrintTestsBanner(logOut, tests)
+		PrintCPUNotes(cpu, concurrency)
+		clock := syncClock(ctx, logOut, config.ClockSync, tests[0].Config.URL, tests[0].Config.Timeout)
+
+		combined := NewStats(total)
+		combined.Configure(config)
+
+		exports := startExportsOrExit(config, combined)
+		baseline := takeResourceBaseline()
+		runCtx, guard := startMemoryGuard(ctx, config.MaxMemory, logOut, combined)
+		runErr := runWithProgress(!config.CI, logOut, combined, func() error {
+			return RunTests(runCtx, tests, combined)
+		})
+		guard.Close()
+		runErr = guard.result(runErr)
+		if runErr != nil {
+			fmt.Fprintf(os.Stderr, "\nError running tests: %v\n", runErr)
+		}
+
+		summary := combined.GetSummary()
+		summary.Clock = clock
+		summary.Cleanup = checkCleanup(baseline)
+		exports.finish(summary)
+		if err := writeReport(config, Report{Summary: summary, Tests: tests}); err != nil {
+			runErr = err
+		}
+
+		exitCI(config, runErr, stop)
 		return
 	}
 
 	// Single-request mode.
-	PrintBanner(config)
+	var probe *ConcurrencyProbe
+	if config.AutoConcurrency {
+		if probe, err = probeConcurrency(ctx, config, logOut); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			stop()
+			os.Exit(1)
+		}
+		config.Concurrency = probe.Chosen
+	}
+	PrintBanner(logOut, config)
+	PrintCPUNotes(cpu, config.Concurrency)
+	clock := syncClock(ctx, logOut, config.ClockSync, config.URL, config.Timeout)
+
+	stats := NewStats(config.NumRequests * config.Repeat)
+	stats.Configure(config)
+
+	exports := startExportsOrExit(config, stats)
+	baseline := takeResourceBaseline()
+	runCtx, guard := startMemoryGuard(ctx, config.MaxMemory, logOut, stats)
+	var runErr error
+	var runs []Summary
+	if config.Repeat > 1 {
+		// Each run has stats of its own; stats collects all of them.
+		runs, runErr = runRepeated(runCtx, config, logOut, stats)
+	} else {
+		runErr = runWithProgress(!config.CI, logOut, stats, func() error {
+			return RunLoadTest(runCtx, config, stats)
+		})
+	}
+	guard.Close()
+	runErr = guard.result(runErr)
+	if runErr != nil {
+		fmt.Fprintf(os.Stderr, "\nError running load test: %v\n", runErr)
+	}
+
+	summary := stats.GetSummary()
+	if runs != nil {
+		summary = repeatedSummary(stats, runs, config.RepeatPause)
+	}
+	summary.Mirror = config.Mirror.summary()
+	summary.Probe = probe
+	summary.Clock = clock
+	summary.Cleanup = checkCleanup(baseline)
+	exports.finish(summary)
+	if err := writeReport(config, Report{Summary: summary}); err != nil {
+		runErr = err
+	}
+
+	exitCI(config, runErr, stop)
+}
+
+// startExportsOrExit starts config's exporters on stats, exiting if one
+// cannot start.
+func startExportsOrExit(config *Config, stats *Stats) *exportSession {
+	exports, err := startExports(config, stats, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return exports
+}
+
+// runWithProgress runs fn while a progress monitor renders stats on w,
+// unless show is false. It returns fn's error once the monitor has
+// finished.
+func runWithProgress(show bool, w io.Writer, stats *Stats, fn func() error) error {
+	if !show {
+		return fn()
+	}
 
-	stats := NewStats(config.NumRequests)
 	done := make(chan struct{})
 	progressDone := make(chan struct{})
-
 	go func() {
-		StartProgressMonitor(stats, done)
+		StartProgressMonitor(w, stats, done)
 		close(progressDone)
 	}()
 
-	if err := RunLoadTest(ctx, config, stats); err != nil {
-		fmt.Fprintf(os.Stderr, "\nError running load test: %v\n", err)
-	}
+	err := fn()
 
 	close(done)
 	<-progressDone
+	return err
+}
 
-	summary := stats.GetSummary()
-	PrintSummary(summary)
+// writeReport checks the configured thresholds and budgets on report's
+// summary and writes the report to stdout with the configured formatter,
+// reporting a failure on stderr. It returns errThresholds if a threshold
+// failed (with errGates if it was set by a gate flag), errBudgets if a
+// budget was violated and errFailedRequests if requests failed with
+// failing statuses set, joined if several apply.
+func writeReport(config *Config, report Report) error {
+	report.Summary.Thresholds = checkThresholds(config.Thresholds, report.Summary)
+	if config.Budgets != nil {
+		report.Summary.Budgets = checkThresholds(config.Budgets.Thresholds, report.Summary)
+	}
+	report.Baseline = config.Baseline
+	if err := formatReport(config, report); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s report: %v\n", config.Output, err)
+		return err
+	}
+	var errs []error
+	if thresholdsFailed(report.Summary.Thresholds) {
+		errs = append(errs, errThresholds)
+	}
+	if gatesFailed(report.Summary.Thresholds) {
+		errs = append(errs, errGates)
+	}
+	if thresholdsFailed(report.Summary.Budgets) {
+		errs = append(errs, errBudgets)
+	}
+	if requestsFailed(config, report) {
+		errs = append(errs, errFailedRequests)
+	}
+	return errors.Join(errs...)
+}
+
+// formatReport writes the report to -output-file, or to stdout if none is
+// set. If the file cannot be created the report goes to stdout instead, so
+// the results of a long run aren't lost to a typo in the path.
+func formatReport(config *Config, report Report) error {
+	f := formatters[config.Output]
+	if config.OutputFile == "" {
+		return f.Format(os.Stdout, report)
+	}
+	out, err := os.Create(config.OutputFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v; writing the report to stdout instead\n", err)
+		if ferr := f.Format(os.Stdout, report); ferr != nil {
+			return ferr
+		}
+		return err
+	}
+	if err := f.Format(out, report); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// logWriter returns where banners, progress and notes go. In CI mode
+// stdout carries only the JSON summary, so they go to stderr. The same
+// goes for any report format but text written to stdout, so the report
+// can be redirected to a file.
+func logWriter(config *Config) io.Writer {
+	if config.CI || (config.Output != "text" && config.OutputFile == "") {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// exitCI terminates with a non-zero status in CI mode when the run failed
+// (e.g. it was interrupted), so pipelines notice. Outside CI mode it only
+// exits when requests failed with failing statuses set, a gate flag's
+// threshold failed or a budget was violated, which ask for a non-zero
+// status explicitly. stop releases the signal handler before exiting.
+func exitCI(config *Config, runErr error, stop context.CancelFunc) {
+	if runErr == nil {
+		return
+	}
+	if !config.CI && !errors.Is(runErr, errFailedRequests) && !errors.Is(runErr, errGates) && !errors.Is(runErr, errBudgets) {
+		return
+	}
+	stop()
+	os.Exit(1)
 }
@@ -0,0 +1,210 @@
+// mdreport.go renders summaries as GitHub-flavored markdown
+// (-output markdown), compact enough to be posted as a pull request
+// comment by a CI bot: a pass/fail headline, the key metrics (next to
+// those of a -baseline run when one is given), threshold and budget
+// results, and a breakdown per step or test, per label and per load
+// profile stage, and the shares of requests in each SLA bucket.
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// formatMarkdown renders the report as markdown tables.
+func formatMarkdown(w io.Writer, r Report) error {
+	s := r.Summary
+	var b strings.Builder
+
+	// Threshold and budget failures have tables of their own below.
+	withoutThresholds := s
+	withoutThresholds.Thresholds = nil
+	withoutThresholds.Budgets = nil
+	failures := reportFailures(withoutThresholds)
+	if len(failures) > 0 || thresholdsFailed(s.Thresholds) || thresholdsFailed(s.Budgets) {
+		b.WriteString("### ❌ Load test failed\n\n")
+	} else {
+		b.WriteString("### ✅ Load test passed\n\n")
+	}
+	for _, f := range failures {
+		fmt.Fprintf(&b, "- %s\n", f)
+	}
+	if len(failures) > 0 {
+		b.WriteString("\n")
+	}
+
+	writeMarkdownMetrics(&b, s, r.Baseline)
+
+	if len(s.Thresholds) > 0 {
+		b.WriteString("\n| Threshold | Actual | Result |\n")
+		b.WriteString("|---|---:|:---:|\n")
+		for _, t := range s.Thresholds {
+			result := "✅"
+			if !t.Passed {
+				result = "❌"
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %s |\n", t.Expr, t.formatActual(), result)
+		}
+	}
+
+	if len(s.Budgets) > 0 {
+		b.WriteString("\n| Budget | Actual | Result |\n")
+		b.WriteString("|---|---:|:---:|\n")
+		for _, t := range s.Budgets {
+			result := "✅"
+			if !t.Passed {
+				result = "❌"
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %s |\n", t.Expr, t.formatActual(), result)
+		}
+	}
+
+	if len(s.StatusCodes) > 0 {
+		codes := make([]int, 0, len(s.StatusCodes))
+		for code := range s.StatusCodes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		parts := make([]string, len(codes))
+		for i, code := range codes {
+			parts[i] = fmt.Sprintf("`%d` × %d", code, s.StatusCodes[code])
+		}
+		fmt.Fprintf(&b, "\nStatus codes: %s\n", strings.Join(parts, ", "))
+	}
+
+	if groups := r.Groups(); len(groups) > 0 {
+		b.WriteString("\n| Name | Request | Requests | Failed | Avg | P95 | P99 |\n")
+		b.WriteString("|---|---|---:|---:|---:|---:|---:|\n")
+		for _, g := range groups {
+			gs := g.Summary
+			fmt.Fprintf(&b, "| %s | `%s %s` | %d | %d | %s | %s | %s |\n",
+				markdownEscape(g.Name), g.Method, markdownEscape(g.URL), gs.TotalRequests, gs.FailCount,
+				formatDuration(gs.AvgDuration), formatDuration(gs.P95), formatDuration(gs.P99))
+		}
+	}
+
+	if labels := r.Labels(); len(labels) > 0 {
+		b.WriteString("\n| Label | Requests | Failed | Avg | P95 | P99 |\n")
+		b.WriteString("|---|---:|---:|---:|---:|---:|\n")
+		for _, g := range labels {
+			gs := g.Summary
+			fmt.Fprintf(&b, "| %s | %d | %d | %s | %s | %s |\n",
+				markdownEscape(g.Label), gs.TotalRequests, gs.FailCount,
+				formatDuration(gs.AvgDuration), formatDuration(gs.P95), formatDuration(gs.P99))
+		}
+	}
+
+	for _, r := range s.SLA {
+		name := r.Label
+		if name == "" {
+			name = "all requests"
+		}
+		fmt.Fprintf(&b, "\n| SLA: %s | Latency | Share |\n|---|---|---:|\n", markdownEscape(name))
+		var prev time.Duration
+		for _, sb := range r.Buckets {
+			fmt.Fprintf(&b, "| %s | %s | %.1f%% |\n", markdownEscape(sb.Name), sb.rangeFrom(prev), sb.Percent)
+			prev = sb.Below
+		}
+	}
+
+	if len(s.Stages) > 0 {
+		b.WriteString("\n| Stage | Duration | Target | Req/s | Requests | Failed | P95 | P99 |\n")
+		b.WriteString("|---|---:|---:|---:|---:|---:|---:|---:|\n")
+		for _, st := range s.Stages {
+			fmt.Fprintf(&b, "| %s | %s | %g | %.2f | %d | %d | %s | %s |\n",
+				markdownEscape(st.Name), st.Duration, st.Rate, st.RequestsPerSec, st.Requests, st.Errors,
+				formatDuration(st.P95), formatDuration(st.P99))
+		}
+	}
+
+	if len(s.Errors) > 0 {
+		b.WriteString("\n<details><summary>Errors</summary>\n\n")
+		for _, e := range s.Errors {
+			fmt.Fprintf(&b, "- `%s`\n", strings.ReplaceAll(e, "`", "'"))
+		}
+		if s.TotalErrors > len(s.Errors) {
+			fmt.Fprintf(&b, "- … and %d more\n", s.TotalErrors-len(s.Errors))
+		}
+		b.WriteString("\n</details>\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeMarkdownMetrics writes the key metrics as a table, with a baseline
+// and change column when base is set.
+func writeMarkdownMetrics(b *strings.Builder, s Summary, base *Summary) {
+	if base == nil {
+		b.WriteString("| Metric | Value |\n|---|---:|\n")
+		fmt.Fprintf(b, "| Requests | %d |\n", s.TotalRequests)
+		fmt.Fprintf(b, "| Error rate | %.2f%% |\n", errorRate(s))
+		fmt.Fprintf(b, "| Req/s | %.2f |\n", s.RequestsPerSec)
+		for _, l := range markdownLatencies {
+			fmt.Fprintf(b, "| %s | %s |\n", l.name, l.format(s))
+		}
+		writeMarkdownConfidence(b, s)
+		return
+	}
+
+	b.WriteString("| Metric | Baseline | Current | Change |\n|---|---:|---:|---:|\n")
+	fmt.Fprintf(b, "| Requests | %d | %d | |\n", base.TotalRequests, s.TotalRequests)
+	fmt.Fprintf(b, "| Error rate | %.2f%% | %.2f%% | %+.2f pp |\n", errorRate(*base), errorRate(s), errorRate(s)-errorRate(*base))
+	fmt.Fprintf(b, "| Req/s | %.2f | %.2f | %s |\n", base.RequestsPerSec, s.RequestsPerSec, relativeChange(base.RequestsPerSec, s.RequestsPerSec))
+	for _, l := range markdownLatencies {
+		before, after := l.get(*base), l.get(s)
+		fmt.Fprintf(b, "| %s | %s | %s | %s |\n", l.name, l.format(*base), l.format(s), relativeChange(float64(before), float64(after)))
+	}
+	writeMarkdownConfidence(b, s)
+}
+
+// writeMarkdownConfidence writes the footnote of the percentiles marked
+// low-confidence in the metrics table, if any.
+func writeMarkdownConfidence(b *strings.Builder, s Summary) {
+	if confidenceNote(s, 99) == "" {
+		return
+	}
+	fmt.Fprintf(b, "\n\\* Low confidence: fewer than %d of the %d samples lie beyond the percentile (`-min-samples`).\n", s.MinSamples, s.Samples)
+}
+
+// markdownLatency is a latency row of the markdown metrics table; pct is
+// the percentile it shows, 0 for the average.
+type markdownLatency struct {
+	name string
+	pct  float64
+	get  func(Summary) time.Duration
+}
+
+// markdownLatencies are the latency rows of the markdown metrics table.
+var markdownLatencies = []markdownLatency{
+	{"Avg", 0, func(s Summary) time.Duration { return s.AvgDuration }},
+	{"P50", 50, func(s Summary) time.Duration { return s.P50 }},
+	{"P95", 95, func(s Summary) time.Duration { return s.P95 }},
+	{"P99", 99, func(s Summary) time.Duration { return s.P99 }},
+}
+
+// format returns the row's value in s, marked with an asterisk if it is a
+// low-confidence percentile.
+func (l markdownLatency) format(s Summary) string {
+	v := formatDuration(l.get(s))
+	if l.pct > 0 && confidenceNote(s, l.pct) != "" {
+		v += "\\*"
+	}
+	return v
+}
+
+// relativeChange formats the change from before to after in percent.
+func relativeChange(before, after float64) string {
+	if before == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%+.1f%%", (after-before)/before*100)
+}
+
+// markdownEscape escapes the characters that would break a table cell.
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
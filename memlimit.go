@@ -0,0 +1,332 @@
+// memlimit.go implements -max-memory, which bounds the memory of a run.
+// Stats normally keeps every dial timing as a raw sample,
+// so its memory grows with the number of requests; under -max-memory those
+// timings go into histograms like the request latencies, and a guard
+// watches the live heap, warning as it nears the limit and ending the run
+// with a summary before it reaches it. A billion-request run on a small CI
+// runner then reports what it managed instead of being killed by the OOM
+// killer with nothing to show.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// minMaxMemory is the smallest -max-memory accepted; below it the runtime
+// and connection buffers alone would trip the guard.
+const minMaxMemory = 64 << 20
+
+// Shares of -max-memory at which the guard warns and ends the run.
+const (
+	memoryWarnShare = 0.80
+	memoryStopShare = 0.95
+)
+
+// memoryCheckInterval is how often the guard reads the live heap.
+const memoryCheckInterval = time.Second
+
+// byteUnits maps the -max-memory suffixes to their multiples, in powers of
+// 1024 like formatBytes.
+var byteUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+}
+
+// parseMaxMemory parses a -max-memory value such as "512MB" or "2GB" into
+// bytes; "" is 0, no limit.
+func parseMaxMemory(raw string) (int64, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	s := strings.ToUpper(strings.TrimSpace(raw))
+	s = strings.Replace(s, "IB", "B", 1) // MiB reads as MB
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	unit, ok := byteUnits[strings.TrimSpace(s[i:])]
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("invalid -max-memory value %q, expected a size such as 512MB or 2GB", raw)
+	}
+	limit := int64(n * float64(unit))
+	if limit < minMaxMemory {
+		return 0, fmt.Errorf("-max-memory must be at least %s, got %s", formatBytes(minMaxMemory), formatBytes(limit))
+	}
+	return limit, nil
+}
+
+// durationHist is a histogram of durations that also keeps their sum, for
+// the averages of a LatencyDist.
+type durationHist struct {
+	hist hdrHistogram
+	sum  time.Duration
+}
+
+// durationHistSnapshot is the serializable form of a durationHist.
+type durationHistSnapshot struct {
+	Hist hdrSnapshot   `json:"hist"`
+	Sum  time.Duration `json:"sum"`
+}
+
+// histMark remembers how much of a durationHist Delta has returned.
+type histMark struct {
+	counts []int64
+	n      int64
+	sum    time.Duration
+}
+
+// record adds one duration.
+func (h *durationHist) record(d time.Duration) {
+	h.hist.record(d)
+	h.sum += d
+}
+
+// merge adds the durations of snap.
+func (h *durationHist) merge(snap durationHistSnapshot) {
+	h.hist.merge(snap.Hist)
+	h.sum += snap.Sum
+}
+
+// delta returns the durations added since mark and advances mark.
+func (h *durationHist) delta(mark *histMark) durationHistSnapshot {
+	snap := durationHistSnapshot{Hist: h.hist.delta(&mark.counts), Sum: h.sum - mark.sum}
+	mark.n, mark.sum = h.hist.total, h.sum
+	return snap
+}
+
+// grew reports whether durations were added since mark.
+func (h *durationHist) grew(mark *histMark) bool {
+	return h.hist.total != mark.n
+}
+
+// dist summarizes the durations, using method m for percentiles.
+func (h *durationHist) dist(m PercentileMethod) LatencyDist {
+	n := h.hist.count()
+	if n == 0 {
+		return LatencyDist{}
+	}
+	return LatencyDist{
+		Count: n,
+		Avg:   h.sum / time.Duration(n),
+		Max:   h.hist.max,
+		P50:   h.hist.percentile(m, 50),
+		P90:   h.hist.percentile(m, 90),
+		P95:   h.hist.percentile(m, 95),
+		P99:   h.hist.percentile(m, 99),
+	}
+}
+
+// histOf returns the histogram of key in hists, creating it if needed.
+func histOf(hists map[string]*durationHist, key string) *durationHist {
+	h, ok := hists[key]
+	if !ok {
+		h = &durationHist{}
+		hists[key] = h
+	}
+	return h
+}
+
+// boundedStats holds the timings Stats keeps as raw samples, in
+// histograms instead, when memory is bounded.
+type boundedStats struct {
+	dials map[string]*durationHist
+}
+
+// boundedSnapshot is the serializable form of boundedStats.
+type boundedSnapshot struct {
+	Dials map[string]durationHistSnapshot `json:"dials,omitempty"`
+}
+
+// boundedMark remembers how much of a boundedStats Delta has returned.
+type boundedMark struct {
+	dials map[string]*histMark
+}
+
+// bound switches s to histograms for the timings it keeps as raw samples,
+// moving those recorded so far into them. The caller must hold s.mu.
+func (s *Stats) bound() {
+	if s.bounded != nil {
+		return
+	}
+	b := &boundedStats{dials: make(map[string]*durationHist)}
+	b.addRaw(s.dials)
+	s.bounded = b
+	s.dials = nil
+}
+
+// addRaw records raw samples, as Stats or a StatsSnapshot of unbounded
+// stats hold them.
+func (b *boundedStats) addRaw(dials map[string][]time.Duration) {
+	for family, durations := range dials {
+		h := histOf(b.dials, family)
+		for _, d := range durations {
+			h.record(d)
+		}
+	}
+}
+
+// snapshot returns a copy of b, nil if b is nil.
+func (b *boundedStats) snapshot() *boundedSnapshot {
+	if b == nil {
+		return nil
+	}
+	return b.delta(&boundedMark{})
+}
+
+// merge adds the histograms of snap.
+func (b *boundedStats) merge(snap *boundedSnapshot) {
+	if snap == nil {
+		return
+	}
+	for family, hs := range snap.Dials {
+		histOf(b.dials, family).merge(hs)
+	}
+}
+
+// delta returns what b gained since m and advances m; nil if b is nil or
+// gained nothing.
+func (b *boundedStats) delta(m *boundedMark) *boundedSnapshot {
+	if b == nil {
+		return nil
+	}
+	if m.dials == nil {
+		m.dials = make(map[string]*histMark)
+	}
+	dials := deltaHists(b.dials, m.dials)
+	if dials == nil {
+		return nil
+	}
+	return &boundedSnapshot{Dials: dials}
+}
+
+// deltaHists returns what the histograms of hists gained since marks, nil
+// if nothing, and advances marks.
+func deltaHists(hists map[string]*durationHist, marks map[string]*histMark) map[string]durationHistSnapshot {
+	var out map[string]durationHistSnapshot
+	for key, h := range hists {
+		mark, ok := marks[key]
+		if !ok {
+			mark = &histMark{}
+			marks[key] = mark
+		}
+		if !h.grew(mark) {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]durationHistSnapshot)
+		}
+		out[key] = h.delta(mark)
+	}
+	return out
+}
+
+// summarize returns the distributions of b's dial timings.
+func (b *boundedStats) summarize(m PercentileMethod) map[string]LatencyDist {
+	dials := make(map[string]LatencyDist, len(b.dials))
+	for family, h := range b.dials {
+		dials[family] = h.dist(m)
+	}
+	return dials
+}
+
+// memoryGuard watches the live heap of a run under -max-memory. It warns
+// once the heap passes memoryWarnShare of the limit and ends the run, as a
+// stop condition does, at memoryStopShare.
+type memoryGuard struct {
+	limit   int64
+	stats   *Stats
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stopped atomic.Bool
+}
+
+// startMemoryGuard sets the runtime's soft memory limit to limit and
+// starts watching the heap of the run recording to stats, noting on w
+// what the limit changes. It returns the context the run must use, which
+// the guard cancels to end it. With limit 0 it returns ctx and a nil
+// guard, whose methods do nothing.
+func startMemoryGuard(ctx context.Context, limit int64, w io.Writer, stats *Stats) (context.Context, *memoryGuard) {
+	if limit <= 0 {
+		return ctx, nil
+	}
+	debug.SetMemoryLimit(limit)
+	fmt.Fprintf(w, "Note: -max-memory %s: dial timings are kept in histograms instead of raw samples, and the run ends early if the live heap reaches %s\n",
+		formatBytes(limit), formatBytes(int64(float64(limit)*memoryStopShare)))
+
+	ctx, cancel := context.WithCancel(ctx)
+	g := &memoryGuard{limit: limit, stats: stats, cancel: cancel, done: make(chan struct{})}
+	go g.watch(ctx, w)
+	return ctx, g
+}
+
+// watch polls the live heap until ctx is done.
+func (g *memoryGuard) watch(ctx context.Context, w io.Writer) {
+	defer close(g.done)
+	ticker := time.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+
+	warned := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		heap := liveHeap()
+		share := float64(heap) / float64(g.limit)
+		switch {
+		case share >= memoryStopShare:
+			g.stats.MarkStopped(fmt.Sprintf("live heap reached %s of -max-memory %s", formatBytes(heap), formatBytes(g.limit)))
+			g.stopped.Store(true)
+			g.cancel()
+			return
+		case share >= memoryWarnShare && !warned:
+			fmt.Fprintf(w, "\nWarning: live heap at %s, %.0f%% of -max-memory %s; the run ends at %.0f%%\n",
+				formatBytes(heap), share*100, formatBytes(g.limit), memoryStopShare*100)
+			warned = true
+		}
+	}
+}
+
+// liveHeap returns the heap memory in use by live objects as of the last
+// garbage collection: what the process could not free if it tried.
+func liveHeap() int64 {
+	sample := []metrics.Sample{{Name: "/gc/heap/live:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return int64(sample[0].Value.Uint64())
+}
+
+// Close stops watching.
+func (g *memoryGuard) Close() {
+	if g == nil {
+		return
+	}
+	g.cancel()
+	<-g.done
+}
+
+// result returns the error of a run the guard watched: err, or nil if err
+// is only the cancellation by which the guard ended the run, which like a
+// stop condition is an expected outcome.
+func (g *memoryGuard) result(err error) error {
+	if g != nil && g.stopped.Load() && errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,128 @@
+// methodmix.go implements weighted HTTP method mixes for single-URL mode.
+// A spec like "GET:80,POST:20" makes each request pick its method at random
+// according to the weights, optionally with a separate body per method, so
+// a simple test can approximate realistic read/write ratios.
+package main
+
+import (
+	"fmt"
+	mathrand "math/rand"
+	"strconv"
+	"strings"
+)
+
+// MethodWeight is a single method entry of a method mix.
+type MethodWeight struct {
+	Method       string
+	Weight       int
+	Body         string    // Raw body for this method, empty if none
+	BodyTemplate *Template // Parsed Body
+}
+
+// MethodMix picks a method for each request according to relative weights.
+type MethodMix struct {
+	Entries []MethodWeight
+	total   int
+}
+
+// parseMethodMix parses a "METHOD:WEIGHT,..." spec. bodies maps an
+// upper-case method to its body; methods without an entry fall back to
+// defaultBody. Methods may be any valid method name. The bodies are parsed
+// with tc.
+func parseMethodMix(spec string, bodies map[string]string, defaultBody string, tc *templateContext) (*MethodMix, error) {
+	mix := &MethodMix{}
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		pieces := strings.SplitN(part, ":", 2)
+		if len(pieces) != 2 {
+			return nil, fmt.Errorf("invalid method mix entry %q, expected 'METHOD:WEIGHT'", part)
+		}
+		method := strings.ToUpper(strings.TrimSpace(pieces[0]))
+		if !validMethod(method) {
+			return nil, fmt.Errorf("method mix: invalid method %q", pieces[0])
+		}
+		if seen[method] {
+			return nil, fmt.Errorf("method mix: duplicate method %q", method)
+		}
+		seen[method] = true
+
+		weight, err := strconv.Atoi(strings.TrimSpace(pieces[1]))
+		if err != nil || weight < 1 {
+			return nil, fmt.Errorf("method mix: weight for %s must be a positive integer, got %q", method, pieces[1])
+		}
+
+		body, ok := bodies[method]
+		if !ok {
+			body = defaultBody
+		}
+		tmpl, err := tc.ParseTemplate(body)
+		if err != nil {
+			return nil, fmt.Errorf("method mix: invalid %s body template: %w", method, err)
+		}
+
+		mix.Entries = append(mix.Entries, MethodWeight{
+			Method:       method,
+			Weight:       weight,
+			Body:         body,
+			BodyTemplate: tmpl,
+		})
+		mix.total += weight
+	}
+
+	if len(mix.Entries) == 0 {
+		return nil, fmt.Errorf("method mix must contain at least one entry")
+	}
+
+	for method := range bodies {
+		if !seen[method] {
+			return nil, fmt.Errorf("-method-body given for %s, which is not part of -method-mix", method)
+		}
+	}
+
+	return mix, nil
+}
+
+// parseMethodBodies parses repeated -method-body values of the form
+// "METHOD:body" into a map keyed by upper-case method.
+func parseMethodBodies(values []string) (map[string]string, error) {
+	bodies := make(map[string]string, len(values))
+	for _, v := range values {
+		parts := strings.SplitN(v, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid -method-body %q, expected 'METHOD:body'", v)
+		}
+		method := strings.ToUpper(strings.TrimSpace(parts[0]))
+		if _, dup := bodies[method]; dup {
+			return nil, fmt.Errorf("duplicate -method-body for %s", method)
+		}
+		bodies[method] = parts[1]
+	}
+	return bodies, nil
+}
+
+// Pick returns an entry chosen with rng, weighted by Weight.
+func (m *MethodMix) Pick(rng *mathrand.Rand) *MethodWeight {
+	n := rng.Intn(m.total)
+	for i := range m.Entries {
+		n -= m.Entries[i].Weight
+		if n < 0 {
+			return &m.Entries[i]
+		}
+	}
+	return &m.Entries[len(m.Entries)-1]
+}
+
+// String formats the mix as percentages, e.g. "GET 80%, POST 20%".
+func (m *MethodMix) String() string {
+	parts := make([]string, len(m.Entries))
+	for i, e := range m.Entries {
+		parts[i] = fmt.Sprintf("%s %.0f%%", e.Method, float64(e.Weight)/float64(m.total)*100)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,192 @@
+// mirror.go implements request mirroring (-mirror-to URL): a copy of a
+// share of the requests (-mirror-percent) is sent to a second target at the
+// same time as the original, with the same method, path, headers and body.
+// The copies are recorded in shadow stats of their own and never count in
+// the primary results, so a canary can be compared with the current
+// version under exactly the same generated traffic. The responses can also
+// be compared pair by pair (mirrordiff.go).
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mirror sends copies of requests to a second target. A nil *Mirror
+// mirrors nothing.
+type Mirror struct {
+	Target *url.URL    // Scheme and host the copies are sent to, and a path prefix
+	Rate   float64     // Share of requests mirrored, 0 to 1
+	Diff   *MirrorDiff // What of the responses is compared, nil to compare nothing
+
+	// Per-run state, set by start.
+	stats   *Stats
+	config  *Config
+	client  *http.Client
+	slots   chan struct{} // Bounds the copies in flight
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	dropped int // Copies not sent because the mirror fell behind
+	diff    MirrorDiffSummary
+}
+
+// MirrorSummary is the shadow results of a mirrored run.
+type MirrorSummary struct {
+	Target  string
+	Rate    float64
+	Dropped int // Copies not sent because as many were in flight as there are workers
+	Summary Summary
+	Diff    *MirrorDiffSummary // Differences between the responses, nil without -mirror-diff
+}
+
+// newMirror returns a mirror to target for a share of rate of the
+// requests, comparing the responses as diff selects.
+func newMirror(target string, rate float64, diff *MirrorDiff) (*Mirror, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	return &Mirror{Target: u, Rate: rate, Diff: diff}, nil
+}
+
+// needsBody reports whether the responses of mirrored requests and their
+// copies are read for comparison.
+func (m *Mirror) needsBody() bool {
+	return m != nil && m.Diff.needsBody()
+}
+
+// start prepares the mirror for a run of config, with fresh shadow stats.
+// As many copies may be in flight as the run has workers.
+func (m *Mirror) start(config *Config) {
+	if m == nil {
+		return
+	}
+	m.stats = NewStats(int(float64(config.NumRequests) * m.Rate))
+	m.stats.Configure(config)
+	m.config = config
+	m.client = &http.Client{Timeout: config.Timeout, Transport: newTransport(config, config.Concurrency, m.stats)}
+	m.slots = make(chan struct{}, config.Concurrency)
+	m.dropped = 0
+	m.diff = MirrorDiffSummary{}
+	if m.Diff != nil {
+		m.diff = MirrorDiffSummary{Fields: m.Diff.fields(), ByField: make(map[string]int)}
+	}
+}
+
+// close waits for the copies in flight and closes the mirror's
+// connections.
+func (m *Mirror) close() {
+	if m == nil || m.client == nil {
+		return
+	}
+	m.wg.Wait()
+	m.client.CloseIdleConnections()
+}
+
+// send sends a copy of req, whose body is body, to the mirror target if
+// the request is picked for mirroring with rng. The copy is bound to ctx, the run's
+// context, rather than to req's, so -cancel-rate injection does not reach
+// it. send does not wait for the response; a copy is dropped rather than
+// delay the original when as many copies are in flight as the run has
+// workers. With -mirror-diff, send returns the pair the result of req is
+// to be recorded on for comparison, and nil otherwise.
+func (m *Mirror) send(ctx context.Context, req *http.Request, body string, label string, rng *mathrand.Rand) *mirrorPair {
+	if m == nil || rng.Float64() >= m.Rate {
+		return nil
+	}
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		m.mu.Lock()
+		m.dropped++
+		m.mu.Unlock()
+		return nil
+	}
+
+	u := *req.URL
+	u.Scheme, u.Host = m.Target.Scheme, m.Target.Host
+	u.Path = strings.TrimSuffix(m.Target.Path, "/") + u.Path
+	if u.RawPath != "" {
+		u.RawPath = strings.TrimSuffix(m.Target.EscapedPath(), "/") + u.RawPath
+	}
+	var reader io.Reader
+	if body != "" {
+		reader = bytes.NewReader([]byte(body))
+	}
+	copyReq, err := http.NewRequestWithContext(ctx, req.Method, u.String(), reader)
+	if err != nil {
+		<-m.slots
+		m.stats.Record(RequestResult{Method: req.Method, Label: label, Error: err})
+		return nil
+	}
+	copyReq.Header = req.Header.Clone()
+
+	var pair *mirrorPair
+	if m.Diff != nil {
+		pair = &mirrorPair{m: m, method: req.Method, url: req.URL.String()}
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer func() { <-m.slots }()
+		w := &Worker{client: m.client, config: m.config}
+		result := w.do(copyReq)
+		result.Method = req.Method
+		result.Label = label
+		m.stats.Record(result)
+		// A copy cut short by the end of the run says nothing about
+		// the mirror's answer.
+		if result.Error == nil || ctx.Err() == nil {
+			pair.record(false, result)
+		}
+	}()
+	return pair
+}
+
+// summary returns the shadow results of the run.
+func (m *Mirror) summary() *MirrorSummary {
+	if m == nil || m.stats == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := &MirrorSummary{Target: m.Target.String(), Rate: m.Rate, Dropped: m.dropped, Summary: m.stats.GetSummary()}
+	if m.Diff != nil {
+		diff := m.diff
+		diff.ByField = copyCounts(m.diff.ByField)
+		diff.Samples = append([]MirrorDiffSample(nil), m.diff.Samples...)
+		s.Diff = &diff
+	}
+	return s
+}
+
+// printMirror prints the primary and the mirror results side by side.
+func printMirror(w io.Writer, primary Summary, m *MirrorSummary) {
+	fmt.Fprintf(w, "Mirror (%s, %.4g%% of requests", m.Target, m.Rate*100)
+	if m.Dropped > 0 {
+		fmt.Fprintf(w, ", %d copies dropped", m.Dropped)
+	}
+	fmt.Fprintln(w, "):")
+	printSideBySide(w, "Primary", "Mirror", primary, m.Summary)
+	codes := make([]int, 0, len(m.Summary.StatusCodes))
+	for code := range m.Summary.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "  Mirror [%d]   %d responses\n", code, m.Summary.StatusCodes[code])
+	}
+	if m.Diff != nil {
+		fmt.Fprintln(w)
+		printMirrorDiff(w, m.Diff)
+	}
+}
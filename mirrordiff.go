@@ -0,0 +1,221 @@
+// mirrordiff.go implements response diffing in mirror mode (-mirror-diff,
+// -mirror-diff-json): the response to every mirrored request is compared
+// with the response to its copy, on the status, a hash of the body or
+// selected JSON fields, and the mismatches are counted with a few samples.
+// Mirroring then checks that a migrated service answers like the old one
+// under load, not just as fast.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxDiffSamples is the number of mismatches kept as samples.
+const maxDiffSamples = 10
+
+// diffError is the field under which a pair is counted when only one of
+// the two requests failed with an error, whatever fields are compared.
+const diffError = "error"
+
+// MirrorDiff selects what of the primary and mirror responses is compared.
+type MirrorDiff struct {
+	Status bool
+	Body   bool     // SHA-256 of the first maxResponseBody bytes of the body
+	JSON   []string // Paths into JSON bodies, as for -assert-json
+}
+
+// parseMirrorDiff builds the comparison of the -mirror-diff and
+// -mirror-diff-json flags, returning nil if neither is set.
+func parseMirrorDiff(fields string, jsonPaths []string) (*MirrorDiff, error) {
+	if fields == "" && len(jsonPaths) == 0 {
+		return nil, nil
+	}
+	d := &MirrorDiff{JSON: jsonPaths}
+	if fields != "" {
+		for _, f := range strings.Split(fields, ",") {
+			switch strings.ToLower(strings.TrimSpace(f)) {
+			case "status":
+				d.Status = true
+			case "body":
+				d.Body = true
+			default:
+				return nil, fmt.Errorf("invalid -mirror-diff field %q, expected status or body", f)
+			}
+		}
+	}
+	for _, path := range jsonPaths {
+		if path == "" {
+			return nil, fmt.Errorf("-mirror-diff-json: empty path")
+		}
+	}
+	return d, nil
+}
+
+// needsBody reports whether the comparison reads the response bodies.
+func (d *MirrorDiff) needsBody() bool {
+	return d != nil && (d.Body || len(d.JSON) > 0)
+}
+
+// fields returns the names of the compared fields, in report order.
+func (d *MirrorDiff) fields() []string {
+	var fields []string
+	if d.Status {
+		fields = append(fields, "status")
+	}
+	if d.Body {
+		fields = append(fields, "body")
+	}
+	for _, path := range d.JSON {
+		fields = append(fields, "json "+path)
+	}
+	return fields
+}
+
+// value returns a response's value of a compared field.
+func (d *MirrorDiff) value(field string, r *RequestResult) string {
+	switch {
+	case field == "status":
+		return strconv.Itoa(r.StatusCode)
+	case field == "body":
+		sum := sha256.Sum256(r.Body)
+		return fmt.Sprintf("sha256:%s (%d bytes)", hex.EncodeToString(sum[:6]), r.ContentLength)
+	default:
+		v, err := extractJSONPath(r.Body, strings.TrimPrefix(field, "json "))
+		if err != nil {
+			return "(missing)"
+		}
+		return strconv.Quote(v)
+	}
+}
+
+// MirrorDiffSample is one field on which a response and the response to
+// its copy differed.
+type MirrorDiffSample struct {
+	Method  string
+	URL     string // Of the primary request
+	Field   string
+	Primary string
+	Mirror  string
+}
+
+// MirrorDiffSummary counts the differences between the primary and mirror
+// responses of a run.
+type MirrorDiffSummary struct {
+	Fields     []string
+	Compared   int            // Pairs of responses compared
+	Mismatched int            // Pairs that differed on at least one field
+	ByField    map[string]int // Pairs that differed per field
+	Samples    []MirrorDiffSample
+}
+
+// mirrorPair matches the result of a mirrored request with that of its
+// copy; whichever arrives second compares them.
+type mirrorPair struct {
+	m       *Mirror
+	method  string
+	url     string
+	mu      sync.Mutex
+	primary *RequestResult
+	mirror  *RequestResult
+}
+
+// record sets the result of the primary request (primary true) or of its
+// copy. A nil pair records nothing.
+func (p *mirrorPair) record(primary bool, r RequestResult) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	if primary {
+		p.primary = &r
+	} else {
+		p.mirror = &r
+	}
+	complete := p.primary != nil && p.mirror != nil
+	p.mu.Unlock()
+	if complete {
+		p.m.compare(p)
+	}
+}
+
+// compare counts the differences between the two results of p. Pairs in
+// which the primary request was cancelled by -cancel-rate, or in which
+// both requests failed, are not compared.
+func (m *Mirror) compare(p *mirrorPair) {
+	primary, mirror := p.primary, p.mirror
+	if primary.Cancelled || (primary.Error != nil && mirror.Error != nil) {
+		return
+	}
+
+	var diffs []MirrorDiffSample
+	if primary.Error != nil || mirror.Error != nil {
+		diffs = append(diffs, MirrorDiffSample{Field: diffError, Primary: errorValue(primary), Mirror: errorValue(mirror)})
+	} else {
+		for _, field := range m.Diff.fields() {
+			a, b := m.Diff.value(field, primary), m.Diff.value(field, mirror)
+			if a != b {
+				diffs = append(diffs, MirrorDiffSample{Field: field, Primary: a, Mirror: b})
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.diff.Compared++
+	if len(diffs) == 0 {
+		return
+	}
+	m.diff.Mismatched++
+	for _, d := range diffs {
+		m.diff.ByField[d.Field]++
+		if len(m.diff.Samples) < maxDiffSamples {
+			d.Method, d.URL = p.method, p.url
+			m.diff.Samples = append(m.diff.Samples, d)
+		}
+	}
+}
+
+// errorValue describes a result for a sample of an error mismatch.
+func errorValue(r *RequestResult) string {
+	if r.Error != nil {
+		return "error: " + r.Error.Error()
+	}
+	return strconv.Itoa(r.StatusCode)
+}
+
+// printMirrorDiff prints the mismatch counts and samples of a mirror
+// diff.
+func printMirrorDiff(w io.Writer, d *MirrorDiffSummary) {
+	fmt.Fprintf(w, "Mirror Diff (%s):\n", strings.Join(d.Fields, ", "))
+	fmt.Fprintf(w, "  Compared:    %d pairs\n", d.Compared)
+	pct := 0.0
+	if d.Compared > 0 {
+		pct = float64(d.Mismatched) / float64(d.Compared) * 100
+	}
+	fmt.Fprintf(w, "  Mismatched:  %d (%.2f%%)\n", d.Mismatched, pct)
+	fields := make([]string, 0, len(d.ByField))
+	for field := range d.ByField {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		fmt.Fprintf(w, "    %-20s %d\n", field, d.ByField[field])
+	}
+	if len(d.Samples) > 0 {
+		fmt.Fprintln(w, "  Samples:")
+		for i, s := range d.Samples {
+			// The fields of one pair are sampled one after the other.
+			if i == 0 || s.URL != d.Samples[i-1].URL || s.Method != d.Samples[i-1].Method {
+				fmt.Fprintf(w, "    %s %s\n", s.Method, s.URL)
+			}
+			fmt.Fprintf(w, "      %s: %s (primary) vs %s (mirror)\n", s.Field, s.Primary, s.Mirror)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// multitest.go implements running several independent tests at once, each
+// defined in its own -config file. Every test has its own Config and Stats
+// and runs its own worker pool, so dependent services can be loaded
+// simultaneously to model system-wide load. Results are reported per test
+// and combined.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// testFile is the JSON layout of a -config file. Flags holds load test
+// flags by name without the leading dash, e.g. {"url": "...", "n": 1000}.
+// Repeatable flags such as header take an array.
+type testFile struct {
+	Name  string                     `json:"name"`
+	Flags map[string]json.RawMessage `json:"flags"`
+}
+
+// TestDefinition is one test of a multi-test run.
+type TestDefinition struct {
+	Name   string
+	Config *Config
+	Stats  *Stats
+}
+
+// commandLineTestFlags are the flags of a multi-test command line: those
+// that apply to the run as a whole, such as the reporting options and
+// thresholds. Every other flag belongs in the -config files and is
+// rejected on the command line rather than ignored.
+var commandLineTestFlags = map[string]bool{
+	"config": true, "ci": true, "output": true, "output-file": true, "progress-interval": true,
+	"threshold": true, "max-error-rate": true, "max-avg": true, "max-p50": true, "max-p95": true, "max-p99": true, "min-rps": true,
+	"budgets": true, "sla": true, "baseline": true, "clock-sync": true,
+	"percentile": true, "percentiles": true, "histogram": true, "min-samples": true, "timeseries": true, "max-memory": true,
+	"spike-window": true, "spike-threshold": true,
+	"export": true, "export-interval": true, "influx-url": true, "influx-bucket": true, "influx-org": true,
+	"http3": true, // Rejected with its own reason
+}
+
+// perTestFlags are the command-line flags of a multi-test run that
+// -config files may set as well: reporting options that the command line
+// applies to the combined results and each file to its own test.
+var perTestFlags = map[string]bool{
+	"sla": true, "percentile": true, "percentiles": true, "histogram": true, "min-samples": true, "timeseries": true,
+	"spike-window": true, "spike-threshold": true,
+	"http3": true,
+}
+
+// unsupportedTestFlags are the command-line flags that -config files
+// cannot set either, with the reason.
+var unsupportedTestFlags = map[string]string{
+	"scenario":         "-config and -scenario are mutually exclusive",
+	"repeat":           "-repeat is not supported with -config",
+	"repeat-pause":     "-repeat-pause is not supported with -config",
+	"mirror-to":        "-mirror-to is not supported with -config",
+	"auto-concurrency": "-auto-concurrency is not supported with -config",
+}
+
+// reservedTestFlag returns why a -config file may not set the flag name:
+// the flags that apply to the whole run, which only the command line sets,
+// and those multi-test runs do not support.
+func reservedTestFlag(name string) (string, bool) {
+	if reason, ok := unsupportedTestFlags[name]; ok {
+		return reason, true
+	}
+	switch {
+	case name == "config":
+		return "-config files cannot include other -config files", true
+	case commandLineTestFlags[name] && !perTestFlags[name]:
+		return "set -" + name + " on the command line", true
+	}
+	return "", false
+}
+
+// LoadTestDefinition reads a -config file and validates its flags exactly
+// as on the command line. The test is named after the file unless the file
+// sets a name.
+func LoadTestDefinition(path string) (*TestDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading test config: %w", err)
+	}
+
+	var f testFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing test config %s: %w", path, err)
+	}
+
+	args, err := testFlagArgs(f.Flags)
+	if err != nil {
+		return nil, fmt.Errorf("test config %s: %w", path, err)
+	}
+	config, err := parseConfigArgs(args)
+	if err != nil {
+		return nil, fmt.Errorf("test config %s: %w", path, err)
+	}
+
+	name := f.Name
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return &TestDefinition{Name: name, Config: config}, nil
+}
+
+// testFlagArgs converts the flags of a -config file to command-line
+// arguments, in name order.
+func testFlagArgs(flags map[string]json.RawMessage) ([]string, error) {
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		if reason, ok := reservedTestFlag(name); ok {
+			return nil, fmt.Errorf("flag %q: %s", name, reason)
+		}
+
+		var list []json.RawMessage
+		if err := json.Unmarshal(flags[name], &list); err != nil {
+			list = []json.RawMessage{flags[name]}
+		}
+		for _, raw := range list {
+			value, err := flagValue(raw)
+			if err != nil {
+				return nil, fmt.Errorf("flag %q: %w", name, err)
+			}
+			args = append(args, "-"+name+"="+value)
+		}
+	}
+	return args, nil
+}
+
+// flagValue formats a JSON string, number or boolean as a flag value.
+func flagValue(raw json.RawMessage) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case float64, bool:
+		return string(raw), nil
+	default:
+		return "", fmt.Errorf("expected a string, number or boolean, got %s", raw)
+	}
+}
+
+// RunTests runs every test concurrently until all have finished or ctx is
+// cancelled. The results of all tests are merged into combined as they
+// come in, so it can drive the progress bar. It returns the errors of the
+// tests that failed.
+func RunTests(ctx context.Context, tests []*TestDefinition, combined *Stats) error {
+	errs := make([]error, len(tests))
+	var wg sync.WaitGroup
+	for i, t := range tests {
+		combined.track(t.Stats)
+		wg.Add(1)
+		go func(i int, t *TestDefinition) {
+			defer wg.Done()
+			if err := RunLoadTest(ctx, t.Config, t.Stats); err != nil {
+				errs[i] = fmt.Errorf("test %s: %w", t.Name, err)
+			}
+		}(i, t)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	marks := make([]statsMark, len(tests))
+	mergeAll := func() {
+		for i, t := range tests {
+			d := t.Stats.Delta(&marks[i])
+			// Client pauses affect every test alike; count them once.
+			if i > 0 {
+				d.GCPauses, d.Stalls = nil, nil
+			}
+			combined.Merge(d)
+		}
+	}
+
+	// The combined stats only serve progress and exporters until the end,
+	// so they are brought up to date as often as progress is shown.
+	ticker := time.NewTicker(combined.progressInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			mergeAll()
+		case <-finished:
+			mergeAll()
+			return errors.Join(errs...)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// pacer.go implements request rate limiting (-rate). Instead of sending as
+// fast as the workers allow, requests are dispatched on a fixed schedule
+// so the run models a steady arrival rate.
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// pacerSlack is how far dispatch may fall behind schedule and still catch
+// up with a burst. Beyond it, e.g. after all workers were busy or the run
+// was paused, the schedule restarts from the current time rather than
+// flooding the target with the missed requests.
+const pacerSlack = 50 * time.Millisecond
+
+// pacer spaces out request dispatch to a fixed rate. Request n is due one
+// interval after request n-1, so timer overshoot on one wait is made up on
+// the next instead of lowering the rate. It is not safe for concurrent use.
+type pacer struct {
+	interval time.Duration
+	next     time.Time
+}
+
+// newPacer returns a pacer for rate requests per second, or nil if rate
+// is 0 (unlimited).
+func newPacer(rate float64) *pacer {
+	if rate <= 0 {
+		return nil
+	}
+	return &pacer{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// reserve claims the next slot of the schedule and returns when it is
+// due, without waiting for it.
+func (p *pacer) reserve() time.Time {
+	now := time.Now()
+	if p.next.IsZero() || now.Sub(p.next) > pacerSlack {
+		p.next = now
+	}
+	due := p.next
+	p.next = p.next.Add(p.interval)
+	return due
+}
+
+// wait blocks until the next request is due or ctx is done. A nil pacer
+// never waits.
+func (p *pacer) wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	d := time.Until(p.reserve())
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
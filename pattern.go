@@ -0,0 +1,489 @@
+// pattern.go implements load patterns (-pattern): traffic shapes such as a
+// ramp, a sine wave or the arrivals of a recorded run. The dispatcher only
+// sees a LoadPattern, the schedule of requests it follows, whatever the
+// shape. Every pattern is created by a factory registered under a name;
+// the built-in ones are registered below, and programs embedding the load
+// tester can add their own with RegisterLoadPattern before parsing the
+// configuration. Load profiles (-profile) are dispatched as patterns too.
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoadPattern is the schedule of a run's requests. The dispatcher calls
+// Next from one goroutine, once per request, so a pattern keeps its
+// position and is not reused across runs.
+type LoadPattern interface {
+	// Next returns when the next request is due, as an offset from the
+	// start of the run, and false once the pattern has ended. Offsets
+	// never decrease.
+	Next() (time.Duration, bool)
+}
+
+// LoadPatternFactory returns a new pattern for the parameters of
+// -pattern NAME:PARAMS, or an error if they are invalid. It is called once
+// to validate the configuration and once more for every run.
+type LoadPatternFactory func(params string) (LoadPattern, error)
+
+// stagedPattern is a pattern whose requests belong to named stages, as
+// those of a load profile.
+type stagedPattern interface {
+	LoadPattern
+	stage() string // Stage of the request Next returned last
+}
+
+// loadPatterns maps -pattern names to their factories.
+var loadPatterns = map[string]LoadPatternFactory{
+	"constant": constantPattern,
+	"ramp":     rampPattern,
+	"step":     stepPattern,
+	"spike":    spikePattern,
+	"sine":     sinePattern,
+	"replay":   replayPattern,
+}
+
+// RegisterLoadPattern makes f available as -pattern name. It panics if
+// name is empty or already registered.
+func RegisterLoadPattern(name string, f LoadPatternFactory) {
+	if name == "" || f == nil {
+		panic("RegisterLoadPattern: empty name or nil factory")
+	}
+	if _, dup := loadPatterns[name]; dup {
+		panic("RegisterLoadPattern: pattern " + name + " already registered")
+	}
+	loadPatterns[name] = f
+}
+
+// loadPatternNames returns the registered pattern names in order.
+func loadPatternNames() []string {
+	names := make([]string, 0, len(loadPatterns))
+	for name := range loadPatterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// maxPatternRequests bounds the requests of a pattern, which are counted
+// up front for the progress bar; a pattern that never ends would
+// otherwise hang the configuration.
+const maxPatternRequests = 100_000_000
+
+// PatternSpec is a validated -pattern.
+type PatternSpec struct {
+	Spec     string        // As given, e.g. "ramp:10,200,5m"
+	Requests int           // Requests the pattern sends if dispatch keeps up
+	Duration time.Duration // Offset of its last request
+	factory  LoadPatternFactory
+	params   string
+}
+
+// parsePatternSpec parses -pattern NAME:PARAMS and runs the pattern
+// through once to count its requests.
+func parsePatternSpec(s string) (*PatternSpec, error) {
+	name, params, _ := strings.Cut(s, ":")
+	factory, ok := loadPatterns[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid -pattern %q, expected NAME:PARAMS with NAME one of %s", s, strings.Join(loadPatternNames(), ", "))
+	}
+	spec := &PatternSpec{Spec: s, factory: factory, params: params}
+	pattern, err := spec.start()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		offset, ok := pattern.Next()
+		if !ok {
+			break
+		}
+		if spec.Requests++; spec.Requests > maxPatternRequests {
+			return nil, fmt.Errorf("-pattern %s sends more than %d requests, it must end", s, maxPatternRequests)
+		}
+		spec.Duration = offset
+	}
+	if spec.Requests == 0 {
+		return nil, fmt.Errorf("-pattern %s sends no requests", s)
+	}
+	return spec, nil
+}
+
+// start returns a new pattern for a run.
+func (s *PatternSpec) start() (LoadPattern, error) {
+	p, err := s.factory(s.params)
+	if err != nil {
+		return nil, fmt.Errorf("-pattern %s: %w", s.Spec, err)
+	}
+	return p, nil
+}
+
+// dispatchPattern hands out a job for every request of pattern when it is
+// due. As with -rate, requests that fell more than pacerSlack behind, while
+// the run was paused or every worker was busy, are skipped rather than
+// sent in a burst, so paused time counts towards the pattern. send
+// delivers a job to the workers and reports false once the run is
+// cancelled, which ends dispatch.
+func dispatchPattern(ctx context.Context, pattern LoadPattern, pause *PauseGate, send func(job) bool) bool {
+	staged, _ := pattern.(stagedPattern)
+	start := time.Now()
+	for index := 0; ; {
+		offset, ok := pattern.Next()
+		if !ok {
+			return true
+		}
+		if pause != nil {
+			pause.Wait(ctx)
+		}
+		due := start.Add(offset)
+		if time.Since(due) > pacerSlack {
+			continue
+		}
+		if d := time.Until(due); d > 0 {
+			timer := time.NewTimer(d)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return false
+			}
+		}
+		j := job{index: index}
+		if staged != nil {
+			j.stage = staged.stage()
+		}
+		if !send(j) {
+			return false
+		}
+		index++
+	}
+}
+
+// rateStep is the resolution at which RatePattern follows its rate.
+const rateStep = 10 * time.Millisecond
+
+// RatePattern is a load pattern given as a rate function: Rate returns the
+// requests per second due at a time into the run, for Duration. Requests
+// are spaced by the rate integrated over steps of 10ms, so that changes of
+// rate take effect within a step however low the rate was, and stretches
+// at a rate of 0 send nothing.
+type RatePattern struct {
+	Rate     func(elapsed time.Duration) float64
+	Duration time.Duration
+
+	at      time.Duration // Offset of the request returned last
+	started bool
+}
+
+// Next implements LoadPattern.
+func (p *RatePattern) Next() (time.Duration, bool) {
+	need := 1.0 // Requests the rate must accumulate before the next one
+	if !p.started {
+		p.started, need = true, 0
+	}
+	for p.at < p.Duration {
+		r := p.Rate(p.at)
+		if r > 0 {
+			if d := time.Duration(need / r * float64(time.Second)); d <= rateStep {
+				if p.at += d; p.at >= p.Duration {
+					break
+				}
+				return p.at, true
+			}
+			need -= r * rateStep.Seconds()
+		}
+		p.at += rateStep
+	}
+	return 0, false
+}
+
+// patternParams splits the parameters of a built-in pattern, which must
+// number n, described by usage.
+func patternParams(params string, n int, usage string) ([]string, error) {
+	parts := strings.Split(params, ",")
+	if params == "" || len(parts) != n {
+		return nil, fmt.Errorf("expected %s", usage)
+	}
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts, nil
+}
+
+// namedPatternParams splits the parameters of a built-in pattern taking
+// those of names, either in that order or as NAME=VALUE pairs in any
+// order. The first required ones must be set; the values of the others
+// are "" if they are not.
+func namedPatternParams(params string, names []string, required int, usage string) ([]string, error) {
+	parts := strings.Split(params, ",")
+	if params == "" || len(parts) > len(names) {
+		return nil, fmt.Errorf("expected %s", usage)
+	}
+	values := make([]string, len(names))
+	if !strings.Contains(params, "=") {
+		if len(parts) < required {
+			return nil, fmt.Errorf("expected %s", usage)
+		}
+		for i, part := range parts {
+			values[i] = strings.TrimSpace(part)
+		}
+		return values, nil
+	}
+	for _, part := range parts {
+		name, value, ok := strings.Cut(part, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		i := slices.Index(names, name)
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("parameter %q is not NAME=VALUE, expected %s", strings.TrimSpace(part), usage)
+		case i < 0:
+			return nil, fmt.Errorf("unknown parameter %q, expected one of %s", name, strings.Join(names, ", "))
+		case values[i] != "":
+			return nil, fmt.Errorf("duplicate parameter %q", name)
+		}
+		values[i] = value
+	}
+	for i := range required {
+		if values[i] == "" {
+			return nil, fmt.Errorf("missing parameter %q, expected %s", names[i], usage)
+		}
+	}
+	return values, nil
+}
+
+// patternRate parses a rate parameter, which must be >= 0.
+func patternRate(s string) (float64, error) {
+	r, err := strconv.ParseFloat(s, 64)
+	if err != nil || r < 0 || math.IsInf(r, 0) {
+		return 0, fmt.Errorf("invalid rate %q, expected requests per second >= 0", s)
+	}
+	return r, nil
+}
+
+// patternDuration parses a duration parameter, which must be > 0.
+func patternDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q, expected a positive duration such as 30s", s)
+	}
+	return d, nil
+}
+
+// parseRates parses the rate parameters of a pattern followed by its
+// duration, the last parameter.
+func parseRates(params string, usage string, rates int) ([]float64, time.Duration, error) {
+	parts, err := patternParams(params, rates+1, usage)
+	if err != nil {
+		return nil, 0, err
+	}
+	values := make([]float64, rates)
+	for i := range values {
+		if values[i], err = patternRate(parts[i]); err != nil {
+			return nil, 0, err
+		}
+	}
+	d, err := patternDuration(parts[rates])
+	return values, d, err
+}
+
+// constantPattern is constant:RATE,DURATION, a steady rate.
+func constantPattern(params string) (LoadPattern, error) {
+	r, d, err := parseRates(params, "constant:RATE,DURATION, e.g. constant:100,1m", 1)
+	if err != nil {
+		return nil, err
+	}
+	return &RatePattern{Rate: func(time.Duration) float64 { return r[0] }, Duration: d}, nil
+}
+
+// rampPattern is ramp:FROM,TO,DURATION, a rate changing linearly.
+func rampPattern(params string) (LoadPattern, error) {
+	r, d, err := parseRates(params, "ramp:FROM,TO,DURATION, e.g. ramp:10,200,5m", 2)
+	if err != nil {
+		return nil, err
+	}
+	from, to := r[0], r[1]
+	return &RatePattern{Rate: func(t time.Duration) float64 {
+		return from + (to-from)*float64(t)/float64(d)
+	}, Duration: d}, nil
+}
+
+// stepPattern is step:FROM,TO,STEPS,DURATION, a rate rising (or falling)
+// from FROM to TO in STEPS equal steps of equal length.
+func stepPattern(params string) (LoadPattern, error) {
+	const usage = "step:FROM,TO,STEPS,DURATION, e.g. step:10,100,10,5m"
+	parts, err := patternParams(params, 4, usage)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := strconv.Atoi(parts[2])
+	if err != nil || steps < 2 {
+		return nil, fmt.Errorf("invalid step count %q, expected at least 2", parts[2])
+	}
+	r, d, err := parseRates(strings.Join([]string{parts[0], parts[1], parts[3]}, ","), usage, 2)
+	if err != nil {
+		return nil, err
+	}
+	from, to := r[0], r[1]
+	width := d / time.Duration(steps)
+	return &RatePattern{Rate: func(t time.Duration) float64 {
+		i := min(int(t/width), steps-1)
+		return from + (to-from)*float64(i)/float64(steps-1)
+	}, Duration: d}, nil
+}
+
+// spikePattern is spike:BASE,PEAK,AT,LENGTH,DURATION, a base rate with a
+// burst at the peak rate for LENGTH from AT into the run.
+func spikePattern(params string) (LoadPattern, error) {
+	const usage = "spike:BASE,PEAK,AT,LENGTH,DURATION, e.g. spike:50,500,2m,30s,5m"
+	parts, err := patternParams(params, 5, usage)
+	if err != nil {
+		return nil, err
+	}
+	r, d, err := parseRates(strings.Join([]string{parts[0], parts[1], parts[4]}, ","), usage, 2)
+	if err != nil {
+		return nil, err
+	}
+	at, err := time.ParseDuration(parts[2])
+	if err != nil || at < 0 {
+		return nil, fmt.Errorf("invalid spike start %q, expected a duration such as 2m", parts[2])
+	}
+	length, err := patternDuration(parts[3])
+	if err != nil {
+		return nil, err
+	}
+	if at >= d {
+		return nil, fmt.Errorf("the spike starts at %s, after the pattern ends at %s", at, d)
+	}
+	base, peak := r[0], r[1]
+	return &RatePattern{Rate: func(t time.Duration) float64 {
+		if t >= at && t < at+length {
+			return peak
+		}
+		return base
+	}, Duration: d}, nil
+}
+
+// sineParams are the names of the parameters of sine, in order.
+var sineParams = []string{"min", "max", "period", "duration"}
+
+// sinePattern is sine:MIN,MAX,PERIOD[,DURATION], a rate swinging between
+// MIN, at the start, and MAX, half a period later, for DURATION or one
+// period. The parameters may also be named, in any order, as in
+// sine:period=5m,min=50,max=500.
+func sinePattern(params string) (LoadPattern, error) {
+	const usage = "sine:MIN,MAX,PERIOD[,DURATION] or sine:min=MIN,max=MAX,period=PERIOD[,duration=DURATION], e.g. sine:20,200,1m,10m"
+	parts, err := namedPatternParams(params, sineParams, 3, usage)
+	if err != nil {
+		return nil, err
+	}
+	if parts[3] == "" {
+		parts[3] = parts[2]
+	}
+	r, d, err := parseRates(strings.Join([]string{parts[0], parts[1], parts[3]}, ","), usage, 2)
+	if err != nil {
+		return nil, err
+	}
+	period, err := patternDuration(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	lo, hi := r[0], r[1]
+	return &RatePattern{Rate: func(t time.Duration) float64 {
+		return lo + (hi-lo)*(1-math.Cos(2*math.Pi*float64(t)/float64(period)))/2
+	}, Duration: d}, nil
+}
+
+// offsetPattern sends requests at fixed offsets.
+type offsetPattern struct {
+	offsets []time.Duration
+	i       int
+}
+
+// Next implements LoadPattern.
+func (p *offsetPattern) Next() (time.Duration, bool) {
+	if p.i == len(p.offsets) {
+		return 0, false
+	}
+	p.i++
+	return p.offsets[p.i-1], true
+}
+
+// replayPattern is replay:FILE[,SPEED], the arrivals of a run recorded
+// with -record, sped up SPEED times.
+func replayPattern(params string) (LoadPattern, error) {
+	path, speedParam, _ := strings.Cut(params, ",")
+	if path = strings.TrimSpace(path); path == "" {
+		return nil, fmt.Errorf("expected replay:FILE or replay:FILE,SPEED, e.g. replay:run.jsonl,2")
+	}
+	speed := 1.0
+	if s := strings.TrimSpace(speedParam); s != "" {
+		var err error
+		if speed, err = strconv.ParseFloat(s, 64); err != nil || speed <= 0 || math.IsInf(speed, 0) {
+			return nil, fmt.Errorf("invalid replay speed %q, expected a factor > 0 such as 2 or 0.5", s)
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading replayed run: %w", err)
+	}
+	defer f.Close()
+	results, err := readRawResults(f, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("%s contains no requests", path)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Time.Before(results[j].Time) })
+	p := &offsetPattern{offsets: make([]time.Duration, len(results))}
+	for i, r := range results {
+		p.offsets[i] = time.Duration(float64(r.Time.Sub(results[0].Time)) / speed)
+	}
+	return p, nil
+}
+
+// profilePattern dispatches the stages of a load profile in turn, each at
+// its own rate until its time is up.
+type profilePattern struct {
+	stages []Stage
+	i      int           // Current stage
+	start  time.Duration // Offset at which the current stage started
+	at     time.Duration // Offset of the request returned last
+	begun  bool          // Whether the current stage has sent a request
+}
+
+// pattern returns the schedule of p's stages.
+func (p *Profile) pattern() LoadPattern {
+	return &profilePattern{stages: p.Stages}
+}
+
+// Next implements LoadPattern.
+func (p *profilePattern) Next() (time.Duration, bool) {
+	for p.i < len(p.stages) {
+		s := p.stages[p.i]
+		if !p.begun {
+			p.at, p.begun = p.start, true
+		} else {
+			p.at += time.Duration(float64(time.Second) / s.Rate)
+		}
+		if p.at < p.start+s.Duration {
+			return p.at, true
+		}
+		p.start += s.Duration
+		p.i++
+		p.begun = false
+	}
+	return 0, false
+}
+
+// stage implements stagedPattern.
+func (p *profilePattern) stage() string {
+	return p.stages[p.i].Name
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// percentileCase is a percentile of a sample with its expected value under
+// both methods. The linear values are those of NumPy's default
+// (numpy.percentile, method="linear") and of Excel's PERCENTILE.INC.
+type percentileCase struct {
+	pct     float64
+	nearest time.Duration
+	linear  time.Duration
+}
+
+var percentileGolden = []struct {
+	name   string
+	sample []time.Duration // Sorted
+	cases  []percentileCase
+}{
+	{
+		name:   "empty",
+		sample: nil,
+		cases: []percentileCase{
+			{50, 0, 0},
+			{99, 0, 0},
+		},
+	},
+	{
+		name:   "one value",
+		sample: millis(7),
+		cases: []percentileCase{
+			{0, millisf(7), millisf(7)},
+			{50, millisf(7), millisf(7)},
+			{99, millisf(7), millisf(7)},
+			{100, millisf(7), millisf(7)},
+		},
+	},
+	{
+		name:   "two values",
+		sample: millis(10, 20),
+		cases: []percentileCase{
+			{1, millisf(10), millisf(10.1)},
+			{50, millisf(10), millisf(15)},
+			{90, millisf(20), millisf(19)},
+			{99, millisf(20), millisf(19.9)},
+		},
+	},
+	{
+		// The example of the Wikipedia article on percentiles.
+		name:   "five values",
+		sample: millis(15, 20, 35, 40, 50),
+		cases: []percentileCase{
+			{0, millisf(15), millisf(15)},
+			{5, millisf(15), millisf(16)},
+			{30, millisf(20), millisf(23)},
+			{40, millisf(20), millisf(29)},
+			{50, millisf(35), millisf(35)},
+			{90, millisf(50), millisf(46)},
+			{95, millisf(50), millisf(48)},
+			{99, millisf(50), millisf(49.6)},
+			{100, millisf(50), millisf(50)},
+		},
+	},
+	{
+		name:   "ten values",
+		sample: millis(1, 2, 3, 4, 5, 6, 7, 8, 9, 10),
+		cases: []percentileCase{
+			{10, millisf(1), millisf(1.9)},
+			{25, millisf(3), millisf(3.25)},
+			{50, millisf(5), millisf(5.5)},
+			{90, millisf(9), millisf(9.1)},
+			{95, millisf(10), millisf(9.55)},
+			{99, millisf(10), millisf(9.91)},
+		},
+	},
+}
+
+// millis returns the durations of the given numbers of milliseconds.
+func millis(values ...int) []time.Duration {
+	out := make([]time.Duration, len(values))
+	for i, v := range values {
+		out[i] = time.Duration(v) * time.Millisecond
+	}
+	return out
+}
+
+// millisf returns the duration of a fractional number of milliseconds.
+func millisf(v float64) time.Duration {
+	return time.Duration(v * float64(time.Millisecond))
+}
+
+func TestPercentileSlice(t *testing.T) {
+	for _, tt := range percentileGolden {
+		for _, c := range tt.cases {
+			if got := PercentileNearestRank.percentile(tt.sample, c.pct); got != c.nearest {
+				t.Errorf("%s: nearest-rank p%g = %v, want %v", tt.name, c.pct, got, c.nearest)
+			}
+			if got := PercentileLinear.percentile(tt.sample, c.pct); got != c.linear {
+				t.Errorf("%s: linear p%g = %v, want %v", tt.name, c.pct, got, c.linear)
+			}
+		}
+	}
+}
+
+// TestPercentileHDR checks the histogram against the same values, to
+// within the histogram's precision of 0.1%.
+func TestPercentileHDR(t *testing.T) {
+	for _, tt := range percentileGolden {
+		var h hdrHistogram
+		for _, d := range tt.sample {
+			h.record(d)
+		}
+		for _, c := range tt.cases {
+			if got := h.percentile(PercentileNearestRank, c.pct); !withinHDRPrecision(got, c.nearest) {
+				t.Errorf("%s: nearest-rank p%g = %v, want %v", tt.name, c.pct, got, c.nearest)
+			}
+			if got := h.percentile(PercentileLinear, c.pct); !withinHDRPrecision(got, c.linear) {
+				t.Errorf("%s: linear p%g = %v, want %v", tt.name, c.pct, got, c.linear)
+			}
+		}
+	}
+}
+
+// TestPercentileHDRExact checks the histogram on values below 2048ns,
+// which it counts exactly.
+func TestPercentileHDRExact(t *testing.T) {
+	sample := []time.Duration{100, 200, 300, 400, 500, 600, 700, 800, 900, 1000}
+	var h hdrHistogram
+	for _, d := range sample {
+		h.record(d)
+	}
+	for _, pct := range []float64{0, 10, 25, 50, 90, 95, 99, 100} {
+		if got, want := h.percentile(PercentileNearestRank, pct), PercentileNearestRank.percentile(sample, pct); got != want {
+			t.Errorf("nearest-rank p%g = %v, want %v", pct, got, want)
+		}
+		if got, want := h.percentile(PercentileLinear, pct), PercentileLinear.percentile(sample, pct); got != want {
+			t.Errorf("linear p%g = %v, want %v", pct, got, want)
+		}
+	}
+}
+
+func withinHDRPrecision(got, want time.Duration) bool {
+	diff := got - want
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= want/1000
+}
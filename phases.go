@@ -0,0 +1,103 @@
+// phases.go implements the latency breakdown: every request is traced with
+// net/http/httptrace, and the time it spent resolving the host, connecting,
+// in the TLS handshake, waiting for the first response byte and downloading
+// the body is recorded per phase. A slow P99 reads very differently when it
+// is spent in connect than when it is spent waiting on the server.
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Request phases.
+const (
+	phaseDNS      = "dns"
+	phaseConnect  = "connect"
+	phaseTLS      = "tls"
+	phaseWait     = "wait"
+	phaseTTFB     = "ttfb"
+	phaseDownload = "download"
+)
+
+// requestPhases lists the phases in request order.
+var requestPhases = []string{phaseDNS, phaseConnect, phaseTLS, phaseWait, phaseTTFB, phaseDownload}
+
+// phaseLabels are the text summary's names of the phases.
+var phaseLabels = map[string]string{
+	phaseDNS:      "DNS",
+	phaseConnect:  "Connect",
+	phaseTLS:      "TLS",
+	phaseWait:     "Wait",
+	phaseTTFB:     "TTFB",
+	phaseDownload: "Download",
+}
+
+// phaseTimings holds the time a request spent in each phase it went
+// through. Requests on a reused connection skip DNS, connect and TLS, and a
+// request that failed before the response skips the rest, so a phase is
+// present only if the request completed it.
+type phaseTimings map[string]time.Duration
+
+// phaseClock records the milestones of one request as httptrace reports
+// them. The hooks of a dial may run on the transport's dialing goroutine,
+// so the clock has a mutex of its own.
+type phaseClock struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time // First address tried
+	connectDone  time.Time // First address connected
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+// mark sets *t to now unless it is already set, so of several dials or
+// attempts the first one counts.
+func (c *phaseClock) mark(t *time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.IsZero() {
+		*t = time.Now()
+	}
+}
+
+// timings returns the phases of a request sent at start whose response
+// body was read completely at end; end is zero if the body was not read.
+// The wait is measured from the request being written to the first
+// response byte, the time to first byte from start.
+func (c *phaseClock) timings(start, end time.Time) phaseTimings {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p := make(phaseTimings)
+	span := func(phase string, from, to time.Time) {
+		if !from.IsZero() && !to.IsZero() {
+			p[phase] = to.Sub(from)
+		}
+	}
+	span(phaseDNS, c.dnsStart, c.dnsDone)
+	span(phaseConnect, c.connectStart, c.connectDone)
+	span(phaseTLS, c.tlsStart, c.tlsDone)
+	span(phaseWait, c.wroteRequest, c.firstByte)
+	span(phaseTTFB, start, c.firstByte)
+	span(phaseDownload, c.firstByte, end)
+	return p
+}
+
+// printPhases prints the distribution of the time spent in each phase.
+func printPhases(w io.Writer, phases map[string]LatencyDist) {
+	fmt.Fprintln(w, "Latency Breakdown:")
+	fmt.Fprintf(w, "  %-9s %8s %10s %10s %10s %10s %10s %10s\n", "Phase", "Count", "Avg", "P50", "P90", "P95", "P99", "Max")
+	for _, phase := range requestPhases {
+		d, ok := phases[phase]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "  %-9s %8d %10s %10s %10s %10s %10s %10s\n", phaseLabels[phase], d.Count,
+			formatDuration(d.Avg), formatDuration(d.P50), formatDuration(d.P90), formatDuration(d.P95), formatDuration(d.P99), formatDuration(d.Max))
+	}
+}
@@ -0,0 +1,149 @@
+// plugin.go implements generator plugins (-generator-plugin): Go plugins
+// that register template generators of their own, so that teams can
+// produce domain-specific values, such as valid account numbers or SKUs,
+// without forking the tool. A plugin is a package main built with
+// go build -buildmode=plugin that exports a Generators variable mapping
+// names to factories:
+//
+//	var Generators = map[string]func(params string) (func(requestIndex int, rng *rand.Rand) string, error){
+//		"sku": func(params string) (func(int, *rand.Rand) string, error) { ... },
+//	}
+//
+// Its generators are then used as {{$sku(params)}}, or {{sku params}} with
+// -template-engine go, like the built-in ones.
+package main
+
+import (
+	"fmt"
+	mathrand "math/rand"
+	"plugin"
+	"sort"
+	"strings"
+)
+
+// pluginSymbol is the variable a generator plugin exports.
+const pluginSymbol = "Generators"
+
+// pluginFactory returns the generator of a plugin placeholder for its
+// parameters, or an error if they are invalid. Factories run while
+// templates are parsed, generators concurrently for every request, with
+// the request's source of randomness like the built-in generators.
+type pluginFactory = func(params string) (func(requestIndex int, rng *mathrand.Rand) string, error)
+
+// pluginGenerator is a generator registered by a plugin.
+type pluginGenerator struct {
+	path    string // Plugin that registered it
+	factory pluginFactory
+}
+
+// pluginGenerators are the generators of the loaded plugins, keyed by
+// placeholder, as in "$sku". Plugins cannot be unloaded, so their
+// generators stay registered for the life of the process.
+var pluginGenerators = map[string]pluginGenerator{}
+
+// reservedGeneratorNames are the names plugin generators cannot take: the
+// built-in generators and the other functions of Go templates.
+var reservedGeneratorNames = map[string]bool{
+	tagFunc: true, "requestIndex": true, "prob": true,
+	"and": true, "call": true, "html": true, "index": true, "slice": true, "js": true, "len": true,
+	"not": true, "or": true, "print": true, "printf": true, "println": true, "urlquery": true,
+	"eq": true, "ge": true, "gt": true, "le": true, "lt": true, "ne": true,
+}
+
+// loadGeneratorPlugins loads the plugins of -generator-plugin and registers
+// their generators. Loading a plugin again is a no-op.
+func loadGeneratorPlugins(paths []string) error {
+	for _, path := range paths {
+		if err := loadGeneratorPlugin(path); err != nil {
+			return fmt.Errorf("-generator-plugin %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// loadGeneratorPlugin loads the plugin at path and registers its
+// generators.
+func loadGeneratorPlugin(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+	sym, err := p.Lookup(pluginSymbol)
+	if err != nil {
+		return fmt.Errorf("the plugin exports no %s variable", pluginSymbol)
+	}
+	gens, ok := sym.(*map[string]pluginFactory)
+	if !ok {
+		return fmt.Errorf("%s is a %T, expected a map[string]func(params string) (func(requestIndex int, rng *rand.Rand) string, error)", pluginSymbol, sym)
+	}
+	for name, factory := range *gens {
+		if err := validPluginGeneratorName(name); err != nil {
+			return err
+		}
+		if factory == nil {
+			return fmt.Errorf("generator %q has no factory", name)
+		}
+		if g, ok := pluginGenerators["$"+name]; ok && g.path != path {
+			return fmt.Errorf("generator %q is already registered by %s", name, g.path)
+		}
+		pluginGenerators["$"+name] = pluginGenerator{path: path, factory: factory}
+	}
+	return nil
+}
+
+// pluginLoaded reports whether the plugin at path has registered
+// generators.
+func pluginLoaded(path string) bool {
+	for _, g := range pluginGenerators {
+		if g.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// validPluginGeneratorName checks that a plugin generator's name is an
+// identifier, usable both as a placeholder and as a Go template function,
+// and taken by no other generator or function.
+func validPluginGeneratorName(name string) error {
+	if name == "" || !isLetter(name[0]) {
+		return fmt.Errorf("invalid generator name %q, expected a letter followed by letters and digits", name)
+	}
+	for i := 1; i < len(name); i++ {
+		if !isLetter(name[i]) && (name[i] < '0' || name[i] > '9') {
+			return fmt.Errorf("invalid generator name %q, expected a letter followed by letters and digits", name)
+		}
+	}
+	if _, ok := goTemplateFuncs[name]; ok || reservedGeneratorNames[name] {
+		return fmt.Errorf("generator %q clashes with a built-in one", name)
+	}
+	return nil
+}
+
+// lookupPluginGenerator returns the generator of plugin placeholder name
+// with params, false if no plugin registered name.
+func lookupPluginGenerator(name, params string) (generatorFunc, bool, error) {
+	g, ok := pluginGenerators[name]
+	if !ok {
+		return nil, false, nil
+	}
+	gen, err := g.factory(params)
+	if err == nil && gen == nil {
+		err = fmt.Errorf("the plugin returned no generator")
+	}
+	if err != nil {
+		return nil, true, fmt.Errorf("%s: %w", name, err)
+	}
+	return gen, true, nil
+}
+
+// pluginGeneratorNames returns the placeholders of the loaded plugins,
+// sorted, for the list of available placeholders.
+func pluginGeneratorNames() string {
+	names := make([]string, 0, len(pluginGenerators))
+	for name := range pluginGenerators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,121 @@
+// profile.go implements staged load profiles (-profile): a JSON file of
+// stages that each send requests at their own rate for a fixed time, such
+// as a warm-up, a plateau and a spike. Stages run back to back on the same
+// worker pool, dispatched as a load pattern (pattern.go), and the summary
+// reports every stage on its own.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Stage is one step of a load profile.
+type Stage struct {
+	Name     string        // From the file, or "stage N"
+	Duration time.Duration // How long the stage sends requests
+	Rate     float64       // Requests per second across all workers
+}
+
+// Profile is a sequence of stages run one after another.
+type Profile struct {
+	Stages []Stage
+}
+
+// profileFile is the JSON layout of a -profile file, e.g.
+//
+//	{"stages": [
+//	  {"name": "warm-up", "duration": "1m", "rate": 10},
+//	  {"name": "plateau", "duration": "5m", "rate": 100},
+//	  {"name": "spike", "duration": "30s", "rate": 500}
+//	]}
+type profileFile struct {
+	Stages []struct {
+		Name     string  `json:"name"`
+		Duration string  `json:"duration"`
+		Rate     float64 `json:"rate"`
+	} `json:"stages"`
+}
+
+// loadProfile reads and validates a -profile file.
+func loadProfile(path string) (*Profile, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return nil, fmt.Errorf("profile %s: YAML is not supported, write the profile as JSON", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading profile: %w", err)
+	}
+	var f profileFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing profile %s: %w", path, err)
+	}
+	if len(f.Stages) == 0 {
+		return nil, fmt.Errorf("profile %s: at least one stage is required", path)
+	}
+
+	p := &Profile{}
+	seen := make(map[string]bool)
+	for i, fs := range f.Stages {
+		name := fs.Name
+		if name == "" {
+			name = fmt.Sprintf("stage %d", i+1)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("profile %s: stage %d: duplicate stage name %q", path, i+1, name)
+		}
+		seen[name] = true
+
+		d, err := time.ParseDuration(fs.Duration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("profile %s: stage %d (%s): duration must be a positive duration such as 30s, got %q", path, i+1, name, fs.Duration)
+		}
+		if fs.Rate <= 0 {
+			return nil, fmt.Errorf("profile %s: stage %d (%s): rate must be > 0, got %g", path, i+1, name, fs.Rate)
+		}
+		p.Stages = append(p.Stages, Stage{Name: name, Duration: d, Rate: fs.Rate})
+	}
+	return p, nil
+}
+
+// plannedRequests returns the number of requests the profile sends if
+// every stage reaches its rate.
+func (p *Profile) plannedRequests() int {
+	n := 0
+	for _, s := range p.Stages {
+		n += int(math.Ceil(s.Rate * s.Duration.Seconds()))
+	}
+	return n
+}
+
+// duration returns the total duration of all stages.
+func (p *Profile) duration() time.Duration {
+	var d time.Duration
+	for _, s := range p.Stages {
+		d += s.Duration
+	}
+	return d
+}
+
+// String describes the stages for the banner, e.g.
+// "warm-up 1m0s at 10 req/s, spike 30s at 500 req/s".
+func (p *Profile) String() string {
+	parts := make([]string, len(p.Stages))
+	for i, s := range p.Stages {
+		parts[i] = fmt.Sprintf("%s %s at %g req/s", s.Name, s.Duration, s.Rate)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// StageSummary is the results of one stage of a load profile.
+type StageSummary struct {
+	Stage
+	GroupSummary
+	RequestsPerSec float64 // Achieved rate over the stage's duration
+}
@@ -0,0 +1,159 @@
+// promexport.go implements the prometheus exporter (-export
+// prometheus=ADDR), which serves the run's metrics at http://ADDR/metrics
+// in the Prometheus text format for a Prometheus server to scrape. Counters
+// accumulate over the run; latency quantiles and the request rate are
+// those of the latest export window, and of the whole run once it has
+// finished. The endpoint stays up until the process exits.
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// prometheusExporter serves the metrics of a run for scraping.
+type prometheusExporter struct {
+	addr string
+
+	mu      sync.Mutex
+	running bool
+	totals  map[string]*exportSeries // Cumulative requests and errors by label, "" for all
+	latest  []exportSeries           // Latencies of the latest window, or of the whole run
+	rps     float64
+}
+
+// newPrometheusExporter creates a prometheus exporter listening on addr.
+func newPrometheusExporter(addr string) (Exporter, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("expected a listen address such as :9102: %w", err)
+	}
+	return &prometheusExporter{addr: addr, totals: make(map[string]*exportSeries)}, nil
+}
+
+// Start starts serving /metrics.
+func (p *prometheusExporter) Start(*Config) error {
+	ln, err := net.Listen("tcp", p.addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", p.serveMetrics)
+	go http.Serve(ln, mux)
+
+	p.mu.Lock()
+	p.running = true
+	p.mu.Unlock()
+	return nil
+}
+
+// RecordWindow adds the window's counts and publishes its latencies.
+func (p *prometheusExporter) RecordWindow(w ExportWindow) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	series := exportSeriesOf(w.Summary)
+	for _, s := range series {
+		t, ok := p.totals[s.Label]
+		if !ok {
+			t = &exportSeries{Label: s.Label}
+			p.totals[s.Label] = t
+		}
+		t.Requests += s.Requests
+		t.Errors += s.Errors
+	}
+	p.latest = series
+	p.rps = w.Summary.RequestsPerSec
+	return nil
+}
+
+// Finish publishes the final results of the run.
+func (p *prometheusExporter) Finish(summary Summary) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.running = false
+	p.latest = exportSeriesOf(summary)
+	for _, s := range p.latest {
+		p.totals[s.Label] = &exportSeries{Label: s.Label, Requests: s.Requests, Errors: s.Errors}
+	}
+	p.rps = summary.RequestsPerSec
+	return nil
+}
+
+// serveMetrics writes the metrics in the Prometheus text format.
+func (p *prometheusExporter) serveMetrics(w http.ResponseWriter, _ *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var b strings.Builder
+	running := 0
+	if p.running {
+		running = 1
+	}
+	promMetric(&b, "load_tester_running", "gauge", "Whether a run is in progress.")
+	fmt.Fprintf(&b, "load_tester_running %d\n", running)
+	promMetric(&b, "load_tester_requests_per_second", "gauge", "Request rate of the latest export window, or of the whole finished run.")
+	fmt.Fprintf(&b, "load_tester_requests_per_second %g\n", p.rps)
+
+	for _, prefix := range []string{"load_tester", "load_tester_label"} {
+		labeled := prefix == "load_tester_label"
+		var series []exportSeries
+		for _, s := range p.latest {
+			if (s.Label != "") == labeled {
+				series = append(series, s)
+			}
+		}
+		if len(series) == 0 {
+			continue
+		}
+
+		promMetric(&b, prefix+"_requests_total", "counter", "Requests completed.")
+		for _, s := range series {
+			fmt.Fprintf(&b, "%s_requests_total%s %d\n", prefix, promLabels(s.Label, ""), p.totals[s.Label].Requests)
+		}
+		promMetric(&b, prefix+"_errors_total", "counter", "Requests that failed without a response.")
+		for _, s := range series {
+			fmt.Fprintf(&b, "%s_errors_total%s %d\n", prefix, promLabels(s.Label, ""), p.totals[s.Label].Errors)
+		}
+		promMetric(&b, prefix+"_latency_seconds", "gauge", "Latency quantiles of the latest export window, or of the whole finished run.")
+		for _, s := range series {
+			for _, q := range []struct {
+				quantile string
+				seconds  float64
+			}{{"0.5", s.P50.Seconds()}, {"0.9", s.P90.Seconds()}, {"0.95", s.P95.Seconds()}, {"0.99", s.P99.Seconds()}} {
+				fmt.Fprintf(&b, "%s_latency_seconds%s %g\n", prefix, promLabels(s.Label, q.quantile), q.seconds)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprint(w, b.String())
+}
+
+// promMetric writes the HELP and TYPE lines of a metric.
+func promMetric(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// promLabels formats the label set of a sample; empty values are left out.
+func promLabels(label, quantile string) string {
+	var pairs []string
+	if label != "" {
+		pairs = append(pairs, `label="`+promEscape(label)+`"`)
+	}
+	if quantile != "" {
+		pairs = append(pairs, `quantile="`+quantile+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// promEscape escapes a label value.
+func promEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
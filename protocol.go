@@ -0,0 +1,72 @@
+// protocol.go implements HTTP protocol selection (-http 1.1, 2 or auto)
+// and the distribution of the protocols the responses came over. HTTP/2
+// multiplexes the workers' requests over a few connections where HTTP/1.1
+// opens one per worker, so the same test can load a server very
+// differently depending on what was negotiated.
+//
+// HTTP/3 is declined rather than left out: speaking QUIC would take
+// quic-go, as the standard library has no QUIC client, and the tool keeps
+// to the standard library so that it builds and ships as a single binary
+// with no dependencies. -http 3 and -http3 fail with that reason.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// HTTP protocol selections.
+const (
+	httpVersion11   = "1.1"  // HTTP/1.1 only
+	httpVersion2    = "2"    // HTTP/2 only: over TLS, and h2c with prior knowledge over cleartext
+	httpVersionAuto = "auto" // HTTP/2 where TLS negotiates it, HTTP/1.1 otherwise
+)
+
+// errHTTP3 is the error of a request for HTTP/3.
+var errHTTP3 = errors.New("HTTP/3 is not supported: it needs a QUIC client, which the Go standard library lacks, and the tool takes no dependencies beyond it; test QUIC edges over the HTTP/1.1 or HTTP/2 they serve alongside")
+
+// parseHTTPVersion validates an -http value.
+func parseHTTPVersion(s string) (string, error) {
+	switch s {
+	case httpVersion11, httpVersion2, httpVersionAuto:
+		return s, nil
+	case "3", "h3":
+		return "", fmt.Errorf("-http %s: %w", s, errHTTP3)
+	}
+	return "", fmt.Errorf("invalid -http %q, expected 1.1, 2 or auto", s)
+}
+
+// httpProtocols returns the protocols a transport speaks for an -http
+// selection. h2c is only spoken with -http 2: a cleartext server cannot
+// tell the client whether it understands HTTP/2, so the client has to
+// assume it does.
+func httpProtocols(version string) *http.Protocols {
+	p := new(http.Protocols)
+	switch version {
+	case httpVersion2:
+		p.SetHTTP2(true)
+		p.SetUnencryptedHTTP2(true)
+	case httpVersionAuto:
+		p.SetHTTP1(true)
+		p.SetHTTP2(true)
+	default:
+		p.SetHTTP1(true)
+	}
+	return p
+}
+
+// printProtocols prints the number of responses per protocol.
+func printProtocols(w io.Writer, protocols map[string]int) {
+	names := make([]string, 0, len(protocols))
+	for name := range protocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "Protocols:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-9s %d responses\n", name, protocols[name])
+	}
+}
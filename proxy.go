@@ -0,0 +1,66 @@
+// proxy.go implements forward proxy support: requests go through the proxy
+// of -proxy, an http, https or socks5 URL, or else through the proxy the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables select, so
+// tests run from behind a corporate proxy the way other tools there do.
+// -proxy none ignores the environment and connects directly.
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// proxyNone is the -proxy value that disables proxying.
+const proxyNone = "none"
+
+// parseProxy validates a -proxy value: "", proxyNone or a proxy URL.
+func parseProxy(raw string) (string, error) {
+	if raw == "" || raw == proxyNone {
+		return raw, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid -proxy %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return "", fmt.Errorf("invalid -proxy %q, expected an http://, https:// or socks5:// URL or none", raw)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid -proxy %q: no host", raw)
+	}
+	return raw, nil
+}
+
+// proxyFunc returns the Transport.Proxy of a -proxy value validated by
+// parseProxy.
+func proxyFunc(proxy string) func(*http.Request) (*url.URL, error) {
+	switch proxy {
+	case "":
+		return http.ProxyFromEnvironment
+	case proxyNone:
+		return nil
+	}
+	u, _ := url.Parse(proxy)
+	return http.ProxyURL(u)
+}
+
+// proxyFor returns the proxy requests to target go through with proxy set
+// as by -proxy, password redacted, or "" if they connect directly.
+func proxyFor(proxy, target string) string {
+	f := proxyFunc(proxy)
+	if f == nil {
+		return ""
+	}
+	req, err := http.NewRequest(http.MethodGet, stripTemplatePlaceholders(target), nil)
+	if err != nil {
+		return ""
+	}
+	u, err := f(req)
+	if err != nil || u == nil {
+		return ""
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,218 @@
+// ratelimit.go implements rate-limit header telemetry. Responses of
+// rate-limited APIs announce the client's quota in X-RateLimit-Limit,
+// -Remaining and -Reset (or the unprefixed RateLimit-* fields of the IETF
+// draft) and ask throttled clients to back off with Retry-After. These
+// values are collected per latency window, so the summary shows how the
+// quota drained over the run and exactly when throttling kicked in.
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRateLimitRows bounds the trajectory rows of the text summary; longer
+// runs fold consecutive windows together.
+const maxRateLimitRows = 20
+
+// epochResetThreshold separates reset values given as Unix timestamps
+// (GitHub style) from ones given as seconds until the reset.
+const epochResetThreshold = 1_000_000_000
+
+// rateLimitSample is what one response said about the client's quota. A
+// value the response did not carry is -1, or 0 for the durations.
+type rateLimitSample struct {
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // Time until the quota resets
+	RetryAfter time.Duration
+}
+
+// rateLimitFromResponse reads the rate-limit headers of resp. It returns
+// nil if the response carries none of them.
+func rateLimitFromResponse(resp *http.Response) *rateLimitSample {
+	s := &rateLimitSample{
+		Limit:      rateLimitInt(resp.Header, "Limit"),
+		Remaining:  rateLimitInt(resp.Header, "Remaining"),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+	if reset := rateLimitInt(resp.Header, "Reset"); reset >= 0 {
+		if reset >= epochResetThreshold {
+			s.Reset = max(time.Until(time.Unix(int64(reset), 0)), 0)
+		} else {
+			s.Reset = time.Duration(reset) * time.Second
+		}
+	}
+	if s.Limit < 0 && s.Remaining < 0 && s.Reset == 0 && s.RetryAfter == 0 {
+		return nil
+	}
+	return s
+}
+
+// rateLimitInt returns the value of the X-RateLimit-<name> header, or of
+// RateLimit-<name> without it, -1 if neither holds a number. Only the
+// first number counts, so policies such as "100, 100;w=60" read as 100.
+func rateLimitInt(h http.Header, name string) int {
+	value := h.Get("X-RateLimit-" + name)
+	if value == "" {
+		value = h.Get("RateLimit-" + name)
+	}
+	if i := strings.IndexAny(value, ",;"); i >= 0 {
+		value = value[:i]
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
+
+// rateLimitWindow aggregates the rate-limit headers and throttled responses
+// of the requests completing within one latency window. Like
+// latencyWindow, its values merge as extremes, so windows of different
+// agents combine.
+type rateLimitWindow struct {
+	Samples      int           `json:"samples"`       // Responses carrying rate-limit headers
+	Throttled    int           `json:"throttled"`     // 429/503 responses
+	Limit        int           `json:"limit"`         // Highest limit announced, -1 if none
+	MinRemaining int           `json:"min_remaining"` // Lowest remaining quota announced, -1 if none
+	Reset        time.Duration `json:"reset"`         // Nearest announced reset, 0 if none
+	RetryAfter   time.Duration `json:"retry_after"`   // Longest Retry-After, 0 if none
+}
+
+// newRateLimitWindow returns an empty window.
+func newRateLimitWindow() *rateLimitWindow {
+	return &rateLimitWindow{Limit: -1, MinRemaining: -1}
+}
+
+// add records one response in the window; sample is nil if it carried no
+// rate-limit headers.
+func (w *rateLimitWindow) add(sample *rateLimitSample, throttled bool) {
+	if throttled {
+		w.Throttled++
+	}
+	if sample == nil {
+		return
+	}
+	w.Samples++
+	w.merge(rateLimitWindow{Limit: sample.Limit, MinRemaining: sample.Remaining, Reset: sample.Reset, RetryAfter: sample.RetryAfter})
+}
+
+// merge folds another window covering the same time into w.
+func (w *rateLimitWindow) merge(o rateLimitWindow) {
+	w.Samples += o.Samples
+	w.Throttled += o.Throttled
+	w.Limit = max(w.Limit, o.Limit)
+	if o.MinRemaining >= 0 && (w.MinRemaining < 0 || o.MinRemaining < w.MinRemaining) {
+		w.MinRemaining = o.MinRemaining
+	}
+	if o.Reset > 0 && (w.Reset == 0 || o.Reset < w.Reset) {
+		w.Reset = o.Reset
+	}
+	w.RetryAfter = max(w.RetryAfter, o.RetryAfter)
+}
+
+// RateLimitPoint is the rate-limit state during one stretch of the run.
+type RateLimitPoint struct {
+	Start time.Time
+	rateLimitWindow
+}
+
+// RateLimitSummary reports the rate-limit headers observed during a run.
+type RateLimitSummary struct {
+	Limit          int           // Highest limit announced, -1 if none
+	MinRemaining   int           // Lowest remaining quota announced, -1 if none
+	Exhausted      time.Time     // Start of the first window announcing no remaining quota, zero if never
+	FirstThrottled time.Time     // Start of the first window with a 429/503 response, zero if none
+	MaxRetryAfter  time.Duration // Longest Retry-After, 0 if none
+	WindowSize     time.Duration
+	Trajectory     []RateLimitPoint // One point per window, in time order
+}
+
+// summarizeRateLimits computes a RateLimitSummary from windows keyed by
+// their start time in Unix nanoseconds. It returns nil if no response
+// carried rate-limit headers.
+func summarizeRateLimits(windows map[int64]*rateLimitWindow, size time.Duration) *RateLimitSummary {
+	starts := make([]int64, 0, len(windows))
+	samples := 0
+	for start, w := range windows {
+		starts = append(starts, start)
+		samples += w.Samples
+	}
+	if samples == 0 {
+		return nil
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	rs := &RateLimitSummary{Limit: -1, MinRemaining: -1, WindowSize: size}
+	overall := newRateLimitWindow()
+	for _, start := range starts {
+		w := windows[start]
+		t := time.Unix(0, start)
+		if w.MinRemaining == 0 && rs.Exhausted.IsZero() {
+			rs.Exhausted = t
+		}
+		if w.Throttled > 0 && rs.FirstThrottled.IsZero() {
+			rs.FirstThrottled = t
+		}
+		overall.merge(*w)
+		rs.Trajectory = append(rs.Trajectory, RateLimitPoint{Start: t, rateLimitWindow: *w})
+	}
+	rs.Limit = overall.Limit
+	rs.MinRemaining = overall.MinRemaining
+	rs.MaxRetryAfter = overall.RetryAfter
+	return rs
+}
+
+// printRateLimits prints the observed quota and its trajectory, folding
+// consecutive windows so that at most maxRateLimitRows rows are printed.
+func printRateLimits(w io.Writer, rs *RateLimitSummary) {
+	fmt.Fprintln(w, "Rate Limit Headers:")
+	if rs.Limit >= 0 {
+		fmt.Fprintf(w, "  Limit:           %d\n", rs.Limit)
+	}
+	if rs.MinRemaining >= 0 {
+		fmt.Fprintf(w, "  Lowest left:     %d", rs.MinRemaining)
+		if !rs.Exhausted.IsZero() {
+			fmt.Fprintf(w, " (quota exhausted at %s)", rs.Exhausted.Format("15:04:05"))
+		}
+		fmt.Fprintln(w)
+	}
+	if !rs.FirstThrottled.IsZero() {
+		fmt.Fprintf(w, "  First throttled: %s\n", rs.FirstThrottled.Format("15:04:05"))
+	}
+	if rs.MaxRetryAfter > 0 {
+		fmt.Fprintf(w, "  Retry-After:     up to %s\n", formatDuration(rs.MaxRetryAfter))
+	}
+
+	per := (len(rs.Trajectory) + maxRateLimitRows - 1) / maxRateLimitRows
+	fmt.Fprintf(w, "  Trajectory (%s per row):\n", rs.WindowSize*time.Duration(per))
+	for i := 0; i < len(rs.Trajectory); i += per {
+		row := newRateLimitWindow()
+		for _, p := range rs.Trajectory[i:min(i+per, len(rs.Trajectory))] {
+			row.merge(p.rateLimitWindow)
+		}
+		line := fmt.Sprintf("    %s  left %-6s limit %-6s", rs.Trajectory[i].Start.Format("15:04:05"),
+			formatQuota(row.MinRemaining), formatQuota(row.Limit))
+		if row.Reset > 0 {
+			line += fmt.Sprintf("  reset in %s", row.Reset.Round(time.Second))
+		}
+		if row.Throttled > 0 {
+			line += fmt.Sprintf("  throttled %d", row.Throttled)
+		}
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
+
+// formatQuota formats a quota value, "-" if it was not announced.
+func formatQuota(n int) string {
+	if n < 0 {
+		return "-"
+	}
+	return strconv.Itoa(n)
+}
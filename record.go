@@ -0,0 +1,274 @@
+// record.go implements the raw result file (-record): one JSON line, or
+// one CSV row for a .csv file, per request, written while the test runs.
+// Unlike the summary, raw results keep the timeline of a run, so runs can
+// be diffed over time with the `compare` subcommand or loaded into other
+// tools.
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recordBuffer is the number of results queued for the writer goroutine
+// before workers have to wait for it.
+const recordBuffer = 4096
+
+// rawResult is one line of a raw result file.
+type rawResult struct {
+	Time          time.Time `json:"time"`   // Request start, client clock
+	Worker        int       `json:"worker"` // Worker that sent the request, from 0
+	Index         int       `json:"index"`  // Request index, as in {{$requestIndex}}
+	LatencyMs     float64   `json:"latency_ms"`
+	Method        string    `json:"method,omitempty"`
+	Label         string    `json:"label,omitempty"`
+	Stage         string    `json:"stage,omitempty"`
+	Status        int       `json:"status,omitempty"`
+	BytesSent     int64     `json:"bytes_sent"`
+	BytesReceived int64     `json:"bytes_received"` // Response headers and body
+	Error         string    `json:"error,omitempty"`
+	Cancelled     bool      `json:"cancelled,omitempty"` // Aborted by -cancel-rate
+	Chaos         string    `json:"chaos,omitempty"`     // Kind of -chaos or -header-fuzz request
+
+	// Request is the request as sent, for replay-request. JSON files hold
+	// it with -record-requests; failure manifests always do.
+	Request *sentRequest `json:"request,omitempty"`
+}
+
+// rawCSVColumns is the header row of a CSV raw result file.
+var rawCSVColumns = []string{
+	"time", "worker", "index", "latency_ms", "method", "label", "stage", "status",
+	"bytes_sent", "bytes_received", "error", "cancelled", "chaos",
+}
+
+// isCSVRecord reports whether a raw result file is CSV rather than JSON
+// lines, which is decided by its extension.
+func isCSVRecord(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".csv")
+}
+
+// csvFields formats r in the order of rawCSVColumns.
+func (r rawResult) csvFields() []string {
+	return []string{
+		r.Time.Format(time.RFC3339Nano), strconv.Itoa(r.Worker), strconv.Itoa(r.Index),
+		strconv.FormatFloat(r.LatencyMs, 'f', -1, 64), r.Method, r.Label, r.Stage, strconv.Itoa(r.Status),
+		strconv.FormatInt(r.BytesSent, 10), strconv.FormatInt(r.BytesReceived, 10),
+		r.Error, strconv.FormatBool(r.Cancelled), r.Chaos,
+	}
+}
+
+// parseRawCSV parses one row of a CSV raw result file.
+func parseRawCSV(fields []string) (rawResult, error) {
+	if len(fields) != len(rawCSVColumns) {
+		return rawResult{}, fmt.Errorf("expected %d fields, got %d", len(rawCSVColumns), len(fields))
+	}
+	r := rawResult{
+		Method:    fields[4],
+		Label:     fields[5],
+		Stage:     fields[6],
+		Error:     fields[10],
+		Cancelled: fields[11] == "true",
+		Chaos:     fields[12],
+	}
+	var err error
+	if r.Time, err = time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+		return rawResult{}, fmt.Errorf("time: %w", err)
+	}
+	if r.LatencyMs, err = strconv.ParseFloat(fields[3], 64); err != nil {
+		return rawResult{}, fmt.Errorf("latency_ms: %w", err)
+	}
+	ints := []struct {
+		name string
+		dst  *int
+		s    string
+	}{
+		{"worker", &r.Worker, fields[1]},
+		{"index", &r.Index, fields[2]},
+		{"status", &r.Status, fields[7]},
+	}
+	for _, f := range ints {
+		if *f.dst, err = strconv.Atoi(f.s); err != nil {
+			return rawResult{}, fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	if r.BytesSent, err = strconv.ParseInt(fields[8], 10, 64); err != nil {
+		return rawResult{}, fmt.Errorf("bytes_sent: %w", err)
+	}
+	if r.BytesReceived, err = strconv.ParseInt(fields[9], 10, 64); err != nil {
+		return rawResult{}, fmt.Errorf("bytes_received: %w", err)
+	}
+	return r, nil
+}
+
+// readRawResults reads the results of a raw result file opened from path,
+// in the format its extension selects.
+func readRawResults(r io.Reader, path string) ([]rawResult, error) {
+	var results []rawResult
+	if isCSVRecord(path) {
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		for line := 1; ; line++ {
+			fields, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			if line == 1 && len(fields) > 0 && fields[0] == rawCSVColumns[0] {
+				continue
+			}
+			raw, err := parseRawCSV(fields)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+			results = append(results, raw)
+		}
+		return results, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var raw rawResult
+		if err := json.Unmarshal(scanner.Bytes(), &raw); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		results = append(results, raw)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return results, nil
+}
+
+// Recorder writes results to a raw result file. Results are handed to a
+// single writer goroutine over a buffered channel, so encoding and disk
+// writes stay off the workers' path.
+type Recorder struct {
+	file     *os.File
+	csv      bool
+	requests bool // Write the requests as sent too
+	results  chan rawResult
+	done     chan error
+}
+
+// NewRecorder creates the raw result file at path and starts its writer.
+// The file is CSV if path ends in .csv and JSON lines otherwise. With
+// requests set, every line also holds the request as sent.
+func NewRecorder(path string, requests bool) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating record file: %w", err)
+	}
+	r := &Recorder{
+		file:     f,
+		csv:      isCSVRecord(path),
+		requests: requests,
+		results:  make(chan rawResult, recordBuffer),
+		done:     make(chan error, 1),
+	}
+	go r.write()
+	return r, nil
+}
+
+// Record queues result, which completed at end, for writing. worker is
+// the worker that sent the request and index the request's index.
+func (r *Recorder) Record(result RequestResult, end time.Time, worker, index int) {
+	raw := newRawResult(result, end, worker, index)
+	if r.requests {
+		raw.Request = result.Sent
+	}
+	r.results <- raw
+}
+
+// newRawResult returns the raw result of result, which completed at end,
+// without the request.
+func newRawResult(result RequestResult, end time.Time, worker, index int) rawResult {
+	raw := rawResult{
+		Time:          end.Add(-result.Duration),
+		Worker:        worker,
+		Index:         index,
+		LatencyMs:     ms(result.Duration),
+		Method:        result.Method,
+		Label:         result.Label,
+		Stage:         result.Stage,
+		Status:        result.StatusCode,
+		BytesSent:     result.RequestBytes,
+		BytesReceived: result.HeaderBytes + result.ContentLength,
+		Cancelled:     result.Cancelled,
+		Chaos:         result.Chaos,
+	}
+	if result.Error != nil {
+		raw.Error = result.Error.Error()
+		raw.Status = 0
+	}
+	return raw
+}
+
+// write encodes queued results until the channel is closed.
+func (r *Recorder) write() {
+	w := bufio.NewWriterSize(r.file, 64<<10)
+	encode := newRawEncoder(w, r.csv)
+	var err error
+	for raw := range r.results {
+		if err == nil {
+			err = encode(raw)
+		}
+	}
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+	r.done <- err
+}
+
+// newRawEncoder returns a function writing one raw result to w, as a CSV
+// row after a header row or as a JSON line.
+func newRawEncoder(w io.Writer, asCSV bool) func(rawResult) error {
+	if !asCSV {
+		enc := json.NewEncoder(w)
+		return func(raw rawResult) error { return enc.Encode(raw) }
+	}
+	cw := csv.NewWriter(w)
+	header := true
+	return func(raw rawResult) error {
+		if header {
+			header = false
+			if err := cw.Write(rawCSVColumns); err != nil {
+				return err
+			}
+		}
+		if err := cw.Write(raw.csvFields()); err != nil {
+			return err
+		}
+		// The csv.Writer buffers on its own; hand rows on to w so they
+		// are flushed with it.
+		cw.Flush()
+		return cw.Error()
+	}
+}
+
+// Close writes the remaining results and closes the file. No results may
+// be recorded after Close.
+func (r *Recorder) Close() error {
+	close(r.results)
+	err := <-r.done
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("writing record file: %w", err)
+	}
+	return nil
+}
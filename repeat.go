@@ -0,0 +1,178 @@
+// repeat.go implements repeated runs (-repeat N): the same test run N times
+// in one invocation, optionally with a pause in between (-repeat-pause),
+// reporting the mean and standard deviation of the key metrics across the
+// runs. A single run's P95 varies enough from one run to the next that a
+// regression of a few percent cannot be told apart from noise; the spread
+// across runs shows how much a difference has to be to mean something.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// RepeatMetric is one metric across the runs of a repeated test.
+type RepeatMetric struct {
+	Name   string    // As in the JSON output, e.g. "p95_ms"
+	Values []float64 // One per run, in run order
+	Mean   float64
+	StdDev float64 // Sample standard deviation, 0 for a single run
+	Min    float64
+	Max    float64
+
+	duration bool // Values are milliseconds
+}
+
+// RepeatSummary is the spread of the key metrics across repeated runs.
+type RepeatSummary struct {
+	Runs    int
+	Pause   time.Duration // -repeat-pause
+	Metrics []RepeatMetric
+}
+
+// runRepeated runs the test described by config config.Repeat times,
+// config.RepeatPause apart, merging every run's results into total. It
+// returns the summary of each run that completed and stops at the first
+// run that fails or when ctx is done.
+func runRepeated(ctx context.Context, config *Config, w io.Writer, total *Stats) ([]Summary, error) {
+	var runs []Summary
+	for i := 0; i < config.Repeat; i++ {
+		if i > 0 && config.RepeatPause > 0 {
+			fmt.Fprintf(w, "Pausing %s before run %d\n", config.RepeatPause, i+1)
+			timer := time.NewTimer(config.RepeatPause)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return runs, ctx.Err()
+			}
+		}
+
+		fmt.Fprintf(w, "Run %d of %d\n", i+1, config.Repeat)
+		stats := NewStats(config.NumRequests)
+		stats.Configure(config)
+		err := runWithProgress(!config.CI, w, stats, func() error {
+			return RunLoadTest(ctx, config, stats)
+		})
+		s := stats.GetSummary()
+		total.Merge(stats.Snapshot())
+		runs = append(runs, s)
+		fmt.Fprintf(w, "\nRun %d: %d requests, %.2f%% failed, %.2f req/s, P50 %s, P95 %s, P99 %s\n",
+			i+1, s.TotalRequests, failRate(s), s.RequestsPerSec, formatDuration(s.P50), formatDuration(s.P95), formatDuration(s.P99))
+		if err != nil {
+			return runs, err
+		}
+	}
+	return runs, nil
+}
+
+// repeatedSummary returns the summary of all runs together, from total
+// into which they were merged, with the spread across runs attached.
+// Throughput is computed over the time the runs took, leaving out the
+// pauses between them.
+func repeatedSummary(total *Stats, runs []Summary, pause time.Duration) Summary {
+	s := total.GetSummary()
+	var active time.Duration
+	for _, r := range runs {
+		active += r.TotalTime
+	}
+	if secs := active.Seconds(); secs > 0 {
+		s.TotalTime = active
+		s.RequestsPerSec = float64(s.realRequests()) / secs
+		s.RecvPerSec = float64(s.TotalBytes+s.HeaderBytes) / secs
+		s.SentPerSec = float64(s.BytesSent) / secs
+	}
+	s.Repeats = summarizeRepeats(runs, pause)
+	return s
+}
+
+// summarizeRepeats computes the spread of the key metrics across runs.
+func summarizeRepeats(runs []Summary, pause time.Duration) *RepeatSummary {
+	metrics := []struct {
+		name     string
+		duration bool
+		value    func(Summary) float64
+	}{
+		{"requests_per_sec", false, func(s Summary) float64 { return s.RequestsPerSec }},
+		{"error_rate", false, failRate},
+		{"avg_ms", true, func(s Summary) float64 { return ms(s.AvgDuration) }},
+		{"p50_ms", true, func(s Summary) float64 { return ms(s.P50) }},
+		{"p90_ms", true, func(s Summary) float64 { return ms(s.P90) }},
+		{"p95_ms", true, func(s Summary) float64 { return ms(s.P95) }},
+		{"p99_ms", true, func(s Summary) float64 { return ms(s.P99) }},
+	}
+
+	r := &RepeatSummary{Runs: len(runs), Pause: pause}
+	for _, m := range metrics {
+		rm := RepeatMetric{Name: m.name, duration: m.duration, Min: math.Inf(1), Max: math.Inf(-1)}
+		for _, s := range runs {
+			v := m.value(s)
+			rm.Values = append(rm.Values, v)
+			rm.Mean += v
+			rm.Min = math.Min(rm.Min, v)
+			rm.Max = math.Max(rm.Max, v)
+		}
+		if len(runs) > 0 {
+			rm.Mean /= float64(len(runs))
+		}
+		if len(runs) > 1 {
+			var sq float64
+			for _, v := range rm.Values {
+				sq += (v - rm.Mean) * (v - rm.Mean)
+			}
+			rm.StdDev = math.Sqrt(sq / float64(len(runs)-1))
+		}
+		r.Metrics = append(r.Metrics, rm)
+	}
+	return r
+}
+
+// failRate returns the percentage of s's requests that failed.
+func failRate(s Summary) float64 {
+	if s.TotalRequests == 0 {
+		return 0
+	}
+	return float64(s.FailCount) / float64(s.TotalRequests) * 100
+}
+
+// repeatMetricLabels are the text summary's names of the metrics.
+var repeatMetricLabels = map[string]string{
+	"requests_per_sec": "Req/sec",
+	"error_rate":       "Failed %",
+	"avg_ms":           "Avg",
+	"p50_ms":           "P50",
+	"p90_ms":           "P90",
+	"p95_ms":           "P95",
+	"p99_ms":           "P99",
+}
+
+// printRepeats prints the spread of the key metrics across the runs, with
+// the coefficient of variation (standard deviation over mean) as a measure
+// of how stable each metric is.
+func printRepeats(w io.Writer, r *RepeatSummary) {
+	if r.Pause > 0 {
+		fmt.Fprintf(w, "Repeated Runs (%d, %s apart):\n", r.Runs, r.Pause)
+	} else {
+		fmt.Fprintf(w, "Repeated Runs (%d):\n", r.Runs)
+	}
+	fmt.Fprintf(w, "  %-9s %10s %10s %7s %10s %10s\n", "Metric", "Mean", "StdDev", "CV", "Min", "Max")
+	for _, m := range r.Metrics {
+		cv := "-"
+		if m.Mean != 0 {
+			cv = fmt.Sprintf("%.1f%%", m.StdDev/m.Mean*100)
+		}
+		fmt.Fprintf(w, "  %-9s %10s %10s %7s %10s %10s\n", repeatMetricLabels[m.Name],
+			m.format(m.Mean), m.format(m.StdDev), cv, m.format(m.Min), m.format(m.Max))
+	}
+}
+
+// format formats a value of the metric for the text summary.
+func (m RepeatMetric) format(v float64) string {
+	if m.duration {
+		return formatDuration(time.Duration(v * float64(time.Millisecond)))
+	}
+	return fmt.Sprintf("%.2f", v)
+}
@@ -0,0 +1,335 @@
+// replay.go implements the failure manifest (-failure-manifest FILE) and
+// the `replay-request` subcommand. The manifest keeps every failed request
+// exactly as it was sent, together with the generated values and scenario
+// variables (the users row and extracted values) it was rendered from, so a
+// failure caused by one bad data row can be found and resent on its own
+// instead of rerunning the whole test and hoping the random values line up.
+// Its lines are raw results (see record.go) with the request attached, the
+// same as a -record file written with -record-requests, so replay-request
+// reads either.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxFailureManifest bounds the number of requests a failure manifest
+// keeps; a run failing wholesale would otherwise write every request.
+const maxFailureManifest = 1000
+
+// sentRequest is a request as it went out, with what it was rendered from.
+type sentRequest struct {
+	Index     int               `json:"-"`              // Request index, or scenario iteration; the raw result's index
+	Step      string            `json:"step,omitempty"` // Scenario step, "" in single-URL mode
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Header    http.Header       `json:"headers,omitempty"`
+	Body      string            `json:"body,omitempty"`
+	Form      []formPart        `json:"form,omitempty"`      // Multipart form sent instead of Body
+	Generated []generatedValue  `json:"generated,omitempty"` // Generator placeholder values in template order
+	Vars      map[string]string `json:"vars,omitempty"`      // Scenario variables the step was rendered with
+}
+
+// newSentRequest captures req, the request with the given index, sent with
+// body and rendered with the generated values.
+func newSentRequest(index int, req *http.Request, body string, generated []generatedValue) *sentRequest {
+	return &sentRequest{
+		Index:     index,
+		Method:    req.Method,
+		URL:       req.URL.String(),
+		Header:    req.Header.Clone(),
+		Body:      body,
+		Generated: generated,
+	}
+}
+
+// FailureManifest writes failed requests to a JSON lines file. A nil
+// *FailureManifest writes nothing.
+type FailureManifest struct {
+	path    string
+	mu      sync.Mutex
+	file    *os.File
+	w       *bufio.Writer
+	enc     *json.Encoder
+	written int
+	dropped int
+	err     error // First write error
+}
+
+// newFailureManifest returns a manifest for path; the file is created by
+// start.
+func newFailureManifest(path string) *FailureManifest {
+	return &FailureManifest{path: path}
+}
+
+// start creates the manifest file.
+func (m *FailureManifest) start() error {
+	if m == nil {
+		return nil
+	}
+	f, err := os.Create(m.path)
+	if err != nil {
+		return fmt.Errorf("creating failure manifest: %w", err)
+	}
+	m.file = f
+	m.w = bufio.NewWriter(f)
+	m.enc = json.NewEncoder(m.w)
+	return nil
+}
+
+// Add writes result, which completed at end on worker (0 in scenario
+// mode, which has no workers), if it failed with an error, an assertion
+// or a 4xx or 5xx status. Cancelled and chaos requests are skipped, and failures beyond
+// maxFailureManifest are only counted. It is safe for concurrent use.
+func (m *FailureManifest) Add(result RequestResult, end time.Time, worker int) {
+	if m == nil || m.enc == nil || result.Sent == nil || result.Cancelled || result.Chaos != "" {
+		return
+	}
+	if !result.failed() && result.StatusCode < 400 {
+		return
+	}
+	entry := newRawResult(result, end, worker, result.Sent.Index)
+	entry.Request = result.Sent
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.written >= maxFailureManifest {
+		m.dropped++
+		return
+	}
+	m.written++
+	if err := m.enc.Encode(entry); err != nil && m.err == nil {
+		m.err = err
+	}
+}
+
+// close flushes and closes the file, noting on stderr how many failures
+// did not fit.
+func (m *FailureManifest) close() error {
+	if m == nil || m.file == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err := m.err
+	if ferr := m.w.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := m.file.Close(); err == nil {
+		err = cerr
+	}
+	if m.dropped > 0 {
+		fmt.Fprintf(os.Stderr, "failure manifest: kept the first %d failed requests, %d more were left out\n", m.written, m.dropped)
+	}
+	if err != nil {
+		return fmt.Errorf("writing failure manifest: %w", err)
+	}
+	return nil
+}
+
+// maxReplayBody is the number of response body bytes replay-request
+// prints.
+const maxReplayBody = 4096
+
+// runReplayRequestCommand implements `replay-request`: it looks up one
+// request of a failure manifest or raw result file by its index and sends
+// it again, printing the request and the response.
+func runReplayRequestCommand(args []string) error {
+	fs := flag.NewFlagSet("replay-request", flag.ContinueOnError)
+	from := fs.String("from", "", "Failure manifest written by -failure-manifest, or -record file written with -record-requests (required)")
+	index := fs.Int("index", -1, "Index of the request to resend, or scenario iteration (required)")
+	step := fs.String("step", "", "Scenario step of the request, when several steps of the iteration failed")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout of the replayed request")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *index < 0 {
+		return fmt.Errorf("replay-request: -from and -index are required")
+	}
+
+	entry, err := findRequest(*from, *index, *step)
+	if err != nil {
+		return fmt.Errorf("replay-request: %w", err)
+	}
+	sent := entry.Request
+	req, err := http.NewRequest(sent.Method, sent.URL, strings.NewReader(sent.Body))
+	if err != nil {
+		return fmt.Errorf("replay-request: %w", err)
+	}
+	if sent.Body == "" {
+		req.Body, req.GetBody, req.ContentLength = http.NoBody, nil, 0
+	}
+	for name, values := range sent.Header {
+		req.Header[name] = values
+	}
+	if sent.Form != nil {
+		// The form gets a new boundary, and with it a new Content-Type.
+		if err := attachForm(req, sent.Form); err != nil {
+			return fmt.Errorf("replay-request: building form: %w", err)
+		}
+	}
+
+	printReplayRequest(os.Stdout, entry)
+	client := &http.Client{Timeout: *timeout}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("replay-request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	latency := time.Since(start)
+	if err != nil {
+		return fmt.Errorf("replay-request: reading response: %w", err)
+	}
+	printReplayResponse(os.Stdout, resp, body, latency)
+	return nil
+}
+
+// findRequest returns the raw result of the request with index, of step
+// if it is not empty, from the failure manifest or raw result file at path.
+// Results recorded without their request are skipped.
+func findRequest(path string, index int, step string) (*rawResult, error) {
+	if isCSVRecord(path) {
+		return nil, fmt.Errorf("%s: CSV record files hold no requests, record to a .jsonl file with -record-requests", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var matches []rawResult
+	unsent := false
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var r rawResult
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		if r.Index != index {
+			continue
+		}
+		if r.Request == nil {
+			unsent = true
+			continue
+		}
+		if step == "" || r.Request.Step == step {
+			matches = append(matches, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	switch {
+	case len(matches) == 0 && unsent:
+		return nil, fmt.Errorf("%s does not hold request %d as sent, record with -record-requests or -failure-manifest", path, index)
+	case len(matches) == 0 && step != "":
+		return nil, fmt.Errorf("%s has no request %d of step %q", path, index, step)
+	case len(matches) == 0:
+		return nil, fmt.Errorf("%s has no request %d", path, index)
+	case len(matches) > 1:
+		steps := make([]string, len(matches))
+		for i, r := range matches {
+			steps[i] = r.Request.Step
+		}
+		return nil, fmt.Errorf("%s has %d requests %d, select one with -step: %s", path, len(matches), index, strings.Join(steps, ", "))
+	}
+	return &matches[0], nil
+}
+
+// printReplayRequest prints the request about to be resent, what it was
+// rendered from and how it went originally.
+func printReplayRequest(w io.Writer, r *rawResult) {
+	e := r.Request
+	fmt.Fprintf(w, "Request %d", r.Index)
+	if e.Step != "" {
+		fmt.Fprintf(w, " (step %s)", e.Step)
+	}
+	fmt.Fprintf(w, ", sent %s:\n", r.Time.Format(time.RFC3339))
+	fmt.Fprintf(w, "  %s %s\n", e.Method, e.URL)
+	printHeaders(w, e.Header)
+	if e.Body != "" {
+		fmt.Fprintf(w, "\n  %s\n", e.Body)
+	}
+	if len(e.Form) > 0 {
+		fmt.Fprintln(w, "Form:")
+		for _, p := range e.Form {
+			if p.File != "" {
+				fmt.Fprintf(w, "  %s = @%s\n", p.Name, p.File)
+			} else {
+				fmt.Fprintf(w, "  %s = %s\n", p.Name, p.Value)
+			}
+		}
+	}
+	if len(e.Vars) > 0 {
+		fmt.Fprintln(w, "Variables:")
+		names := make([]string, 0, len(e.Vars))
+		for name := range e.Vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "  %s = %s\n", name, e.Vars[name])
+		}
+	}
+	if len(e.Generated) > 0 {
+		fmt.Fprintln(w, "Generated values:")
+		for _, g := range e.Generated {
+			fmt.Fprintf(w, "  %s = %s\n", g.Placeholder, g.Value)
+		}
+	}
+	latency := formatDuration(time.Duration(r.LatencyMs * float64(time.Millisecond)))
+	if r.Error != "" {
+		fmt.Fprintf(w, "Originally: %s after %s\n", r.Error, latency)
+	} else {
+		fmt.Fprintf(w, "Originally: %d %s after %s\n", r.Status, http.StatusText(r.Status), latency)
+	}
+	fmt.Fprintln(w)
+}
+
+// printReplayResponse prints the response to the replayed request, with
+// at most maxReplayBody bytes of its body.
+func printReplayResponse(w io.Writer, resp *http.Response, body []byte, latency time.Duration) {
+	fmt.Fprintf(w, "Response after %s:\n", formatDuration(latency))
+	fmt.Fprintf(w, "  %s %s\n", resp.Proto, resp.Status)
+	printHeaders(w, resp.Header)
+	if len(body) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	if len(body) > maxReplayBody {
+		fmt.Fprintf(w, "  %s\n  ... (%d more bytes)\n", body[:maxReplayBody], len(body)-maxReplayBody)
+		return
+	}
+	fmt.Fprintf(w, "  %s\n", body)
+}
+
+// printHeaders prints headers sorted by name, one value per line.
+func printHeaders(w io.Writer, h http.Header) {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range h[name] {
+			fmt.Fprintf(w, "  %s: %s\n", name, v)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+// resultstream.go implements live result streaming from agents to the
+// controller in distributed mode. While a run is in progress each agent
+// pushes windowed deltas of its statistics (see Stats.Delta) as numbered
+// frames; the controller applies them in sequence order and acknowledges
+// the highest frame applied. Unacknowledged frames stay buffered on the
+// agent and are resent with the next push, and duplicates are ignored, so
+// a controller restart or network blip delays results but never loses or
+// double-counts them. Should frames still be missing at the end of a run,
+// the controller falls back to the agent's final snapshot.
+//
+// Frames travel in the body of POST /frames requests, each encoded as a
+// 4-byte big-endian length followed by that many bytes of JSON. The
+// response is a single frame of the same encoding holding a frameAck.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxFrameSize bounds the size of a single encoded frame.
+const maxFrameSize = 64 << 20
+
+// defaultStreamWindow is how often agents push a frame.
+const defaultStreamWindow = time.Second
+
+// finalFlushTimeout is how long an agent keeps retrying to deliver its
+// remaining frames after a run before relying on its final snapshot.
+const finalFlushTimeout = 10 * time.Second
+
+// streamTarget tells an agent where to push its frames.
+type streamTarget struct {
+	Addr    string        `json:"addr,omitempty"` // Controller address; empty means "the address the assignment came from"
+	Port    int           `json:"port"`           // Controller port, used when Addr is empty
+	RunID   string        `json:"run_id"`
+	AgentID string        `json:"agent_id"`
+	Window  time.Duration `json:"window"`
+}
+
+// resultFrame is one window of an agent's results.
+type resultFrame struct {
+	RunID   string        `json:"run_id"`
+	AgentID string        `json:"agent_id"`
+	Seq     uint64        `json:"seq"` // Starts at 1 and increases by one per frame
+	Final   bool          `json:"final,omitempty"`
+	Window  StatsSnapshot `json:"window"`
+}
+
+// frameAck acknowledges every frame up to and including Seq.
+type frameAck struct {
+	Seq uint64 `json:"seq"`
+}
+
+// writeFrame encodes v as a length-prefixed JSON frame.
+func writeFrame(w io.Writer, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds limit of %d", len(payload), maxFrameSize)
+	}
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+	return err
+}
+
+// readFrame decodes one length-prefixed JSON frame into v. It returns
+// io.EOF if r is exhausted before a new frame starts.
+func readFrame(r io.Reader, v interface{}) error {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("truncated frame header")
+		}
+		return err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds limit of %d", size, maxFrameSize)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return fmt.Errorf("truncated frame: %w", err)
+	}
+	return json.Unmarshal(payload, v)
+}
+
+// agentStream is the controller-side state of one agent's frames.
+type agentStream struct {
+	stats *Stats
+	acked uint64
+	final bool
+}
+
+// resultCollector receives frames on the controller. It merges each frame
+// into live, which reflects all agents combined, and into a per-agent
+// Stats used to assemble the final result.
+type resultCollector struct {
+	token string
+	runID string
+	live  *Stats
+
+	mu     sync.Mutex
+	agents map[string]*agentStream
+}
+
+// newResultCollector creates a collector for the run runID, expecting
+// frames from the given agents.
+func newResultCollector(token, runID string, live *Stats, agents []string) *resultCollector {
+	rc := &resultCollector{
+		token:  token,
+		runID:  runID,
+		live:   live,
+		agents: make(map[string]*agentStream, len(agents)),
+	}
+	for _, a := range agents {
+		rc.agents[a] = &agentStream{stats: NewStats(0)}
+	}
+	return rc
+}
+
+// handleFrames applies the frames in a POST /frames request and responds
+// with an acknowledgement for the sending agent.
+func (rc *resultCollector) handleFrames(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkToken(r, rc.token) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	body := bufio.NewReader(r.Body)
+	var agentID string
+	for {
+		var f resultFrame
+		err := readFrame(body, &f)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// Frames before the damaged one were applied; the ack tells
+			// the agent where to resume.
+			break
+		}
+		if f.RunID != rc.runID {
+			http.Error(w, "unknown run", http.StatusGone)
+			return
+		}
+		agentID = f.AgentID
+		rc.apply(f)
+	}
+
+	rc.mu.Lock()
+	as, ok := rc.agents[agentID]
+	var ack frameAck
+	if ok {
+		ack.Seq = as.acked
+	}
+	rc.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown agent", http.StatusGone)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	writeFrame(w, ack)
+}
+
+// apply merges f if it is the next frame expected from its agent.
+// Duplicates and frames beyond a gap are ignored; the agent resends them.
+func (rc *resultCollector) apply(f resultFrame) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	as, ok := rc.agents[f.AgentID]
+	if !ok || f.Seq != as.acked+1 {
+		return
+	}
+	as.stats.Merge(f.Window)
+	rc.live.Merge(f.Window)
+	as.acked = f.Seq
+	if f.Final {
+		as.final = true
+	}
+}
+
+// complete reports whether every frame of the agent, including its final
+// one, has been applied, and returns the agent's merged statistics.
+func (rc *resultCollector) complete(agentID string) (*Stats, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	as, ok := rc.agents[agentID]
+	if !ok {
+		return nil, false
+	}
+	return as.stats, as.final
+}
+
+// framePusher sends an agent's frames to the controller.
+type framePusher struct {
+	client *http.Client
+	url    string
+	token  string
+	target streamTarget
+
+	seq       uint64
+	pending   []resultFrame
+	failing   bool
+	discarded bool
+}
+
+// pushFrames streams windowed deltas of stats to the controller until
+// ctx is done, then delivers the remaining frames, giving up after
+// finalFlushTimeout.
+func pushFrames(ctx context.Context, controllerAddr, token string, target streamTarget, stats *Stats) {
+	p := &framePusher{
+		client: &http.Client{Timeout: 10 * time.Second},
+		url:    agentURL(controllerAddr, "/frames"),
+		token:  token,
+		target: target,
+	}
+
+	var mark statsMark
+	ticker := time.NewTicker(target.Window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if delta := stats.Delta(&mark); !delta.empty() {
+				p.enqueue(delta, false)
+			}
+			if len(p.pending) > 0 {
+				p.flush(context.Background())
+			}
+		case <-ctx.Done():
+			p.enqueue(stats.Delta(&mark), true)
+			flushCtx, cancel := context.WithTimeout(context.Background(), finalFlushTimeout)
+			defer cancel()
+			for {
+				if p.flush(flushCtx) || p.discarded {
+					return
+				}
+				select {
+				case <-flushCtx.Done():
+					fmt.Fprintf(os.Stderr, "agent: %d result frame(s) undelivered, controller will use the final snapshot\n", len(p.pending))
+					return
+				case <-time.After(agentPollInterval / 4):
+				}
+			}
+		}
+	}
+}
+
+// enqueue buffers a new frame for delivery.
+func (p *framePusher) enqueue(window StatsSnapshot, final bool) {
+	if p.discarded {
+		return
+	}
+	p.seq++
+	p.pending = append(p.pending, resultFrame{
+		RunID:   p.target.RunID,
+		AgentID: p.target.AgentID,
+		Seq:     p.seq,
+		Final:   final,
+		Window:  window,
+	})
+}
+
+// flush sends all unacknowledged frames and drops those the controller
+// acknowledges. It returns true when nothing remains pending.
+func (p *framePusher) flush(ctx context.Context) bool {
+	ack, err := p.send(ctx)
+	if err != nil {
+		if !p.failing {
+			fmt.Fprintf(os.Stderr, "agent: pushing results: %v (buffering %d frame(s))\n", err, len(p.pending))
+			p.failing = true
+		}
+		return false
+	}
+	if p.failing {
+		fmt.Fprintf(os.Stderr, "agent: result push recovered\n")
+		p.failing = false
+	}
+
+	i := 0
+	for i < len(p.pending) && p.pending[i].Seq <= ack.Seq {
+		i++
+	}
+	p.pending = p.pending[i:]
+	return len(p.pending) == 0
+}
+
+// send performs one POST /frames round trip.
+func (p *framePusher) send(ctx context.Context) (frameAck, error) {
+	var ack frameAck
+
+	var body bytes.Buffer
+	for _, f := range p.pending {
+		if err := writeFrame(&body, f); err != nil {
+			return ack, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, &body)
+	if err != nil {
+		return ack, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return ack, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusGone {
+		// The controller no longer wants these frames (e.g. it restarted
+		// into a new run); drop them rather than retrying forever.
+		p.pending = nil
+		p.discarded = true
+		return ack, fmt.Errorf("controller discarded the run")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ack, fmt.Errorf("controller returned %d", resp.StatusCode)
+	}
+	if err := readFrame(resp.Body, &ack); err != nil {
+		return ack, fmt.Errorf("reading ack: %w", err)
+	}
+	return ack, nil
+}
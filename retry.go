@@ -0,0 +1,217 @@
+// retry.go implements request retries (-retries) and idempotency keys
+// (-idempotency-header). Every logical request gets its own key, sent
+// unchanged on each retry together with the same body, so a server that
+// honors idempotency keys can recognize retries. Responses that show how
+// the server handled them are counted: replays of a stored response,
+// 409 Conflict for a key still in flight, and retries that succeeded as
+// fresh requests after an attempt that may already have been processed.
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultRetryBackoff is the default delay before the first retry.
+const defaultRetryBackoff = 100 * time.Millisecond
+
+// replayHeaders are response headers with which servers mark a response
+// replayed for a known idempotency key, e.g. Stripe's Idempotent-Replayed.
+var replayHeaders = []string{"Idempotent-Replayed", "Idempotency-Replayed"}
+
+// RetryPolicy describes how failed requests are retried. The zero value
+// disables retries.
+type RetryPolicy struct {
+	Max     int           // Retries after the first attempt
+	Backoff time.Duration // Delay before the first retry, doubled for each further one
+}
+
+// idempotencyOutcome records how the server treated the retries of one
+// logical request.
+type idempotencyOutcome struct {
+	Replayed          bool // A response was marked as a replay
+	Conflict          bool // A retry was answered 409 Conflict
+	PossibleDuplicate bool // A retry succeeded unmarked after an ambiguous failure
+}
+
+// retryCounts tallies retries and idempotency key outcomes over a run.
+type retryCounts struct {
+	Retried            int `json:"retried"`             // Requests retried at least once
+	Retries            int `json:"retries"`             // Retry attempts
+	Keyed              int `json:"keyed"`               // Requests sent with an idempotency key
+	Replayed           int `json:"replayed"`            // Requests answered with a replayed response
+	Conflicts          int `json:"conflicts"`           // Requests whose retry got 409 Conflict
+	PossibleDuplicates int `json:"possible_duplicates"` // Requests possibly processed twice
+}
+
+// add counts the retries and idempotency outcome of one request.
+func (c *retryCounts) add(result RequestResult) {
+	if result.Attempts > 1 {
+		c.Retried++
+		c.Retries += result.Attempts - 1
+	}
+	if o := result.Idempotency; o != nil {
+		c.Keyed++
+		if o.Replayed {
+			c.Replayed++
+		}
+		if o.Conflict {
+			c.Conflicts++
+		}
+		if o.PossibleDuplicate {
+			c.PossibleDuplicates++
+		}
+	}
+}
+
+// merge adds o to c.
+func (c *retryCounts) merge(o retryCounts) {
+	c.Retried += o.Retried
+	c.Retries += o.Retries
+	c.Keyed += o.Keyed
+	c.Replayed += o.Replayed
+	c.Conflicts += o.Conflicts
+	c.PossibleDuplicates += o.PossibleDuplicates
+}
+
+// sub returns the counts in c that are not in prev.
+func (c retryCounts) sub(prev retryCounts) retryCounts {
+	return retryCounts{
+		Retried:            c.Retried - prev.Retried,
+		Retries:            c.Retries - prev.Retries,
+		Keyed:              c.Keyed - prev.Keyed,
+		Replayed:           c.Replayed - prev.Replayed,
+		Conflicts:          c.Conflicts - prev.Conflicts,
+		PossibleDuplicates: c.PossibleDuplicates - prev.PossibleDuplicates,
+	}
+}
+
+// retryable reports whether a result is worth retrying: transport errors,
+// throttling and server errors.
+func retryable(result RequestResult) bool {
+	if result.Error != nil {
+		return true
+	}
+	switch result.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// ambiguous reports whether the server may have processed a failed
+// attempt: the request was lost in flight, or failed at or behind a
+// gateway. 429 and 503 are taken to mean the request was turned away.
+func ambiguous(result RequestResult) bool {
+	if result.Error != nil {
+		return true
+	}
+	switch result.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isReplayResponse reports whether resp is marked as a replayed response.
+func isReplayResponse(resp *http.Response) bool {
+	for _, h := range replayHeaders {
+		if strings.EqualFold(resp.Header.Get(h), "true") {
+			return true
+		}
+	}
+	return false
+}
+
+// validIdempotencyHeader checks that name can be used as a header name.
+func validIdempotencyHeader(name string) error {
+	if name == "" {
+		return nil
+	}
+	for _, c := range name {
+		if !strings.ContainsRune(tokenChars, c) {
+			return fmt.Errorf("invalid -idempotency-header %q, not a valid header name", name)
+		}
+	}
+	return nil
+}
+
+// doWithRetries sends req, retrying it under the configured RetryPolicy.
+// Each attempt resends the same body and headers, including the
+// idempotency key. The returned result is that of the last attempt, with
+// RequestBytes covering every attempt and, if the request was retried or
+// redirected, the latency of every exchange and of the whole request.
+// Retrying stops once req's context is done.
+func (w *Worker) doWithRetries(req *http.Request, renderedBody string) RequestResult {
+	policy := w.config.Retry
+	size := requestWireSize(req, renderedBody)
+	keyed := w.config.IdempotencyHeader != ""
+	req, redirects := withRedirectLog(req)
+
+	var outcome idempotencyOutcome
+	var sawAmbiguous bool
+	var exchanges []time.Duration
+	var redirected int
+	first := time.Now()
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			req = req.Clone(req.Context())
+			if req.GetBody != nil {
+				req.Body, _ = req.GetBody()
+			}
+		}
+
+		redirects.at = redirects.at[:0]
+		start := time.Now()
+		result := w.do(req)
+		result.Attempts = attempt + 1
+		result.RequestBytes = size * int64(attempt+1)
+		// Without retries, only redirected requests have exchanges to
+		// tell apart.
+		redirected += len(redirects.at)
+		if policy.Max > 0 || len(redirects.at) > 0 {
+			exchanges = redirects.hops(exchanges, start, result.Duration)
+		}
+		if len(exchanges) > 1 {
+			result.Exchanges = exchanges
+			result.Logical = start.Sub(first) + result.Duration
+			result.Redirects = redirected
+		}
+
+		if keyed {
+			if result.Replayed {
+				outcome.Replayed = true
+			}
+			if attempt > 0 && result.Error == nil {
+				if result.StatusCode == http.StatusConflict {
+					outcome.Conflict = true
+				}
+				if sawAmbiguous && result.StatusCode < 300 && !result.Replayed {
+					outcome.PossibleDuplicate = true
+				}
+			}
+			sawAmbiguous = sawAmbiguous || ambiguous(result)
+			result.Idempotency = &outcome
+		}
+
+		if attempt >= policy.Max || !retryable(result) || req.Context().Err() != nil {
+			return result
+		}
+
+		// Back off exponentially, or for as long as the server asked.
+		delay := policy.Backoff << attempt
+		if ra := min(result.RetryAfter, w.config.RetryAfterMax); ra > delay {
+			delay = ra
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return result
+		}
+	}
+}
@@ -10,8 +10,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
+	mathrand "math/rand"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -24,12 +28,21 @@ type ScenarioStep struct {
 	URL     string            `json:"url"`
 	Headers map[string]string `json:"headers"`
 	Body    string            `json:"body"`
-	Extract map[string]string `json:"extract"` // varName -> JSON dot-path
+	Extract map[string]string `json:"extract"` // varName -> JSON dot-path, "regex:PATTERN" or "header:NAME"
+	// Label names the logical endpoint the step exercises. Results of steps
+	// sharing a label are grouped together in every output.
+	Label string `json:"label"`
+	// DependsOn names the steps that must succeed before this one starts.
+	// When any step sets it, steps run as a dependency graph.
+	DependsOn []string `json:"depends_on"`
 
 	// Parsed templates (populated by LoadScenario, not from JSON).
+	methodTemplate  *Template // Only set when the method has placeholders
 	urlTemplate     *Template
 	bodyTemplate    *Template
-	headerTemplates map[string]*Template
+	headerTemplates []headerTemplate // Names and values, sorted by name
+	extractors      map[string]*extractor
+	deps            []int // Indices of DependsOn steps
 }
 
 // Scenario defines a complete multi-step load test flow.
@@ -40,10 +53,46 @@ type Scenario struct {
 	Concurrency int                 `json:"concurrency"`
 	Iterations  int                 `json:"iterations"`
 	Users       []map[string]string `json:"users"` // per-iteration credentials/data
+
+	graph bool // Steps declare dependencies (populated by LoadScenario)
+}
+
+// scenarioFlags are the flags scenario mode uses. The scenario file
+// defines the requests and how many are sent, so the other flags, such as
+// -n, -c, -rate, -retries or -chaos, are rejected rather than ignored.
+var scenarioFlags = map[string]bool{
+	"scenario": true, "timeout": true, "stop-when-body-contains": true, "stop-after-consecutive": true,
+	"fail-on-5xx": true, "fail-on-4xx": true, "fail-on-status": true, "honor-retry-after": true, "retry-after-max": true,
+	"ci": true, "output": true, "output-file": true, "progress-interval": true,
+	"threshold": true, "max-error-rate": true, "max-avg": true, "max-p50": true, "max-p95": true, "max-p99": true, "min-rps": true,
+	"budgets": true, "sla": true, "baseline": true, "clock-sync": true,
+	"percentile": true, "percentiles": true, "histogram": true, "min-samples": true, "timeseries": true, "max-memory": true,
+	"spike-window": true, "spike-threshold": true,
+	"export": true, "export-interval": true, "influx-url": true, "influx-bucket": true, "influx-org": true,
+	"statsd": true, "failure-manifest": true,
+	"browser-mode": true, "browser-conns": true, "client-profiles": true, "max-conn-rate": true,
+	"disable-keepalive": true, "max-conns-per-host": true, "proxy": true, "http": true, "http3": true,
+	"insecure": true, "cert": true, "key": true, "ca": true, "tls-min-version": true, "tls-ciphers": true,
+	"template-engine": true, "data": true, "data-order": true, "jwt-secret": true, "generator-plugin": true,
+	"seed": true, "value-report": true,
+}
+
+// scenarioFlagHints point rejected flags to their counterpart in the
+// scenario file.
+var scenarioFlagHints = map[string]string{
+	"n":                `set "iterations" in the scenario`,
+	"c":                `set "concurrency" in the scenario`,
+	"auto-concurrency": `set "concurrency" in the scenario`,
+	"url":              `set "base_url" and the steps' "url" in the scenario`,
+	"method":           `set "method" on the steps`,
+	"header":           `set "headers" on the steps`,
+	"body":             `set "body" on the steps`,
+	"label":            `set "label" on the steps instead`,
 }
 
-// LoadScenario reads and validates a scenario JSON file, parsing all templates.
-func LoadScenario(path string) (*Scenario, error) {
+// LoadScenario reads and validates a scenario JSON file, parsing all
+// templates with tc.
+func LoadScenario(path string, tc *templateContext) (*Scenario, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading scenario file: %w", err)
@@ -66,9 +115,6 @@ func LoadScenario(path string) (*Scenario, error) {
 	}
 
 	// Validate steps and parse templates.
-	validMethods := map[string]bool{
-		"GET": true, "POST": true, "PUT": true, "DELETE": true, "PATCH": true,
-	}
 	seenNames := make(map[string]bool)
 
 	for i := range s.Steps {
@@ -82,49 +128,77 @@ func LoadScenario(path string) (*Scenario, error) {
 		}
 		seenNames[step.Name] = true
 
-		step.Method = strings.ToUpper(step.Method)
 		if step.Method == "" {
 			return nil, fmt.Errorf("step %d (%s): method is required", i+1, step.Name)
 		}
-		if !validMethods[step.Method] {
-			return nil, fmt.Errorf("step %d (%s): invalid method %q", i+1, step.Name, step.Method)
+		// A method with placeholders, such as one extracted by an earlier
+		// step, is upper-cased and checked once rendered.
+		if strings.Contains(step.Method, "{{") {
+			step.methodTemplate, err = tc.ParseTemplate(step.Method)
+			if err != nil {
+				return nil, fmt.Errorf("step %d (%s) method: %w", i+1, step.Name, err)
+			}
+		} else {
+			step.Method = strings.ToUpper(step.Method)
+			if !validMethod(step.Method) {
+				return nil, fmt.Errorf("step %d (%s): invalid method %q", i+1, step.Name, step.Method)
+			}
 		}
 		if step.URL == "" {
 			return nil, fmt.Errorf("step %d (%s): URL is required", i+1, step.Name)
 		}
 
 		// Parse URL template.
-		step.urlTemplate, err = ParseTemplate(step.URL)
+		step.urlTemplate, err = tc.ParseTemplate(step.URL)
 		if err != nil {
 			return nil, fmt.Errorf("step %d (%s) URL: %w", i+1, step.Name, err)
 		}
 
 		// Parse body template.
 		if step.Body != "" {
-			step.bodyTemplate, err = ParseTemplate(step.Body)
+			step.bodyTemplate, err = tc.ParseTemplate(step.Body)
 			if err != nil {
 				return nil, fmt.Errorf("step %d (%s) body: %w", i+1, step.Name, err)
 			}
 		}
 
-		// Parse header value templates.
-		if len(step.Headers) > 0 {
-			step.headerTemplates = make(map[string]*Template, len(step.Headers))
-			for k, v := range step.Headers {
-				tmpl, err := ParseTemplate(v)
-				if err != nil {
-					return nil, fmt.Errorf("step %d (%s) header %q: %w", i+1, step.Name, k, err)
-				}
-				step.headerTemplates[k] = tmpl
+		// Parse header name and value templates.
+		names := make([]string, 0, len(step.Headers))
+		for k := range step.Headers {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			name, err := tc.ParseTemplate(k)
+			if err != nil {
+				return nil, fmt.Errorf("step %d (%s) header name %q: %w", i+1, step.Name, k, err)
+			}
+			value, err := tc.ParseTemplate(step.Headers[k])
+			if err != nil {
+				return nil, fmt.Errorf("step %d (%s) header %q: %w", i+1, step.Name, k, err)
+			}
+			step.headerTemplates = append(step.headerTemplates, headerTemplate{name: name, value: value})
+		}
+
+		// Parse extraction rules.
+		step.extractors = make(map[string]*extractor, len(step.Extract))
+		for varName, rule := range step.Extract {
+			if step.extractors[varName], err = parseExtractor(rule); err != nil {
+				return nil, fmt.Errorf("step %d (%s) extract %q: %w", i+1, step.Name, varName, err)
 			}
 		}
 	}
 
+	if err := resolveDependencies(&s); err != nil {
+		return nil, err
+	}
+
 	return &s, nil
 }
 
-// extractJSONPath extracts a value from JSON data using a dot-separated path.
-// Uses json.Decoder with UseNumber() to preserve numeric formatting.
+// extractJSONPath extracts a value from JSON data using a dot-separated path,
+// in which numeric segments index arrays (e.g. "items.0.id"). Uses
+// json.Decoder with UseNumber() to preserve numeric formatting.
 func extractJSONPath(data []byte, path string) (string, error) {
 	var raw interface{}
 	dec := json.NewDecoder(bytes.NewReader(data))
@@ -137,6 +211,17 @@ func extractJSONPath(data []byte, path string) (string, error) {
 	current := raw
 
 	for i, part := range parts {
+		if arr, ok := current.([]interface{}); ok {
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 {
+				return "", fmt.Errorf("path %q: at %q (segment %d), expected an array index", path, part, i+1)
+			}
+			if idx >= len(arr) {
+				return "", fmt.Errorf("path %q: index %d out of range at segment %d, array has %d elements", path, idx, i+1, len(arr))
+			}
+			current = arr[idx]
+			continue
+		}
 		obj, ok := current.(map[string]interface{})
 		if !ok {
 			return "", fmt.Errorf("path %q: at %q (segment %d), expected object but got %T", path, part, i+1, current)
@@ -174,29 +259,48 @@ func extractJSONPath(data []byte, path string) (string, error) {
 // Each iteration runs all steps sequentially, chaining extracted variables.
 // The requestIndex (iteration index) is shared across all steps in one
 // iteration so that $sequence produces consistent values.
-func RunScenario(ctx context.Context, scenario *Scenario, config *Config, overallStats *Stats, stepStats map[string]*Stats) error {
-	transport := &http.Transport{
-		MaxIdleConns:        scenario.Concurrency + 10,
-		MaxIdleConnsPerHost: scenario.Concurrency + 10,
-		IdleConnTimeout:     30 * time.Second,
-		DisableKeepAlives:   false,
+func RunScenario(ctx context.Context, scenario *Scenario, config *Config, overallStats *Stats, stepStats map[string]*Stats) (err error) {
+	if err := config.StatsD.start(); err != nil {
+		return err
 	}
+	defer config.StatsD.close()
 
+	if err := config.FailureManifest.start(); err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := config.FailureManifest.close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	ctx, monitor := newStopMonitor(ctx, config.Stop)
+	defer monitor.Close()
+
+	// Client-side GC pauses and stalls annotate the latency windows.
+	stopPauses := startPauseMonitor(overallStats)
+	defer stopPauses()
+
+	transport := newTransport(config, scenario.Concurrency, overallStats)
+	defer transport.CloseIdleConnections()
 	client := &http.Client{
-		Timeout:   config.Timeout,
-		Transport: transport,
+		Timeout:       config.Timeout,
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
 	}
 
 	jobs := make(chan int, scenario.Concurrency*2)
 
 	var wg sync.WaitGroup
+	overallStats.setWorkers(scenario.Concurrency)
 
 	for i := 0; i < scenario.Concurrency; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
+			rng := newRequestRand(config.Seed)
 			for iterIndex := range jobs {
-				runIteration(ctx, client, scenario, iterIndex, overallStats, stepStats)
+				runIteration(ctx, client, scenario, config, monitor, iterIndex, rng, overallStats, stepStats)
 			}
 		}()
 	}
@@ -208,12 +312,21 @@ func RunScenario(ctx context.Context, scenario *Scenario, config *Config, overal
 		case <-ctx.Done():
 			close(jobs)
 			wg.Wait()
+			// A triggered stop condition is an expected outcome, not an error.
+			if reason := monitor.Reason(); reason != "" {
+				overallStats.MarkStopped(reason)
+				return nil
+			}
 			return ctx.Err()
 		}
 	}
 	close(jobs)
 	wg.Wait()
 
+	if reason := monitor.Reason(); reason != "" {
+		overallStats.MarkStopped(reason)
+	}
+
 	return nil
 }
 
@@ -221,8 +334,9 @@ func RunScenario(ctx context.Context, scenario *Scenario, config *Config, overal
 const maxResponseBody = 1 << 20 // 1 MB
 
 // runIteration executes all steps of a scenario for a single iteration.
-// If any step fails (transport error or non-2xx), remaining steps are skipped.
-func runIteration(ctx context.Context, client *http.Client, scenario *Scenario, iterIndex int, overallStats *Stats, stepStats map[string]*Stats) {
+// If any step fails (transport error or non-2xx), remaining steps are skipped;
+// in a dependency graph, only the steps depending on it are.
+func runIteration(ctx context.Context, client *http.Client, scenario *Scenario, config *Config, monitor *stopMonitor, iterIndex int, rng *requestRand, overallStats *Stats, stepStats map[string]*Stats) {
 	vars := map[string]string{
 		"base_url": scenario.BaseURL,
 	}
@@ -232,6 +346,11 @@ func runIteration(ctx context.Context, client *http.Client, scenario *Scenario,
 		}
 	}
 
+	if scenario.graph {
+		runGraph(ctx, client, scenario, config, monitor, iterIndex, rng, vars, overallStats, stepStats)
+		return
+	}
+
 	var failed bool
 
 	for i := range scenario.Steps {
@@ -244,93 +363,181 @@ func runIteration(ctx context.Context, client *http.Client, scenario *Scenario,
 
 		// If a previous step failed, record skip for remaining steps.
 		if failed {
-			result := RequestResult{
-				Error: fmt.Errorf("skipped: previous step failed"),
-			}
-			overallStats.Record(result)
-			if ss, ok := stepStats[step.Name]; ok {
-				ss.Record(result)
-			}
+			recordSkip(step, fmt.Errorf("skipped: previous step failed"), overallStats, stepStats)
 			continue
 		}
 
-		result := executeStep(ctx, client, step, iterIndex, vars)
+		overallStats.RequestStarted()
+		result := executeStep(ctx, client, step, config, iterIndex, rng.at(stepRandIndex(scenario, iterIndex, i)), vars)
+		overallStats.RequestDone()
+		failed = !recordStep(ctx, step, config, monitor, result, overallStats, stepStats)
+	}
+}
 
-		overallStats.Record(result)
-		if ss, ok := stepStats[step.Name]; ok {
-			ss.Record(result)
-		}
+// recordStep records the result of a step on the overall and per-step
+// stats, StatsD and the failure manifest, feeds it to the stop monitor and honors its Retry-After
+// delay. It reports whether the step succeeded (no transport error and a
+// 2xx status).
+func recordStep(ctx context.Context, step *ScenarioStep, config *Config, monitor *stopMonitor, result RequestResult, overallStats *Stats, stepStats map[string]*Stats) bool {
+	if result.Method == "" {
+		result.Method = step.Method
+	}
+	result.Label = step.Label
+	result.StatusFailed = result.Error == nil && config.FailOn.contains(result.StatusCode)
 
-		if result.Error != nil || (result.StatusCode < 200 || result.StatusCode >= 300) {
-			failed = true
-			if result.Error == nil {
-				// Non-2xx is a logical failure — record it as an error too.
-				errResult := RequestResult{
-					StatusCode:    result.StatusCode,
-					Duration:      result.Duration,
-					ContentLength: result.ContentLength,
-					Error:         fmt.Errorf("step %q: HTTP %d", step.Name, result.StatusCode),
-				}
-				// Re-record with error for the overall stats error list.
-				// The status code was already recorded above, so just add the error info.
-				_ = errResult // error is already visible from the non-2xx status code
-			}
-		}
+	overallStats.Record(result)
+	if ss, ok := stepStats[step.Name]; ok {
+		ss.Record(result)
+	}
+	config.StatsD.Record(result)
+	config.FailureManifest.Add(result, time.Now(), 0)
+	monitor.Observe(result)
+	if config.HonorRetryAfter {
+		honorRetryAfter(ctx, result, config.RetryAfterMax, overallStats)
+	}
+
+	// A non-2xx status is a logical failure; it is already visible in the
+	// status code distribution.
+	return result.Error == nil && result.StatusCode >= 200 && result.StatusCode < 300
+}
+
+// recordSkip records a step that was not run because an earlier step failed.
+func recordSkip(step *ScenarioStep, reason error, overallStats *Stats, stepStats map[string]*Stats) {
+	result := RequestResult{
+		Method:  step.Method,
+		Label:   step.Label,
+		Error:   reason,
+		Skipped: true,
+	}
+	overallStats.Record(result)
+	if ss, ok := stepStats[step.Name]; ok {
+		ss.Record(result)
 	}
 }
 
 // executeStep runs a single scenario step, rendering templates, making the
 // HTTP request, and extracting variables from the response.
-func executeStep(ctx context.Context, client *http.Client, step *ScenarioStep, iterIndex int, vars map[string]string) RequestResult {
+func executeStep(ctx context.Context, client *http.Client, step *ScenarioStep, config *Config, iterIndex int, rng *mathrand.Rand, vars map[string]string) RequestResult {
+	var generated *[]generatedValue
+	if config.FailureManifest != nil || config.ValueReport || step.tagged() {
+		generated = new([]generatedValue)
+	}
+
+	method := step.Method
+	if step.methodTemplate != nil {
+		method = strings.ToUpper(step.methodTemplate.RenderRecording(iterIndex, rng, vars, generated))
+		if !validMethod(method) {
+			return RequestResult{Method: method, Error: fmt.Errorf("step %q: rendered method %q is not a valid HTTP method", step.Name, method)}
+		}
+	}
+
 	// Render URL.
-	targetURL := step.urlTemplate.RenderWithVars(iterIndex, vars)
+	targetURL := step.urlTemplate.RenderRecording(iterIndex, rng, vars, generated)
 
 	// Render body.
 	var body io.Reader
+	var renderedBody string
 	if step.bodyTemplate != nil {
-		renderedBody := step.bodyTemplate.RenderWithVars(iterIndex, vars)
+		renderedBody = step.bodyTemplate.RenderRecording(iterIndex, rng, vars, generated)
 		body = bytes.NewBufferString(renderedBody)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, step.Method, targetURL, body)
+	req, err := http.NewRequestWithContext(ctx, method, targetURL, body)
 	if err != nil {
-		return RequestResult{Error: fmt.Errorf("step %q: creating request: %w", step.Name, err)}
+		return RequestResult{Method: method, Error: fmt.Errorf("step %q: creating request: %w", step.Name, err)}
 	}
 
 	// Render and set headers.
-	for key, tmpl := range step.headerTemplates {
-		req.Header.Set(key, tmpl.RenderWithVars(iterIndex, vars))
+	for _, h := range step.headerTemplates {
+		req.Header.Set(h.name.RenderRecording(iterIndex, rng, vars, generated), h.value.RenderRecording(iterIndex, rng, vars, generated))
+	}
+	// Like the "users" entry, the client profile follows the iteration, so
+	// every step of a user's session presents the same client.
+	req = config.ClientProfiles.forUser(iterIndex).apply(req)
+	if config.BrowserMode {
+		applyBrowserHeaders(req)
 	}
 
+	// The variables are captured before the response's extracted values
+	// are added to them.
+	var sent *sentRequest
+	if config.FailureManifest != nil {
+		sent = newSentRequest(iterIndex, req, renderedBody, *generated)
+		sent.Step = step.Name
+		sent.Vars = maps.Clone(vars)
+	}
+
+	req, redirects := withRedirectLog(req)
 	start := time.Now()
-	resp, err := client.Do(req)
+	result := sendStep(client, step, config, req, vars)
+	redirects.attribute(&result, start)
+	result.Method = method
+	result.Sent = sent
+	if generated != nil {
+		result.Tags = tagsOf(*generated)
+	}
+	if config.ValueReport {
+		result.Values = *generated
+	}
+	result.RequestBytes = requestWireSize(req, renderedBody)
+	return result
+}
+
+// stepRandIndex is the index the random source of step i of iteration
+// iterIndex is seeded with, so that every step of every iteration draws
+// values of its own, whether or not the steps before it ran.
+func stepRandIndex(scenario *Scenario, iterIndex, i int) int {
+	return iterIndex*len(scenario.Steps) + i
+}
+
+// sendStep sends a prepared step request and, on success, extracts the
+// step's variables from the response into vars.
+func sendStep(client *http.Client, step *ScenarioStep, config *Config, req *http.Request, vars map[string]string) RequestResult {
+	var trace phaseTrace
+	start := time.Now()
+	resp, err := client.Do(trace.attach(req))
 	duration := time.Since(start)
 
 	if err != nil {
+		phase, err := trace.timeout(err, false)
 		return RequestResult{
-			Duration: duration,
-			Error:    fmt.Errorf("step %q: %w", step.Name, err),
+			Duration:  duration,
+			Error:     fmt.Errorf("step %q: %w", step.Name, err),
+			Timeout:   phase,
+			ConnError: trace.connError(err),
+			Phases:    trace.clock.timings(start, time.Time{}),
 		}
 	}
 	defer resp.Body.Close()
 
 	// If we need to extract variables, read the body; otherwise discard.
 	var contentLength int64
+	var bodyMatched bool
 	if len(step.Extract) > 0 {
 		bodyData, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
 		if err != nil {
+			phase, err := trace.timeout(err, true)
+			if phase == "" {
+				err = fmt.Errorf("reading response: %w", err)
+			}
 			return RequestResult{
 				StatusCode: resp.StatusCode,
 				Duration:   duration,
-				Error:      fmt.Errorf("step %q: reading response: %w", step.Name, err),
+				Error:      fmt.Errorf("step %q: %w", step.Name, err),
+				Timeout:    phase,
+				ConnError:  trace.connError(err),
+				Phases:     trace.clock.timings(start, time.Time{}),
 			}
 		}
 		contentLength = int64(len(bodyData))
+		if config.Stop.BodyContains != "" {
+			bodyMatched = bytes.Contains(bodyData, []byte(config.Stop.BodyContains))
+		}
 
 		// Only extract if status is 2xx.
 		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			for varName, jsonPath := range step.Extract {
-				val, err := extractJSONPath(bodyData, jsonPath)
+			for varName, e := range step.extractors {
+				val, err := e.extract(resp.Header, bodyData)
 				if err != nil {
 					return RequestResult{
 						StatusCode:    resp.StatusCode,
@@ -343,12 +550,26 @@ func executeStep(ctx context.Context, client *http.Client, step *ScenarioStep, i
 			}
 		}
 	} else {
-		contentLength, err = io.Copy(io.Discard, resp.Body)
+		var sink io.Writer = io.Discard
+		var matcher *substringWriter
+		if config.Stop.BodyContains != "" {
+			matcher = newSubstringWriter(config.Stop.BodyContains)
+			sink = matcher
+		}
+		contentLength, err = io.Copy(sink, resp.Body)
+		bodyMatched = matcher != nil && matcher.found
 		if err != nil {
+			phase, err := trace.timeout(err, true)
+			if phase == "" {
+				err = fmt.Errorf("reading response: %w", err)
+			}
 			return RequestResult{
 				StatusCode: resp.StatusCode,
 				Duration:   duration,
-				Error:      fmt.Errorf("step %q: reading response: %w", step.Name, err),
+				Error:      fmt.Errorf("step %q: %w", step.Name, err),
+				Timeout:    phase,
+				ConnError:  trace.connError(err),
+				Phases:     trace.clock.timings(start, time.Time{}),
 			}
 		}
 	}
@@ -357,5 +578,14 @@ func executeStep(ctx context.Context, client *http.Client, step *ScenarioStep, i
 		StatusCode:    resp.StatusCode,
 		Duration:      duration,
 		ContentLength: contentLength,
+		HeaderBytes:   responseHeaderSize(resp),
+		LengthUnknown: resp.ContentLength < 0,
+		BodyMatched:   bodyMatched,
+		RetryAfter:    retryAfterFromResponse(resp),
+		RateLimit:     rateLimitFromResponse(resp),
+		Phases:        trace.clock.timings(start, time.Now()),
+		Proto:         resp.Proto,
+		ContentType:   contentTypeOf(resp.Header.Get("Content-Type"), contentLength),
+		Conn:          trace.connKind(),
 	}
 }
@@ -0,0 +1,83 @@
+// seed.go implements the random sources of workers and seeded runs
+// (-seed). Every worker renders and picks its requests with a source of
+// its own rather than the shared one of math/rand, whose lock would
+// otherwise serialize rendering across workers. With -seed the source is
+// reseeded for every request from the seed and the request index, so that
+// a request gets the same payload in every run with the same seed,
+// whichever worker sends it and whatever -c is.
+package main
+
+import (
+	mathrand "math/rand"
+)
+
+// splitmixGamma is the increment of the splitmix64 sequence.
+const splitmixGamma = 0x9e3779b97f4a7c15
+
+// splitmixSource is a math/rand source producing the splitmix64 sequence.
+// Unlike the default source, which fills a table of 607 values, it is
+// cheap enough to reseed for every request.
+type splitmixSource struct {
+	state uint64
+}
+
+func (s *splitmixSource) Uint64() uint64 {
+	v := splitmix64(s.state)
+	s.state += splitmixGamma
+	return v
+}
+
+func (s *splitmixSource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+func (s *splitmixSource) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+// requestRand is the random source of a worker. It is not safe for
+// concurrent use.
+type requestRand struct {
+	rand   *mathrand.Rand
+	src    splitmixSource
+	seed   uint64 // Scrambled -seed
+	seeded bool
+}
+
+// newRequestRand returns a source for a worker of a run with seed, 0 for
+// an unseeded run, whose workers draw from streams picked at random. Only
+// picking the stream takes the lock of the shared source.
+func newRequestRand(seed int64) *requestRand {
+	r := &requestRand{seed: splitmix64(uint64(seed)), seeded: seed != 0}
+	if !r.seeded {
+		r.src.state = mathrand.Uint64()
+	}
+	r.rand = mathrand.New(&r.src)
+	return r
+}
+
+// at returns the source to render and pick request index with. Seeded, it
+// starts the request's own stream; unseeded, it goes on with the worker's.
+func (r *requestRand) at(index int) *mathrand.Rand {
+	if r.seeded {
+		r.src.state = r.seed ^ splitmix64(uint64(index))
+	}
+	return r.rand
+}
+
+// fork returns a new source with the seed of r, or, unseeded, a stream
+// picked by r, for work r cannot be shared with.
+func (r *requestRand) fork() *requestRand {
+	f := &requestRand{seed: r.seed, seeded: r.seeded}
+	if !f.seeded {
+		f.src.state = r.rand.Uint64()
+	}
+	f.rand = mathrand.New(&f.src)
+	return f
+}
+
+// scratchRand returns an unseeded source for renders outside of a run,
+// such as the one that checks a Go template when it is parsed.
+func scratchRand() *mathrand.Rand {
+	return newRequestRand(0).rand
+}
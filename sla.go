@@ -0,0 +1,165 @@
+// sla.go implements latency SLA buckets (-sla): named latency ranges such
+// as fast <100ms, ok <300ms and slow for everything above, with the share
+// of requests falling into each. Buckets can be declared for the whole run
+// and every label at once, or for one label on its own.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SLABucket is one latency range of an SLA.
+type SLABucket struct {
+	Name  string
+	Below time.Duration // Upper bound (exclusive), 0 for the last, open-ended bucket
+}
+
+// SLA is a set of latency buckets, in increasing order of their bounds.
+type SLA struct {
+	Label   string // Label the buckets apply to, "" for the whole run and every other label
+	Buckets []SLABucket
+}
+
+// SLAReport is the share of requests in each bucket of an SLA.
+type SLAReport struct {
+	Label   string // "" for the whole run
+	Total   int
+	Buckets []SLAShare
+}
+
+// SLAShare is the number and percentage of requests in one bucket.
+type SLAShare struct {
+	SLABucket
+	Count   int
+	Percent float64
+}
+
+// parseSLA parses an -sla value: comma-separated buckets NAME<DURATION in
+// increasing order, ending with an open-ended bucket NAME or
+// NAME>=DURATION, optionally preceded by LABEL= to apply to one label
+// only, e.g. "checkout=fast<100ms,ok<300ms,slow".
+func parseSLA(s string) (SLA, error) {
+	var sla SLA
+	spec := s
+	if i := strings.IndexByte(spec, '='); i >= 0 && !strings.ContainsAny(spec[:i], "<>,") {
+		sla.Label, spec = strings.TrimSpace(spec[:i]), spec[i+1:]
+		if sla.Label == "" {
+			return SLA{}, fmt.Errorf("invalid -sla %q: empty label", s)
+		}
+	}
+
+	parts := strings.Split(spec, ",")
+	if len(parts) < 2 {
+		return SLA{}, fmt.Errorf("invalid -sla %q: at least two buckets are required, e.g. fast<100ms,slow", s)
+	}
+	var last time.Duration
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if i == len(parts)-1 {
+			// The last bucket takes everything from the previous bound on;
+			// a bound written out must match it.
+			name := part
+			if j := strings.Index(part, ">="); j >= 0 {
+				name = part[:j]
+				d, err := time.ParseDuration(part[j+2:])
+				if err != nil || d != last {
+					return SLA{}, fmt.Errorf("invalid -sla %q: last bucket %q must start at %s", s, part, last)
+				}
+			}
+			if name == "" {
+				return SLA{}, fmt.Errorf("invalid -sla %q: bucket name is required", s)
+			}
+			sla.Buckets = append(sla.Buckets, SLABucket{Name: name})
+			break
+		}
+
+		j := strings.IndexByte(part, '<')
+		if j <= 0 {
+			return SLA{}, fmt.Errorf("invalid -sla %q: expected NAME<DURATION, got %q", s, part)
+		}
+		d, err := time.ParseDuration(part[j+1:])
+		if err != nil || d <= last {
+			return SLA{}, fmt.Errorf("invalid -sla %q: bucket %q needs a duration above the previous bound", s, part)
+		}
+		sla.Buckets = append(sla.Buckets, SLABucket{Name: part[:j], Below: d})
+		last = d
+	}
+	return sla, nil
+}
+
+// bucketize counts the latencies into the SLA's buckets. A histogram
+// bucket straddling a bound counts on the side of its middle.
+func (sla SLA) bucketize(label string, latencies *hdrHistogram) SLAReport {
+	r := SLAReport{Label: label, Total: latencies.count(), Buckets: make([]SLAShare, len(sla.Buckets))}
+	for i, b := range sla.Buckets {
+		r.Buckets[i].SLABucket = b
+	}
+	open := len(sla.Buckets) - 1
+	latencies.each(func(d time.Duration, count int) {
+		i := 0
+		for i < open && d >= sla.Buckets[i].Below {
+			i++
+		}
+		r.Buckets[i].Count += count
+	})
+	if r.Total > 0 {
+		for i := range r.Buckets {
+			r.Buckets[i].Percent = float64(r.Buckets[i].Count) / float64(r.Total) * 100
+		}
+	}
+	return r
+}
+
+// rangeFrom formats the bucket's range, e.g. "<100ms", "100ms-300ms" or
+// ">=300ms", given the bound of the bucket before it.
+func (b SLABucket) rangeFrom(prev time.Duration) string {
+	switch {
+	case b.Below == 0:
+		return ">=" + formatDuration(prev)
+	case prev == 0:
+		return "<" + formatDuration(b.Below)
+	}
+	return formatDuration(prev) + "-" + formatDuration(b.Below)
+}
+
+// slaReports computes the SLA reports of a run: one for the whole run under
+// the default SLA, then one per label in label order, under the label's
+// own SLA or else the default. latencies are those of the whole run.
+func slaReports(slas []SLA, latencies *hdrHistogram, byLabel map[string]*groupStats) []SLAReport {
+	if len(slas) == 0 {
+		return nil
+	}
+	perLabel := make(map[string]SLA)
+	var def *SLA
+	for i, sla := range slas {
+		if sla.Label == "" {
+			def = &slas[i]
+			continue
+		}
+		perLabel[sla.Label] = sla
+	}
+
+	var reports []SLAReport
+	if def != nil {
+		reports = append(reports, def.bucketize("", latencies))
+	}
+	labels := make([]string, 0, len(byLabel))
+	for label := range byLabel {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		sla, ok := perLabel[label]
+		if !ok {
+			if def == nil {
+				continue
+			}
+			sla = *def
+		}
+		reports = append(reports, sla.bucketize(label, &byLabel[label].latencies))
+	}
+	return reports
+}
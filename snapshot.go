@@ -0,0 +1,656 @@
+// snapshot.go defines StatsSnapshot, a serializable copy of the raw data
+// held by Stats. Snapshots can be sent between processes and merged into
+// another Stats, which is how a distributed controller combines the results
+// of its agents into one Summary with exact percentiles.
+package main
+
+import "time"
+
+// StatsSnapshot is a mergeable, JSON-serializable copy of a Stats' raw data.
+type StatsSnapshot struct {
+	TotalRequests  int                             `json:"total_requests"`
+	TotalErrors    int                             `json:"total_errors"`
+	SuccessCount   int                             `json:"success_count"`
+	FailCount      int                             `json:"fail_count"`
+	Failed5xx      int                             `json:"failed_5xx,omitempty"`
+	Cancelled      int                             `json:"cancelled"`
+	StatusCodes    map[int]int                     `json:"status_codes"`
+	Latencies      hdrSnapshot                     `json:"latencies"`
+	TotalDuration  time.Duration                   `json:"total_duration"`
+	Timed          int                             `json:"timed"`
+	MinDuration    time.Duration                   `json:"min_duration"`
+	MaxDuration    time.Duration                   `json:"max_duration"`
+	TotalBytes     int64                           `json:"total_bytes"`
+	BytesSent      int64                           `json:"bytes_sent"`
+	HeaderBytes    int64                           `json:"header_bytes"`
+	LengthUnknown  int                             `json:"length_unknown"`
+	Errors         []string                        `json:"errors"`
+	Timeouts       map[string]int                  `json:"timeouts,omitempty"`
+	Protocols      map[string]int                  `json:"protocols,omitempty"`
+	ContentTypes   map[string]mediaTypeCounts      `json:"content_types,omitempty"`
+	ConnErrors     map[string]int                  `json:"conn_errors,omitempty"`
+	AssertFailures map[string]int                  `json:"assert_failures,omitempty"`
+	StopReason     string                          `json:"stop_reason,omitempty"`
+	Throttled      int                             `json:"throttled"`
+	ThrottledTime  time.Duration                   `json:"throttled_time"`
+	ByMethod       map[string]groupSnapshot        `json:"by_method"`
+	ByLabel        map[string]groupSnapshot        `json:"by_label,omitempty"`
+	ByConn         map[string]groupSnapshot        `json:"by_conn,omitempty"`
+	ByTag          map[string]groupSnapshot        `json:"by_tag,omitempty"`
+	Values         map[string]valueCounts          `json:"values,omitempty"`
+	Sent           int                             `json:"sent,omitempty"`
+	Dropped        int                             `json:"dropped,omitempty"`
+	SkippedSteps   int                             `json:"skipped_steps,omitempty"`
+	Attribution    *attributionSnapshot            `json:"attribution,omitempty"`
+	Stream         streamSnapshot                  `json:"stream"`
+	Dials          map[string][]time.Duration      `json:"dials"`
+	DialFallbacks  int                             `json:"dial_fallbacks"`
+	Phases         map[string]durationHistSnapshot `json:"phases,omitempty"`
+	ConnWaits      int                             `json:"conn_waits,omitempty"`
+	ConnWaitTime   time.Duration                   `json:"conn_wait_time,omitempty"`
+	Windows        map[int64]latencyWindow         `json:"windows"` // Keyed by window start in Unix ns
+	RateLimits     map[int64]rateLimitWindow       `json:"rate_limits,omitempty"`
+	TimeSeries     map[int64]timeBucket            `json:"timeseries,omitempty"` // Keyed by interval start in Unix ns
+	GCPauses       []time.Duration                 `json:"gc_pauses"`
+	Stalls         []time.Duration                 `json:"stalls"`
+	Chaos          map[string]ChaosCounts          `json:"chaos,omitempty"`
+	Retries        retryCounts                     `json:"retries"`
+	Bounded        *boundedSnapshot                `json:"bounded,omitempty"` // Dial histograms of bounded stats
+}
+
+// groupSnapshot is the serializable form of groupStats.
+type groupSnapshot struct {
+	Requests      int           `json:"requests"`
+	Errors        int           `json:"errors"`
+	ServerErrors  int           `json:"server_errors"`
+	TotalDuration time.Duration `json:"total_duration"`
+	Latencies     hdrSnapshot   `json:"latencies"`
+}
+
+// snapshotGroups returns deep copies of groups.
+func snapshotGroups(groups map[string]*groupStats) map[string]groupSnapshot {
+	snap := make(map[string]groupSnapshot, len(groups))
+	for name, g := range groups {
+		snap[name] = groupSnapshot{
+			Requests:      g.requests,
+			Errors:        g.errors,
+			ServerErrors:  g.serverErrors,
+			TotalDuration: g.totalDuration,
+			Latencies:     g.latencies.snapshot(),
+		}
+	}
+	return snap
+}
+
+// mergeGroups adds the groups of a snapshot to groups.
+func mergeGroups(groups map[string]*groupStats, snap map[string]groupSnapshot) {
+	for name, gs := range snap {
+		g, ok := groups[name]
+		if !ok {
+			g = &groupStats{}
+			groups[name] = g
+		}
+		g.requests += gs.Requests
+		g.errors += gs.Errors
+		g.serverErrors += gs.ServerErrors
+		g.totalDuration += gs.TotalDuration
+		g.latencies.merge(gs.Latencies)
+	}
+}
+
+// deltaGroups returns what groups gained since the counters in prev and
+// advances prev, along with marks, the latency counts of each group
+// already returned.
+func deltaGroups(groups map[string]*groupStats, prev map[string]groupSnapshot, marks map[string][]int64) map[string]groupSnapshot {
+	d := make(map[string]groupSnapshot)
+	for name, g := range groups {
+		pg := prev[name]
+		if g.requests == pg.Requests {
+			continue
+		}
+		d[name] = groupSnapshot{
+			Requests:      g.requests - pg.Requests,
+			Errors:        g.errors - pg.Errors,
+			ServerErrors:  g.serverErrors - pg.ServerErrors,
+			TotalDuration: g.totalDuration - pg.TotalDuration,
+		}
+		mark := marks[name]
+		gd := d[name]
+		gd.Latencies = g.latencies.delta(&mark)
+		d[name] = gd
+		marks[name] = mark
+		prev[name] = groupSnapshot{Requests: g.requests, Errors: g.errors, ServerErrors: g.serverErrors, TotalDuration: g.totalDuration}
+	}
+	return d
+}
+
+// streamSnapshot is the serializable form of streamStats.
+type streamSnapshot struct {
+	Requests   int                  `json:"requests"`
+	Chunks     int                  `json:"chunks"`
+	FirstChunk durationHistSnapshot `json:"first_chunk"`
+	Gaps       durationHistSnapshot `json:"gaps"`
+	Total      durationHistSnapshot `json:"total"`
+}
+
+// Snapshot returns a deep copy of the raw statistics. It is safe for
+// concurrent use.
+func (s *Stats) Snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := StatsSnapshot{
+		TotalRequests:  s.totalRequests,
+		TotalErrors:    s.totalErrors,
+		SuccessCount:   s.successCount,
+		FailCount:      s.failCount,
+		Failed5xx:      s.failed5xx,
+		Cancelled:      s.cancelled,
+		Retries:        s.retries,
+		StatusCodes:    make(map[int]int, len(s.statusCodes)),
+		Latencies:      s.latencies.snapshot(),
+		TotalDuration:  s.totalDuration,
+		Timed:          s.timed,
+		MinDuration:    s.minDuration,
+		MaxDuration:    s.maxDuration,
+		TotalBytes:     s.totalBytes,
+		BytesSent:      s.bytesSent,
+		HeaderBytes:    s.headerBytes,
+		LengthUnknown:  s.lengthUnknown,
+		Errors:         append([]string(nil), s.errors...),
+		Timeouts:       copyCounts(s.timeouts),
+		Protocols:      copyCounts(s.protocols),
+		ConnErrors:     copyCounts(s.connErrors),
+		AssertFailures: copyCounts(s.assertFailures),
+		StopReason:     s.stopReason,
+		Throttled:      s.throttled,
+		ThrottledTime:  s.throttledTime,
+		ByMethod:       snapshotGroups(s.byMethod),
+		ByLabel:        snapshotGroups(s.byLabel),
+		ByConn:         snapshotGroups(s.byConn),
+		ByTag:          snapshotGroups(s.byTag),
+		Values:         snapshotValues(s.values),
+		Sent:           int(s.sent.Load()),
+		Dropped:        int(s.dropped.Load()),
+		SkippedSteps:   s.skippedSteps,
+		Attribution:    s.attribution.snapshot(),
+		Stream: streamSnapshot{
+			Requests:   s.stream.requests,
+			Chunks:     s.stream.chunks,
+			FirstChunk: s.stream.firstChunk.delta(&histMark{}),
+			Gaps:       s.stream.gaps.delta(&histMark{}),
+			Total:      s.stream.total.delta(&histMark{}),
+		},
+		Dials:         make(map[string][]time.Duration, len(s.dials)),
+		DialFallbacks: s.dialFallbacks,
+		ConnWaits:     s.connWaits,
+		ConnWaitTime:  s.connWaitTime,
+		Windows:       make(map[int64]latencyWindow, len(s.windows)),
+		GCPauses:      append([]time.Duration(nil), s.gcPauses...),
+		Stalls:        append([]time.Duration(nil), s.stalls...),
+	}
+
+	for start, w := range s.windows {
+		snap.Windows[start] = *w
+	}
+	if len(s.rateLimits) > 0 {
+		snap.RateLimits = make(map[int64]rateLimitWindow, len(s.rateLimits))
+		for start, w := range s.rateLimits {
+			snap.RateLimits[start] = *w
+		}
+	}
+	if len(s.series) > 0 {
+		snap.TimeSeries = make(map[int64]timeBucket, len(s.series))
+		for start, b := range s.series {
+			snap.TimeSeries[start] = b.clone()
+		}
+	}
+	if len(s.contentTypes) > 0 {
+		snap.ContentTypes = make(map[string]mediaTypeCounts, len(s.contentTypes))
+		for ct, c := range s.contentTypes {
+			snap.ContentTypes[ct] = c
+		}
+	}
+	if len(s.chaos) > 0 {
+		snap.Chaos = make(map[string]ChaosCounts, len(s.chaos))
+		for kind, c := range s.chaos {
+			var cp ChaosCounts
+			cp.merge(*c)
+			snap.Chaos[kind] = cp
+		}
+	}
+	for code, count := range s.statusCodes {
+		snap.StatusCodes[code] = count
+	}
+	for family, durations := range s.dials {
+		snap.Dials[family] = append([]time.Duration(nil), durations...)
+	}
+	for phase, h := range s.phases {
+		if snap.Phases == nil {
+			snap.Phases = make(map[string]durationHistSnapshot, len(s.phases))
+		}
+		snap.Phases[phase] = h.delta(&histMark{})
+	}
+	snap.Bounded = s.bounded.snapshot()
+
+	return snap
+}
+
+// Merge adds the data of snap to s, as if every request recorded in snap
+// had been recorded on s directly. It is safe for concurrent use.
+func (s *Stats) Merge(snap StatsSnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.totalRequests += snap.TotalRequests
+	s.totalErrors += snap.TotalErrors
+	s.successCount += snap.SuccessCount
+	s.failCount += snap.FailCount
+	s.liveCompleted.Add(int64(snap.TotalRequests))
+	s.liveErrors.Add(int64(snap.FailCount))
+	s.sent.Add(int64(snap.Sent))
+	s.dropped.Add(int64(snap.Dropped))
+	s.skippedSteps += snap.SkippedSteps
+	s.attribution.merge(snap.Attribution)
+	s.failed5xx += snap.Failed5xx
+	s.cancelled += snap.Cancelled
+	s.retries.merge(snap.Retries)
+	for code, count := range snap.StatusCodes {
+		s.statusCodes[code] += count
+	}
+	s.latencies.merge(snap.Latencies)
+	s.live.add(time.Now(), snap.TotalRequests, snap.Latencies)
+	s.totalDuration += snap.TotalDuration
+	s.timed += snap.Timed
+	if snap.TotalRequests > 0 && snap.MinDuration < s.minDuration {
+		s.minDuration = snap.MinDuration
+	}
+	if snap.MaxDuration > s.maxDuration {
+		s.maxDuration = snap.MaxDuration
+	}
+	s.totalBytes += snap.TotalBytes
+	s.bytesSent += snap.BytesSent
+	s.headerBytes += snap.HeaderBytes
+	s.lengthUnknown += snap.LengthUnknown
+	for _, e := range snap.Errors {
+		if len(s.errors) >= maxRecordedErrors {
+			break
+		}
+		s.errors = append(s.errors, e)
+	}
+	if len(snap.Timeouts) > 0 && s.timeouts == nil {
+		s.timeouts = make(map[string]int)
+	}
+	for phase, n := range snap.Timeouts {
+		s.timeouts[phase] += n
+	}
+	if len(snap.Protocols) > 0 && s.protocols == nil {
+		s.protocols = make(map[string]int)
+	}
+	for proto, n := range snap.Protocols {
+		s.protocols[proto] += n
+	}
+	if len(snap.ContentTypes) > 0 && s.contentTypes == nil {
+		s.contentTypes = make(map[string]mediaTypeCounts)
+	}
+	for ct, c := range snap.ContentTypes {
+		recordContentType(s.contentTypes, ct, c)
+	}
+	if len(snap.ConnErrors) > 0 && s.connErrors == nil {
+		s.connErrors = make(map[string]int)
+	}
+	for kind, n := range snap.ConnErrors {
+		s.connErrors[kind] += n
+	}
+	if len(snap.AssertFailures) > 0 && s.assertFailures == nil {
+		s.assertFailures = make(map[string]int)
+	}
+	for reason, n := range snap.AssertFailures {
+		s.assertFailures[reason] += n
+	}
+	if s.stopReason == "" {
+		s.stopReason = snap.StopReason
+	}
+	s.throttled += snap.Throttled
+	s.throttledTime += snap.ThrottledTime
+
+	mergeGroups(s.byMethod, snap.ByMethod)
+	mergeGroups(s.byLabel, snap.ByLabel)
+	mergeGroups(s.byConn, snap.ByConn)
+	mergeGroups(s.byTag, snap.ByTag)
+	mergeValues(s.values, snap.Values)
+
+	s.stream.requests += snap.Stream.Requests
+	s.stream.chunks += snap.Stream.Chunks
+
+	// Histograms cannot be turned back into raw samples, so bounded stats
+	// merged into unbounded ones bound them.
+	if snap.Bounded != nil {
+		s.bound()
+	}
+	s.stream.firstChunk.merge(snap.Stream.FirstChunk)
+	s.stream.gaps.merge(snap.Stream.Gaps)
+	s.stream.total.merge(snap.Stream.Total)
+	if s.bounded != nil {
+		s.bounded.addRaw(snap.Dials)
+		s.bounded.merge(snap.Bounded)
+	} else {
+		if len(snap.Dials) > 0 && s.dials == nil {
+			s.dials = make(map[string][]time.Duration)
+		}
+		for family, durations := range snap.Dials {
+			s.dials[family] = append(s.dials[family], durations...)
+		}
+	}
+	if len(snap.Phases) > 0 && s.phases == nil {
+		s.phases = make(map[string]*durationHist)
+	}
+	for phase, hs := range snap.Phases {
+		histOf(s.phases, phase).merge(hs)
+	}
+	s.dialFallbacks += snap.DialFallbacks
+	s.connWaits += snap.ConnWaits
+	s.connWaitTime += snap.ConnWaitTime
+
+	for start, sw := range snap.Windows {
+		w, ok := s.windows[start]
+		if !ok {
+			w = &latencyWindow{}
+			s.windows[start] = w
+		}
+		w.merge(sw)
+	}
+	if len(snap.RateLimits) > 0 && s.rateLimits == nil {
+		s.rateLimits = make(map[int64]*rateLimitWindow)
+	}
+	for start, sw := range snap.RateLimits {
+		w, ok := s.rateLimits[start]
+		if !ok {
+			w = newRateLimitWindow()
+			s.rateLimits[start] = w
+		}
+		w.merge(sw)
+	}
+	if len(snap.TimeSeries) > 0 && s.series == nil {
+		s.series = make(map[int64]*timeBucket)
+	}
+	for start, sb := range snap.TimeSeries {
+		b, ok := s.series[start]
+		if !ok {
+			b = &timeBucket{}
+			s.series[start] = b
+		}
+		b.merge(sb)
+	}
+	s.gcPauses = append(s.gcPauses, snap.GCPauses...)
+	s.stalls = append(s.stalls, snap.Stalls...)
+
+	if len(snap.Chaos) > 0 && s.chaos == nil {
+		s.chaos = make(map[string]*ChaosCounts)
+	}
+	for kind, sc := range snap.Chaos {
+		c, ok := s.chaos[kind]
+		if !ok {
+			c = &ChaosCounts{}
+			s.chaos[kind] = c
+		}
+		c.merge(sc)
+	}
+}
+
+// statsMark remembers how much of a Stats has already been returned by
+// Delta. The zero value marks the beginning of a run.
+type statsMark struct {
+	counts          StatsSnapshot // Cumulative counters; slice fields are unused
+	latencies       []int64       // Latency histogram counts at the mark
+	errors          int
+	stopReason      bool
+	methodLatencies map[string][]int64
+	labelLatencies  map[string][]int64
+	connLatencies   map[string][]int64
+	tagLatencies    map[string][]int64
+	firstChunk      histMark
+	gaps            histMark
+	streamTotal     histMark
+	dials           map[string]int
+	phases          map[string]*histMark
+	bounded         boundedMark
+	windows         map[int64]latencyWindow   // Request count and pause per window at the mark
+	rateLimits      map[int64]rateLimitWindow // Sample and throttled counts per window at the mark
+	series          map[int64]timeBucket      // Time-series buckets at the mark
+	gcPauses        int
+	stalls          int
+	attribution     attributionMark
+}
+
+// Delta returns the data recorded since m was last advanced and advances
+// m, so that merging every delta in order is equivalent to merging one
+// Snapshot. Raw data in Stats is append-only and latency histogram counts
+// only grow, which lets a delta carry just what was added since the mark.
+// It is safe for concurrent use.
+func (s *Stats) Delta(m *statsMark) StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := &m.counts
+	d := StatsSnapshot{
+		TotalRequests: s.totalRequests - prev.TotalRequests,
+		TotalErrors:   s.totalErrors - prev.TotalErrors,
+		SuccessCount:  s.successCount - prev.SuccessCount,
+		FailCount:     s.failCount - prev.FailCount,
+		Failed5xx:     s.failed5xx - prev.Failed5xx,
+		Cancelled:     s.cancelled - prev.Cancelled,
+		Sent:          int(s.sent.Load()) - prev.Sent,
+		Dropped:       int(s.dropped.Load()) - prev.Dropped,
+		SkippedSteps:  s.skippedSteps - prev.SkippedSteps,
+		Attribution:   s.attribution.delta(&m.attribution),
+		Retries:       s.retries.sub(prev.Retries),
+		StatusCodes:   make(map[int]int),
+		Latencies:     s.latencies.delta(&m.latencies),
+		TotalDuration: s.totalDuration - prev.TotalDuration,
+		Timed:         s.timed - prev.Timed,
+		TotalBytes:    s.totalBytes - prev.TotalBytes,
+		BytesSent:     s.bytesSent - prev.BytesSent,
+		HeaderBytes:   s.headerBytes - prev.HeaderBytes,
+		LengthUnknown: s.lengthUnknown - prev.LengthUnknown,
+		Errors:        append([]string(nil), s.errors[m.errors:]...),
+		Throttled:     s.throttled - prev.Throttled,
+		ThrottledTime: s.throttledTime - prev.ThrottledTime,
+		Stream: streamSnapshot{
+			Requests:   s.stream.requests - prev.Stream.Requests,
+			Chunks:     s.stream.chunks - prev.Stream.Chunks,
+			FirstChunk: s.stream.firstChunk.delta(&m.firstChunk),
+			Gaps:       s.stream.gaps.delta(&m.gaps),
+			Total:      s.stream.total.delta(&m.streamTotal),
+		},
+		Dials:         make(map[string][]time.Duration),
+		DialFallbacks: s.dialFallbacks - prev.DialFallbacks,
+		ConnWaits:     s.connWaits - prev.ConnWaits,
+		ConnWaitTime:  s.connWaitTime - prev.ConnWaitTime,
+		Windows:       make(map[int64]latencyWindow),
+		GCPauses:      append([]time.Duration(nil), s.gcPauses[m.gcPauses:]...),
+		Stalls:        append([]time.Duration(nil), s.stalls[m.stalls:]...),
+	}
+
+	// The latency extremes merge idempotently, so a delta carries the
+	// current ones.
+	d.MinDuration, d.MaxDuration = s.minDuration, s.maxDuration
+	if s.stopReason != "" && !m.stopReason {
+		d.StopReason = s.stopReason
+		m.stopReason = true
+	}
+
+	if prev.StatusCodes == nil {
+		prev.StatusCodes = make(map[int]int)
+		prev.ByMethod = make(map[string]groupSnapshot)
+		prev.ByLabel = make(map[string]groupSnapshot)
+		prev.ByConn = make(map[string]groupSnapshot)
+		prev.ByTag = make(map[string]groupSnapshot)
+		prev.Values = make(map[string]valueCounts)
+		prev.Timeouts = make(map[string]int)
+		prev.Protocols = make(map[string]int)
+		prev.ContentTypes = make(map[string]mediaTypeCounts)
+		prev.ConnErrors = make(map[string]int)
+		prev.AssertFailures = make(map[string]int)
+		m.methodLatencies = make(map[string][]int64)
+		m.labelLatencies = make(map[string][]int64)
+		m.connLatencies = make(map[string][]int64)
+		m.tagLatencies = make(map[string][]int64)
+		m.dials = make(map[string]int)
+		m.phases = make(map[string]*histMark)
+		m.windows = make(map[int64]latencyWindow)
+		m.rateLimits = make(map[int64]rateLimitWindow)
+		m.series = make(map[int64]timeBucket)
+		prev.Chaos = make(map[string]ChaosCounts)
+	}
+	for code, count := range s.statusCodes {
+		if diff := count - prev.StatusCodes[code]; diff > 0 {
+			d.StatusCodes[code] = diff
+			prev.StatusCodes[code] = count
+		}
+	}
+	for phase, n := range s.timeouts {
+		if diff := n - prev.Timeouts[phase]; diff > 0 {
+			if d.Timeouts == nil {
+				d.Timeouts = make(map[string]int)
+			}
+			d.Timeouts[phase] = diff
+			prev.Timeouts[phase] = n
+		}
+	}
+	for proto, n := range s.protocols {
+		if diff := n - prev.Protocols[proto]; diff > 0 {
+			if d.Protocols == nil {
+				d.Protocols = make(map[string]int)
+			}
+			d.Protocols[proto] = diff
+			prev.Protocols[proto] = n
+		}
+	}
+	for ct, c := range s.contentTypes {
+		if diff := c.sub(prev.ContentTypes[ct]); diff.Responses > 0 {
+			if d.ContentTypes == nil {
+				d.ContentTypes = make(map[string]mediaTypeCounts)
+			}
+			d.ContentTypes[ct] = diff
+			prev.ContentTypes[ct] = c
+		}
+	}
+	for kind, n := range s.connErrors {
+		if diff := n - prev.ConnErrors[kind]; diff > 0 {
+			if d.ConnErrors == nil {
+				d.ConnErrors = make(map[string]int)
+			}
+			d.ConnErrors[kind] = diff
+			prev.ConnErrors[kind] = n
+		}
+	}
+	for reason, n := range s.assertFailures {
+		if diff := n - prev.AssertFailures[reason]; diff > 0 {
+			if d.AssertFailures == nil {
+				d.AssertFailures = make(map[string]int)
+			}
+			d.AssertFailures[reason] = diff
+			prev.AssertFailures[reason] = n
+		}
+	}
+	d.ByMethod = deltaGroups(s.byMethod, prev.ByMethod, m.methodLatencies)
+	d.ByLabel = deltaGroups(s.byLabel, prev.ByLabel, m.labelLatencies)
+	d.ByConn = deltaGroups(s.byConn, prev.ByConn, m.connLatencies)
+	d.ByTag = deltaGroups(s.byTag, prev.ByTag, m.tagLatencies)
+	d.Values = deltaValues(s.values, prev.Values)
+	for family, durations := range s.dials {
+		if n := m.dials[family]; n < len(durations) {
+			d.Dials[family] = append([]time.Duration(nil), durations[n:]...)
+			m.dials[family] = len(durations)
+		}
+	}
+	d.Phases = deltaHists(s.phases, m.phases)
+	d.Bounded = s.bounded.delta(&m.bounded)
+
+	// Windows are not append-only, but their min, max and pause merge
+	// idempotently, so a delta carries the current extremes of every
+	// window that changed along with the number of requests it gained.
+	for start, w := range s.windows {
+		if mw := m.windows[start]; mw.Count < w.Count || mw.Pause < w.Pause {
+			d.Windows[start] = latencyWindow{Count: w.Count - mw.Count, Min: w.Min, Max: w.Max, Pause: w.Pause}
+			m.windows[start] = latencyWindow{Count: w.Count, Pause: w.Pause}
+		}
+	}
+	for start, w := range s.rateLimits {
+		mw := m.rateLimits[start]
+		if mw.Samples == w.Samples && mw.Throttled == w.Throttled {
+			continue
+		}
+		if d.RateLimits == nil {
+			d.RateLimits = make(map[int64]rateLimitWindow)
+		}
+		dw := *w
+		dw.Samples -= mw.Samples
+		dw.Throttled -= mw.Throttled
+		d.RateLimits[start] = dw
+		m.rateLimits[start] = rateLimitWindow{Samples: w.Samples, Throttled: w.Throttled}
+	}
+
+	// Time-series buckets only grow, like the latency histogram.
+	for start, b := range s.series {
+		mb := m.series[start]
+		if mb.Requests == b.Requests {
+			continue
+		}
+		if d.TimeSeries == nil {
+			d.TimeSeries = make(map[int64]timeBucket)
+		}
+		d.TimeSeries[start] = b.since(mb)
+		m.series[start] = b.clone()
+	}
+
+	for kind, c := range s.chaos {
+		pc := prev.Chaos[kind]
+		if c.Sent == pc.Sent {
+			continue
+		}
+		if d.Chaos == nil {
+			d.Chaos = make(map[string]ChaosCounts)
+		}
+		d.Chaos[kind] = c.sub(pc)
+		var cp ChaosCounts
+		cp.merge(*c)
+		prev.Chaos[kind] = cp
+	}
+
+	prev.TotalRequests = s.totalRequests
+	prev.TotalErrors = s.totalErrors
+	prev.SuccessCount = s.successCount
+	prev.FailCount = s.failCount
+	prev.Failed5xx = s.failed5xx
+	prev.Cancelled = s.cancelled
+	prev.Sent = int(s.sent.Load())
+	prev.Dropped = int(s.dropped.Load())
+	prev.SkippedSteps = s.skippedSteps
+	prev.Retries = s.retries
+	prev.TotalDuration = s.totalDuration
+	prev.Timed = s.timed
+	prev.TotalBytes = s.totalBytes
+	prev.BytesSent = s.bytesSent
+	prev.HeaderBytes = s.headerBytes
+	prev.LengthUnknown = s.lengthUnknown
+	prev.Throttled = s.throttled
+	prev.ThrottledTime = s.throttledTime
+	prev.Stream.Requests = s.stream.requests
+	prev.Stream.Chunks = s.stream.chunks
+	prev.DialFallbacks = s.dialFallbacks
+	prev.ConnWaits = s.connWaits
+	prev.ConnWaitTime = s.connWaitTime
+	m.errors = len(s.errors)
+	m.gcPauses = len(s.gcPauses)
+	m.stalls = len(s.stalls)
+
+	return d
+}
+
+// empty reports whether snap carries no data.
+func (snap StatsSnapshot) empty() bool {
+	return snap.TotalRequests == 0 && snap.ThrottledTime == 0 && len(snap.Dials) == 0 && snap.StopReason == "" &&
+		len(snap.Windows) == 0 && len(snap.GCPauses) == 0 && len(snap.Stalls) == 0 && snap.Bounded == nil
+}
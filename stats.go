@@ -4,30 +4,175 @@
 package main
 
 import (
+	"fmt"
 	"math"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// maxRecordedErrors is the number of distinct error messages kept for the
+// summary; further errors are only counted.
+const maxRecordedErrors = 10
+
 // Stats collects and aggregates metrics from every request in a load test.
 // All fields are protected by a mutex so that concurrent workers can safely
 // record results without data races.
 type Stats struct {
-	mu            sync.Mutex
-	totalRequests int
-	totalErrors   int
-	successCount  int
-	failCount     int
-	statusCodes   map[int]int
-	durations     []time.Duration
+	mu             sync.Mutex
+	totalRequests  int
+	totalErrors    int
+	successCount   int
+	failCount      int
+	failed5xx      int                     // 5xx responses counted in failCount by -fail-on-* or -assert-*
+	cancelled      int                     // Requests aborted by -cancel-rate injection
+	chaos          map[string]*ChaosCounts // Malformed request outcomes by kind, nil unless -chaos is used
+	retries        retryCounts
+	statusCodes    map[int]int
+	latencies      hdrHistogram
+	totalDuration  time.Duration
+	timed          int // Results totalDuration counts: neither chaos nor cancelled requests
+	minDuration    time.Duration
+	maxDuration    time.Duration
+	totalBytes     int64
+	bytesSent      int64
+	headerBytes    int64
+	lengthUnknown  int
+	errors         []string
+	timeouts       map[string]int // Timed-out requests by phase
+	protocols      map[string]int // Responses by protocol
+	contentTypes   map[string]mediaTypeCounts
+	connErrors     map[string]int // Failed requests by connection error kind
+	assertFailures map[string]int // Responses that failed an -assert-* check, by reason
+	startTime      time.Time
+	numRequests    int
+	stopReason     string
+	throttled      int
+	throttledTime  time.Duration
+	byMethod       map[string]*groupStats
+	byLabel        map[string]*groupStats // Labeled requests by label
+	byStage        map[string]*groupStats // Requests by load profile stage
+	byConn         map[string]*groupStats // Responses by connection kind (connNew, connReused)
+	byTag          map[string]*groupStats // Requests by {{$label}} tag, "NAME=value"
+	profile        *Profile               // Load profile whose stages are reported, nil if none
+	patterned      bool                   // The run follows a -pattern, so numRequests is an estimate
+	sla            []SLA                  // Latency buckets to report
+	stream         streamStats
+	dials          map[string][]time.Duration // address family -> dial times
+	dialFallbacks  int
+	phases         map[string]*durationHist // request phase -> time spent in it
+	connWaits      int                      // Dials delayed by -max-conn-rate
+	connWaitTime   time.Duration            // Total delay of those dials
+	pctMethod      PercentileMethod
+	percentiles    []float64                  // Percentiles to report, nil for defaultPercentiles
+	minSamples     int                        // Samples beyond a percentile below which it is low-confidence
+	histogram      int                        // Latency histogram buckets, 0 for none
+	targetRate     float64                    // Requested -rate, 0 if unlimited
+	windowSize     time.Duration              // Width of latency windows
+	spikeLimit     time.Duration              // Latency above which a window counts as a spike, 0 = unset
+	windows        map[int64]*latencyWindow   // Window start (Unix ns) -> latency extremes
+	rateLimits     map[int64]*rateLimitWindow // Window start (Unix ns) -> rate-limit headers seen
+	seriesSize     time.Duration              // Time-series interval, 0 for no time series
+	series         map[int64]*timeBucket      // Interval start (Unix ns) -> requests completed within
+	gcPauses       []time.Duration            // Client GC pauses
+	stalls         []time.Duration            // Client scheduling stalls
+
+	// bounded, set under -max-memory, takes the dial timings in
+	// histograms; the raw sample fields above stay empty.
+	bounded *boundedStats
+
+	// values counts what random placeholders rendered to, by placeholder
+	// as written, under -value-report.
+	values map[string]*valueCounts
+
+	// Live figures of the progress line. The counters mirror totalRequests
+	// and failCount, and like the gauges can be read without s.mu, so that
+	// the progress monitor does not hold up Record; it only takes s.mu to
+	// refresh the moving figures once every liveRefresh.
+	live          liveWindow
+	liveCompleted atomic.Int64
+	liveErrors    atomic.Int64
+	inFlight      atomic.Int64 // Requests between RequestStarted and RequestDone
+	workers       atomic.Int64 // Workers of the run, 0 if not tracked
+
+	// Request accounting: requests started and queued requests dropped,
+	// counted as they happen, and results recorded for skipped steps.
+	sent         atomic.Int64
+	dropped      atomic.Int64
+	skippedSteps int
+
+	attribution latencyAttribution // Attempt and request latencies (attribution.go)
+
+	liveMu   sync.Mutex    // Guards sources and moving
+	sources  []*Stats      // Stats whose in-flight requests s reports too
+	moving   liveMoving    // Moving figures as last refreshed
+	interval time.Duration // Progress monitor interval, 0 for defaultProgressInterval
+}
+
+// streamStats accumulates chunk timings of streamed responses (-stream mode).
+type streamStats struct {
+	requests   int
+	chunks     int
+	firstChunk durationHist
+	gaps       durationHist // One per chunk after the first
+	total      durationHist
+}
+
+// record adds the chunk timings of a streamed response.
+func (st *streamStats) record(timing *StreamTiming) {
+	st.requests++
+	st.chunks += timing.Chunks
+	if timing.Chunks > 0 {
+		st.firstChunk.record(timing.FirstChunk)
+	}
+	for _, d := range timing.Gaps {
+		st.gaps.record(d)
+	}
+	st.total.record(timing.Total)
+}
+
+// groupStats accumulates the metrics of one slice of a run, such as all
+// requests sent with a particular HTTP method.
+type groupStats struct {
+	requests      int
+	errors        int
+	serverErrors  int // Responses with a 5xx status not counted in errors
 	totalDuration time.Duration
-	minDuration   time.Duration
-	maxDuration   time.Duration
-	totalBytes    int64
-	errors        []string
-	startTime     time.Time
-	numRequests   int
+	latencies     hdrHistogram
+}
+
+// record adds a single result to the group.
+func (g *groupStats) record(result RequestResult) {
+	g.requests++
+	if result.failed() {
+		g.errors++
+	}
+	if result.StatusCode >= 500 && !result.failed() {
+		g.serverErrors++
+	}
+	g.totalDuration += result.Duration
+	g.latencies.record(result.Duration)
+}
+
+// summary computes the group's GroupSummary, using method m for percentiles.
+func (g *groupStats) summary(m PercentileMethod) GroupSummary {
+	gs := GroupSummary{
+		Requests:     g.requests,
+		Errors:       g.errors,
+		ServerErrors: g.serverErrors,
+		P50:          g.latencies.percentile(m, 50),
+		P90:          g.latencies.percentile(m, 90),
+		P95:          g.latencies.percentile(m, 95),
+		P99:          g.latencies.percentile(m, 99),
+	}
+	if g.requests > 0 {
+		gs.ErrorRate = float64(g.errors) / float64(g.requests) * 100
+		gs.AvgDuration = g.totalDuration / time.Duration(g.requests)
+	}
+	return gs
 }
 
 // NewStats creates and initializes a Stats instance for a test expecting
@@ -36,10 +181,17 @@ type Stats struct {
 func NewStats(numRequests int) *Stats {
 	return &Stats{
 		statusCodes: make(map[int]int),
-		durations:   make([]time.Duration, 0, numRequests),
+		byMethod:    make(map[string]*groupStats),
+		byLabel:     make(map[string]*groupStats),
+		byStage:     make(map[string]*groupStats),
+		byConn:      make(map[string]*groupStats),
+		byTag:       make(map[string]*groupStats),
+		values:      make(map[string]*valueCounts),
 		minDuration: time.Duration(math.MaxInt64),
 		startTime:   time.Now(),
 		numRequests: numRequests,
+		windowSize:  defaultSpikeWindow,
+		windows:     make(map[int64]*latencyWindow),
 	}
 }
 
@@ -50,19 +202,97 @@ func (s *Stats) Record(result RequestResult) {
 	defer s.mu.Unlock()
 
 	s.totalRequests++
+	s.liveCompleted.Add(1)
+	if result.Skipped {
+		s.skippedSteps++
+	}
+	live := s.live.slot(time.Now())
+	live.requests++
+
+	// Malformed chaos requests are tallied on their own.
+	if result.Chaos != "" {
+		if s.chaos == nil {
+			s.chaos = make(map[string]*ChaosCounts)
+		}
+		c, ok := s.chaos[result.Chaos]
+		if !ok {
+			c = &ChaosCounts{}
+			s.chaos[result.Chaos] = c
+		}
+		c.add(result)
+		s.bytesSent += result.RequestBytes
+		return
+	}
+
+	s.retries.add(result)
+
+	// Injected cancellations are intentional; keep them out of the error
+	// and latency figures.
+	if result.Cancelled {
+		s.cancelled++
+		s.bytesSent += result.RequestBytes
+		return
+	}
 
 	if result.Error != nil {
 		s.failCount++
+		s.liveErrors.Add(1)
 		s.totalErrors++
-		if len(s.errors) < 10 {
+		if result.Timeout != "" {
+			if s.timeouts == nil {
+				s.timeouts = make(map[string]int)
+			}
+			s.timeouts[result.Timeout]++
+		}
+		if result.ConnError != "" {
+			if s.connErrors == nil {
+				s.connErrors = make(map[string]int)
+			}
+			s.connErrors[result.ConnError]++
+		}
+		if len(s.errors) < maxRecordedErrors {
 			s.errors = append(s.errors, result.Error.Error())
 		}
 	} else {
-		s.successCount++
+		if result.StatusFailed || result.Assertion != "" {
+			s.failCount++
+			s.liveErrors.Add(1)
+			if result.StatusCode >= 500 {
+				s.failed5xx++
+			}
+		} else {
+			s.successCount++
+		}
+		if result.Assertion != "" {
+			if s.assertFailures == nil {
+				s.assertFailures = make(map[string]int)
+			}
+			s.assertFailures[result.Assertion]++
+		}
 		s.statusCodes[result.StatusCode]++
+		if result.Proto != "" {
+			if s.protocols == nil {
+				s.protocols = make(map[string]int)
+			}
+			s.protocols[result.Proto]++
+		}
+		if result.ContentType != "" {
+			if s.contentTypes == nil {
+				s.contentTypes = make(map[string]mediaTypeCounts)
+			}
+			recordContentType(s.contentTypes, result.ContentType, mediaTypeCounts{1, result.ContentLength, result.Duration})
+		}
+		throttled := isThrottleStatus(result.StatusCode)
+		if throttled {
+			s.throttled++
+		}
+		if throttled || result.RateLimit != nil {
+			s.recordRateLimit(time.Now(), result.RateLimit, throttled)
+		}
 	}
 
 	s.totalDuration += result.Duration
+	s.timed++
 
 	if result.Duration < s.minDuration {
 		s.minDuration = result.Duration
@@ -71,17 +301,224 @@ func (s *Stats) Record(result RequestResult) {
 		s.maxDuration = result.Duration
 	}
 
-	s.durations = append(s.durations, result.Duration)
+	s.latencies.record(result.Duration)
+	live.latencies.record(result.Duration)
+	if !result.Skipped {
+		s.attribution.record(result)
+	}
+	if len(result.Phases) > 0 && s.phases == nil {
+		s.phases = make(map[string]*durationHist)
+	}
+	for phase, d := range result.Phases {
+		histOf(s.phases, phase).record(d)
+	}
+	s.recordWindow(time.Now(), result.Duration)
+	if s.seriesSize > 0 {
+		s.recordSeries(time.Now(), result)
+	}
 	s.totalBytes += result.ContentLength
+	s.bytesSent += result.RequestBytes
+	s.headerBytes += result.HeaderBytes
+	if result.Error == nil && result.LengthUnknown {
+		s.lengthUnknown++
+	}
+
+	if result.Stream != nil {
+		s.stream.record(result.Stream)
+	}
+
+	if result.Method != "" {
+		g, ok := s.byMethod[result.Method]
+		if !ok {
+			g = &groupStats{}
+			s.byMethod[result.Method] = g
+		}
+		g.record(result)
+	}
+	if result.Label != "" {
+		g, ok := s.byLabel[result.Label]
+		if !ok {
+			g = &groupStats{}
+			s.byLabel[result.Label] = g
+		}
+		g.record(result)
+	}
+	if result.Stage != "" {
+		g, ok := s.byStage[result.Stage]
+		if !ok {
+			g = &groupStats{}
+			s.byStage[result.Stage] = g
+		}
+		g.record(result)
+	}
+	if result.Conn != "" {
+		g, ok := s.byConn[result.Conn]
+		if !ok {
+			g = &groupStats{}
+			s.byConn[result.Conn] = g
+		}
+		g.record(result)
+	}
+	recordValues(s.values, result.Values)
+	for _, tag := range result.Tags {
+		g, ok := s.byTag[tag]
+		if !ok {
+			g = &groupStats{}
+			s.byTag[tag] = g
+		}
+		g.record(result)
+	}
 }
 
 // Progress returns the current completion count, total expected requests,
-// and time elapsed since the test started. It is safe for concurrent use.
+// and time elapsed since the test started. It is safe for concurrent use,
+// and does not wait for requests being recorded.
 func (s *Stats) Progress() (completed int, total int, elapsed time.Duration) {
+	return int(s.liveCompleted.Load()), s.numRequests, time.Since(s.startTime)
+}
+
+// MarkStopped records that the test ended early because a stop condition
+// was met. It is safe for concurrent use.
+func (s *Stats) MarkStopped(reason string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.totalRequests, s.numRequests, time.Since(s.startTime)
+	s.stopReason = reason
+}
+
+// RecordDial records a newly established connection with its address
+// family ("IPv4", "IPv6"), dial time, and whether it looks like a Happy
+// Eyeballs fallback from IPv6 to IPv4. It is safe for concurrent use.
+func (s *Stats) RecordDial(family string, d time.Duration, fallback bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.bounded != nil {
+		histOf(s.bounded.dials, family).record(d)
+	} else {
+		if s.dials == nil {
+			s.dials = make(map[string][]time.Duration)
+		}
+		s.dials[family] = append(s.dials[family], d)
+	}
+	if fallback {
+		s.dialFallbacks++
+	}
+}
+
+// RecordConnWait records that a new connection waited d for the
+// -max-conn-rate limit. It is safe for concurrent use.
+func (s *Stats) RecordConnWait(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connWaits++
+	s.connWaitTime += d
+}
+
+// Configure applies the reporting options of config: the percentile
+// method, the latency window and time-series settings, and the bounded
+// memory of -max-memory. Call it before recording.
+func (s *Stats) Configure(config *Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pctMethod = config.Percentile
+	s.histogram = config.Histogram
+	s.percentiles = config.Percentiles
+	s.minSamples = config.MinSamples
+	s.targetRate = config.Rate
+	s.profile = config.Profile
+	s.patterned = config.Pattern != nil
+	s.sla = config.SLA
+	if config.SpikeWindow > 0 {
+		s.windowSize = config.SpikeWindow
+	}
+	s.spikeLimit = config.SpikeThreshold
+	s.seriesSize = config.TimeSeries
+	s.interval = config.ProgressInterval
+	if config.MaxMemory > 0 {
+		s.bound()
+	}
+}
+
+// RecordClientPause records a pause of the load generator itself: a GC
+// pause (kind pauseGC) or a scheduling stall (pauseStall) of duration d
+// ending at end. The pause is noted on the latency windows it overlaps.
+// It is safe for concurrent use.
+func (s *Stats) RecordClientPause(kind string, end time.Time, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch kind {
+	case pauseGC:
+		s.gcPauses = append(s.gcPauses, d)
+	case pauseStall:
+		s.stalls = append(s.stalls, d)
+	}
+
+	for t := end.Add(-d).Truncate(s.windowSize); !t.After(end); t = t.Add(s.windowSize) {
+		start := t.UnixNano()
+		w, ok := s.windows[start]
+		if !ok {
+			w = &latencyWindow{}
+			s.windows[start] = w
+		}
+		if d > w.Pause {
+			w.Pause = d
+		}
+	}
+}
+
+// recordRateLimit adds the rate-limit headers of a response received at t
+// to the window of t. The caller must hold s.mu.
+func (s *Stats) recordRateLimit(t time.Time, sample *rateLimitSample, throttled bool) {
+	start := t.Truncate(s.windowSize).UnixNano()
+	if s.rateLimits == nil {
+		s.rateLimits = make(map[int64]*rateLimitWindow)
+	}
+	w, ok := s.rateLimits[start]
+	if !ok {
+		w = newRateLimitWindow()
+		s.rateLimits[start] = w
+	}
+	w.add(sample, throttled)
+}
+
+// recordWindow adds a request that completed at t to its latency window.
+// The caller must hold s.mu.
+func (s *Stats) recordWindow(t time.Time, d time.Duration) {
+	start := t.Truncate(s.windowSize).UnixNano()
+	w, ok := s.windows[start]
+	if !ok {
+		w = &latencyWindow{}
+		s.windows[start] = w
+	}
+	w.add(d)
+}
+
+// recordSeries adds a request that completed at t to its time-series
+// interval. The caller must hold s.mu.
+func (s *Stats) recordSeries(t time.Time, result RequestResult) {
+	start := t.Truncate(s.seriesSize).UnixNano()
+	if s.series == nil {
+		s.series = make(map[int64]*timeBucket)
+	}
+	b, ok := s.series[start]
+	if !ok {
+		b = &timeBucket{}
+		s.series[start] = b
+	}
+	b.add(result.Duration, result.failed() || result.StatusCode >= 500)
+}
+
+// RecordThrottlePause adds time a worker spent paused honoring Retry-After.
+// It is safe for concurrent use.
+func (s *Stats) RecordThrottlePause(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.throttledTime += d
 }
 
 // Summary holds the final, fully-computed results of a load test.
@@ -90,6 +527,10 @@ type Summary struct {
 	TotalRequests  int
 	SuccessCount   int
 	FailCount      int
+	Failed5xx      int                    // 5xx responses counted in FailCount by -fail-on-* or -assert-*
+	Cancelled      int                    // Requests aborted by -cancel-rate injection
+	Chaos          map[string]ChaosCounts // Malformed request outcomes by kind, nil unless -chaos is used
+	Retries        retryCounts            // Retries and idempotency key outcomes
 	TotalErrors    int
 	TotalTime      time.Duration
 	AvgDuration    time.Duration
@@ -99,42 +540,166 @@ type Summary struct {
 	P90            time.Duration
 	P95            time.Duration
 	P99            time.Duration
+	Percentiles    []PercentileValue // Latency at each -percentiles percentile, in increasing order
+	Samples        int               // Latencies the percentiles were computed from
+	MinSamples     int               // Samples beyond a percentile below which it is low-confidence, 0 if unchecked
+	Histogram      []HistogramBucket // Latency histogram, nil with -histogram 0
 	RequestsPerSec float64
+	TargetRate     float64 // Requests per second asked for with -rate, 0 if unlimited
 	StatusCodes    map[int]int
-	TotalBytes     int64
+	ContentTypes   map[string]ContentTypeSummary
+	Protocols      map[string]int // Responses by protocol ("HTTP/1.1", "HTTP/2.0")
+	TotalBytes     int64          // Response body bytes received
+	HeaderBytes    int64          // Response status line and header bytes received
+	LengthUnknown  int            // Responses without a Content-Length (e.g. chunked)
+	BytesSent      int64          // Request bytes sent (request line, headers and body)
+	RecvPerSec     float64        // Received bytes (headers and body) per second
+	SentPerSec     float64        // Sent bytes per second
 	Errors         []string
+	Timeouts       map[string]int    // Timed-out requests by phase (timeoutConnect, ...), nil if none timed out
+	ConnErrors     map[string]int    // Failed requests by connection error kind (connErrorReset, ...), nil if none
+	AssertFailures map[string]int    // Responses that failed an -assert-* check by reason, nil if none
+	StopReason     string            // Why the test ended early, empty if it ran to completion
+	Throttled      int               // Responses with status 429 or 503
+	RateLimit      *RateLimitSummary // Rate-limit headers over the run, nil if no response carried any
+	ThrottledTime  time.Duration     // Total time workers paused honoring Retry-After
+	ByMethod       map[string]GroupSummary
+	ByLabel        map[string]GroupSummary // Results per -label or scenario step label, empty if nothing was labeled
+	ByTag          map[string]GroupSummary // Results per {{$label}} tag, keyed "NAME=value", nil if none
+	Stages         []StageSummary          // Results per -profile stage in profile order, nil without a profile
+	SLA            []SLAReport             // Shares of requests per -sla bucket, nil without -sla
+	Stream         *StreamSummary          // Chunk timing distributions, nil outside -stream mode
+	Dials          map[string]LatencyDist  // Dial time per address family ("IPv4", "IPv6")
+	DialFallbacks  int                     // IPv4 connections to dual-stack hosts after the fallback delay
+	ConnReuse      map[string]GroupSummary // Responses on new and reused connections (connNew, connReused), nil if none
+	Phases         map[string]LatencyDist  // Time spent per request phase ("dns", "ttfb", ...), see phases.go
+	ConnWaits      int                     // New connections delayed by -max-conn-rate
+	ConnWaitTime   time.Duration           // Total delay of those connections
+	Percentile     PercentileMethod        // How the percentiles were computed
+	Windows        *WindowSummary          // Latency extremes per time window, nil if nothing was recorded
+	TimeSeries     *TimeSeries             // Results per -timeseries interval, nil without -timeseries
+	ClientPauses   *ClientPauseSummary     // Pauses of the load generator, nil if none were recorded
+	Clock          *ClockOffset            // Client clock offset, nil unless -clock-sync measured it
+	Cleanup        *CleanupReport          // What the run left behind, nil if not checked
+	Repeats        *RepeatSummary          // Spread of the key metrics across -repeat runs, nil for a single run
+	Mirror         *MirrorSummary          // Shadow results of the -mirror-to target, nil without mirroring
+	Probe          *ConcurrencyProbe       // Levels probed by -auto-concurrency, nil without it
+	Thresholds     []ThresholdResult       // Outcome of each -threshold, in order
+	Budgets        []ThresholdResult       // Outcome of each limit of the -budgets file, in order
+
+	// Values is the distribution of each random placeholder's values, keyed
+	// by the placeholder as written, nil without -value-report.
+	Values map[string]ValueDistribution
+
+	// Accounting reconciles sent requests with recorded results, nil for
+	// stats that do not see requests being sent.
+	Accounting *Accounting
+
+	// Attribution holds the attempt and request latencies, nil unless
+	// requests were retried or redirected.
+	Attribution *LatencyAttribution
+}
+
+// LatencyDist is a distribution of durations summarized by average,
+// maximum, and percentiles.
+type LatencyDist struct {
+	Count int
+	Avg   time.Duration
+	Max   time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+}
+
+// newLatencyDist summarizes a slice of durations, using method m for
+// percentiles. The input is not modified.
+func newLatencyDist(durations []time.Duration, m PercentileMethod) LatencyDist {
+	if len(durations) == 0 {
+		return LatencyDist{}
+	}
+
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	return LatencyDist{
+		Count: len(sorted),
+		Avg:   total / time.Duration(len(sorted)),
+		Max:   sorted[len(sorted)-1],
+		P50:   m.percentile(sorted, 50),
+		P90:   m.percentile(sorted, 90),
+		P95:   m.percentile(sorted, 95),
+		P99:   m.percentile(sorted, 99),
+	}
+}
+
+// StreamSummary holds the chunk timing distributions of streamed responses.
+type StreamSummary struct {
+	Requests   int
+	Chunks     int
+	FirstChunk LatencyDist // Time from request start to first chunk
+	Gaps       LatencyDist // Gaps between successive chunks
+	Total      LatencyDist // Total stream duration
+}
+
+// GroupSummary holds the computed metrics for one slice of a run,
+// e.g. all requests sent with one HTTP method.
+type GroupSummary struct {
+	Requests     int
+	Errors       int
+	ServerErrors int     // Responses with a 5xx status not counted in Errors
+	ErrorRate    float64 // Percentage of requests that failed
+	AvgDuration  time.Duration
+	P50          time.Duration
+	P90          time.Duration
+	P95          time.Duration
+	P99          time.Duration
+}
+
+// groupNames returns the names of groups in sorted order.
+func groupNames(groups map[string]GroupSummary) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // GetSummary computes and returns a Summary snapshot of the current statistics.
-// It sorts a copy of the recorded durations to calculate percentile latencies
-// and derives throughput from the wall-clock elapsed time.
+// It reads percentile latencies off the latency histogram and derives
+// throughput from the wall-clock elapsed time.
 func (s *Stats) GetSummary() Summary {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	elapsed := time.Since(s.startTime)
 
-	// Sort a copy of durations so we don't mutate internal state.
-	sorted := make([]time.Duration, len(s.durations))
-	copy(sorted, s.durations)
-	sort.Slice(sorted, func(i, j int) bool {
-		return sorted[i] < sorted[j]
-	})
-
 	// Compute minDuration locally without mutating the field.
 	minDur := s.minDuration
 	if minDur == time.Duration(math.MaxInt64) {
 		minDur = 0
 	}
 
+	// Chaos and cancelled requests have no latency to average.
 	var avgDuration time.Duration
-	if s.totalRequests > 0 {
-		avgDuration = s.totalDuration / time.Duration(s.totalRequests)
+	if s.timed > 0 {
+		avgDuration = s.totalDuration / time.Duration(s.timed)
 	}
 
-	var reqPerSec float64
+	var reqPerSec, recvPerSec, sentPerSec float64
 	if elapsed.Seconds() > 0 {
-		reqPerSec = float64(s.totalRequests) / elapsed.Seconds()
+		reqPerSec = float64(s.totalRequests-s.chaosSent()) / elapsed.Seconds()
+		recvPerSec = float64(s.totalBytes+s.headerBytes) / elapsed.Seconds()
+		sentPerSec = float64(s.bytesSent) / elapsed.Seconds()
 	}
 
 	// Copy the status codes map so the caller cannot mutate internal state.
@@ -143,6 +708,68 @@ func (s *Stats) GetSummary() Summary {
 		codes[k] = v
 	}
 
+	byMethod := make(map[string]GroupSummary, len(s.byMethod))
+	for method, g := range s.byMethod {
+		byMethod[method] = g.summary(s.pctMethod)
+	}
+	byLabel := make(map[string]GroupSummary, len(s.byLabel))
+	for label, g := range s.byLabel {
+		byLabel[label] = g.summary(s.pctMethod)
+	}
+	var byTag map[string]GroupSummary
+	for tag, g := range s.byTag {
+		if byTag == nil {
+			byTag = make(map[string]GroupSummary, len(s.byTag))
+		}
+		byTag[tag] = g.summary(s.pctMethod)
+	}
+	var connReuse map[string]GroupSummary
+	for kind, g := range s.byConn {
+		if connReuse == nil {
+			connReuse = make(map[string]GroupSummary, len(s.byConn))
+		}
+		connReuse[kind] = g.summary(s.pctMethod)
+	}
+
+	// Stages that never started are reported with no requests.
+	var stages []StageSummary
+	if s.profile != nil {
+		for _, stage := range s.profile.Stages {
+			ss := StageSummary{Stage: stage}
+			if g, ok := s.byStage[stage.Name]; ok {
+				ss.GroupSummary = g.summary(s.pctMethod)
+				ss.RequestsPerSec = float64(g.requests) / stage.Duration.Seconds()
+			}
+			stages = append(stages, ss)
+		}
+	}
+
+	var stream *StreamSummary
+	if s.stream.requests > 0 {
+		stream = &StreamSummary{
+			Requests:   s.stream.requests,
+			Chunks:     s.stream.chunks,
+			FirstChunk: s.stream.firstChunk.dist(s.pctMethod),
+			Gaps:       s.stream.gaps.dist(s.pctMethod),
+			Total:      s.stream.total.dist(s.pctMethod),
+		}
+	}
+
+	dials := make(map[string]LatencyDist, len(s.dials))
+	for family, durations := range s.dials {
+		dials[family] = newLatencyDist(durations, s.pctMethod)
+	}
+	var phases map[string]LatencyDist
+	if len(s.phases) > 0 {
+		phases = make(map[string]LatencyDist, len(s.phases))
+		for phase, h := range s.phases {
+			phases[phase] = h.dist(s.pctMethod)
+		}
+	}
+	if s.bounded != nil {
+		dials = s.bounded.summarize(s.pctMethod)
+	}
+
 	// Copy the errors slice for the same reason.
 	errs := make([]string, len(s.errors))
 	copy(errs, s.errors)
@@ -151,24 +778,156 @@ func (s *Stats) GetSummary() Summary {
 		TotalRequests:  s.totalRequests,
 		SuccessCount:   s.successCount,
 		FailCount:      s.failCount,
+		Failed5xx:      s.failed5xx,
+		Cancelled:      s.cancelled,
+		Chaos:          s.chaosSummary(),
+		Retries:        s.retries,
 		TotalErrors:    s.totalErrors,
 		TotalTime:      elapsed,
 		AvgDuration:    avgDuration,
 		MinDuration:    minDur,
 		MaxDuration:    s.maxDuration,
-		P50:            percentile(sorted, 50),
-		P90:            percentile(sorted, 90),
-		P95:            percentile(sorted, 95),
-		P99:            percentile(sorted, 99),
+		P50:            s.latencies.percentile(s.pctMethod, 50),
+		P90:            s.latencies.percentile(s.pctMethod, 90),
+		P95:            s.latencies.percentile(s.pctMethod, 95),
+		P99:            s.latencies.percentile(s.pctMethod, 99),
+		Percentiles:    s.percentileValues(),
+		Samples:        s.latencies.count(),
+		MinSamples:     s.minSamples,
+		Histogram:      latencyHistogram(&s.latencies, s.histogram),
 		RequestsPerSec: reqPerSec,
+		TargetRate:     s.targetRate,
 		StatusCodes:    codes,
 		TotalBytes:     s.totalBytes,
+		HeaderBytes:    s.headerBytes,
+		LengthUnknown:  s.lengthUnknown,
+		BytesSent:      s.bytesSent,
+		RecvPerSec:     recvPerSec,
+		SentPerSec:     sentPerSec,
 		Errors:         errs,
+		Timeouts:       copyCounts(s.timeouts),
+		Protocols:      copyCounts(s.protocols),
+		ContentTypes:   summarizeContentTypes(s.contentTypes),
+		ConnErrors:     copyCounts(s.connErrors),
+		AssertFailures: copyCounts(s.assertFailures),
+		StopReason:     s.stopReason,
+		Throttled:      s.throttled,
+		ThrottledTime:  s.throttledTime,
+		ByMethod:       byMethod,
+		ByLabel:        byLabel,
+		ByTag:          byTag,
+		Values:         valueDistributions(s.values),
+		Accounting:     s.accounting(),
+		Attribution:    s.attribution.summarize(s.pctMethod, s.retries.Retried),
+		Stages:         stages,
+		SLA:            slaReports(s.sla, &s.latencies, s.byLabel),
+		Stream:         stream,
+		Dials:          dials,
+		DialFallbacks:  s.dialFallbacks,
+		ConnReuse:      connReuse,
+		Phases:         phases,
+		ConnWaits:      s.connWaits,
+		ConnWaitTime:   s.connWaitTime,
+		Percentile:     s.pctMethod,
+		Windows:        summarizeWindows(s.windows, s.windowSize, s.spikeLimit),
+		RateLimit:      summarizeRateLimits(s.rateLimits, s.windowSize),
+		TimeSeries:     summarizeTimeSeries(s.series, s.seriesSize, s.pctMethod, s.startTime, s.startTime.Add(elapsed)),
+	}
+
+	if len(s.gcPauses) > 0 || len(s.stalls) > 0 {
+		summary.ClientPauses = &ClientPauseSummary{
+			GC:     newLatencyDist(s.gcPauses, s.pctMethod),
+			Stalls: newLatencyDist(s.stalls, s.pctMethod),
+		}
+		for _, d := range s.gcPauses {
+			summary.ClientPauses.GCTotal += d
+		}
 	}
 
 	return summary
 }
 
+// PercentileMethod selects how percentiles are computed from the recorded
+// samples.
+type PercentileMethod int
+
+const (
+	// PercentileNearestRank picks the smallest sample with at least pct% of
+	// samples at or below it. Results are observed values (to the latency
+	// histogram's precision), but jump between neighbouring samples, which
+	// is noticeable on small runs.
+	PercentileNearestRank PercentileMethod = iota
+	// PercentileLinear interpolates linearly between the two closest ranks,
+	// as NumPy's default method and spreadsheet PERCENTILE.INC do.
+	PercentileLinear
+)
+
+// defaultPercentiles are the percentiles reported without -percentiles.
+var defaultPercentiles = []float64{50, 90, 95, 99}
+
+// PercentileValue is the latency at one of the reported percentiles.
+type PercentileValue struct {
+	Percentile float64
+	Value      time.Duration
+}
+
+// parsePercentiles parses the -percentiles flag value, a comma-separated
+// list such as "50,90,99,99.9".
+func parsePercentiles(s string) ([]float64, error) {
+	var pcts []float64
+	for _, part := range strings.Split(s, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid -percentiles value %q: each percentile must be a number in (0, 100]", s)
+		}
+		pcts = append(pcts, p)
+	}
+	sort.Float64s(pcts)
+	return pcts, nil
+}
+
+// percentileValues computes the reported percentiles. The caller must hold
+// s.mu.
+func (s *Stats) percentileValues() []PercentileValue {
+	pcts := s.percentiles
+	if pcts == nil {
+		pcts = defaultPercentiles
+	}
+	values := make([]PercentileValue, len(pcts))
+	for i, p := range pcts {
+		values[i] = PercentileValue{Percentile: p, Value: s.latencies.percentile(s.pctMethod, p)}
+	}
+	return values
+}
+
+// parsePercentileMethod parses the -percentile flag value.
+func parsePercentileMethod(s string) (PercentileMethod, error) {
+	switch s {
+	case "nearest-rank":
+		return PercentileNearestRank, nil
+	case "linear":
+		return PercentileLinear, nil
+	}
+	return 0, fmt.Errorf("invalid percentile method %q, expected 'nearest-rank' or 'linear'", s)
+}
+
+// String returns the flag spelling of m.
+func (m PercentileMethod) String() string {
+	if m == PercentileLinear {
+		return "linear"
+	}
+	return "nearest-rank"
+}
+
+// percentile returns the value at the given percentile from a sorted slice
+// of durations using method m. If the slice is empty it returns zero.
+func (m PercentileMethod) percentile(sorted []time.Duration, pct float64) time.Duration {
+	if m == PercentileLinear {
+		return linearPercentile(sorted, pct)
+	}
+	return percentile(sorted, pct)
+}
+
 // percentile returns the value at the given percentile from a sorted slice
 // of durations using the nearest-rank method. If the slice is empty it returns zero.
 func percentile(sorted []time.Duration, pct float64) time.Duration {
@@ -184,3 +943,58 @@ func percentile(sorted []time.Duration, pct float64) time.Duration {
 	}
 	return sorted[rank]
 }
+
+// linearPercentile returns the value at the given percentile from a sorted
+// slice of durations, interpolating linearly between the closest ranks. If
+// the slice is empty it returns zero.
+func linearPercentile(sorted []time.Duration, pct float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := pct / 100 * float64(len(sorted)-1)
+	if pos <= 0 {
+		return sorted[0]
+	}
+	lo := int(math.Floor(pos))
+	if lo >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	frac := pos - float64(lo)
+	return sorted[lo] + time.Duration(math.Round(frac*float64(sorted[lo+1]-sorted[lo])))
+}
+
+// chaosSent returns the number of chaos requests recorded. Call with s.mu
+// held.
+func (s *Stats) chaosSent() int {
+	n := 0
+	for _, c := range s.chaos {
+		n += c.Sent
+	}
+	return n
+}
+
+// chaosSummary copies the chaos request counts. Call with s.mu held.
+func (s *Stats) chaosSummary() map[string]ChaosCounts {
+	if len(s.chaos) == 0 {
+		return nil
+	}
+	out := make(map[string]ChaosCounts, len(s.chaos))
+	for kind, c := range s.chaos {
+		var cp ChaosCounts
+		cp.merge(*c)
+		out[kind] = cp
+	}
+	return out
+}
+
+// copyCounts returns a copy of counts, nil if it is empty.
+func copyCounts(counts map[string]int) map[string]int {
+	if len(counts) == 0 {
+		return nil
+	}
+	cp := make(map[string]int, len(counts))
+	for k, n := range counts {
+		cp[k] = n
+	}
+	return cp
+}
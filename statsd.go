@@ -0,0 +1,198 @@
+// statsd.go implements per-request StatsD emission (-statsd HOST:PORT):
+// while a test runs, every request is sent to a StatsD or DogStatsD server
+// over UDP as a latency timer and a counter, tagged with its method,
+// status, label and stage, so results show up next to the target's own
+// metrics in existing dashboards. Lines are batched into packets by a
+// background goroutine; when the server or network cannot keep up, lines
+// are dropped rather than slowing the test down.
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxStatsDPacket keeps packets below the usual Ethernet MTU.
+	maxStatsDPacket = 1400
+	// statsdQueue is the number of lines queued for the sender.
+	statsdQueue = 8192
+	// statsdFlushInterval bounds how long a line waits for its packet.
+	statsdFlushInterval = 100 * time.Millisecond
+)
+
+// StatsD sends per-request metrics to a StatsD server. A nil *StatsD
+// sends nothing.
+type StatsD struct {
+	addr    string
+	conn    net.Conn
+	lines   chan string
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+// newStatsD validates addr; the socket is opened by start.
+func newStatsD(addr string) (*StatsD, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid -statsd %q, expected HOST:PORT such as 127.0.0.1:8125", addr)
+	}
+	return &StatsD{addr: addr}, nil
+}
+
+// start opens the socket and starts the sender.
+func (s *StatsD) start() error {
+	if s == nil {
+		return nil
+	}
+	conn, err := net.Dial("udp", s.addr)
+	if err != nil {
+		return fmt.Errorf("statsd: %w", err)
+	}
+	s.conn = conn
+	s.lines = make(chan string, statsdQueue)
+	s.done = make(chan struct{})
+	go s.run()
+	return nil
+}
+
+// Record queues the metrics of one request: load_tester.request.duration
+// (a timer in milliseconds), load_tester.request.count and, for requests
+// failing without a response, with a -fail-on-* status or with a failed
+// assertion, load_tester.request.errors tagged with the timeout phase, the
+// connection error kind, "transport", "status" or "assertion". Cancelled and chaos requests are skipped,
+// as they are in the summary's latencies. It is safe for concurrent use.
+func (s *StatsD) Record(result RequestResult) {
+	if s == nil || result.Cancelled || result.Chaos != "" {
+		return
+	}
+	tags := statsdTags(result)
+	s.queue("load_tester.request.duration:" + strconv.FormatFloat(ms(result.Duration), 'f', 3, 64) + "|ms" + formatStatsDTags(tags))
+	s.queue("load_tester.request.count:1|c" + formatStatsDTags(tags))
+	if result.Error != nil {
+		kind := "transport"
+		if result.Timeout != "" {
+			kind = "timeout_" + result.Timeout
+		} else if result.ConnError != "" {
+			kind = result.ConnError
+		}
+		s.queue("load_tester.request.errors:1|c" + formatStatsDTags(append(tags, "error:"+kind)))
+	} else if result.StatusFailed {
+		s.queue("load_tester.request.errors:1|c" + formatStatsDTags(append(tags, "error:status")))
+	} else if result.Assertion != "" {
+		s.queue("load_tester.request.errors:1|c" + formatStatsDTags(append(tags, "error:assertion")))
+	}
+}
+
+// queue hands a line to the sender, dropping it if the queue is full.
+func (s *StatsD) queue(line string) {
+	select {
+	case s.lines <- line:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// run batches queued lines into packets until the queue is closed.
+func (s *StatsD) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(statsdFlushInterval)
+	defer ticker.Stop()
+
+	var batch []string
+	size := 0
+	flush := func() {
+		if len(batch) > 0 {
+			sendStatsD(s.conn, batch) // Best effort, like UDP delivery itself
+			batch, size = batch[:0], 0
+		}
+	}
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				flush()
+				return
+			}
+			if size+len(line)+1 > maxStatsDPacket {
+				flush()
+			}
+			batch = append(batch, line)
+			size += len(line) + 1
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// close sends what is queued and closes the socket, noting on stderr how
+// many lines were dropped.
+func (s *StatsD) close() {
+	if s == nil || s.lines == nil {
+		return
+	}
+	close(s.lines)
+	<-s.done
+	s.conn.Close()
+	if n := s.dropped.Load(); n > 0 {
+		fmt.Fprintf(os.Stderr, "statsd: dropped %d metric lines, the sender could not keep up\n", n)
+	}
+}
+
+// statsdTags returns the DogStatsD tags of a request.
+func statsdTags(result RequestResult) []string {
+	tags := make([]string, 0, 5)
+	if result.Method != "" {
+		tags = append(tags, "method:"+result.Method)
+	}
+	if result.Error == nil {
+		tags = append(tags, "status:"+strconv.Itoa(result.StatusCode))
+	}
+	if result.Label != "" {
+		tags = append(tags, "label:"+statsdTag(result.Label))
+	}
+	if result.Stage != "" {
+		tags = append(tags, "stage:"+statsdTag(result.Stage))
+	}
+	return tags
+}
+
+// formatStatsDTags formats tags as a metric line suffix, "|#a:1,b:2", or ""
+// without tags.
+func formatStatsDTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return "|#" + strings.Join(tags, ",")
+}
+
+// sendStatsD writes lines in as few packets as fit.
+func sendStatsD(conn net.Conn, lines []string) error {
+	var packet strings.Builder
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxStatsDPacket {
+			if _, err := conn.Write([]byte(packet.String())); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() == 0 {
+		return nil
+	}
+	_, err := conn.Write([]byte(packet.String()))
+	return err
+}
+
+// statsdTag replaces the characters that delimit StatsD tags.
+func statsdTag(s string) string {
+	return strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_").Replace(s)
+}
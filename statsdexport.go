@@ -0,0 +1,66 @@
+// statsdexport.go implements the statsd exporter (-export
+// statsd=HOST:PORT), which sends every export window to a StatsD server
+// over UDP: request and error counts as counters, the request rate and
+// latency percentiles (in milliseconds) as gauges. Per-label metrics carry
+// the label as a DogStatsD-style tag, as understood by Datadog, Telegraf
+// and the StatsD exporter of Prometheus.
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// statsdExporter sends metrics to a StatsD server.
+type statsdExporter struct {
+	addr string
+	conn net.Conn
+}
+
+// newStatsDExporter creates a statsd exporter sending to addr.
+func newStatsDExporter(addr string) (Exporter, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("expected HOST:PORT such as 127.0.0.1:8125: %w", err)
+	}
+	return &statsdExporter{addr: addr}, nil
+}
+
+// Start opens the UDP socket.
+func (e *statsdExporter) Start(*Config) error {
+	conn, err := net.Dial("udp", e.addr)
+	if err != nil {
+		return err
+	}
+	e.conn = conn
+	return nil
+}
+
+// RecordWindow sends the metrics of the window.
+func (e *statsdExporter) RecordWindow(w ExportWindow) error {
+	var lines []string
+	for _, s := range exportSeriesOf(w.Summary) {
+		prefix, tags := "load_tester.", ""
+		if s.Label != "" {
+			prefix, tags = "load_tester.label.", formatStatsDTags([]string{"label:" + statsdTag(s.Label)})
+		}
+		lines = append(lines,
+			fmt.Sprintf("%srequests:%d|c%s", prefix, s.Requests, tags),
+			fmt.Sprintf("%serrors:%d|c%s", prefix, s.Errors, tags))
+		if s.Requests == 0 {
+			continue
+		}
+		for _, m := range []struct {
+			name string
+			ms   float64
+		}{{"avg", ms(s.Avg)}, {"p50", ms(s.P50)}, {"p90", ms(s.P90)}, {"p95", ms(s.P95)}, {"p99", ms(s.P99)}} {
+			lines = append(lines, fmt.Sprintf("%slatency.%s:%g|g%s", prefix, m.name, m.ms, tags))
+		}
+	}
+	lines = append(lines, fmt.Sprintf("load_tester.rps:%g|g", w.Summary.RequestsPerSec))
+	return sendStatsD(e.conn, lines)
+}
+
+// Finish closes the socket; the last window has already been sent.
+func (e *statsdExporter) Finish(Summary) error {
+	return e.conn.Close()
+}
@@ -0,0 +1,140 @@
+// stepgraph.go implements dependency graphs of scenario steps. A step
+// may list the steps it depends on in "depends_on"; it then starts as soon
+// as all of them have succeeded, and steps that don't depend on each other
+// run in parallel within the same iteration. A scenario without any
+// depends_on keeps the strict linear order.
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// resolveDependencies validates the depends_on lists of the scenario's
+// steps and resolves them to step indices. It rejects unknown steps and
+// cycles. Scenarios that declare no dependencies are left linear.
+func resolveDependencies(s *Scenario) error {
+	index := make(map[string]int, len(s.Steps))
+	for i, step := range s.Steps {
+		index[step.Name] = i
+		if len(step.DependsOn) > 0 {
+			s.graph = true
+		}
+	}
+	if !s.graph {
+		return nil
+	}
+
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		step.deps = nil
+		for _, name := range step.DependsOn {
+			d, ok := index[name]
+			if !ok {
+				return fmt.Errorf("step %d (%s): depends on unknown step %q", i+1, step.Name, name)
+			}
+			if d == i {
+				return fmt.Errorf("step %d (%s): depends on itself", i+1, step.Name)
+			}
+			step.deps = append(step.deps, d)
+		}
+	}
+
+	// Depth-first search for cycles; state 1 = on the current path, 2 = done.
+	state := make([]int, len(s.Steps))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case 1:
+			return fmt.Errorf("step %q is part of a dependency cycle", s.Steps[i].Name)
+		case 2:
+			return nil
+		}
+		state[i] = 1
+		for _, d := range s.Steps[i].deps {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		state[i] = 2
+		return nil
+	}
+	for i := range s.Steps {
+		if err := visit(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runGraph executes one iteration of a scenario whose steps form a
+// dependency graph. Every step waits for its dependencies and is skipped if
+// any of them failed or was skipped. Extracted variables become visible to
+// the steps that start after the extracting step finished, so a step should
+// depend on every step whose variables it uses. Parallel steps cannot
+// share rng, the iteration's random source, so each step gets one of its
+// own forked from it.
+func runGraph(ctx context.Context, client *http.Client, scenario *Scenario, config *Config, monitor *stopMonitor, iterIndex int, rng *requestRand, vars map[string]string, overallStats *Stats, stepStats map[string]*Stats) {
+	n := len(scenario.Steps)
+	rngs := make([]*requestRand, n)
+	for i := range rngs {
+		rngs[i] = rng.fork()
+	}
+	done := make([]chan struct{}, n)
+	succeeded := make([]bool, n) // Written before done[i] is closed
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	var mu sync.Mutex // Guards vars
+	var wg sync.WaitGroup
+	for i := range scenario.Steps {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer close(done[i])
+			step := &scenario.Steps[i]
+
+			for _, d := range step.deps {
+				<-done[d]
+				// A dependency cut short by the end of the run did not
+				// fail: leave the step unrecorded, as the linear runner does.
+				if ctx.Err() != nil {
+					return
+				}
+				if !succeeded[d] {
+					recordSkip(step, fmt.Errorf("skipped: dependency %q failed", scenario.Steps[d].Name), overallStats, stepStats)
+					return
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			// Run on a copy of the variables so parallel steps don't race,
+			// then publish what this step extracted.
+			mu.Lock()
+			local := make(map[string]string, len(vars))
+			for k, v := range vars {
+				local[k] = v
+			}
+			mu.Unlock()
+
+			overallStats.RequestStarted()
+			result := executeStep(ctx, client, step, config, iterIndex, rngs[i].at(stepRandIndex(scenario, iterIndex, i)), local)
+			overallStats.RequestDone()
+			succeeded[i] = recordStep(ctx, step, config, monitor, result, overallStats, stepStats)
+
+			mu.Lock()
+			for name := range step.Extract {
+				if v, ok := local[name]; ok {
+					vars[name] = v
+				}
+			}
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+}
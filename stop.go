@@ -0,0 +1,156 @@
+// stop.go implements response-based stop conditions. Workers report every
+// result to a shared stopMonitor, which cancels the run as soon as a
+// configured condition is met (e.g. a body containing "quota exceeded" or
+// N consecutive 429s) so tests against rate-limited targets end promptly.
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StopConditions describes the response-based conditions that end a test early.
+// The zero value disables all conditions.
+type StopConditions struct {
+	BodyContains string // Stop when a response body contains this substring
+	Status       int    // Status code counted towards Consecutive
+	Consecutive  int    // Stop after this many consecutive Status responses (0 = disabled)
+}
+
+// Enabled reports whether any stop condition is configured.
+func (c StopConditions) Enabled() bool {
+	return c.BodyContains != "" || c.Consecutive > 0
+}
+
+// parseStopConditions builds StopConditions from the raw CLI flag values.
+// consecutive uses the "STATUS:N" format, e.g. "429:10".
+func parseStopConditions(bodyContains, consecutive string) (StopConditions, error) {
+	conds := StopConditions{BodyContains: bodyContains}
+	if consecutive == "" {
+		return conds, nil
+	}
+
+	parts := strings.SplitN(consecutive, ":", 2)
+	if len(parts) != 2 {
+		return conds, fmt.Errorf("invalid -stop-after-consecutive value %q, expected 'STATUS:N' (e.g. 429:10)", consecutive)
+	}
+	status, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || status < 100 || status > 599 {
+		return conds, fmt.Errorf("invalid -stop-after-consecutive status %q, expected an HTTP status code", parts[0])
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || count < 1 {
+		return conds, fmt.Errorf("invalid -stop-after-consecutive count %q, expected an integer >= 1", parts[1])
+	}
+
+	conds.Status = status
+	conds.Consecutive = count
+	return conds, nil
+}
+
+// stopMonitor evaluates stop conditions against the stream of results from
+// all workers and cancels the run's context the first time one is met.
+// It is safe for concurrent use.
+type stopMonitor struct {
+	conds  StopConditions
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	consecutive int
+	reason      string
+}
+
+// newStopMonitor derives a cancellable context from parent and returns it
+// together with a monitor that cancels it when a stop condition triggers.
+func newStopMonitor(parent context.Context, conds StopConditions) (context.Context, *stopMonitor) {
+	ctx, cancel := context.WithCancel(parent)
+	return ctx, &stopMonitor{conds: conds, cancel: cancel}
+}
+
+// Observe checks a single result against the stop conditions.
+func (m *stopMonitor) Observe(result RequestResult) {
+	if !m.conds.Enabled() {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Injected cancellations and chaos requests are not regular traffic.
+	if m.reason != "" || result.Cancelled || result.Chaos != "" {
+		return
+	}
+
+	if result.BodyMatched {
+		m.trigger(fmt.Sprintf("response body contained %q", m.conds.BodyContains))
+		return
+	}
+
+	if m.conds.Consecutive > 0 {
+		if result.Error == nil && result.StatusCode == m.conds.Status {
+			m.consecutive++
+		} else {
+			m.consecutive = 0
+		}
+		if m.consecutive >= m.conds.Consecutive {
+			m.trigger(fmt.Sprintf("%d consecutive HTTP %d responses", m.consecutive, m.conds.Status))
+		}
+	}
+}
+
+// trigger records the stop reason and cancels the run. Callers must hold mu.
+func (m *stopMonitor) trigger(reason string) {
+	m.reason = reason
+	m.cancel()
+}
+
+// Reason returns why the run was stopped, or "" if no condition triggered.
+func (m *stopMonitor) Reason() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reason
+}
+
+// Close releases the monitor's context resources.
+func (m *stopMonitor) Close() {
+	m.cancel()
+}
+
+// substringWriter is an io.Writer that scans a byte stream for a substring
+// without buffering the whole stream. It keeps only the last len(needle)-1
+// bytes between writes so matches spanning chunk boundaries are detected.
+type substringWriter struct {
+	needle []byte
+	tail   []byte
+	found  bool
+}
+
+// newSubstringWriter returns a writer that searches for needle.
+func newSubstringWriter(needle string) *substringWriter {
+	return &substringWriter{needle: []byte(needle)}
+}
+
+// Write scans p for the needle. It never returns an error.
+func (w *substringWriter) Write(p []byte) (int, error) {
+	if w.found || len(w.needle) == 0 {
+		return len(p), nil
+	}
+
+	buf := append(w.tail, p...)
+	if bytes.Contains(buf, w.needle) {
+		w.found = true
+		w.tail = nil
+		return len(p), nil
+	}
+
+	keep := len(w.needle) - 1
+	if len(buf) > keep {
+		buf = buf[len(buf)-keep:]
+	}
+	w.tail = append([]byte(nil), buf...)
+	return len(p), nil
+}
@@ -0,0 +1,65 @@
+// stream.go implements streaming verification mode. For chunked/streaming
+// endpoints (chat completions, event feeds) a single duration says little,
+// so with -stream every response body is read chunk by chunk and the time to
+// first chunk, the gaps between chunks, and the total stream duration are
+// recorded per request.
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// streamBufferSize is the read buffer used when timing streamed bodies. It is
+// deliberately smaller than io.Copy's buffer so that chunks arriving close
+// together are still observed as separate reads.
+const streamBufferSize = 4 * 1024
+
+// StreamTiming holds the timings of a single streamed response body.
+// A "chunk" is one read that returned data, which usually but not always
+// corresponds to one HTTP chunk or server-sent event.
+type StreamTiming struct {
+	FirstChunk time.Duration   // From request start to the first body bytes
+	Gaps       []time.Duration // Time between successive chunks
+	Total      time.Duration   // From request start to the end of the stream
+	Chunks     int             // Number of reads that returned data
+}
+
+// copyStream copies src to dst like io.Copy while timing each chunk
+// relative to start, the moment the request was sent.
+func copyStream(dst io.Writer, src io.Reader, start time.Time) (int64, *StreamTiming, error) {
+	timing := &StreamTiming{}
+	buf := make([]byte, streamBufferSize)
+	var written int64
+	var last time.Time
+
+	for {
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			now := time.Now()
+			if timing.Chunks == 0 {
+				timing.FirstChunk = now.Sub(start)
+			} else {
+				timing.Gaps = append(timing.Gaps, now.Sub(last))
+			}
+			last = now
+			timing.Chunks++
+
+			if _, err := dst.Write(buf[:n]); err != nil {
+				timing.Total = time.Since(start)
+				return written, timing, err
+			}
+			written += int64(n)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			timing.Total = time.Since(start)
+			return written, timing, readErr
+		}
+	}
+
+	timing.Total = time.Since(start)
+	return written, timing, nil
+}
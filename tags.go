@@ -0,0 +1,112 @@
+// tags.go implements request tags: {{$label(NAME,PLACEHOLDER)}} renders
+// the inner placeholder as usual and tags the request NAME=value, so that
+// the results can be broken down by generated attributes, such as gold
+// against free users picked by {{$weightedChoice(gold:1|free:9)}}.
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// tagPlaceholder is the placeholder that tags requests, and tagFunc its
+// function in Go templates.
+const (
+	tagPlaceholder = "$label"
+	tagFunc        = "label"
+)
+
+// parseTag parses the parameters of {{$label(NAME,PLACEHOLDER)}}: the tag
+// name and the generator of the inner placeholder.
+func (c *templateContext) parseTag(params string) (name string, gen generatorFunc, err error) {
+	name, inner, ok := strings.Cut(params, ",")
+	name, inner = strings.TrimSpace(name), strings.TrimSpace(inner)
+	if !ok || name == "" || !strings.HasPrefix(inner, "$") {
+		return "", nil, fmt.Errorf("$label: expected a tag name and a placeholder, e.g. $label(tier,$weightedChoice(gold:1|free:9))")
+	}
+	if strings.ContainsAny(name, "=,") {
+		return "", nil, fmt.Errorf("$label: tag name %q must not contain '=' or ','", name)
+	}
+	baseName, innerParams, err := splitPlaceholder(inner)
+	if err != nil {
+		return "", nil, fmt.Errorf("$label: %w", err)
+	}
+	if baseName == tagPlaceholder {
+		return "", nil, fmt.Errorf("$label: tags do not nest")
+	}
+	if gen, err = c.lookupGenerator(baseName, innerParams); err != nil {
+		return "", nil, fmt.Errorf("$label: %w", err)
+	}
+	return name, gen, nil
+}
+
+// tagged reports whether t tags the requests it renders.
+func (t *Template) tagged() bool {
+	if t == nil {
+		return false
+	}
+	name := tagPlaceholder
+	if t.goTmpl != nil {
+		name = tagFunc
+	}
+	return slices.Contains(t.placeholders, name)
+}
+
+// headersTagged reports whether any of headers tags requests.
+func headersTagged(headers []headerTemplate) bool {
+	return slices.ContainsFunc(headers, func(h headerTemplate) bool {
+		return h.name.tagged() || h.value.tagged()
+	})
+}
+
+// tagged reports whether any template of config tags requests, so that
+// workers collect the tags of every request.
+func (c *Config) tagged() bool {
+	if c.URLTemplate.tagged() || c.BodyTemplate.tagged() || headersTagged(c.HeaderTemplates) {
+		return true
+	}
+	if c.Endpoints != nil {
+		for _, e := range c.Endpoints.Endpoints {
+			if e.urlTemplate.tagged() || e.bodyTemplate.tagged() || headersTagged(e.headers) {
+				return true
+			}
+		}
+	}
+	if c.MethodMix != nil {
+		for _, e := range c.MethodMix.Entries {
+			if e.BodyTemplate.tagged() {
+				return true
+			}
+		}
+	}
+	if c.Form != nil {
+		for _, f := range c.Form.fields {
+			if f.value.tagged() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tagged reports whether any template of the step tags requests.
+func (s *ScenarioStep) tagged() bool {
+	return s.methodTemplate.tagged() || s.urlTemplate.tagged() || s.bodyTemplate.tagged() || headersTagged(s.headerTemplates)
+}
+
+// tagsOf returns the tags among the generated values of a request, keyed
+// "NAME=value" as the results are broken down by, or nil if there are
+// none. A tag rendered more than once keeps its first value.
+func tagsOf(values []generatedValue) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, v := range values {
+		if v.Tag == "" || seen[v.Tag] {
+			continue
+		}
+		seen[v.Tag] = true
+		tags = append(tags, v.Tag+"="+v.Value)
+	}
+	return tags
+}
@@ -0,0 +1,176 @@
+// templatecmd.go implements the `template` subcommand, a fast feedback loop
+// for scenario authors. It parses a body/URL template exactly as a load test
+// would and either prints rendered samples or lists detected placeholders,
+// without sending any requests.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// runTemplateCommand dispatches `template render` and `template placeholders`.
+// args holds everything after the `template` keyword.
+func runTemplateCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("template: expected a subcommand (render, placeholders)")
+	}
+
+	switch args[0] {
+	case "render":
+		return runTemplateRender(args[1:])
+	case "placeholders":
+		return runTemplatePlaceholders(args[1:])
+	default:
+		return fmt.Errorf("template: unknown subcommand %q (available: render, placeholders)", args[0])
+	}
+}
+
+// templateSources holds the template inputs shared by the template subcommands.
+type templateSources struct {
+	url       *string
+	body      *string
+	bodyFile  *string
+	data      *string
+	dataOrder *string
+	engine    *string
+	jwtSecret *string
+	plugins   *headerFlags
+}
+
+// registerTemplateSources registers the -url, -body, -body-file, -data,
+// -data-order, -template-engine, -jwt-secret and -generator-plugin flags
+// on fs.
+func registerTemplateSources(fs *flag.FlagSet) templateSources {
+	plugins := new(headerFlags)
+	fs.Var(plugins, "generator-plugin", "Go plugin (.so) registering template generators (can be repeated)")
+	return templateSources{
+		url:       fs.String("url", "", "URL template to preview"),
+		body:      fs.String("body", "", "Body template to preview"),
+		bodyFile:  fs.String("body-file", "", "Path to a file containing the body template"),
+		data:      fs.String("data", "", "CSV file whose columns the templates read as {{$csv(column)}}"),
+		dataOrder: fs.String("data-order", dataOrderCycle, "Order in which samples take the -data rows: cycle or random"),
+		engine:    fs.String("template-engine", engineBuiltin, "Template language: builtin or go"),
+		jwtSecret: fs.String("jwt-secret", "", "Key {{$jwt(claims)}} tokens are signed with (default $"+jwtSecretEnv+")"),
+		plugins:   plugins,
+	}
+}
+
+// load parses the URL and body templates for a run seeded with seed, 0
+// for none, with a template context of their own. A nil template is
+// returned for any source that was not provided.
+func (s templateSources) load(seed int64) (urlTmpl, bodyTmpl *Template, err error) {
+	body, err := loadBody(*s.body, *s.bodyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if *s.url == "" && body == "" {
+		return nil, nil, fmt.Errorf("one of -url, -body or -body-file is required")
+	}
+
+	tc := &templateContext{jwtKey: jwtKey(*s.jwtSecret), seed: seed}
+	if tc.engine, err = parseTemplateEngine(*s.engine); err != nil {
+		return nil, nil, err
+	}
+	if err := loadGeneratorPlugins(*s.plugins); err != nil {
+		return nil, nil, err
+	}
+	if *s.data != "" {
+		if tc.feed, err = loadDataFeed(*s.data, *s.dataOrder); err != nil {
+			return nil, nil, err
+		}
+		if seed != 0 {
+			tc.feed.seedWith(seed)
+		}
+	}
+
+	if *s.url != "" {
+		urlTmpl, err = tc.ParseTemplate(*s.url)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid URL template: %w", err)
+		}
+	}
+	if body != "" {
+		bodyTmpl, err = tc.ParseTemplate(body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid body template: %w", err)
+		}
+	}
+	return urlTmpl, bodyTmpl, nil
+}
+
+// runTemplateRender prints N rendered samples of the URL and/or body template.
+// With -seed the samples are reproducible across invocations.
+func runTemplateRender(args []string) error {
+	fs := flag.NewFlagSet("template render", flag.ContinueOnError)
+	sources := registerTemplateSources(fs)
+	n := fs.Int("n", 3, "Number of samples to render")
+	seed := fs.Int64("seed", 0, "Seed for random generators (0 = random)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *n < 1 {
+		return fmt.Errorf("-n must be >= 1, got %d", *n)
+	}
+
+	urlTmpl, bodyTmpl, err := sources.load(*seed)
+	if err != nil {
+		return err
+	}
+
+	// Samples render as a worker renders requests, URL first, so a seeded
+	// sample is what the request of the same index of a run with that
+	// seed sends.
+	rng := newRequestRand(*seed)
+	for i := 0; i < *n; i++ {
+		fmt.Printf("--- sample %d (request index %d) ---\n", i+1, i)
+		r := rng.at(i)
+		if urlTmpl != nil {
+			fmt.Printf("URL:  %s\n", urlTmpl.Render(i, r))
+		}
+		if bodyTmpl != nil {
+			if urlTmpl != nil {
+				fmt.Println("Body:")
+			}
+			fmt.Println(strings.TrimSuffix(bodyTmpl.Render(i, r), "\n"))
+		}
+	}
+	return nil
+}
+
+// runTemplatePlaceholders lists the placeholders detected in each template.
+func runTemplatePlaceholders(args []string) error {
+	fs := flag.NewFlagSet("template placeholders", flag.ContinueOnError)
+	sources := registerTemplateSources(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	urlTmpl, bodyTmpl, err := sources.load(0)
+	if err != nil {
+		return err
+	}
+
+	printPlaceholders("URL", urlTmpl)
+	printPlaceholders("Body", bodyTmpl)
+	return nil
+}
+
+// printPlaceholders prints the placeholders of a single template, if present.
+func printPlaceholders(label string, tmpl *Template) {
+	if tmpl == nil {
+		return
+	}
+	fmt.Printf("%s:\n", label)
+	if !tmpl.HasPlaceholders() {
+		fmt.Println("  (no placeholders)")
+		return
+	}
+	for _, p := range tmpl.Placeholders() {
+		fmt.Printf("  %s\n", p)
+	}
+}
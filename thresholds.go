@@ -0,0 +1,238 @@
+// thresholds.go implements pass/fail thresholds on the summary
+// (-threshold), such as "p95<300ms" or "error_rate<1%". A threshold can be
+// scoped to the requests of one label, as in "p95{checkout}<300ms". Every
+// threshold is checked once the run has finished; the results are part of
+// every output format, and in CI mode a failed threshold fails the run.
+// The gate flags (-max-error-rate, -max-p95, -min-rps, ...) are shorthands
+// for common thresholds that fail the run in every mode.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errThresholds is returned when at least one threshold failed.
+var errThresholds = errors.New("thresholds failed")
+
+// errGates is returned when at least one gate flag's threshold failed.
+var errGates = errors.New("performance gate failed")
+
+// gateFlags are the flags that set a threshold on one metric, with the
+// operator their limit is checked with.
+var gateFlags = []struct {
+	name, metric, op, usage string
+}{
+	{"max-error-rate", "error_rate", "<=", "Fail the run, with a non-zero exit status, if the error rate exceeds this percentage, e.g. 1%"},
+	{"max-avg", "avg", "<=", "Fail the run, with a non-zero exit status, if the average latency exceeds this duration, e.g. 200ms"},
+	{"max-p50", "p50", "<=", "Fail the run, with a non-zero exit status, if P50 latency exceeds this duration"},
+	{"max-p95", "p95", "<=", "Fail the run, with a non-zero exit status, if P95 latency exceeds this duration, e.g. 300ms"},
+	{"max-p99", "p99", "<=", "Fail the run, with a non-zero exit status, if P99 latency exceeds this duration"},
+	{"min-rps", "rps", ">=", "Fail the run, with a non-zero exit status, if fewer requests per second were sent, e.g. 100"},
+}
+
+// parseGate returns the threshold of gate flag name set to value.
+func parseGate(name, metric, op, value string) (Threshold, error) {
+	value = strings.TrimSpace(value)
+	limit, err := parseThresholdLimit(metric, value)
+	if err != nil {
+		return Threshold{}, fmt.Errorf("invalid -%s %q: %w", name, value, err)
+	}
+	return Threshold{Expr: metric + op + value, Metric: metric, Op: op, Limit: limit, Gate: true}, nil
+}
+
+// thresholdOps lists the comparison operators, longest first so "<="
+// isn't read as "<".
+var thresholdOps = []string{"<=", ">=", "<", ">"}
+
+// thresholdMetrics maps metric names to how they are read from a summary.
+// Latency metrics are in milliseconds, error_rate in percent and rps in
+// requests per second.
+var thresholdMetrics = map[string]func(s Summary) float64{
+	"avg":        func(s Summary) float64 { return ms(s.AvgDuration) },
+	"p50":        func(s Summary) float64 { return ms(s.P50) },
+	"p90":        func(s Summary) float64 { return ms(s.P90) },
+	"p95":        func(s Summary) float64 { return ms(s.P95) },
+	"p99":        func(s Summary) float64 { return ms(s.P99) },
+	"max":        func(s Summary) float64 { return ms(s.MaxDuration) },
+	"error_rate": errorRate,
+	"rps":        func(s Summary) float64 { return s.RequestsPerSec },
+}
+
+// Threshold is a limit on one summary metric.
+type Threshold struct {
+	Expr   string  // As given on the command line, e.g. "p95<300ms"
+	Metric string  // Key of thresholdMetrics
+	Label  string  // Only requests with this label count, "" for all
+	Op     string  // One of thresholdOps
+	Limit  float64 // In the metric's unit
+	Gate   bool    // Set by a gate flag, failing the run outside CI mode too
+}
+
+// ThresholdResult is the outcome of checking one threshold.
+type ThresholdResult struct {
+	Threshold
+	Actual  float64 // The metric's value, in its unit
+	Passed  bool
+	Missing bool // No request carried the threshold's label; always fails
+}
+
+// parseThreshold parses an expression such as "p95<300ms", "rps>=100",
+// "error_rate<1%" or "p99{checkout}<1s".
+func parseThreshold(expr string) (Threshold, error) {
+	s := strings.ReplaceAll(expr, " ", "")
+	for _, op := range thresholdOps {
+		i := strings.Index(s, op)
+		if i < 0 {
+			continue
+		}
+		metric, value := s[:i], s[i+len(op):]
+		var label string
+		if open := strings.IndexByte(metric, '{'); open >= 0 && strings.HasSuffix(metric, "}") {
+			metric, label = metric[:open], metric[open+1:len(metric)-1]
+			if label == "" {
+				return Threshold{}, fmt.Errorf("invalid -threshold %q: empty label", expr)
+			}
+		}
+		if _, ok := thresholdMetrics[metric]; !ok {
+			return Threshold{}, fmt.Errorf("invalid -threshold %q: unknown metric %q, expected one of avg, p50, p90, p95, p99, max, error_rate, rps", expr, metric)
+		}
+		if label != "" && metric == "max" {
+			return Threshold{}, fmt.Errorf("invalid -threshold %q: max is not tracked per label", expr)
+		}
+		limit, err := parseThresholdLimit(metric, value)
+		if err != nil {
+			return Threshold{}, fmt.Errorf("invalid -threshold %q: %w", expr, err)
+		}
+		return Threshold{Expr: s, Metric: metric, Label: label, Op: op, Limit: limit}, nil
+	}
+	return Threshold{}, fmt.Errorf("invalid -threshold %q, expected METRIC<VALUE such as p95<300ms", expr)
+}
+
+// parseThresholdLimit parses the limit of a threshold on metric into the
+// metric's unit.
+func parseThresholdLimit(metric, value string) (float64, error) {
+	switch metric {
+	case "error_rate":
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("expected a percentage such as 1%%, got %q", value)
+		}
+		return pct, nil
+	case "rps":
+		rps, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("expected requests per second, got %q", value)
+		}
+		return rps, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("expected a duration such as 300ms, got %q", value)
+	}
+	return ms(d), nil
+}
+
+// errorRate returns the percentage of requests that failed or got a 5xx
+// response. 5xx responses that failed are counted once.
+func errorRate(s Summary) float64 {
+	if s.TotalRequests == 0 {
+		return 0
+	}
+	failed := s.FailCount - s.Failed5xx
+	for code, count := range s.StatusCodes {
+		if code >= 500 {
+			failed += count
+		}
+	}
+	return float64(failed) / float64(s.TotalRequests) * 100
+}
+
+// labelSummary returns the results of one label as a Summary that the
+// metrics of thresholdMetrics other than max can be read from. elapsed is
+// the duration of the whole run.
+func labelSummary(g GroupSummary, elapsed time.Duration) Summary {
+	s := Summary{
+		TotalRequests: g.Requests,
+		TotalTime:     elapsed,
+		FailCount:     g.Errors,
+		StatusCodes:   map[int]int{500: g.ServerErrors},
+		AvgDuration:   g.AvgDuration,
+		P50:           g.P50,
+		P90:           g.P90,
+		P95:           g.P95,
+		P99:           g.P99,
+	}
+	if elapsed > 0 {
+		s.RequestsPerSec = float64(g.Requests) / elapsed.Seconds()
+	}
+	return s
+}
+
+// checkThresholds checks every threshold against s, in order. Thresholds
+// on a label are checked against that label's results.
+func checkThresholds(thresholds []Threshold, s Summary) []ThresholdResult {
+	var results []ThresholdResult
+	for _, t := range thresholds {
+		src := s
+		if t.Label != "" {
+			g, ok := s.ByLabel[t.Label]
+			if !ok {
+				results = append(results, ThresholdResult{Threshold: t, Missing: true})
+				continue
+			}
+			src = labelSummary(g, s.TotalTime)
+		}
+		actual := thresholdMetrics[t.Metric](src)
+		var passed bool
+		switch t.Op {
+		case "<":
+			passed = actual < t.Limit
+		case "<=":
+			passed = actual <= t.Limit
+		case ">":
+			passed = actual > t.Limit
+		case ">=":
+			passed = actual >= t.Limit
+		}
+		results = append(results, ThresholdResult{Threshold: t, Actual: actual, Passed: passed})
+	}
+	return results
+}
+
+// thresholdsFailed reports whether any threshold result failed.
+func thresholdsFailed(results []ThresholdResult) bool {
+	for _, r := range results {
+		if !r.Passed {
+			return true
+		}
+	}
+	return false
+}
+
+// gatesFailed reports whether the threshold of any gate flag failed.
+func gatesFailed(results []ThresholdResult) bool {
+	for _, r := range results {
+		if r.Gate && !r.Passed {
+			return true
+		}
+	}
+	return false
+}
+
+// formatActual formats a threshold's actual value in its metric's unit.
+func (r ThresholdResult) formatActual() string {
+	if r.Missing {
+		return "none (no request labeled " + r.Label + ")"
+	}
+	switch r.Metric {
+	case "error_rate":
+		return fmt.Sprintf("%.2f%%", r.Actual)
+	case "rps":
+		return fmt.Sprintf("%.2f req/s", r.Actual)
+	}
+	return formatDuration(time.Duration(r.Actual * float64(time.Millisecond)))
+}
@@ -0,0 +1,74 @@
+// throttle.go implements Retry-After aware pacing. When the target answers
+// 429 or 503 with a Retry-After header, the worker that received it can
+// optionally pause for the requested interval, behaving like a compliant
+// client instead of hammering an API that has asked it to back off.
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isThrottleStatus reports whether a status code signals server-side throttling.
+func isThrottleStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable
+}
+
+// parseRetryAfter parses a Retry-After header value, which is either a
+// number of seconds or an HTTP-date. It returns 0 when the value is empty,
+// malformed, or already in the past.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// retryAfterFromResponse returns the Retry-After delay of a throttling
+// response, or 0 if the response is not throttled or carries no delay.
+func retryAfterFromResponse(resp *http.Response) time.Duration {
+	if !isThrottleStatus(resp.StatusCode) {
+		return 0
+	}
+	return parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+}
+
+// honorRetryAfter pauses the calling worker for the result's Retry-After
+// delay, capped at max, and records the pause on stats. It returns early if
+// ctx is cancelled. Nothing happens when the result carries no delay.
+func honorRetryAfter(ctx context.Context, result RequestResult, max time.Duration, stats *Stats) {
+	d := result.RetryAfter
+	if d <= 0 {
+		return
+	}
+	if max > 0 && d > max {
+		d = max
+	}
+
+	start := time.Now()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	stats.RecordThrottlePause(time.Since(start))
+}
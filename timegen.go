@@ -0,0 +1,164 @@
+// timegen.go implements the time generators for APIs that validate time
+// windows: {{$timestamp(offset,format)}}, the current time shifted by an
+// offset such as -1h or +7d, and {{$randomDate(from,to,format)}}, a random
+// time within a range whose bounds are dates, RFC 3339 times or offsets
+// from now.
+package main
+
+import (
+	"fmt"
+	mathrand "math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Named output formats of the time generators. Any other format is a Go
+// time layout, such as "02/01/2006 15:04".
+var timeFormats = map[string]func(time.Time) string{
+	"unix":    func(t time.Time) string { return strconv.FormatInt(t.Unix(), 10) },
+	"unixms":  func(t time.Time) string { return strconv.FormatInt(t.UnixMilli(), 10) },
+	"rfc3339": func(t time.Time) string { return t.Format(time.RFC3339) },
+	"iso":     func(t time.Time) string { return t.Format(time.RFC3339) },
+	"date":    func(t time.Time) string { return t.Format(time.DateOnly) },
+	"rfc1123": func(t time.Time) string { return t.Format(http1123) },
+}
+
+// http1123 is the layout of HTTP dates, as in If-Modified-Since headers.
+const http1123 = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// parseTimeFormat returns the formatter of a time generator's format,
+// named or a Go layout. Times are formatted in UTC.
+func parseTimeFormat(format string) (func(time.Time) string, error) {
+	if f, ok := timeFormats[format]; ok {
+		return func(t time.Time) string { return f(t.UTC()) }, nil
+	}
+	// A layout without any of the reference time's fields formats every
+	// time as itself, which is surely a typo for a named format.
+	if time.Unix(0, 0).UTC().Format(format) == format {
+		return nil, fmt.Errorf("unknown time format %q, expected unix, unixms, rfc3339, date, rfc1123 or a Go layout such as 2006-01-02T15:04", format)
+	}
+	return func(t time.Time) string { return t.UTC().Format(format) }, nil
+}
+
+// parseTimeOffset parses an offset from now: a Go duration such as -1h30m,
+// or a whole number of days such as +7d.
+func parseTimeOffset(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid offset %q, expected a duration such as -1h or a number of days such as +7d", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset %q, expected a duration such as -1h or a number of days such as +7d", s)
+	}
+	return d, nil
+}
+
+// timeBound is a bound of a $randomDate range: a fixed time, or an offset
+// from the time of rendering.
+type timeBound struct {
+	fixed    time.Time
+	offset   time.Duration
+	relative bool
+	dateOnly bool // Given as a date, without a time of day
+}
+
+// parseTimeBound parses a $randomDate bound: "now", an offset such as
+// -30d, a date such as 2024-01-31 or an RFC 3339 time.
+func parseTimeBound(s string) (timeBound, error) {
+	switch {
+	case s == "now":
+		return timeBound{relative: true}, nil
+	case strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+"):
+		d, err := parseTimeOffset(s)
+		return timeBound{offset: d, relative: true}, err
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return timeBound{fixed: t, dateOnly: true}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return timeBound{fixed: t}, nil
+	}
+	return timeBound{}, fmt.Errorf("invalid bound %q, expected now, an offset such as -30d, a date such as 2024-01-31 or an RFC 3339 time", s)
+}
+
+// at returns the time b stands for when rendering at now.
+func (b timeBound) at(now time.Time) time.Time {
+	if b.relative {
+		return now.Add(b.offset)
+	}
+	return b.fixed
+}
+
+// timestampGenerator returns the generator of {{$timestamp(offset,format)}}
+// and, with defaultFormat "rfc3339", of {{$timestampISO(offset,format)}}.
+// The format may contain commas.
+func timestampGenerator(name, params, defaultFormat string) (generatorFunc, error) {
+	offsetParam, format, _ := strings.Cut(params, ",")
+	var offset time.Duration
+	if s := strings.TrimSpace(offsetParam); s != "" {
+		var err error
+		if offset, err = parseTimeOffset(s); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if format = strings.TrimSpace(format); format == "" {
+		format = defaultFormat
+	}
+	formatTime, err := parseTimeFormat(format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return func(_ int, _ *mathrand.Rand) string { return formatTime(time.Now().Add(offset)) }, nil
+}
+
+// randomDateGenerator returns the generator of
+// {{$randomDate(from,to,format)}}. A date as the upper bound includes that
+// whole day. The format defaults to date if both bounds are dates, and to
+// rfc3339 otherwise.
+func randomDateGenerator(params string) (generatorFunc, error) {
+	parts := strings.SplitN(params, ",", 3)
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("$randomDate: expected a range, e.g. $randomDate(2024-01-01,2024-12-31) or $randomDate(-30d,now)")
+	}
+	from, err := parseTimeBound(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return nil, fmt.Errorf("$randomDate: %w", err)
+	}
+	to, err := parseTimeBound(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return nil, fmt.Errorf("$randomDate: %w", err)
+	}
+	if to.dateOnly {
+		to.fixed = to.fixed.Add(24*time.Hour - time.Second)
+	}
+	format := "rfc3339"
+	if from.dateOnly && to.dateOnly {
+		format = "date"
+	}
+	if len(parts) == 3 && strings.TrimSpace(parts[2]) != "" {
+		format = strings.TrimSpace(parts[2])
+	}
+	formatTime, err := parseTimeFormat(format)
+	if err != nil {
+		return nil, fmt.Errorf("$randomDate: %w", err)
+	}
+	// Ranges with a relative bound move with the clock, but keep their
+	// order unless they mix fixed and relative bounds.
+	now := time.Now()
+	if !to.at(now).After(from.at(now)) {
+		return nil, fmt.Errorf("$randomDate: the range %s to %s is empty, the first bound must come first", strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+	return func(_ int, rng *mathrand.Rand) string {
+		now := time.Now()
+		lo, span := from.at(now), to.at(now).Sub(from.at(now))
+		if span <= 0 {
+			return formatTime(lo)
+		}
+		return formatTime(lo.Add(time.Duration(rng.Int63n(int64(span) + 1))))
+	}, nil
+}
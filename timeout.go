@@ -0,0 +1,124 @@
+// timeout.go classifies request timeouts by the phase the request was in
+// when its time ran out: connecting (including DNS, TLS and waiting for a
+// free connection), waiting for the response headers, or reading the
+// response body. Go reports all three as "context deadline exceeded", while
+// each points somewhere else: an overloaded accept queue or network path,
+// slow request handling, or a slow or stalled response stream.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+)
+
+// Timeout phases.
+const (
+	timeoutConnect = "connect"
+	timeoutHeaders = "headers"
+	timeoutBody    = "body"
+)
+
+// timeoutPhases lists the phases in request order.
+var timeoutPhases = []string{timeoutConnect, timeoutHeaders, timeoutBody}
+
+// timeoutDescriptions prefix the errors of timed-out requests.
+var timeoutDescriptions = map[string]string{
+	timeoutConnect: "timeout while connecting",
+	timeoutHeaders: "timeout waiting for response headers",
+	timeoutBody:    "timeout reading response body",
+}
+
+// phaseTrace follows a request through its milestones to tell in which
+// phase it timed out, or what failed on its connection (connerrors.go), and
+// how long it spent in each phase (phases.go).
+type phaseTrace struct {
+	connected atomic.Bool // A connection was obtained for the request
+	reused    atomic.Bool // That connection had carried earlier requests
+	tlsFailed atomic.Bool // A TLS handshake for the request failed
+	clock     phaseClock
+}
+
+// attach returns req with a client trace recording the milestones on t.
+func (t *phaseTrace) attach(req *http.Request) *http.Request {
+	c := &t.clock
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { c.mark(&c.dnsStart) },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			if info.Err == nil {
+				c.mark(&c.dnsDone)
+			}
+		},
+		ConnectStart: func(_, _ string) { c.mark(&c.connectStart) },
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				c.mark(&c.connectDone)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.connected.Store(true)
+			t.reused.Store(info.Reused)
+		},
+		TLSHandshakeStart: func() { c.mark(&c.tlsStart) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err != nil {
+				t.tlsFailed.Store(true)
+				return
+			}
+			c.mark(&c.tlsDone)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				c.mark(&c.wroteRequest)
+			}
+		},
+		GotFirstResponseByte: func() { c.mark(&c.firstByte) },
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// timeout classifies err, returned by the client (readingBody false) or
+// while reading the response body (readingBody true). For a timeout it
+// returns the phase and err prefixed with the phase's description; other
+// errors are returned unchanged with an empty phase.
+func (t *phaseTrace) timeout(err error, readingBody bool) (string, error) {
+	if !isTimeout(err) {
+		return "", err
+	}
+	phase := timeoutHeaders
+	switch {
+	case readingBody:
+		phase = timeoutBody
+	case !t.connected.Load():
+		phase = timeoutConnect
+	}
+	return phase, fmt.Errorf("%s: %w", timeoutDescriptions[phase], err)
+}
+
+// isTimeout reports whether err is a deadline being exceeded, from the
+// client's -timeout, a context deadline or a network deadline.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	// A client timeout while reading the body does not wrap
+	// context.DeadlineExceeded, but reports itself as a timeout.
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// printTimeouts prints the number of timeouts per phase.
+func printTimeouts(w io.Writer, timeouts map[string]int) {
+	fmt.Fprintln(w, "Timeouts:")
+	for _, phase := range timeoutPhases {
+		if n := timeouts[phase]; n > 0 {
+			fmt.Fprintf(w, "  %-9s %d (%s)\n", phase+":", n, timeoutDescriptions[phase])
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// timeseries.go implements time-series statistics (-timeseries): requests
+// are counted in buckets of a fixed interval by completion time, each with
+// its own latency histogram, so the summary can show how throughput, error
+// rate and percentiles evolved over the run rather than only their totals.
+// Like latency windows, buckets are aligned to absolute time so those of
+// distributed agents merge into one series.
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// timeBucket holds the requests completing within one interval. Latencies
+// are kept as sparse histogram buckets, as most intervals only see a
+// narrow range of latencies.
+type timeBucket struct {
+	Requests  int         `json:"requests"`
+	Errors    int         `json:"errors"` // Failed requests and 5xx responses
+	Latencies hdrSnapshot `json:"latencies"`
+}
+
+// add records one request.
+func (b *timeBucket) add(d time.Duration, failed bool) {
+	if d < 0 {
+		d = 0
+	}
+	if b.Latencies.Counts == nil {
+		b.Latencies.Counts = make(map[int]int64)
+	}
+	b.Latencies.Counts[hdrIndex(int64(d))]++
+	if b.Requests == 0 || d < b.Latencies.Min {
+		b.Latencies.Min = d
+	}
+	if d > b.Latencies.Max {
+		b.Latencies.Max = d
+	}
+	b.Requests++
+	if failed {
+		b.Errors++
+	}
+}
+
+// merge folds another bucket covering the same interval into b.
+func (b *timeBucket) merge(o timeBucket) {
+	if o.Requests == 0 {
+		return
+	}
+	if b.Latencies.Counts == nil {
+		b.Latencies.Counts = make(map[int]int64, len(o.Latencies.Counts))
+	}
+	for i, c := range o.Latencies.Counts {
+		b.Latencies.Counts[i] += c
+	}
+	if b.Requests == 0 || o.Latencies.Min < b.Latencies.Min {
+		b.Latencies.Min = o.Latencies.Min
+	}
+	if o.Latencies.Max > b.Latencies.Max {
+		b.Latencies.Max = o.Latencies.Max
+	}
+	b.Requests += o.Requests
+	b.Errors += o.Errors
+}
+
+// since returns the requests b gained after mark, a copy of b taken
+// earlier, with b's current extremes.
+func (b *timeBucket) since(mark timeBucket) timeBucket {
+	d := timeBucket{
+		Requests:  b.Requests - mark.Requests,
+		Errors:    b.Errors - mark.Errors,
+		Latencies: hdrSnapshot{Counts: make(map[int]int64), Min: b.Latencies.Min, Max: b.Latencies.Max},
+	}
+	for i, c := range b.Latencies.Counts {
+		if diff := c - mark.Latencies.Counts[i]; diff > 0 {
+			d.Latencies.Counts[i] = diff
+		}
+	}
+	return d
+}
+
+// clone returns a deep copy of b.
+func (b *timeBucket) clone() timeBucket {
+	var cp timeBucket
+	cp.merge(*b)
+	return cp
+}
+
+// TimePoint is the results of one time-series interval.
+type TimePoint struct {
+	Start          time.Time
+	Requests       int
+	Errors         int     // Failed requests and 5xx responses
+	ErrorRate      float64 // Percentage of Requests
+	RequestsPerSec float64 // Over the part of the interval the run covered
+	P50            time.Duration
+	P90            time.Duration
+	P95            time.Duration
+	P99            time.Duration
+}
+
+// TimeSeries reports the results of a run interval by interval.
+type TimeSeries struct {
+	Interval time.Duration
+	Points   []TimePoint // In time order, including intervals without requests
+}
+
+// summarizeTimeSeries computes the series of buckets keyed by their start
+// in Unix nanoseconds, for a run from start to end. Rates of the first and
+// last intervals only count the time the run covered. It returns nil if
+// there are no buckets.
+func summarizeTimeSeries(buckets map[int64]*timeBucket, interval time.Duration, m PercentileMethod, start, end time.Time) *TimeSeries {
+	if len(buckets) == 0 || interval <= 0 {
+		return nil
+	}
+
+	starts := make([]int64, 0, len(buckets))
+	for s := range buckets {
+		starts = append(starts, s)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	ts := &TimeSeries{Interval: interval}
+	first, last := time.Unix(0, starts[0]), time.Unix(0, starts[len(starts)-1])
+	for t := first; !t.After(last); t = t.Add(interval) {
+		p := TimePoint{Start: t}
+		from, to := t, t.Add(interval)
+		if start.After(from) {
+			from = start
+		}
+		if end.Before(to) {
+			to = end
+		}
+		covered := interval
+		if to.After(from) {
+			covered = to.Sub(from)
+		}
+		if b, ok := buckets[t.UnixNano()]; ok && b.Requests > 0 {
+			var h hdrHistogram
+			h.merge(b.Latencies)
+			p.Requests = b.Requests
+			p.Errors = b.Errors
+			p.ErrorRate = float64(b.Errors) / float64(b.Requests) * 100
+			p.P50 = h.percentile(m, 50)
+			p.P90 = h.percentile(m, 90)
+			p.P95 = h.percentile(m, 95)
+			p.P99 = h.percentile(m, 99)
+			if covered > 0 {
+				p.RequestsPerSec = float64(b.Requests) / covered.Seconds()
+			}
+		}
+		ts.Points = append(ts.Points, p)
+	}
+	return ts
+}
+
+// printTimeSeries prints one line per interval with its start time.
+func printTimeSeries(w io.Writer, ts *TimeSeries) {
+	layout := "15:04:05"
+	if ts.Interval%time.Second != 0 {
+		layout = "15:04:05.000"
+	}
+	fmt.Fprintf(w, "Time Series (%s):\n", ts.Interval)
+	fmt.Fprintf(w, "  %-12s %8s %10s %8s %10s %10s %10s\n", "Time", "Requests", "Req/sec", "Errors", "P50", "P95", "P99")
+	for _, p := range ts.Points {
+		fmt.Fprintf(w, "  %-12s %8d %10.2f %7.2f%% %10s %10s %10s\n",
+			p.Start.Format(layout), p.Requests, p.RequestsPerSec, p.ErrorRate,
+			formatDuration(p.P50), formatDuration(p.P95), formatDuration(p.P99))
+	}
+}
+
+// parseTimeSeriesInterval validates the -timeseries value; empty disables
+// the time series.
+func parseTimeSeriesInterval(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid -timeseries value %q: %w", s, err)
+	}
+	if d < time.Millisecond {
+		return 0, fmt.Errorf("-timeseries must be at least 1ms, got %s", d)
+	}
+	return d, nil
+}
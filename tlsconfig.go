@@ -0,0 +1,128 @@
+// tlsconfig.go implements the TLS flags: -insecure to skip certificate
+// verification, -cert and -key for a client certificate (mutual TLS), -ca
+// for a custom CA bundle, and -tls-min-version and -tls-ciphers to restrict
+// what the handshake may negotiate. Staging targets often sit behind a
+// private CA or require client certificates, and a server's cost per
+// handshake depends on the version and cipher it ends up with.
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// tlsVersions are the -tls-min-version values.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSSettings is the TLS configuration of a run's requests.
+type TLSSettings struct {
+	Insecure   bool   // Skip certificate verification
+	CertFile   string // Client certificate, "" for none
+	KeyFile    string
+	CAFile     string // CA bundle replacing the system roots, "" for none
+	MinVersion string // -tls-min-version, "" for Go's default
+	Ciphers    []string
+
+	config *tls.Config
+}
+
+// parseTLSSettings builds the TLS configuration of the TLS flags, returning
+// nil if none is set. The certificate files are read right away, so a bad
+// path fails validation rather than every request.
+func parseTLSSettings(insecure bool, certFile, keyFile, caFile, minVersion, ciphers string) (*TLSSettings, error) {
+	if !insecure && certFile == "" && keyFile == "" && caFile == "" && minVersion == "" && ciphers == "" {
+		return nil, nil
+	}
+	t := &TLSSettings{Insecure: insecure, CertFile: certFile, KeyFile: keyFile, CAFile: caFile, MinVersion: minVersion}
+	t.config = &tls.Config{InsecureSkipVerify: insecure}
+
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("-cert and -key must be set together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("-cert/-key: %w", err)
+		}
+		t.config.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("-ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("-ca: no PEM certificates in %s", caFile)
+		}
+		t.config.RootCAs = pool
+	}
+
+	if minVersion != "" {
+		v, ok := tlsVersions[minVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid -tls-min-version %q, expected 1.0, 1.1, 1.2 or 1.3", minVersion)
+		}
+		t.config.MinVersion = v
+	}
+
+	if ciphers != "" {
+		ids := make(map[string]uint16)
+		for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			ids[s.Name] = s.ID
+		}
+		for _, name := range strings.Split(ciphers, ",") {
+			name = strings.TrimSpace(name)
+			id, ok := ids[name]
+			if !ok {
+				return nil, fmt.Errorf("-tls-ciphers: unknown cipher suite %q, expected names such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", name)
+			}
+			t.Ciphers = append(t.Ciphers, name)
+			t.config.CipherSuites = append(t.config.CipherSuites, id)
+		}
+		if minVersion == "1.3" {
+			return nil, fmt.Errorf("-tls-ciphers has no effect with -tls-min-version 1.3, TLS 1.3 cipher suites are not configurable")
+		}
+	}
+	return t, nil
+}
+
+// clientConfig returns a copy of the TLS configuration for a transport or
+// dialer to use, or nil for Go's defaults.
+func (t *TLSSettings) clientConfig() *tls.Config {
+	if t == nil {
+		return nil
+	}
+	return t.config.Clone()
+}
+
+// String describes the settings for the banner, e.g. "client certificate
+// client.pem, min TLS 1.2".
+func (t *TLSSettings) String() string {
+	var parts []string
+	if t.Insecure {
+		parts = append(parts, "insecure (certificates not verified)")
+	}
+	if t.CertFile != "" {
+		parts = append(parts, "client certificate "+t.CertFile)
+	}
+	if t.CAFile != "" {
+		parts = append(parts, "CA "+t.CAFile)
+	}
+	if t.MinVersion != "" {
+		parts = append(parts, "min TLS "+t.MinVersion)
+	}
+	if len(t.Ciphers) > 0 {
+		parts = append(parts, "ciphers "+strings.Join(t.Ciphers, ","))
+	}
+	return strings.Join(parts, ", ")
+}
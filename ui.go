@@ -2,58 +2,130 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"sort"
 	"strings"
 	"time"
 )
 
 // PrintBanner displays the load tester header with the current configuration.
 // When dynamic templates are in use, it lists the detected placeholders.
-func PrintBanner(config *Config) {
-	fmt.Println("══════════════════════════════════════════")
-	fmt.Println(" Go Load Tester")
-	fmt.Println("══════════════════════════════════════════")
-	fmt.Printf("Target:      %s\n", config.URL)
-	fmt.Printf("Requests:    %d\n", config.NumRequests)
-	fmt.Printf("Concurrency: %d\n", config.Concurrency)
-	fmt.Printf("Method:      %s\n", config.Method)
+func PrintBanner(w io.Writer, config *Config) {
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	fmt.Fprintln(w, " Go Load Tester")
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	if config.Endpoints != nil {
+		fmt.Fprintf(w, "Endpoints:   %s\n", config.Endpoints)
+	} else {
+		fmt.Fprintf(w, "Target:      %s\n", config.URL)
+	}
+	if config.Label != "" {
+		fmt.Fprintf(w, "Label:       %s\n", config.Label)
+	}
+	if config.Profile != nil {
+		fmt.Fprintf(w, "Requests:    ~%d over %s\n", config.NumRequests, config.Profile.duration())
+		fmt.Fprintf(w, "Profile:     %s\n", config.Profile)
+	} else if config.Pattern != nil {
+		fmt.Fprintf(w, "Requests:    ~%d over %s\n", config.NumRequests, formatDuration(config.Pattern.Duration))
+		fmt.Fprintf(w, "Pattern:     %s\n", config.Pattern.Spec)
+	} else {
+		fmt.Fprintf(w, "Requests:    %d\n", config.NumRequests)
+	}
+	fmt.Fprintf(w, "Concurrency: %d\n", config.Concurrency)
+	if config.Rate > 0 {
+		fmt.Fprintf(w, "Rate:        %g req/s\n", config.Rate)
+	}
+	if config.Batch != nil {
+		fmt.Fprintf(w, "Batch:       %s\n", config.Batch)
+	}
+	if config.Data != nil {
+		fmt.Fprintf(w, "Data:        %s\n", config.Data.describe())
+	}
+	if config.Seed != 0 {
+		fmt.Fprintf(w, "Seed:        %d\n", config.Seed)
+	}
+	if config.BrowserMode {
+		fmt.Fprintf(w, "Browser:     enabled (max %d connections per host)\n", config.BrowserConns)
+	}
+	if config.ClientProfiles != nil {
+		fmt.Fprintf(w, "Clients:     %s\n", config.ClientProfiles)
+	}
+	if config.MaxConnRate > 0 {
+		fmt.Fprintf(w, "Conn Rate:   max %g new connections/s\n", config.MaxConnRate)
+	}
+	if desc := connPoolDescription(config); desc != "" {
+		fmt.Fprintf(w, "Conn Pool:   %s\n", desc)
+	}
+	if config.TLS != nil {
+		fmt.Fprintf(w, "TLS:         %s\n", config.TLS)
+	}
+	if proxy := proxyFor(config.Proxy, config.URL); proxy != "" {
+		fmt.Fprintf(w, "Proxy:       %s\n", proxy)
+	}
+	if config.Retry.Max > 0 {
+		fmt.Fprintf(w, "Retries:     %d (backoff %s)\n", config.Retry.Max, config.Retry.Backoff)
+	}
+	if config.IdempotencyHeader != "" {
+		fmt.Fprintf(w, "Idempotency: %s\n", config.IdempotencyHeader)
+	}
+	if config.MethodMix != nil {
+		fmt.Fprintf(w, "Method Mix:  %s\n", config.MethodMix)
+	} else if config.Endpoints == nil {
+		fmt.Fprintf(w, "Method:      %s\n", config.Method)
+	}
 
 	// Show dynamic URL template info when placeholders are detected.
-	if config.URLTemplate != nil && config.URLTemplate.HasPlaceholders() {
-		fmt.Printf("Dynamic URL: enabled (%s)\n", strings.Join(config.URLTemplate.Placeholders(), ", "))
+	if config.Endpoints == nil && config.URLTemplate != nil && config.URLTemplate.HasPlaceholders() {
+		fmt.Fprintf(w, "Dynamic URL: enabled (%s)\n", strings.Join(config.URLTemplate.Placeholders(), ", "))
 	}
 
 	// Show dynamic body template info when placeholders are detected.
 	if config.BodyTemplate != nil && config.BodyTemplate.HasPlaceholders() {
-		fmt.Printf("Dynamic Body: enabled (%s)\n", strings.Join(config.BodyTemplate.Placeholders(), ", "))
+		fmt.Fprintf(w, "Dynamic Body: enabled (%s)\n", strings.Join(config.BodyTemplate.Placeholders(), ", "))
 	}
 
-	fmt.Println("══════════════════════════════════════════")
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+}
+
+// PrintCPUNotes reports container CPU limit tuning and warns on stderr when
+// the requested concurrency vastly exceeds the available CPU.
+func PrintCPUNotes(cpu CPUInfo, concurrency int) {
+	if cpu.Adjusted {
+		fmt.Fprintf(os.Stderr, "Note: container CPU limit of %.2f CPUs detected; GOMAXPROCS set to %d (host has %d)\n",
+			cpu.Limit, cpu.GOMAXPROCS, cpu.HostCPUs)
+	}
+	if warning := cpu.concurrencyWarning(concurrency); warning != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
 }
 
 // StartProgressMonitor runs in a goroutine and prints a live progress bar
-// every 200ms until the done channel is closed.
-func StartProgressMonitor(stats *Stats, done chan struct{}) {
-	ticker := time.NewTicker(200 * time.Millisecond)
+// to w every -progress-interval until the done channel is closed.
+func StartProgressMonitor(w io.Writer, stats *Stats, done chan struct{}) {
+	ticker := time.NewTicker(stats.progressInterval())
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			completed, total, elapsed := stats.Progress()
-			printProgressBar(completed, total, elapsed)
+			printProgressBar(w, stats.Live())
 		case <-done:
 			// Print a final 100% progress line before returning.
-			completed, total, elapsed := stats.Progress()
-			_ = completed
-			printProgressBar(total, total, elapsed)
-			fmt.Println() // Move to the next line after the progress bar.
+			st := stats.Live()
+			st.Completed = st.Total
+			printProgressBar(w, st)
+			fmt.Fprintln(w) // Move to the next line after the progress bar.
 			return
 		}
 	}
 }
 
-// printProgressBar renders a single progress line using carriage return.
-func printProgressBar(completed, total int, elapsed time.Duration) {
+// printProgressBar renders a single progress line using carriage return,
+// followed by the live figures of st. The figures are padded to a fixed
+// width so a shorter line fully overwrites a longer one.
+func printProgressBar(w io.Writer, st LiveStatus) {
+	completed, total := st.Completed, st.Total
 	var pct float64
 	if total > 0 {
 		pct = float64(completed) / float64(total) * 100
@@ -61,57 +133,458 @@ func printProgressBar(completed, total int, elapsed time.Duration) {
 
 	filled := 0
 	if total > 0 {
-		filled = int(float64(completed) / float64(total) * 50)
+		filled = int(float64(completed) / float64(total) * 30)
 	}
-	if filled > 50 {
-		filled = 50
+	if filled > 30 {
+		filled = 30
 	}
 
-	bar := strings.Repeat("#", filled) + strings.Repeat(" ", 50-filled)
-	fmt.Printf("\r  Progress: [%-50s] %d/%d (%.1f%%) | Elapsed: %s", bar, completed, total, pct, elapsed.Round(time.Millisecond))
+	bar := strings.Repeat("#", filled) + strings.Repeat(" ", 30-filled)
+	fmt.Fprintf(w, "\r  Progress: [%-30s] %d/%d (%.1f%%) | Elapsed: %-8s | %7.1f req/s | Errors: %-5d",
+		bar, completed, total, pct, formatDuration(st.Elapsed), st.Rate, st.Errors)
+	if st.Workers > 0 {
+		fmt.Fprintf(w, " | In-flight: %-9s", fmt.Sprintf("%d/%d", st.InFlight, st.Workers))
+	}
+	fmt.Fprintf(w, " | P95: %-8s", formatDuration(st.P95))
 }
 
 // PrintSummary displays the final results table after the load test completes.
-func PrintSummary(summary Summary) {
-	fmt.Println()
-	fmt.Println("══════════════════════════════════════════")
-	fmt.Println(" Results")
-	fmt.Println("══════════════════════════════════════════")
-	fmt.Printf("Total Requests:    %d\n", summary.TotalRequests)
-	fmt.Printf("Successful:        %d\n", summary.SuccessCount)
-	fmt.Printf("Failed:            %d\n", summary.FailCount)
-	fmt.Printf("Total Time:        %s\n", formatDuration(summary.TotalTime))
-	fmt.Printf("Requests/sec:      %.2f\n", summary.RequestsPerSec)
-
-	fmt.Println()
-	fmt.Println("Latency Distribution:")
-	fmt.Printf("  Average:   %s\n", formatDuration(summary.AvgDuration))
-	fmt.Printf("  Min:       %s\n", formatDuration(summary.MinDuration))
-	fmt.Printf("  Max:       %s\n", formatDuration(summary.MaxDuration))
-	fmt.Printf("  P50:       %s\n", formatDuration(summary.P50))
-	fmt.Printf("  P90:       %s\n", formatDuration(summary.P90))
-	fmt.Printf("  P95:       %s\n", formatDuration(summary.P95))
-	fmt.Printf("  P99:       %s\n", formatDuration(summary.P99))
-
-	fmt.Println()
-	fmt.Println("Status Code Distribution:")
+func PrintSummary(w io.Writer, summary Summary) {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	fmt.Fprintln(w, " Results")
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	fmt.Fprintf(w, "Total Requests:    %d\n", summary.TotalRequests)
+	fmt.Fprintf(w, "Successful:        %d\n", summary.SuccessCount)
+	fmt.Fprintf(w, "Failed:            %d\n", summary.FailCount)
+	if summary.Cancelled > 0 {
+		fmt.Fprintf(w, "Cancelled:         %d (injected by -cancel-rate)\n", summary.Cancelled)
+	}
+	fmt.Fprintf(w, "Total Time:        %s\n", formatDuration(summary.TotalTime))
+	fmt.Fprintf(w, "Requests/sec:      %s\n", formatRate(summary))
+	if summary.TargetRate > 0 && summary.RequestsPerSec < summary.TargetRate*rateShortfall {
+		fmt.Fprintln(w, "                   target rate not reached: all workers were busy; raise -c")
+	}
+	if summary.StopReason != "" {
+		fmt.Fprintf(w, "Stopped early:     %s\n", summary.StopReason)
+	}
+	if summary.Accounting != nil {
+		printAccounting(w, summary.Accounting)
+	}
+	if summary.Clock != nil {
+		fmt.Fprintf(w, "Clock Offset:      %s\n", formatClockOffset(summary.Clock))
+	}
+	if summary.Cleanup != nil {
+		printCleanup(w, summary.Cleanup)
+	}
+
+	fmt.Fprintln(w)
+	if summary.Percentile == PercentileLinear {
+		fmt.Fprintln(w, "Latency Distribution (interpolated percentiles):")
+	} else {
+		fmt.Fprintln(w, "Latency Distribution:")
+	}
+	fmt.Fprintf(w, "  Average:   %s\n", formatDuration(summary.AvgDuration))
+	fmt.Fprintf(w, "  Min:       %s\n", formatDuration(summary.MinDuration))
+	fmt.Fprintf(w, "  Max:       %s\n", formatDuration(summary.MaxDuration))
+	for _, p := range summaryPercentiles(summary) {
+		fmt.Fprintf(w, "  %-11s%s\n", fmt.Sprintf("P%g:", p.Percentile), withConfidence(summary, p.Percentile, formatDuration(p.Value)))
+	}
+
+	if len(summary.Phases) > 0 {
+		fmt.Fprintln(w)
+		printPhases(w, summary.Phases)
+	}
+
+	if summary.Attribution != nil {
+		fmt.Fprintln(w)
+		printAttribution(w, summary.Attribution)
+	}
+
+	if len(summary.Histogram) > 0 {
+		fmt.Fprintln(w)
+		printHistogram(w, summary.Histogram)
+	}
+
+	if summary.Windows != nil {
+		fmt.Fprintln(w)
+		printWindows(w, summary.Windows, summary.Clock)
+	}
+
+	if summary.TimeSeries != nil {
+		fmt.Fprintln(w)
+		printTimeSeries(w, summary.TimeSeries)
+	}
+
+	if summary.ClientPauses != nil {
+		fmt.Fprintln(w)
+		printClientPauses(w, summary.ClientPauses)
+	}
+
+	if summary.Stream != nil {
+		fmt.Fprintln(w)
+		printStreamSummary(w, summary.Stream)
+	}
+
+	if len(summary.ByMethod) > 1 {
+		fmt.Fprintln(w)
+		printGroupBreakdown(w, "Per-Method Breakdown:", summary.ByMethod)
+	}
+
+	if len(summary.ByLabel) > 0 {
+		fmt.Fprintln(w)
+		printGroupBreakdown(w, "Per-Label Breakdown:", summary.ByLabel)
+	}
+
+	if len(summary.ByTag) > 0 {
+		fmt.Fprintln(w)
+		printGroupBreakdown(w, "Per-Tag Breakdown:", summary.ByTag)
+	}
+
+	if len(summary.Values) > 0 {
+		fmt.Fprintln(w)
+		printValueDistributions(w, summary.Values)
+	}
+
+	if len(summary.Stages) > 0 {
+		fmt.Fprintln(w)
+		printStages(w, summary.Stages)
+	}
+
+	if summary.Repeats != nil {
+		fmt.Fprintln(w)
+		printRepeats(w, summary.Repeats)
+	}
+
+	if summary.Probe != nil {
+		fmt.Fprintln(w)
+		printConcurrencyProbe(w, summary.Probe)
+	}
+
+	if summary.Mirror != nil {
+		fmt.Fprintln(w)
+		printMirror(w, summary, summary.Mirror)
+	}
+
+	if len(summary.SLA) > 0 {
+		fmt.Fprintln(w)
+		printSLA(w, summary.SLA)
+	}
+
+	if len(summary.Dials) > 0 || len(summary.ConnReuse) > 0 {
+		fmt.Fprintln(w)
+		printConnections(w, summary)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Status Code Distribution:")
 	for code, count := range summary.StatusCodes {
-		fmt.Printf("  [%d] %d responses\n", code, count)
+		fmt.Fprintf(w, "  [%d] %d responses\n", code, count)
 	}
 
-	fmt.Println()
-	fmt.Printf("Total Data Received: %s\n", formatBytes(summary.TotalBytes))
+	if len(summary.Protocols) > 0 {
+		fmt.Fprintln(w)
+		printProtocols(w, summary.Protocols)
+	}
+
+	if len(summary.ContentTypes) > 0 {
+		fmt.Fprintln(w)
+		printContentTypes(w, summary.ContentTypes)
+	}
+
+	if summary.Throttled > 0 {
+		fmt.Fprintln(w)
+		printThrottling(w, summary)
+	}
+
+	if summary.RateLimit != nil {
+		fmt.Fprintln(w)
+		printRateLimits(w, summary.RateLimit)
+	}
+
+	if len(summary.Chaos) > 0 {
+		fmt.Fprintln(w)
+		printChaos(w, summary.Chaos)
+	}
+
+	if summary.Retries.Retried > 0 || summary.Retries.Keyed > 0 {
+		fmt.Fprintln(w)
+		printRetries(w, summary.Retries)
+	}
+
+	fmt.Fprintln(w)
+	printDataTransfer(w, summary)
+
+	if len(summary.Timeouts) > 0 {
+		fmt.Fprintln(w)
+		printTimeouts(w, summary.Timeouts)
+	}
+
+	if len(summary.ConnErrors) > 0 {
+		fmt.Fprintln(w)
+		printConnErrors(w, summary.ConnErrors)
+	}
+
+	if len(summary.AssertFailures) > 0 {
+		fmt.Fprintln(w)
+		printAssertFailures(w, summary.AssertFailures)
+	}
 
 	if len(summary.Errors) > 0 {
-		fmt.Println()
-		fmt.Println("Errors:")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Errors:")
 		for _, e := range summary.Errors {
-			fmt.Printf("  - %s\n", e)
+			fmt.Fprintf(w, "  - %s\n", e)
 		}
 		if summary.TotalErrors > len(summary.Errors) {
-			fmt.Printf("  ... and %d more errors\n", summary.TotalErrors-len(summary.Errors))
+			fmt.Fprintf(w, "  ... and %d more errors\n", summary.TotalErrors-len(summary.Errors))
 		}
 	}
+
+	if len(summary.Thresholds) > 0 {
+		fmt.Fprintln(w)
+		printThresholds(w, summary.Thresholds)
+	}
+
+	if len(summary.Budgets) > 0 {
+		fmt.Fprintln(w)
+		printBudgets(w, summary.Budgets)
+	}
+}
+
+// summaryPercentiles returns the percentiles of summary to report: the
+// -percentiles list, or P50 to P99 for summaries without one (such as a
+// -baseline file).
+func summaryPercentiles(summary Summary) []PercentileValue {
+	if summary.Percentiles != nil {
+		return summary.Percentiles
+	}
+	return []PercentileValue{{50, summary.P50}, {90, summary.P90}, {95, summary.P95}, {99, summary.P99}}
+}
+
+// printThresholds lists each -threshold with the actual value and whether
+// it passed.
+func printThresholds(w io.Writer, results []ThresholdResult) {
+	fmt.Fprintln(w, "Thresholds:")
+	for _, r := range results {
+		verdict := "PASS"
+		if !r.Passed {
+			verdict = "FAIL"
+		}
+		fmt.Fprintf(w, "  %s  %-20s actual %s\n", verdict, r.Expr, r.formatActual())
+	}
+	failed := 0
+	for _, r := range results {
+		if !r.Passed {
+			failed++
+		}
+	}
+	if failed == 0 {
+		fmt.Fprintf(w, "Result: PASS (%d of %d thresholds passed)\n", len(results), len(results))
+	} else {
+		fmt.Fprintf(w, "Result: FAIL (%d of %d thresholds failed)\n", failed, len(results))
+	}
+}
+
+// labelSuffix formats a step or test label for its heading, "" if unset.
+func labelSuffix(label string) string {
+	if label == "" {
+		return ""
+	}
+	return " (label: " + label + ")"
+}
+
+// printStages prints the results of each load profile stage, with the
+// achieved rate next to the stage's target.
+func printStages(w io.Writer, stages []StageSummary) {
+	fmt.Fprintln(w, "Per-Stage Breakdown:")
+	for i, s := range stages {
+		fmt.Fprintf(w, "  %d. %s (%s at %g req/s)\n", i+1, s.Name, s.Duration, s.Rate)
+		fmt.Fprintf(w, "     requests: %d, errors: %d (%.2f%%) | %.2f req/s (%.1f%% of target)\n",
+			s.Requests, s.Errors, s.ErrorRate, s.RequestsPerSec, s.RequestsPerSec/s.Rate*100)
+		if s.Requests > 0 {
+			fmt.Fprintf(w, "     Avg: %s | P50: %s | P90: %s | P95: %s | P99: %s\n",
+				formatDuration(s.AvgDuration), formatDuration(s.P50), formatDuration(s.P90), formatDuration(s.P95), formatDuration(s.P99))
+		}
+	}
+}
+
+// printSLA prints the share of requests in each SLA bucket, for the whole
+// run and per label.
+func printSLA(w io.Writer, reports []SLAReport) {
+	fmt.Fprintln(w, "SLA Buckets:")
+	for _, r := range reports {
+		name := r.Label
+		if name == "" {
+			name = "all"
+		}
+		fmt.Fprintf(w, "  %s (%d requests)\n", name, r.Total)
+		var prev time.Duration
+		for _, b := range r.Buckets {
+			fmt.Fprintf(w, "    %-10s %-18s %6.2f%% (%d)\n", b.Name, b.rangeFrom(prev), b.Percent, b.Count)
+			prev = b.Below
+		}
+	}
+}
+
+// printGroupBreakdown prints request count, error rate, and latency
+// percentiles for each group, sorted by group name.
+func printGroupBreakdown(w io.Writer, title string, groups map[string]GroupSummary) {
+	fmt.Fprintln(w, title)
+	for _, name := range groupNames(groups) {
+		g := groups[name]
+		fmt.Fprintf(w, "  %-8s requests: %d, errors: %d (%.2f%%)\n", name, g.Requests, g.Errors, g.ErrorRate)
+		fmt.Fprintf(w, "           Avg: %s | P50: %s | P90: %s | P95: %s | P99: %s\n",
+			formatDuration(g.AvgDuration), formatDuration(g.P50), formatDuration(g.P90), formatDuration(g.P95), formatDuration(g.P99))
+	}
+}
+
+// printDataTransfer reports bytes sent and received, splitting received
+// bytes into headers and body. It warns when some responses had no
+// Content-Length, since their body sizes could only be measured.
+func printDataTransfer(w io.Writer, summary Summary) {
+	received := summary.TotalBytes + summary.HeaderBytes
+	fmt.Fprintf(w, "Total Data Sent:     %s (%s/s)\n", formatBytes(summary.BytesSent), formatBytes(int64(summary.SentPerSec)))
+	fmt.Fprintf(w, "Total Data Received: %s (%s/s)\n", formatBytes(received), formatBytes(int64(summary.RecvPerSec)))
+	fmt.Fprintf(w, "  Headers:           %s\n", formatBytes(summary.HeaderBytes))
+	fmt.Fprintf(w, "  Body:              %s\n", formatBytes(summary.TotalBytes))
+	if summary.LengthUnknown > 0 {
+		fmt.Fprintf(w, "  Warning: %d responses had no Content-Length (chunked); body sizes are measured, not declared\n", summary.LengthUnknown)
+	}
+}
+
+// printStreamSummary prints time-to-first-chunk, inter-chunk gap, and
+// total stream duration distributions.
+func printStreamSummary(w io.Writer, stream *StreamSummary) {
+	fmt.Fprintln(w, "Streaming:")
+	fmt.Fprintf(w, "  Streams:   %d (%d chunks)\n", stream.Requests, stream.Chunks)
+	printLatencyDist(w, "First Chunk", stream.FirstChunk)
+	printLatencyDist(w, "Chunk Gap", stream.Gaps)
+	printLatencyDist(w, "Duration", stream.Total)
+}
+
+// printWindows prints where the worst latency window occurred and, with a
+// spike threshold, how many windows exceeded it. With a measured clock
+// offset, the worst window's start is also given in corrected time.
+func printWindows(w io.Writer, ws *WindowSummary, clock *ClockOffset) {
+	at := ws.WorstStart.Format("15:04:05.000")
+	if clock != nil {
+		at += fmt.Sprintf(" (%s corrected)", ws.WorstStart.Add(clock.Offset).Format("15:04:05.000"))
+	}
+	fmt.Fprintf(w, "Latency Windows (%s):\n", ws.Size)
+	fmt.Fprintf(w, "  Worst:     max %s at %s, %d requests (min %s)\n",
+		formatDuration(ws.WorstMax), at, ws.WorstCount, formatDuration(ws.WorstMin))
+	if ws.WorstPause >= significantClientPause {
+		fmt.Fprintf(w, "             coincides with a %s client-side pause\n", formatDuration(ws.WorstPause))
+	}
+	if ws.Threshold > 0 {
+		fmt.Fprintf(w, "  Spikes:    %d of %d windows had max > %s", ws.OverThreshold, ws.Windows, formatDuration(ws.Threshold))
+		if ws.PausedSpikes > 0 {
+			fmt.Fprintf(w, " (%d during a client-side pause)", ws.PausedSpikes)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// printClientPauses prints the GC pauses and scheduling stalls of the load
+// generator itself.
+func printClientPauses(w io.Writer, cp *ClientPauseSummary) {
+	fmt.Fprintln(w, "Client Pauses:")
+	if cp.GC.Count > 0 {
+		fmt.Fprintf(w, "  GC:        %d pauses | total %s | P99 %s | max %s\n",
+			cp.GC.Count, formatDuration(cp.GCTotal), formatDuration(cp.GC.P99), formatDuration(cp.GC.Max))
+	}
+	if cp.Stalls.Count > 0 {
+		fmt.Fprintf(w, "  Stalls:    %d scheduling stalls > %s | max %s\n",
+			cp.Stalls.Count, formatDuration(stallThreshold), formatDuration(cp.Stalls.Max))
+	}
+}
+
+// printLatencyDist prints a single-line summary of a duration distribution.
+func printLatencyDist(w io.Writer, label string, d LatencyDist) {
+	if d.Count == 0 {
+		fmt.Fprintf(w, "  %-13s n/a\n", label+":")
+		return
+	}
+	fmt.Fprintf(w, "  %-13s avg %s | P50 %s | P90 %s | P99 %s | max %s\n", label+":",
+		formatDuration(d.Avg), formatDuration(d.P50), formatDuration(d.P90), formatDuration(d.P99), formatDuration(d.Max))
+}
+
+// printConnections reports new connections by address family with their
+// dial times, any dual-stack fallbacks from IPv6 to IPv4, and how many
+// responses came over new and reused connections.
+func printConnections(w io.Writer, summary Summary) {
+	total := 0
+	for _, d := range summary.Dials {
+		total += d.Count
+	}
+
+	fmt.Fprintln(w, "Connections:")
+	for _, family := range []string{"IPv4", "IPv6", "unknown"} {
+		d, ok := summary.Dials[family]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "  %-8s %d (%.1f%%) | dial avg %s | P95 %s | max %s\n", family+":", d.Count,
+			float64(d.Count)/float64(total)*100, formatDuration(d.Avg), formatDuration(d.P95), formatDuration(d.Max))
+	}
+	if summary.DialFallbacks > 0 {
+		fmt.Fprintf(w, "  Warning: %d connections to dual-stack hosts fell back to IPv4 after %s; IPv6 may be broken\n",
+			summary.DialFallbacks, happyEyeballsDelay)
+	}
+	if summary.ConnWaits > 0 {
+		fmt.Fprintf(w, "  Rate limited: %d connections waited for -max-conn-rate, %s in total\n",
+			summary.ConnWaits, formatDuration(summary.ConnWaitTime))
+	}
+	printConnReuse(w, summary.ConnReuse)
+}
+
+// printChaos reports how the server responded to each kind of chaos or
+// header fuzzing request, warning about malformed requests it accepted.
+func printChaos(w io.Writer, chaos map[string]ChaosCounts) {
+	fmt.Fprintln(w, "Chaos Requests:")
+	kinds := append(append([]string(nil), chaosKinds...), headerFuzzKinds...)
+	for i, kind := range kinds {
+		c, ok := chaos[kind]
+		if !ok {
+			continue
+		}
+		var parts []string
+		if len(c.Status) > 0 {
+			parts = append(parts, c.statusList())
+		}
+		if c.NoResponse > 0 {
+			parts = append(parts, fmt.Sprintf("no response: %d", c.NoResponse))
+		}
+		fmt.Fprintf(w, "  %-16s %d sent -> %s\n", kind+":", c.Sent, strings.Join(parts, ", "))
+		if n := c.accepted(); n > 0 && i < len(chaosKinds) {
+			fmt.Fprintf(w, "  Warning: %d %s requests were accepted with a non-error status\n", n, kind)
+		}
+	}
+}
+
+// printRetries reports retried requests and, with idempotency keys, how
+// the server handled the retries.
+func printRetries(w io.Writer, r retryCounts) {
+	fmt.Fprintf(w, "Retried:           %d requests (%d retries)\n", r.Retried, r.Retries)
+	if r.Keyed == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Idempotency Keys:  %d requests\n", r.Keyed)
+	fmt.Fprintf(w, "  Replayed:        %d (server returned the stored response)\n", r.Replayed)
+	fmt.Fprintf(w, "  Conflicts:       %d (409 while the key was in use)\n", r.Conflicts)
+	if r.PossibleDuplicates > 0 {
+		fmt.Fprintf(w, "  Warning: %d retries succeeded as new requests after an attempt the server may have processed; check for duplicates\n", r.PossibleDuplicates)
+	}
+}
+
+// printThrottling reports throttled (429/503) responses and the time spent
+// honoring their Retry-After delays.
+func printThrottling(w io.Writer, summary Summary) {
+	fmt.Fprintf(w, "Throttled:         %d responses (429/503)\n", summary.Throttled)
+	if summary.ThrottledTime > 0 {
+		fmt.Fprintf(w, "Throttled Time:    %s (paused honoring Retry-After)\n", formatDuration(summary.ThrottledTime))
+	}
 }
 
 // formatBytes returns a human-readable byte size string.
@@ -134,60 +607,174 @@ func formatBytes(bytes int64) string {
 	}
 }
 
-// formatDuration returns a duration formatted as milliseconds if under 1s,
-// or as seconds with 2 decimal places otherwise.
+// rateShortfall is the fraction of the -rate target below which the
+// achieved rate is reported as not reached.
+const rateShortfall = 0.9
+
+// formatRate formats the achieved request rate, along with the -rate
+// target when one was set.
+func formatRate(s Summary) string {
+	if s.TargetRate <= 0 {
+		return fmt.Sprintf("%.2f", s.RequestsPerSec)
+	}
+	return fmt.Sprintf("%.2f (target %.2f, %.1f%%)", s.RequestsPerSec, s.TargetRate, s.RequestsPerSec/s.TargetRate*100)
+}
+
+// formatDuration returns a duration with 2 decimal places in the largest
+// unit below it, so sub-millisecond latencies of local or in-datacenter
+// targets keep their precision: nanoseconds under 1µs, microseconds under
+// 1ms, milliseconds under 1s and seconds otherwise.
 func formatDuration(d time.Duration) string {
-	if d < time.Second {
+	switch {
+	case d < time.Microsecond:
+		return fmt.Sprintf("%dns", d.Nanoseconds())
+	case d < time.Millisecond:
+		return fmt.Sprintf("%.2fµs", float64(d)/float64(time.Microsecond))
+	case d < time.Second:
 		return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
 	}
 	return fmt.Sprintf("%.2fs", d.Seconds())
 }
 
 // PrintScenarioBanner displays the scenario load test header.
-func PrintScenarioBanner(scenario *Scenario) {
-	fmt.Println("══════════════════════════════════════════")
-	fmt.Println(" Go Load Tester — Scenario Mode")
-	fmt.Println("══════════════════════════════════════════")
-	fmt.Printf("Scenario:    %s\n", scenario.Name)
-	fmt.Printf("Base URL:    %s\n", scenario.BaseURL)
-	fmt.Printf("Steps:       %d\n", len(scenario.Steps))
+func PrintScenarioBanner(w io.Writer, scenario *Scenario) {
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	fmt.Fprintln(w, " Go Load Tester — Scenario Mode")
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	fmt.Fprintf(w, "Scenario:    %s\n", scenario.Name)
+	fmt.Fprintf(w, "Base URL:    %s\n", scenario.BaseURL)
+	fmt.Fprintf(w, "Steps:       %d\n", len(scenario.Steps))
 	for i, step := range scenario.Steps {
-		fmt.Printf("  %d. %s [%s]\n", i+1, step.Name, step.Method)
+		if len(step.DependsOn) > 0 {
+			fmt.Fprintf(w, "  %d. %s [%s] after %s\n", i+1, step.Name, step.Method, strings.Join(step.DependsOn, ", "))
+			continue
+		}
+		fmt.Fprintf(w, "  %d. %s [%s]\n", i+1, step.Name, step.Method)
 	}
-	fmt.Printf("Concurrency: %d\n", scenario.Concurrency)
-	fmt.Printf("Iterations:  %d\n", scenario.Iterations)
-	fmt.Println("══════════════════════════════════════════")
+	fmt.Fprintf(w, "Concurrency: %d\n", scenario.Concurrency)
+	fmt.Fprintf(w, "Iterations:  %d\n", scenario.Iterations)
+	fmt.Fprintln(w, "══════════════════════════════════════════")
 }
 
 // PrintScenarioSummary displays the overall and per-step results.
-func PrintScenarioSummary(overall Summary, scenario *Scenario, stepStats map[string]*Stats) {
-	fmt.Println()
-	fmt.Println("══════════════════════════════════════════")
-	fmt.Println(" Overall Results")
-	fmt.Println("══════════════════════════════════════════")
-	fmt.Printf("Total Requests:    %d\n", overall.TotalRequests)
-	fmt.Printf("Successful:        %d\n", overall.SuccessCount)
-	fmt.Printf("Failed:            %d\n", overall.FailCount)
-	fmt.Printf("Total Time:        %s\n", formatDuration(overall.TotalTime))
-	fmt.Printf("Requests/sec:      %.2f\n", overall.RequestsPerSec)
-	fmt.Printf("Avg Latency:       %s\n", formatDuration(overall.AvgDuration))
-	fmt.Printf("P50:               %s\n", formatDuration(overall.P50))
-	fmt.Printf("P95:               %s\n", formatDuration(overall.P95))
-	fmt.Printf("P99:               %s\n", formatDuration(overall.P99))
+func PrintScenarioSummary(w io.Writer, overall Summary, scenario *Scenario, stepStats map[string]*Stats) {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	fmt.Fprintln(w, " Overall Results")
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	fmt.Fprintf(w, "Total Requests:    %d\n", overall.TotalRequests)
+	fmt.Fprintf(w, "Successful:        %d\n", overall.SuccessCount)
+	fmt.Fprintf(w, "Failed:            %d\n", overall.FailCount)
+	fmt.Fprintf(w, "Total Time:        %s\n", formatDuration(overall.TotalTime))
+	fmt.Fprintf(w, "Requests/sec:      %.2f\n", overall.RequestsPerSec)
+	if overall.StopReason != "" {
+		fmt.Fprintf(w, "Stopped early:     %s\n", overall.StopReason)
+	}
+	if overall.Accounting != nil {
+		printAccounting(w, overall.Accounting)
+	}
+	if overall.Clock != nil {
+		fmt.Fprintf(w, "Clock Offset:      %s\n", formatClockOffset(overall.Clock))
+	}
+	if overall.Cleanup != nil {
+		printCleanup(w, overall.Cleanup)
+	}
+	fmt.Fprintf(w, "Avg Latency:       %s\n", formatDuration(overall.AvgDuration))
+	fmt.Fprintf(w, "P50:               %s\n", withConfidence(overall, 50, formatDuration(overall.P50)))
+	fmt.Fprintf(w, "P95:               %s\n", withConfidence(overall, 95, formatDuration(overall.P95)))
+	fmt.Fprintf(w, "P99:               %s\n", withConfidence(overall, 99, formatDuration(overall.P99)))
+
+	if len(overall.Phases) > 0 {
+		fmt.Fprintln(w)
+		printPhases(w, overall.Phases)
+	}
+
+	if overall.Attribution != nil {
+		fmt.Fprintln(w)
+		printAttribution(w, overall.Attribution)
+	}
+
+	if len(overall.Histogram) > 0 {
+		fmt.Fprintln(w)
+		printHistogram(w, overall.Histogram)
+	}
+
+	if overall.TimeSeries != nil {
+		fmt.Fprintln(w)
+		printTimeSeries(w, overall.TimeSeries)
+	}
 
 	if len(overall.StatusCodes) > 0 {
-		fmt.Println()
-		fmt.Println("Status Code Distribution:")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Status Code Distribution:")
 		for code, count := range overall.StatusCodes {
-			fmt.Printf("  [%d] %d responses\n", code, count)
+			fmt.Fprintf(w, "  [%d] %d responses\n", code, count)
 		}
 	}
 
+	if len(overall.Protocols) > 0 {
+		fmt.Fprintln(w)
+		printProtocols(w, overall.Protocols)
+	}
+
+	if len(overall.ContentTypes) > 0 {
+		fmt.Fprintln(w)
+		printContentTypes(w, overall.ContentTypes)
+	}
+
+	fmt.Fprintln(w)
+	printDataTransfer(w, overall)
+
+	if len(overall.Timeouts) > 0 {
+		fmt.Fprintln(w)
+		printTimeouts(w, overall.Timeouts)
+	}
+
+	if len(overall.ConnErrors) > 0 {
+		fmt.Fprintln(w)
+		printConnErrors(w, overall.ConnErrors)
+	}
+
+	if len(overall.ByMethod) > 1 {
+		fmt.Fprintln(w)
+		printGroupBreakdown(w, "Per-Method Breakdown:", overall.ByMethod)
+	}
+
+	if len(overall.ByLabel) > 0 {
+		fmt.Fprintln(w)
+		printGroupBreakdown(w, "Per-Label Breakdown:", overall.ByLabel)
+	}
+
+	if len(overall.ByTag) > 0 {
+		fmt.Fprintln(w)
+		printGroupBreakdown(w, "Per-Tag Breakdown:", overall.ByTag)
+	}
+
+	if len(overall.Values) > 0 {
+		fmt.Fprintln(w)
+		printValueDistributions(w, overall.Values)
+	}
+
+	if len(overall.SLA) > 0 {
+		fmt.Fprintln(w)
+		printSLA(w, overall.SLA)
+	}
+
+	if len(overall.Dials) > 0 || len(overall.ConnReuse) > 0 {
+		fmt.Fprintln(w)
+		printConnections(w, overall)
+	}
+
+	if overall.Throttled > 0 {
+		fmt.Fprintln(w)
+		printThrottling(w, overall)
+	}
+
 	// Per-step breakdown — iterate scenario.Steps for consistent ordering.
-	fmt.Println()
-	fmt.Println("══════════════════════════════════════════")
-	fmt.Println(" Per-Step Breakdown")
-	fmt.Println("══════════════════════════════════════════")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	fmt.Fprintln(w, " Per-Step Breakdown")
+	fmt.Fprintln(w, "══════════════════════════════════════════")
 
 	for i, step := range scenario.Steps {
 		ss, ok := stepStats[step.Name]
@@ -195,42 +782,147 @@ func PrintScenarioSummary(overall Summary, scenario *Scenario, stepStats map[str
 			continue
 		}
 		stepSummary := ss.GetSummary()
-		fmt.Printf("\n  Step %d: %s [%s]\n", i+1, step.Name, step.Method)
-		fmt.Printf("    Requests:  %d (ok: %d, fail: %d)\n", stepSummary.TotalRequests, stepSummary.SuccessCount, stepSummary.FailCount)
-		fmt.Printf("    Avg:       %s\n", formatDuration(stepSummary.AvgDuration))
-		fmt.Printf("    P50:       %s | P95: %s | P99: %s\n", formatDuration(stepSummary.P50), formatDuration(stepSummary.P95), formatDuration(stepSummary.P99))
+		fmt.Fprintf(w, "\n  Step %d: %s [%s]%s\n", i+1, step.Name, step.Method, labelSuffix(step.Label))
+		fmt.Fprintf(w, "    Requests:  %d (ok: %d, fail: %d)\n", stepSummary.TotalRequests, stepSummary.SuccessCount, stepSummary.FailCount)
+		fmt.Fprintf(w, "    Avg:       %s\n", formatDuration(stepSummary.AvgDuration))
+		fmt.Fprintf(w, "    P50:       %s | P95: %s | P99: %s\n", formatDuration(stepSummary.P50), formatDuration(stepSummary.P95), formatDuration(stepSummary.P99))
 		if len(stepSummary.StatusCodes) > 0 {
-			fmt.Printf("    Status:    ")
+			fmt.Fprintf(w, "    Status:    ")
 			first := true
 			for code, count := range stepSummary.StatusCodes {
 				if !first {
-					fmt.Printf(", ")
+					fmt.Fprintf(w, ", ")
 				}
-				fmt.Printf("[%d]=%d", code, count)
+				fmt.Fprintf(w, "[%d]=%d", code, count)
 				first = false
 			}
-			fmt.Println()
+			fmt.Fprintln(w)
 		}
 		if len(stepSummary.Errors) > 0 {
-			fmt.Printf("    Errors:\n")
+			fmt.Fprintf(w, "    Errors:\n")
 			for _, e := range stepSummary.Errors {
-				fmt.Printf("      - %s\n", e)
+				fmt.Fprintf(w, "      - %s\n", e)
 			}
 			if stepSummary.TotalErrors > len(stepSummary.Errors) {
-				fmt.Printf("      ... and %d more\n", stepSummary.TotalErrors-len(stepSummary.Errors))
+				fmt.Fprintf(w, "      ... and %d more\n", stepSummary.TotalErrors-len(stepSummary.Errors))
 			}
 		}
 	}
 
 	// Overall errors at the bottom.
 	if len(overall.Errors) > 0 {
-		fmt.Println()
-		fmt.Println("Errors:")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Errors:")
 		for _, e := range overall.Errors {
-			fmt.Printf("  - %s\n", e)
+			fmt.Fprintf(w, "  - %s\n", e)
 		}
 		if overall.TotalErrors > len(overall.Errors) {
-			fmt.Printf("  ... and %d more errors\n", overall.TotalErrors-len(overall.Errors))
+			fmt.Fprintf(w, "  ... and %d more errors\n", overall.TotalErrors-len(overall.Errors))
+		}
+	}
+
+	if len(overall.Thresholds) > 0 {
+		fmt.Fprintln(w)
+		printThresholds(w, overall.Thresholds)
+	}
+
+	if len(overall.Budgets) > 0 {
+		fmt.Fprintln(w)
+		printBudgets(w, overall.Budgets)
+	}
+}
+
+// testTarget describes what a test of a multi-test run sends: its method
+// and URL, or its endpoint mix.
+func testTarget(config *Config) string {
+	if config.Endpoints != nil {
+		return "endpoints " + config.Endpoints.String()
+	}
+	return config.Method + " " + config.URL
+}
+
+// PrintTestsBanner displays the tests of a multi-test run.
+func PrintTestsBanner(w io.Writer, tests []*TestDefinition) {
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	fmt.Fprintln(w, " Go Load Tester")
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	fmt.Fprintf(w, "Tests:       %d (running concurrently)\n", len(tests))
+	for _, t := range tests {
+		fmt.Fprintf(w, "  %s: %s | %d requests, %d workers\n", t.Name, testTarget(t.Config), t.Config.NumRequests, t.Config.Concurrency)
+	}
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+}
+
+// PrintTestsSummary displays the combined results of a multi-test run
+// followed by a breakdown per test.
+func PrintTestsSummary(w io.Writer, combined Summary, tests []*TestDefinition) {
+	PrintSummary(w, combined)
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+	fmt.Fprintln(w, " Per-Test Breakdown")
+	fmt.Fprintln(w, "══════════════════════════════════════════")
+
+	for _, t := range tests {
+		s := t.Stats.GetSummary()
+		fmt.Fprintf(w, "\n  %s: %s%s\n", t.Name, testTarget(t.Config), labelSuffix(t.Config.Label))
+		fmt.Fprintf(w, "    Requests:  %d (ok: %d, fail: %d) | %s req/s\n", s.TotalRequests, s.SuccessCount, s.FailCount, formatRate(s))
+		fmt.Fprintf(w, "    Avg:       %s\n", formatDuration(s.AvgDuration))
+		fmt.Fprintf(w, "    P50:       %s | P95: %s | P99: %s\n", formatDuration(s.P50), formatDuration(s.P95), formatDuration(s.P99))
+		if len(s.StatusCodes) > 0 {
+			codes := make([]int, 0, len(s.StatusCodes))
+			for code := range s.StatusCodes {
+				codes = append(codes, code)
+			}
+			sort.Ints(codes)
+			parts := make([]string, len(codes))
+			for i, code := range codes {
+				parts[i] = fmt.Sprintf("[%d]=%d", code, s.StatusCodes[code])
+			}
+			fmt.Fprintf(w, "    Status:    %s\n", strings.Join(parts, ", "))
+		}
+		if s.StopReason != "" {
+			fmt.Fprintf(w, "    Stopped:   %s\n", s.StopReason)
+		}
+		if len(s.Errors) > 0 {
+			fmt.Fprintf(w, "    Errors:\n")
+			for _, e := range s.Errors {
+				fmt.Fprintf(w, "      - %s\n", e)
+			}
+			if s.TotalErrors > len(s.Errors) {
+				fmt.Fprintf(w, "      ... and %d more\n", s.TotalErrors-len(s.Errors))
+			}
 		}
 	}
 }
+
+// printSideBySide prints two summaries side by side, under the column
+// names leftName and rightName, with the change from left to right.
+func printSideBySide(w io.Writer, leftName, rightName string, left, right Summary) {
+	fmt.Fprintf(w, "  %-10s %12s %12s %10s\n", "Metric", leftName, rightName, "Change")
+	row := func(name, l, r string, from, to float64) {
+		change := "-"
+		if from != 0 {
+			change = fmt.Sprintf("%+.1f%%", (to-from)/from*100)
+		}
+		fmt.Fprintf(w, "  %-10s %12s %12s %10s\n", name, l, r, change)
+	}
+	count := func(name string, l, r int) {
+		row(name, fmt.Sprint(l), fmt.Sprint(r), float64(l), float64(r))
+	}
+	latency := func(name string, l, r time.Duration) {
+		row(name, formatDuration(l), formatDuration(r), float64(l), float64(r))
+	}
+
+	count("Requests", left.TotalRequests, right.TotalRequests)
+	count("Failed", left.FailCount, right.FailCount)
+	row("Req/sec", fmt.Sprintf("%.2f", left.RequestsPerSec), fmt.Sprintf("%.2f", right.RequestsPerSec), left.RequestsPerSec, right.RequestsPerSec)
+	latency("Avg", left.AvgDuration, right.AvgDuration)
+	latency("P50", left.P50, right.P50)
+	latency("P90", left.P90, right.P90)
+	latency("P95", left.P95, right.P95)
+	latency("P99", left.P99, right.P99)
+	latency("Max", left.MaxDuration, right.MaxDuration)
+	row("Received", formatBytes(left.TotalBytes+left.HeaderBytes), formatBytes(right.TotalBytes+right.HeaderBytes),
+		float64(left.TotalBytes+left.HeaderBytes), float64(right.TotalBytes+right.HeaderBytes))
+}
@@ -0,0 +1,295 @@
+// valuereport.go implements the generated value report (-value-report):
+// how often each value of a random placeholder was actually sent, so that
+// the data shape of a run can be checked against the one intended. Numeric
+// placeholders such as {{$randomInt(1,500)}} are reported in equal-width
+// buckets, picks such as {{$weightedChoice(a:70|b:30)}} by their most
+// frequent values.
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// maxTrackedValues is how many distinct values are counted per placeholder.
+// Further values are only counted together, which bounds memory for
+// placeholders such as {{$randomInt}} with wide ranges.
+const maxTrackedValues = 1000
+
+// valueReportTop is how many of the most frequent values are reported for
+// placeholders that are not bucketed.
+const valueReportTop = 10
+
+// valueReportBuckets is how many buckets numeric placeholders are reported
+// in, when they have more distinct values than valueReportTop.
+const valueReportBuckets = 10
+
+// distributedGenerators are the placeholders whose values are reported:
+// those drawing from a set or range, as opposed to ones unique per request
+// such as $uuid or fixed such as $env.
+var distributedGenerators = map[string]bool{
+	"$randomInt":      true,
+	"$randomFloat":    true,
+	"$randomBool":     true,
+	"$randomName":     true,
+	"$randomUA":       true,
+	"$cycle":          true,
+	"$randomChoice":   true,
+	"$weightedChoice": true,
+	"$csv":            true,
+	"$lines":          true,
+	tagPlaceholder:    true,
+}
+
+// valueCounts counts the values a placeholder rendered to.
+type valueCounts struct {
+	Counts map[string]int `json:"counts"`
+	Other  int            `json:"other,omitempty"` // Values beyond the first maxTrackedValues distinct ones
+}
+
+// add counts n renderings of value.
+func (c *valueCounts) add(value string, n int) {
+	if c.Counts == nil {
+		c.Counts = make(map[string]int)
+	}
+	if _, ok := c.Counts[value]; ok || len(c.Counts) < maxTrackedValues {
+		c.Counts[value] += n
+	} else {
+		c.Other += n
+	}
+}
+
+// copy returns a deep copy of c.
+func (c *valueCounts) copy() valueCounts {
+	return valueCounts{Counts: copyCounts(c.Counts), Other: c.Other}
+}
+
+// recordValues counts the values of distributed placeholders among values,
+// keyed by the placeholder as written.
+func recordValues(dists map[string]*valueCounts, values []generatedValue) {
+	for _, v := range values {
+		if !distributedGenerators[v.Placeholder] {
+			continue
+		}
+		c, ok := dists[v.Source]
+		if !ok {
+			c = &valueCounts{}
+			dists[v.Source] = c
+		}
+		c.add(v.Value, 1)
+	}
+}
+
+// snapshotValues returns deep copies of dists.
+func snapshotValues(dists map[string]*valueCounts) map[string]valueCounts {
+	if len(dists) == 0 {
+		return nil
+	}
+	snap := make(map[string]valueCounts, len(dists))
+	for source, c := range dists {
+		snap[source] = c.copy()
+	}
+	return snap
+}
+
+// mergeValues adds the counts of a snapshot to dists.
+func mergeValues(dists map[string]*valueCounts, snap map[string]valueCounts) {
+	for source, sc := range snap {
+		c, ok := dists[source]
+		if !ok {
+			c = &valueCounts{}
+			dists[source] = c
+		}
+		for value, n := range sc.Counts {
+			c.add(value, n)
+		}
+		c.Other += sc.Other
+	}
+}
+
+// deltaValues returns the counts dists gained since prev, and records the
+// current counts in prev.
+func deltaValues(dists map[string]*valueCounts, prev map[string]valueCounts) map[string]valueCounts {
+	var d map[string]valueCounts
+	for source, c := range dists {
+		p := prev[source]
+		var dc valueCounts
+		for value, n := range c.Counts {
+			if diff := n - p.Counts[value]; diff > 0 {
+				dc.add(value, diff)
+			}
+		}
+		dc.Other = c.Other - p.Other
+		if len(dc.Counts) == 0 && dc.Other == 0 {
+			continue
+		}
+		if d == nil {
+			d = make(map[string]valueCounts)
+		}
+		d[source] = dc
+		prev[source] = c.copy()
+	}
+	return d
+}
+
+// ValueDistribution is the reported distribution of a placeholder's
+// values.
+type ValueDistribution struct {
+	Total    int           `json:"total"`
+	Distinct int           `json:"distinct"`          // Distinct values counted, at most maxTrackedValues
+	Other    int           `json:"other,omitempty"`   // Renderings beyond the counted values
+	Buckets  []ValueBucket `json:"buckets,omitempty"` // Equal-width ranges of numeric values
+	Top      []ValueCount  `json:"top,omitempty"`     // Most frequent values of other placeholders
+}
+
+// ValueBucket counts the numeric values within [Low, High].
+type ValueBucket struct {
+	Low   float64 `json:"low"`
+	High  float64 `json:"high"`
+	Count int     `json:"count"`
+}
+
+// ValueCount is how often one value was rendered.
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// valueDistributions summarizes dists, nil if it is empty.
+func valueDistributions(dists map[string]*valueCounts) map[string]ValueDistribution {
+	if len(dists) == 0 {
+		return nil
+	}
+	out := make(map[string]ValueDistribution, len(dists))
+	for source, c := range dists {
+		out[source] = c.distribution()
+	}
+	return out
+}
+
+// distribution summarizes c: in buckets if its values are numbers with
+// more distinct ones than valueReportTop, by its most frequent values
+// otherwise.
+func (c *valueCounts) distribution() ValueDistribution {
+	d := ValueDistribution{Distinct: len(c.Counts), Other: c.Other, Total: c.Other}
+	numbers := make(map[string]float64, len(c.Counts))
+	integers := true
+	for value, n := range c.Counts {
+		d.Total += n
+		if numbers == nil {
+			continue
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			numbers = nil
+			continue
+		}
+		numbers[value] = f
+		integers = integers && f == math.Trunc(f)
+	}
+	if numbers != nil && len(numbers) > valueReportTop {
+		d.Buckets = c.buckets(numbers, integers)
+		return d
+	}
+
+	for value, n := range c.Counts {
+		d.Top = append(d.Top, ValueCount{Value: value, Count: n})
+	}
+	sort.Slice(d.Top, func(i, j int) bool {
+		if d.Top[i].Count != d.Top[j].Count {
+			return d.Top[i].Count > d.Top[j].Count
+		}
+		return d.Top[i].Value < d.Top[j].Value
+	})
+	if len(d.Top) > valueReportTop {
+		d.Top = d.Top[:valueReportTop]
+	}
+	return d
+}
+
+// buckets counts numbers, the numeric values of c, in valueReportBuckets
+// equal-width buckets spanning their range. Integer buckets have integer
+// bounds and do not overlap.
+func (c *valueCounts) buckets(numbers map[string]float64, integers bool) []ValueBucket {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, f := range numbers {
+		lo, hi = min(lo, f), max(hi, f)
+	}
+	width := (hi - lo) / valueReportBuckets
+	if integers {
+		width = math.Ceil((hi - lo + 1) / valueReportBuckets)
+	}
+	buckets := make([]ValueBucket, valueReportBuckets)
+	for i := range buckets {
+		buckets[i].Low = lo + float64(i)*width
+		buckets[i].High = buckets[i].Low + width
+		if integers {
+			buckets[i].High--
+		}
+	}
+	for value, f := range numbers {
+		i := valueReportBuckets - 1
+		if width > 0 {
+			i = min(int((f-lo)/width), valueReportBuckets-1)
+		}
+		buckets[i].Count += c.Counts[value]
+	}
+	// Integer ranges narrower than the bucket count leave buckets past the
+	// highest value.
+	for len(buckets) > 1 && buckets[len(buckets)-1].Low > hi {
+		buckets = buckets[:len(buckets)-1]
+	}
+	buckets[len(buckets)-1].High = hi
+	return buckets
+}
+
+// printValueDistributions prints the distribution of every reported
+// placeholder, sorted by placeholder.
+func printValueDistributions(w io.Writer, dists map[string]ValueDistribution) {
+	sources := make([]string, 0, len(dists))
+	for source := range dists {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	fmt.Fprintln(w, "Generated Values:")
+	for _, source := range sources {
+		d := dists[source]
+		fmt.Fprintf(w, "  {{%s}}: %d values, %d distinct", source, d.Total, d.Distinct)
+		if d.Other > 0 {
+			fmt.Fprintf(w, " (%d more renderings of further values not counted)", d.Other)
+		}
+		fmt.Fprintln(w)
+		for _, b := range d.Buckets {
+			label := formatValueBound(b.Low) + " - " + formatValueBound(b.High)
+			fmt.Fprintf(w, "    %-24s %8d %6.2f%%\n", label, b.Count, valueShare(b.Count, d.Total))
+		}
+		for _, v := range d.Top {
+			fmt.Fprintf(w, "    %-24s %8d %6.2f%%\n", shortValue(v.Value, 24), v.Count, valueShare(v.Count, d.Total))
+		}
+	}
+}
+
+// formatValueBound formats a bucket bound without needless decimals.
+func formatValueBound(f float64) string {
+	return strconv.FormatFloat(f, 'g', 6, 64)
+}
+
+// shortValue cuts s to at most n runes, marking the cut with an ellipsis.
+func shortValue(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// valueShare returns n as a percentage of total.
+func valueShare(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total) * 100
+}
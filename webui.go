@@ -0,0 +1,319 @@
+// webui.go implements the controller's optional web dashboard (-web). It
+// shows the health of every agent, the merged live metrics of the run, and
+// buttons to pause, resume or stop the run on all agents at once. Live
+// metrics require the controller to receive streamed results (-listen);
+// without it the dashboard shows the merged results once the run is over.
+// The buttons act on the whole fleet, so with a -token they ask for it and
+// present it as the agents do, and without one the dashboard only listens
+// on loopback.
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// agentHealth is the dashboard's view of one agent.
+type agentHealth struct {
+	Addr      string    `json:"addr"`
+	Healthy   bool      `json:"healthy"`
+	State     string    `json:"state,omitempty"`
+	Completed int       `json:"completed"`
+	Total     int       `json:"total"`
+	Error     string    `json:"error,omitempty"`
+	LastSeen  time.Time `json:"last_seen,omitempty"`
+}
+
+// dashboardStatus is the body of GET /api/status.
+type dashboardStatus struct {
+	State   string        `json:"state"` // "waiting", "running", "paused", "stopping" or "finished"
+	Target  string        `json:"target"`
+	Agents  []agentHealth `json:"agents"`
+	Summary *summaryJSON  `json:"summary"`
+}
+
+// dashboard holds the state rendered by the web UI.
+type dashboard struct {
+	c      *controller
+	config *Config
+
+	mu     sync.Mutex
+	state  string
+	agents []string
+	health map[string]agentHealth
+	stats  *Stats // Live or final results, nil until available
+}
+
+// newDashboard creates a dashboard for a run of config.
+func newDashboard(c *controller, config *Config) *dashboard {
+	return &dashboard{
+		c:      c,
+		config: config,
+		state:  "waiting",
+		health: make(map[string]agentHealth),
+	}
+}
+
+// serve starts the dashboard server on addr. It runs until ctx is done.
+func (d *dashboard) serve(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("starting web dashboard: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", d.handleIndex)
+	mux.HandleFunc("/api/status", d.handleStatus)
+	mux.HandleFunc("/api/pause", d.handleAction)
+	mux.HandleFunc("/api/resume", d.handleAction)
+	mux.HandleFunc("/api/stop", d.handleAction)
+	server := &http.Server{Handler: mux}
+
+	go server.Serve(ln)
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	go d.pollAgents(ctx)
+
+	fmt.Fprintf(os.Stderr, "controller: dashboard at http://%s/\n", ln.Addr())
+	return nil
+}
+
+// setAgents records the agents taking part in the run.
+func (d *dashboard) setAgents(agents []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.agents = agents
+}
+
+// setState records the run state shown in the dashboard.
+func (d *dashboard) setState(state string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.state = state
+}
+
+// setStats sets the Stats whose summary the dashboard shows.
+func (d *dashboard) setStats(stats *Stats) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stats = stats
+}
+
+// pollAgents refreshes the health of every agent until ctx is done.
+func (d *dashboard) pollAgents(ctx context.Context) {
+	ticker := time.NewTicker(agentPollInterval)
+	defer ticker.Stop()
+	for {
+		d.mu.Lock()
+		agents := d.agents
+		d.mu.Unlock()
+
+		for _, addr := range agents {
+			h := agentHealth{Addr: addr}
+			status, err := d.c.fetchStatus(ctx, addr)
+			if err != nil {
+				h.Error = err.Error()
+			} else {
+				h.Healthy = true
+				h.State = status.State
+				h.Completed = status.Completed
+				h.Total = status.Total
+				h.LastSeen = time.Now()
+			}
+
+			d.mu.Lock()
+			if !h.Healthy {
+				h.LastSeen = d.health[addr].LastSeen
+			}
+			d.health[addr] = h
+			d.mu.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleIndex serves the dashboard page.
+func (d *dashboard) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, dashboardHTML)
+}
+
+// handleStatus serves the current dashboardStatus as JSON.
+func (d *dashboard) handleStatus(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	status := dashboardStatus{
+		State:  d.state,
+		Target: d.config.URL,
+		Agents: make([]agentHealth, 0, len(d.agents)),
+	}
+	for _, addr := range d.agents {
+		h, ok := d.health[addr]
+		if !ok {
+			h = agentHealth{Addr: addr}
+		}
+		status.Agents = append(status.Agents, h)
+	}
+	stats := d.stats
+	d.mu.Unlock()
+
+	if stats != nil {
+		summary := newSummaryJSON(stats.GetSummary())
+		status.Summary = &summary
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, status)
+}
+
+// handleAction relays pause, resume and stop to every agent.
+func (d *dashboard) handleAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkToken(r, d.c.token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	action := strings.TrimPrefix(r.URL.Path, "/api/")
+
+	d.mu.Lock()
+	agents, state := d.agents, d.state
+	d.mu.Unlock()
+	if state != "running" && state != "paused" {
+		http.Error(w, "no run in progress", http.StatusConflict)
+		return
+	}
+
+	if err := d.c.broadcast(r.Context(), agents, "/"+action); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "controller: %s requested from dashboard\n", action)
+
+	switch action {
+	case "pause":
+		d.setState("paused")
+	case "resume":
+		d.setState("running")
+	case "stop":
+		d.setState("stopping")
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// dashboardHTML is the single-page dashboard. It polls /api/status once
+// per second.
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Go Load Tester</title>
+<style>
+  body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+  h1 { font-size: 1.4em; margin-bottom: 0.2em; }
+  .muted { color: #777; }
+  table { border-collapse: collapse; margin: 1em 0; }
+  th, td { text-align: left; padding: 0.3em 1em 0.3em 0; border-bottom: 1px solid #eee; }
+  .ok { color: #2a7d2a; } .bad { color: #b22; }
+  .metrics { display: flex; gap: 2em; flex-wrap: wrap; margin: 1em 0; }
+  .metric b { display: block; font-size: 1.6em; }
+  button { font-size: 1em; margin-right: 0.5em; padding: 0.3em 1em; }
+</style>
+</head>
+<body>
+<h1>Go Load Tester</h1>
+<div class="muted"><span id="target"></span> &middot; <span id="state"></span></div>
+<p>
+  <button onclick="act('pause')">Pause</button>
+  <button onclick="act('resume')">Resume</button>
+  <button onclick="act('stop')">Stop</button>
+</p>
+<div class="metrics">
+  <div class="metric">Requests<b id="requests">-</b></div>
+  <div class="metric">Requests/sec<b id="rps">-</b></div>
+  <div class="metric">Errors<b id="errors">-</b></div>
+  <div class="metric">P50<b id="p50">-</b></div>
+  <div class="metric">P95<b id="p95">-</b></div>
+  <div class="metric">P99<b id="p99">-</b></div>
+</div>
+<h2>Status codes</h2>
+<div id="codes" class="muted">-</div>
+<h2>Agents</h2>
+<table>
+  <thead><tr><th>Agent</th><th>Health</th><th>State</th><th>Progress</th></tr></thead>
+  <tbody id="agents"></tbody>
+</table>
+<script>
+function esc(v) {
+  return String(v).replace(/[&<>"]/g, function (c) { return {'&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;'}[c]; });
+}
+function ms(v) {
+  if (v < 0.001) { return Math.round(v * 1e6) + ' ns'; }
+  if (v < 1) { return (v * 1000).toFixed(2) + ' µs'; }
+  if (v < 1000) { return v.toFixed(2) + ' ms'; }
+  return (v / 1000).toFixed(2) + ' s';
+}
+function text(id, v) { document.getElementById(id).textContent = v; }
+var token = sessionStorage.getItem('token') || '';
+function act(action) {
+  fetch('/api/' + action, {method: 'POST', headers: {'Authorization': 'Bearer ' + token}}).then(function (r) {
+    if (r.status === 401) {
+      var t = prompt('Controller token:');
+      if (t) {
+        token = t;
+        sessionStorage.setItem('token', t);
+        act(action);
+      }
+      return;
+    }
+    if (!r.ok) { r.text().then(function (t) { alert(t); }); }
+    refresh();
+  });
+}
+function refresh() {
+  fetch('/api/status').then(function (r) { return r.json(); }).then(function (s) {
+    text('target', s.target);
+    text('state', s.state);
+    var rows = '';
+    s.agents.forEach(function (a) {
+      var health = a.healthy ? '<span class="ok">healthy</span>' : '<span class="bad">' + esc(a.error || 'unknown') + '</span>';
+      rows += '<tr><td>' + esc(a.addr) + '</td><td>' + health + '</td><td>' + esc(a.state || '-') +
+        '</td><td>' + a.completed + ' / ' + a.total + '</td></tr>';
+    });
+    document.getElementById('agents').innerHTML = rows;
+    var m = s.summary;
+    if (!m) { return; }
+    text('requests', m.total_requests);
+    text('rps', m.requests_per_sec.toFixed(1));
+    text('errors', m.total_errors);
+    text('p50', ms(m.latency_ms.p50));
+    text('p95', ms(m.latency_ms.p95));
+    text('p99', ms(m.latency_ms.p99));
+    var codes = Object.keys(m.status_codes).sort().map(function (c) { return c + ': ' + m.status_codes[c]; });
+    text('codes', codes.length ? codes.join('  ') : '-');
+  });
+}
+refresh();
+setInterval(refresh, 1000);
+</script>
+</body>
+</html>
+`
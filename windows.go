@@ -0,0 +1,130 @@
+// windows.go implements windowed latency tracking. Requests are grouped by
+// the wall-clock window (1s by default) in which they complete, and each
+// window keeps its latency extremes, so the summary can tell one isolated
+// spike from hundreds of slow windows and point at when the worst one
+// happened. Windows are aligned to absolute time, so windows recorded by
+// different distributed agents line up when merged.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// defaultSpikeWindow is the default width of a latency window.
+const defaultSpikeWindow = time.Second
+
+// latencyWindow holds the latency extremes of the requests completing
+// within one window.
+type latencyWindow struct {
+	Count int           `json:"count"`
+	Min   time.Duration `json:"min"`
+	Max   time.Duration `json:"max"`
+	Pause time.Duration `json:"pause,omitempty"` // Longest client pause (GC or stall) overlapping the window
+}
+
+// add records one request duration in the window.
+func (w *latencyWindow) add(d time.Duration) {
+	if w.Count == 0 || d < w.Min {
+		w.Min = d
+	}
+	if d > w.Max {
+		w.Max = d
+	}
+	w.Count++
+}
+
+// merge folds another window covering the same time into w.
+func (w *latencyWindow) merge(o latencyWindow) {
+	if o.Pause > w.Pause {
+		w.Pause = o.Pause
+	}
+	if o.Count == 0 {
+		return
+	}
+	if w.Count == 0 || o.Min < w.Min {
+		w.Min = o.Min
+	}
+	if o.Max > w.Max {
+		w.Max = o.Max
+	}
+	w.Count += o.Count
+}
+
+// WindowSummary reports how latency extremes were spread over time.
+type WindowSummary struct {
+	Size          time.Duration // Width of each window
+	Windows       int           // Windows in which at least one request completed
+	Threshold     time.Duration // Spike threshold, 0 if not set
+	OverThreshold int           // Windows whose max latency exceeded Threshold
+	WorstStart    time.Time     // Start of the window with the highest max latency
+	WorstMax      time.Duration // Max latency of the worst window
+	WorstMin      time.Duration // Min latency of the worst window
+	WorstCount    int           // Requests completed in the worst window
+	WorstPause    time.Duration // Longest client pause overlapping the worst window
+	PausedSpikes  int           // Windows over Threshold that overlap a significant client pause
+}
+
+// summarizeWindows computes a WindowSummary from windows keyed by their
+// start time in Unix nanoseconds. It returns nil if there are no windows.
+func summarizeWindows(windows map[int64]*latencyWindow, size, threshold time.Duration) *WindowSummary {
+	if len(windows) == 0 {
+		return nil
+	}
+
+	// Iterate in time order so ties resolve to the earliest window.
+	starts := make([]int64, 0, len(windows))
+	for start := range windows {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	ws := &WindowSummary{Size: size, Threshold: threshold}
+	for _, start := range starts {
+		w := windows[start]
+		if w.Count == 0 {
+			continue // Only a client pause was recorded in this window
+		}
+		if threshold > 0 && w.Max > threshold {
+			ws.OverThreshold++
+			if w.Pause >= significantClientPause {
+				ws.PausedSpikes++
+			}
+		}
+		if ws.WorstCount == 0 || w.Max > ws.WorstMax {
+			ws.WorstStart = time.Unix(0, start)
+			ws.WorstMax = w.Max
+			ws.WorstMin = w.Min
+			ws.WorstCount = w.Count
+			ws.WorstPause = w.Pause
+		}
+		ws.Windows++
+	}
+	if ws.Windows == 0 {
+		return nil
+	}
+	return ws
+}
+
+// parseSpikeFlags validates the -spike-window and -spike-threshold values.
+func parseSpikeFlags(window, threshold string) (time.Duration, time.Duration, error) {
+	size, err := time.ParseDuration(window)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid -spike-window value %q: %w", window, err)
+	}
+	if size <= 0 {
+		return 0, 0, fmt.Errorf("-spike-window must be > 0, got %s", size)
+	}
+	var limit time.Duration
+	if threshold != "" {
+		limit, err = time.ParseDuration(threshold)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid -spike-threshold value %q: %w", threshold, err)
+		}
+		if limit < 0 {
+			return 0, 0, fmt.Errorf("-spike-threshold must be >= 0, got %s", limit)
+		}
+	}
+	return size, limit, nil
+}
@@ -0,0 +1,70 @@
+// wiresize.go computes how many bytes requests occupy on the wire so the
+// tool can report outbound traffic alongside the response bytes it reads.
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// countingWriter is an io.Writer that discards its input and counts bytes.
+type countingWriter struct {
+	n int64
+}
+
+// Write counts p and never returns an error.
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// acceptEncodingGzip is the header line http.Transport adds to requests that
+// don't set Accept-Encoding themselves (transparent gzip support).
+const acceptEncodingGzip = "Accept-Encoding: gzip\r\n"
+
+// requestWireSize returns the size of req serialized as an HTTP/1.1 request:
+// request line, headers (including the ones the Transport adds) and body.
+// body must be the rendered request body, since req.Body can only be read
+// once. For HTTP/2 connections the real size is smaller due to header
+// compression, so the value is an upper bound there.
+func requestWireSize(req *http.Request, body string) int64 {
+	clone := req.Clone(req.Context())
+	clone.Body, clone.ContentLength = nil, 0
+	if body != "" {
+		clone.Body = io.NopCloser(strings.NewReader(body))
+		clone.ContentLength = int64(len(body))
+	}
+
+	var cw countingWriter
+	if err := clone.Write(&cw); err != nil {
+		return 0
+	}
+	if body == "" && req.ContentLength > 0 {
+		// A streamed body, such as a form upload, counts by its length.
+		cw.n += int64(len("Content-Length: \r\n")+len(strconv.FormatInt(req.ContentLength, 10))) + req.ContentLength
+	}
+
+	if req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" && req.Method != http.MethodHead {
+		cw.n += int64(len(acceptEncodingGzip))
+	}
+	return cw.n
+}
+
+// responseHeaderSize returns the size of resp's status line and header block
+// as sent by the server. The Transfer-Encoding header is reconstructed since
+// net/http moves it out of resp.Header.
+func responseHeaderSize(resp *http.Response) int64 {
+	var cw countingWriter
+	// Status line, e.g. "HTTP/1.1 200 OK\r\n"; resp.Status already holds "200 OK".
+	cw.n += int64(len(resp.Proto) + 1 + len(resp.Status) + 2)
+	if err := resp.Header.Write(&cw); err != nil {
+		return 0
+	}
+	if len(resp.TransferEncoding) > 0 {
+		cw.n += int64(len("Transfer-Encoding: ") + len(strings.Join(resp.TransferEncoding, ", ")) + 2)
+	}
+	// Blank line terminating the header block.
+	return cw.n + 2
+}
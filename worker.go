@@ -6,125 +6,458 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"sync"
 	"time"
 )
 
 // RequestResult holds the outcome of a single HTTP request.
 type RequestResult struct {
+	Method        string
 	StatusCode    int
 	Duration      time.Duration
 	Error         error
-	ContentLength int64
+	ContentLength int64               // Response body bytes received (measured, not declared)
+	HeaderBytes   int64               // Response status line and header bytes received
+	LengthUnknown bool                // Response declared no Content-Length (e.g. chunked)
+	RequestBytes  int64               // Request bytes sent: request line, headers and body
+	BodyMatched   bool                // Response body contained the -stop-when-body-contains substring
+	RetryAfter    time.Duration       // Retry-After delay of a 429/503 response, 0 if none
+	RateLimit     *rateLimitSample    // Rate-limit headers of the response, nil if it carried none
+	Stream        *StreamTiming       // Chunk timings, set only in -stream mode
+	Cancelled     bool                // Aborted mid-flight by -cancel-rate injection
+	Chaos         string              // Kind of -chaos or -header-fuzz request, "" for regular requests
+	Timeout       string              // Phase in which the request timed out (timeoutConnect, ...), "" if it did not
+	ConnError     string              // Kind of connection error the request failed with (connErrorReset, ...), "" if none
+	Label         string              // Logical endpoint the request belongs to, "" if unlabeled
+	Tags          []string            // Tags set by {{$label(...)}} placeholders, as "NAME=value"
+	Values        []generatedValue    // Generated values of the request, kept only with -value-report
+	Stage         string              // Load profile stage the request was sent in, "" without -profile
+	Attempts      int                 // Attempts made, more than 1 if the request was retried
+	Redirects     int                 // Redirects followed over all attempts
+	Exchanges     []time.Duration     // Latency of each attempt and redirect hop, set only if there were several
+	Logical       time.Duration       // First attempt to final response headers, backoff included; set with Exchanges
+	Replayed      bool                // Response was marked as a replay for a known idempotency key
+	Skipped       bool                // Recorded without being sent: a scenario step skipped after a failure
+	Idempotency   *idempotencyOutcome // Server handling of the idempotency key, nil without -idempotency-header
+	Sent          *sentRequest        // The request as sent, kept only with -failure-manifest or -record-requests
+	Assertion     string              // First -assert-* check the response failed, "" if it passed them all
+	StatusFailed  bool                // Response status is one of the -fail-on-* statuses
+	Phases        phaseTimings        // Time spent in each phase of the request, nil if not traced
+	Proto         string              // Protocol of the response, e.g. "HTTP/2.0"
+	ContentType   string              // Content-Type key of the response (see contentTypeOf), "" without a response
+	Conn          string              // Kind of connection the response came over (connNew, connReused), "" without a response
+	Body          []byte              // First maxResponseBody bytes of the response body, kept only if assertions or -mirror-diff read it
+}
+
+// failed reports whether the request failed: with an error, with a
+// failing status, or with a response that failed an assertion.
+func (r RequestResult) failed() bool {
+	return r.Error != nil || r.StatusFailed || r.Assertion != ""
 }
 
 // Worker performs HTTP requests using a shared client for connection reuse.
 type Worker struct {
-	client *http.Client
-	config *Config
+	client  *http.Client
+	config  *Config
+	profile *ClientProfile // Client profile of this virtual user, nil without -client-profiles
+	tagged  bool           // Templates tag requests, so generated values are always collected
+	rng     *requestRand   // Random source of the requests the worker sends
 }
 
 // SendRequest executes a single HTTP request and returns the result.
 // The requestIndex is used by the template engine to generate per-request
 // dynamic values (e.g. {{$sequence}} uses the index directly).
 func (w *Worker) SendRequest(ctx context.Context, requestIndex int) RequestResult {
+	rng := w.rng.at(requestIndex)
+	if kind, ok := w.config.Chaos.pick(rng); ok {
+		return w.sendChaos(ctx, kind, requestIndex, rng)
+	}
+
+	parent := ctx
+	ctx, cancel, injected := w.config.Cancel.apply(ctx, rng)
+	defer cancel()
+
+	// With a failure manifest or recorded requests, the generated values
+	// are kept so a request can be traced back to them. Tags are among
+	// them.
+	keepSent := w.config.FailureManifest != nil || w.config.RecordRequests
+	var generated *[]generatedValue
+	if keepSent || w.tagged || w.config.ValueReport {
+		generated = new([]generatedValue)
+	}
+
+	// Pick the URL, method and body templates, honoring the endpoint or
+	// method mix if set.
+	urlTmpl, method, rawBody, bodyTmpl := w.config.URLTemplate, w.config.Method, w.config.Body, w.config.BodyTemplate
+	var endpoint *Endpoint
+	if w.config.Endpoints != nil {
+		endpoint = w.config.Endpoints.Pick(rng)
+		urlTmpl, method, rawBody, bodyTmpl = endpoint.urlTemplate, endpoint.Method, endpoint.Body, endpoint.bodyTemplate
+	} else if w.config.MethodMix != nil {
+		entry := w.config.MethodMix.Pick(rng)
+		method, rawBody, bodyTmpl = entry.Method, entry.Body, entry.BodyTemplate
+	}
+
 	// Render the URL template. When no placeholders exist this returns
 	// the original static URL without allocation.
-	targetURL := w.config.URLTemplate.Render(requestIndex)
+	targetURL := urlTmpl.RenderRecording(requestIndex, rng, nil, generated)
 
 	// Build the request body from the body template.
 	var body io.Reader
-	if (w.config.Method == http.MethodPost || w.config.Method == http.MethodPut) && w.config.Body != "" {
-		renderedBody := w.config.BodyTemplate.Render(requestIndex)
+	var renderedBody string
+	if rawBody != "" && methodSendsBody(method) {
+		renderedBody = w.config.Batch.render(bodyTmpl, requestIndex, rng, generated)
 		body = bytes.NewBufferString(renderedBody)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, w.config.Method, targetURL, body)
+	req, err := http.NewRequestWithContext(ctx, method, targetURL, body)
 	if err != nil {
 		return RequestResult{
-			Error: err,
+			Method: method,
+			Error:  err,
+		}
+	}
+
+	// Endpoint headers come last, so they override -header.
+	headers := w.config.HeaderTemplates
+	if endpoint != nil {
+		headers = append(slices.Clip(headers), endpoint.headers...)
+	}
+	for _, h := range headers {
+		req.Header.Set(h.name.RenderRecording(requestIndex, rng, nil, generated), h.value.RenderRecording(requestIndex, rng, nil, generated))
+	}
+	if w.config.Batch != nil && body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", w.config.Batch.contentType())
+	}
+
+	// A form body sets its own Content-Type, overriding -header.
+	var form []formPart
+	if w.config.Form != nil {
+		form = w.config.Form.render(requestIndex, rng, generated)
+		if err := attachForm(req, form); err != nil {
+			return RequestResult{
+				Method: method,
+				Error:  fmt.Errorf("building form: %w", err),
+			}
 		}
 	}
+	req = w.profile.apply(req)
+	if w.config.BrowserMode {
+		applyBrowserHeaders(req)
+	}
+	fuzzKind, fuzzed := w.config.HeaderFuzz.pick(rng)
+	if fuzzed {
+		w.config.HeaderFuzz.apply(req, fuzzKind, rng)
+	}
+	// Idempotency keys stay random with -seed: a rerun would otherwise
+	// present the keys of the previous one and only get replays.
+	if w.config.IdempotencyHeader != "" {
+		req.Header.Set(w.config.IdempotencyHeader, genUUID(requestIndex, nil))
+	}
+	var pair *mirrorPair
+	if w.config.Mirror != nil {
+		label := w.config.Label
+		if endpoint != nil {
+			label = endpoint.Label
+		}
+		pair = w.config.Mirror.send(parent, req, renderedBody, label, rng)
+	}
 
-	for key, value := range w.config.Headers {
-		req.Header.Set(key, value)
+	result := w.doWithRetries(req, renderedBody)
+	result.Method = method
+	if endpoint != nil {
+		result.Label = endpoint.Label
+	}
+	if keepSent {
+		result.Sent = newSentRequest(requestIndex, req, renderedBody, *generated)
+		result.Sent.Form = form
+	}
+	if w.tagged {
+		result.Tags = tagsOf(*generated)
+	}
+	if w.config.ValueReport {
+		result.Values = *generated
+	}
+	if fuzzed {
+		result.Chaos = fuzzKind
 	}
+	result.Cancelled = wasInjectedCancel(parent, injected, result.Error)
+	pair.record(true, result)
+	return result
+}
 
+// do sends a prepared request, drains the response body, and measures the
+// round trip.
+func (w *Worker) do(req *http.Request) RequestResult {
+	var trace phaseTrace
 	start := time.Now()
-	resp, err := w.client.Do(req)
+	resp, err := w.client.Do(trace.attach(req))
 	duration := time.Since(start)
 
 	if err != nil {
+		phase, err := trace.timeout(err, false)
 		return RequestResult{
-			Duration: duration,
-			Error:    err,
+			Duration:  duration,
+			Error:     err,
+			Timeout:   phase,
+			ConnError: trace.connError(err),
+			Phases:    trace.clock.timings(start, time.Time{}),
 		}
 	}
 	defer resp.Body.Close()
 
-	contentLength, err := io.Copy(io.Discard, resp.Body)
+	// Drain the body, scanning it for the stop substring when one is set.
+	var sink io.Writer = io.Discard
+	var matcher *substringWriter
+	if w.config.Stop.BodyContains != "" {
+		matcher = newSubstringWriter(w.config.Stop.BodyContains)
+		sink = matcher
+	}
+	var capture *bodyCapture
+	if w.config.Assertions.needsBody() || w.config.Mirror.needsBody() {
+		capture = &bodyCapture{}
+		sink = io.MultiWriter(sink, capture)
+	}
+
+	var contentLength int64
+	var stream *StreamTiming
+	if w.config.Stream {
+		contentLength, stream, err = copyStream(sink, resp.Body, start)
+	} else {
+		contentLength, err = io.Copy(sink, resp.Body)
+	}
 	if err != nil {
+		phase, err := trace.timeout(err, true)
+		if phase == "" {
+			err = fmt.Errorf("reading response body: %w", err)
+		}
 		return RequestResult{
-			Duration: duration,
-			Error:    fmt.Errorf("reading response body: %w", err),
+			Duration:  duration,
+			Error:     err,
+			Timeout:   phase,
+			ConnError: trace.connError(err),
+			Phases:    trace.clock.timings(start, time.Time{}),
 		}
 	}
+	phases := trace.clock.timings(start, time.Now())
 
+	var captured []byte
+	if capture != nil {
+		captured = capture.buf
+	}
 	return RequestResult{
 		StatusCode:    resp.StatusCode,
 		Duration:      duration,
 		ContentLength: contentLength,
+		HeaderBytes:   responseHeaderSize(resp),
+		LengthUnknown: resp.ContentLength < 0,
+		BodyMatched:   matcher != nil && matcher.found,
+		RetryAfter:    retryAfterFromResponse(resp),
+		RateLimit:     rateLimitFromResponse(resp),
+		Replayed:      isReplayResponse(resp),
+		Stream:        stream,
+		Assertion:     w.config.Assertions.check(resp.StatusCode, captured),
+		StatusFailed:  w.config.FailOn.contains(resp.StatusCode),
+		Phases:        phases,
+		Proto:         resp.Proto,
+		ContentType:   contentTypeOf(resp.Header.Get("Content-Type"), contentLength),
+		Conn:          trace.connKind(),
+		Body:          captured,
 	}
 }
 
-// RunLoadTest orchestrates the load test using a fixed worker pool pattern.
-// It dispatches NumRequests jobs across Concurrency goroutines, each reusing
-// a shared Transport for connection pooling, and records every result into stats.
-// The context can be used to cancel the test early (e.g. on SIGINT).
-func RunLoadTest(ctx context.Context, config *Config, stats *Stats) error {
+// newTransport builds the shared Transport for a run with the given number of
+// concurrent workers. The idle pool is sized so every worker can keep its
+// connection alive between requests.
+// New connections are instrumented so their address family and dial time
+// are recorded on stats.
+func newTransport(config *Config, concurrency int, stats *Stats) *http.Transport {
 	transport := &http.Transport{
-		MaxIdleConns:        config.Concurrency + 10,
-		MaxIdleConnsPerHost: config.Concurrency + 10,
+		DialContext:         newInstrumentedDialer(stats, config.MaxConnRate).DialContext,
+		MaxIdleConns:        concurrency + 10,
+		MaxIdleConnsPerHost: concurrency + 10,
 		IdleConnTimeout:     30 * time.Second,
-		DisableKeepAlives:   false,
+		DisableKeepAlives:   config.DisableKeepAlive,
+		Protocols:           httpProtocols(config.HTTPVersion),
+		TLSClientConfig:     config.TLS.clientConfig(),
+		Proxy:               proxyFunc(config.Proxy),
 	}
+	if config.BrowserMode {
+		transport.MaxConnsPerHost = config.BrowserConns
+	}
+	if config.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = config.MaxConnsPerHost
+	}
+	if config.ClientProfiles.ordered() {
+		orderHeaders(transport)
+	}
+	return transport
+}
+
+// job is one request handed to a worker.
+type job struct {
+	index int    // Request index, for templates such as {{$requestIndex}}
+	stage string // Load profile stage the request belongs to, "" without -profile
+}
+
+// RunLoadTest orchestrates the load test using a fixed worker pool pattern.
+// It dispatches NumRequests jobs, or with config.Profile or config.Pattern
+// set the jobs of that load pattern, across Concurrency goroutines, each reusing a shared
+// Transport for connection pooling, and records every result into stats.
+// The context can be used to cancel the test early (e.g. on SIGINT); the
+// test also ends early when one of config.Stop's conditions is met. With
+// config.RecordFile set, every result is also written to that file, with
+// config.FailureManifest set every failed request to the manifest, with
+// config.StatsD set sent to StatsD, and with config.Mirror set a share of
+// the requests is copied to the mirror target.
+func RunLoadTest(ctx context.Context, config *Config, stats *Stats) (err error) {
+	var recorder *Recorder
+	if config.RecordFile != "" {
+		if recorder, err = NewRecorder(config.RecordFile, config.RecordRequests); err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := recorder.Close(); err == nil {
+				err = cerr
+			}
+		}()
+	}
+
+	if err := config.StatsD.start(); err != nil {
+		return err
+	}
+	defer config.StatsD.close()
+
+	if err := config.FailureManifest.start(); err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := config.FailureManifest.close(); err == nil {
+			err = cerr
+		}
+	}()
 
+	ctx, monitor := newStopMonitor(ctx, config.Stop)
+	defer monitor.Close()
+
+	// Copies still in flight when the last request ends are waited for
+	// before the stop monitor cancels ctx.
+	config.Mirror.start(config)
+	defer config.Mirror.close()
+
+	// Watch for pauses of this process so they aren't blamed on the server.
+	stopPauses := startPauseMonitor(stats)
+	defer stopPauses()
+
+	// Pooled connections are closed when the run ends rather than when
+	// they time out, so repeated runs in one process don't pile them up.
+	transport := newTransport(config, config.Concurrency, stats)
+	defer transport.CloseIdleConnections()
 	client := &http.Client{
-		Timeout:   config.Timeout,
-		Transport: transport,
+		Timeout:       config.Timeout,
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
 	}
 
-	jobs := make(chan int, config.Concurrency*2)
+	// A load pattern or profile schedules the jobs instead of -n and -rate.
+	var pattern LoadPattern
+	switch {
+	case config.Profile != nil:
+		pattern = config.Profile.pattern()
+	case config.Pattern != nil:
+		if pattern, err = config.Pattern.start(); err != nil {
+			return err
+		}
+	}
+
+	// A paced run hands each job to a worker when it is due; queued jobs
+	// would start late whenever all workers are busy.
+	jobs := make(chan job, config.Concurrency*2)
+	if config.Rate > 0 || pattern != nil {
+		jobs = make(chan job)
+	}
 
 	var wg sync.WaitGroup
+	stats.setWorkers(config.Concurrency)
+	tagged := config.tagged()
 
 	// Launch a fixed pool of worker goroutines.
 	for i := 0; i < config.Concurrency; i++ {
 		wg.Add(1)
-		go func() {
+		go func(id int) {
 			defer wg.Done()
-			worker := &Worker{client: client, config: config}
-			for requestIndex := range jobs {
-				result := worker.SendRequest(ctx, requestIndex)
+			worker := &Worker{client: client, config: config, profile: config.ClientProfiles.forUser(id), tagged: tagged, rng: newRequestRand(config.Seed)}
+			for j := range jobs {
+				// Skip queued jobs once the test has been cancelled so they
+				// aren't recorded as spurious "context canceled" failures.
+				if ctx.Err() != nil {
+					stats.RequestDropped()
+					continue
+				}
+				stats.RequestStarted()
+				result := worker.SendRequest(ctx, j.index)
+				stats.RequestDone()
+				if result.Label == "" {
+					result.Label = config.Label
+				}
+				result.Stage = j.stage
 				stats.Record(result)
+				if recorder != nil {
+					recorder.Record(result, time.Now(), id, j.index)
+				}
+				config.FailureManifest.Add(result, time.Now(), id)
+				config.StatsD.Record(result)
+				monitor.Observe(result)
+				if config.HonorRetryAfter {
+					honorRetryAfter(ctx, result, config.RetryAfterMax, stats)
+				}
 			}
-		}()
+		}(i)
 	}
 
-	// Dispatch all request indices into the jobs channel.
-	for i := 0; i < config.NumRequests; i++ {
+	send := func(j job) bool {
 		select {
-		case jobs <- i:
+		case jobs <- j:
+			return true
 		case <-ctx.Done():
-			close(jobs)
-			wg.Wait()
-			return ctx.Err()
+			return false
+		}
+	}
+
+	// Dispatch the jobs: NumRequests of them, or those of the load pattern
+	// or profile.
+	completed := true
+	if pattern != nil {
+		completed = dispatchPattern(ctx, pattern, config.Pause, send)
+	} else {
+		pace := newPacer(config.Rate)
+		for i := 0; i < config.NumRequests && completed; i++ {
+			if config.Pause != nil {
+				config.Pause.Wait(ctx)
+			}
+			pace.wait(ctx)
+			completed = send(job{index: i})
 		}
 	}
 	close(jobs)
 
+	if !completed {
+		wg.Wait()
+		// A triggered stop condition is an expected outcome, not an error.
+		if reason := monitor.Reason(); reason != "" {
+			stats.MarkStopped(reason)
+			return nil
+		}
+		return ctx.Err()
+	}
+
 	// Wait for every worker goroutine to finish.
 	wg.Wait()
 
+	if reason := monitor.Reason(); reason != "" {
+		stats.MarkStopped(reason)
+	}
+
 	return nil
 }